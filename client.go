@@ -73,7 +73,9 @@ var (
 	cliServerStart               bool
 	cliConsoleServerIndex        int
 	cliShowObjects               string
+	cliFailoverID                string
 	cliConfirm                   string
+	cliDryRun                    bool
 )
 
 type RequetParam struct {
@@ -184,6 +186,8 @@ func init() {
 	initCliCommonFlags(serverCmd)
 	rootCmd.AddCommand(showCmd)
 	initCliCommonFlags(showCmd)
+	rootCmd.AddCommand(failoversCmd)
+	initCliCommonFlags(failoversCmd)
 
 	serverCmd.Flags().StringVar(&cliServerID, "id", "", "server id")
 	serverCmd.Flags().BoolVar(&cliServerMaintenance, "maintenance", false, "Toggle maintenance")
@@ -193,6 +197,9 @@ func init() {
 	apiCmd.Flags().StringVar(&cliUrl, "url", "https://127.0.0.1:10005/api/clusters", "Url to rest API")
 
 	switchoverCmd.Flags().StringVar(&cliPrefMaster, "db-servers-prefered-master", "", "Database preferred candidate in election,  host:[port] format")
+	switchoverCmd.Flags().BoolVar(&cliDryRun, "dry-run", false, "Print the switchover plan without executing it")
+
+	failoversCmd.Flags().StringVar(&cliFailoverID, "id", "", "Print only the failover with this id")
 
 	testCmd.Flags().StringVar(&cliTTestRun, "run-tests", "", "tests list to be run ")
 	testCmd.Flags().StringVar(&cliTestResultDBServer, "result-db-server", "", "MariaDB MySQL host to store result")
@@ -371,6 +378,18 @@ and demoting the old master to slave`,
 
 		cliInit(true)
 		cliGetTopology()
+		if cliDryRun {
+			urlpost := "https://" + cliHost + ":" + cliPort + "/api/clusters/" + cliClusters[cliClusterIndex] + "/actions/switchover/plan"
+			if cliPrefMaster != "" {
+				urlpost += "?prefmaster=" + url.QueryEscape(cliPrefMaster)
+			}
+			res, err := cliAPICmd(urlpost, nil)
+			if err != nil {
+				log.Fatal("Error in API call ", err)
+			}
+			fmt.Fprintf(os.Stdout, "%s\n", res)
+			return
+		}
 		if cliPrefMaster != "" {
 			prefMasterParam.key = "prefmaster"
 			prefMasterParam.value = cliPrefMaster
@@ -391,6 +410,24 @@ and demoting the old master to slave`,
 	},
 }
 
+var failoversCmd = &cobra.Command{
+	Use:   "failovers",
+	Short: "Print the failover journal",
+	Long:  `Print the timeline of past switchovers and failovers of a cluster`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cliInit(true)
+		urlpost := "https://" + cliHost + ":" + cliPort + "/api/clusters/" + cliClusters[cliClusterIndex] + "/failovers"
+		if cliFailoverID != "" {
+			urlpost += "/" + url.PathEscape(cliFailoverID)
+		}
+		res, err := cliAPICmd(urlpost, nil)
+		if err != nil {
+			log.Fatal("Error in API call ", err)
+		}
+		fmt.Fprintf(os.Stdout, "%s\n", res)
+	},
+}
+
 var apiCmd = &cobra.Command{
 	Use:   "api",
 	Short: "Call JWT API",
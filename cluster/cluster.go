@@ -22,9 +22,12 @@ import (
 	"github.com/BurntSushi/toml"
 	"github.com/signal18/replication-manager/cluster/nbc"
 	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/router/envoy"
 	"github.com/signal18/replication-manager/router/maxscale"
+	"github.com/signal18/replication-manager/utils/alert"
 	"github.com/signal18/replication-manager/utils/cron"
 	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/ldap"
 	"github.com/signal18/replication-manager/utils/s18log"
 	"github.com/signal18/replication-manager/utils/state"
 	log "github.com/sirupsen/logrus"
@@ -44,6 +47,9 @@ type Cluster struct {
 	ProxyIdList                   []string                    `json:"proxyServers"`
 	FailoverCtr                   int                         `json:"failoverCounter"`
 	FailoverTs                    int64                       `json:"failoverLastTime"`
+	FailoverJournal               failoverJournal             `json:"-"`
+	AlertSilences                 []alert.Silence             `json:"-"`
+	BackupCatalog                 backupCatalog               `json:"-"`
 	Status                        string                      `json:"activePassiveStatus"`
 	IsSplitBrain                  bool                        `json:"isSplitBrain"`
 	IsSplitBrainBck               bool                        `json:"-"`
@@ -99,11 +105,18 @@ type Cluster struct {
 	oldMaster                     *ServerMonitor              `json:"-"`
 	vmaster                       *ServerMonitor              `json:"-"`
 	mxs                           *maxscale.MaxScale          `json:"-"`
+	mxsRestClients                map[string]mxsRestClient    `json:"-"`
+	mxsRestClientsMutex           sync.Mutex                  `json:"-"`
 	dbUser                        string                      `json:"-"`
 	dbPass                        string                      `json:"-"`
 	rplUser                       string                      `json:"-"`
 	rplPass                       string                      `json:"-"`
 	sme                           *state.StateMachine         `json:"-"`
+	alertDispatcher               *alert.Dispatcher           `json:"-"`
+	alertSilencesMutex            sync.Mutex                  `json:"-"`
+	queryRulesMutex               sync.Mutex                  `json:"-"`
+	backupCatalogMutex            sync.RWMutex                `json:"-"`
+	failoverJournalMutex          sync.Mutex                  `json:"-"`
 	runOnceAfterTopology          bool                        `json:"-"`
 	logPtr                        *os.File                    `json:"-"`
 	termlength                    int                         `json:"-"`
@@ -139,6 +152,13 @@ type Cluster struct {
 	Backups                       []Backup                    `json:"-"`
 	SLAHistory                    []state.Sla                 `json:"slaHistory"`
 	APIUsers                      map[string]APIUser          `json:"apiUsers"`
+	ldapAuth                      *ldap.Authenticator         `json:"-"`
+	apiTokens                     map[string]*APIToken        `json:"-"`
+	apiTokensMutex                sync.Mutex                  `json:"-"`
+	apiTokensDirty                bool                        `json:"-"`
+	electionScores                []ElectionScore             `json:"-"`
+	electionScoresMutex           sync.Mutex                  `json:"-"`
+	xdsServer                     *envoy.Server               `json:"-"`
 	Schedule                      map[string]cron.Entry       `json:"-"`
 	scheduler                     *cron.Cron                  `json:"-"`
 	idSchedulerPhysicalBackup     cron.EntryID                `json:"-"`
@@ -150,6 +170,7 @@ type Cluster struct {
 	idSchedulerRollingRestart     cron.EntryID                `json:"-"`
 	idSchedulerDbsjobsSsh         cron.EntryID                `json:"-"`
 	idSchedulerRollingReprov      cron.EntryID                `json:"-"`
+	idSchedulerBackupVerify       cron.EntryID                `json:"-"`
 	WaitingRejoin                 int                         `json:"waitingRejoin"`
 	WaitingSwitchover             int                         `json:"waitingSwitchover"`
 	WaitingFailover               int                         `json:"waitingFailover"`
@@ -193,19 +214,21 @@ type Tag struct {
 }
 
 type JobResult struct {
-	Xtrabackup            bool `json:"xtrabackup"`
-	Mariabackup           bool `json:"mariabackup"`
-	Zfssnapback           bool `json:"zfssnapback"`
-	Optimize              bool `json:"optimize"`
-	Reseedxtrabackup      bool `json:"reseedxtrabackup"`
-	Reseedmariabackup     bool `json:"reseedmariabackup"`
-	Reseedmysqldump       bool `json:"reseedmysqldump"`
-	Flashbackxtrabackup   bool `json:"flashbackxtrabackup"`
-	Flashbackmariadbackup bool `json:"flashbackmariadbackup"`
-	Flashbackmysqldump    bool `json:"flashbackmysqldump"`
-	Stop                  bool `json:"stop"`
-	Start                 bool `json:"start"`
-	Restart               bool `json:"restart"`
+	Xtrabackup            bool        `json:"xtrabackup"`
+	Mariabackup           bool        `json:"mariabackup"`
+	Zfssnapback           bool        `json:"zfssnapback"`
+	Optimize              bool        `json:"optimize"`
+	Reseedxtrabackup      bool        `json:"reseedxtrabackup"`
+	Reseedmariabackup     bool        `json:"reseedmariabackup"`
+	Reseedmysqldump       bool        `json:"reseedmysqldump"`
+	Flashbackxtrabackup   bool        `json:"flashbackxtrabackup"`
+	Flashbackmariadbackup bool        `json:"flashbackmariadbackup"`
+	Flashbackmysqldump    bool        `json:"flashbackmysqldump"`
+	Stop                  bool        `json:"stop"`
+	Start                 bool        `json:"start"`
+	Restart               bool        `json:"restart"`
+	Pitr                  *PitrJob    `json:"pitr,omitempty"`
+	Delayed               *DelayedJob `json:"delayed,omitempty"`
 }
 
 const (
@@ -273,6 +296,7 @@ func (cluster *Cluster) Init(conf config.Config, cfgGroup string, tlog *s18log.T
 	cluster.sme.Init()
 
 	cluster.Conf = conf
+	cluster.initAlertDispatcher()
 	if cluster.Conf.Interactive {
 		cluster.LogPrintf(LvlInfo, "Failover in interactive mode")
 	} else {
@@ -374,6 +398,7 @@ func (cluster *Cluster) initScheduler() {
 		cluster.SetSchedulerSlaRotate()
 		cluster.SetSchedulerRollingRestart()
 		cluster.SetSchedulerDbJobsSsh()
+		cluster.SetSchedulerBackupVerify()
 		cluster.scheduler.Start()
 	}
 
@@ -509,9 +534,9 @@ func (cluster *Cluster) StateProcessing() {
 				cluster.LogPrintf(LvlInfo, "Sending master logical backup to reseed %s", s.ServerUrl)
 				if master != nil {
 					if mybcksrv != nil {
-						go cluster.SSTRunSender(mybcksrv.GetMyBackupDirectory()+"mysqldump.sql.gz", servertoreseed)
+						go cluster.SSTRunSender(getBackupDumpFile(mybcksrv.GetMyBackupDirectory()), servertoreseed)
 					} else {
-						go cluster.SSTRunSender(master.GetMasterBackupDirectory()+"mysqldump.sql.gz", servertoreseed)
+						go cluster.SSTRunSender(getBackupDumpFile(master.GetMasterBackupDirectory()), servertoreseed)
 					}
 				} else {
 					cluster.LogPrintf(LvlErr, "No master cancel backup reseeding %s", s.ServerUrl)
@@ -529,9 +554,9 @@ func (cluster *Cluster) StateProcessing() {
 
 				cluster.LogPrintf(LvlInfo, "Sending logical backup to flashback reseed %s", s.ServerUrl)
 				if mybcksrv != nil {
-					go cluster.SSTRunSender(mybcksrv.GetMyBackupDirectory()+"mysqldump.sql.gz", servertoreseed)
+					go cluster.SSTRunSender(getBackupDumpFile(mybcksrv.GetMyBackupDirectory()), servertoreseed)
 				} else {
-					go cluster.SSTRunSender(servertoreseed.GetMyBackupDirectory()+"mysqldump.sql.gz", servertoreseed)
+					go cluster.SSTRunSender(getBackupDumpFile(servertoreseed.GetMyBackupDirectory()), servertoreseed)
 				}
 			}
 			//		cluster.statecloseChan <- s
@@ -540,6 +565,7 @@ func (cluster *Cluster) StateProcessing() {
 		for i := range states {
 			cluster.LogPrintf("STATE", states[i])
 		}
+		cluster.sendStateAlerts()
 		// trigger action on resolving states
 		ostates := cluster.sme.GetOpenStates()
 		for _, s := range ostates {
@@ -582,11 +608,12 @@ func (cluster *Cluster) Save() error {
 		return err
 	}
 
-	saveQeueryRules, _ := json.MarshalIndent(cluster.QueryRules, "", "\t")
-	err = ioutil.WriteFile(cluster.Conf.WorkingDir+"/"+cluster.Name+"/queryrules.json", saveQeueryRules, 0644)
+	err = cluster.saveQueryRules()
 	if err != nil {
 		return err
 	}
+	// flush the last use of the API tokens, a failure is logged and does not skip the config rewrite
+	cluster.SaveAPITokens()
 	if cluster.Conf.ConfRewrite {
 		var myconf = make(map[string]config.Config)
 
@@ -625,6 +652,7 @@ func (cluster *Cluster) InitAgent(conf config.Config) {
 
 func (cluster *Cluster) ReloadConfig(conf config.Config) {
 	cluster.Conf = conf
+	cluster.initAlertDispatcher()
 	cluster.sme.SetFailoverState()
 	cluster.newServerList()
 	cluster.newProxyList()
@@ -883,6 +911,8 @@ func (cluster *Cluster) MonitorQueryRules() {
 	if !cluster.Conf.MonitorQueryRules {
 		return
 	}
+	cluster.queryRulesMutex.Lock()
+	defer cluster.queryRulesMutex.Unlock()
 	for _, prx := range cluster.Proxies {
 		if cluster.Conf.ProxysqlOn && prx.Type == config.ConstProxySqlproxy {
 			qr := prx.QueryRules
@@ -7,10 +7,15 @@
 package cluster
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
 	"strings"
+	"time"
 
 	"github.com/signal18/replication-manager/config"
 	"github.com/signal18/replication-manager/utils/crypto"
+	"github.com/signal18/replication-manager/utils/ldap"
 	"github.com/signal18/replication-manager/utils/misc"
 )
 
@@ -21,16 +26,99 @@ type APIUser struct {
 }
 
 func (cluster *Cluster) IsValidACL(strUser string, strPassword string, URL string) bool {
+	grants, ok := cluster.GetUserGrants(strUser, strPassword)
+	if !ok {
+		return false
+	}
+	return cluster.IsURLPassGrantsACL(strUser, grants, URL)
+}
+
+// GetUserGrants authenticates a user of api-credentials, or of the LDAP directory, and returns its grants
+func (cluster *Cluster) GetUserGrants(strUser string, strPassword string) (map[string]bool, bool) {
 	if user, ok := cluster.APIUsers[strUser]; ok {
 		if user.Password == strPassword {
-
-			return cluster.IsURLPassACL(strUser, URL)
+			return user.Grants, true
+		}
+		return nil, false
+	}
+	if cluster.ldapAuth != nil {
+		groups, err := cluster.ldapAuth.Authenticate(strUser, strPassword)
+		if err != nil {
+			cluster.LogPrintf(LvlInfo, "LDAP authentication failed for user %s: %s", strUser, err)
+			return nil, false
 		}
+		return cluster.getGroupsGrants(cluster.Conf.APILdapGroupsACL, groups), true
+	}
+	return nil, false
+}
+
+// IsLdapUser returns true for the users authenticated by the LDAP directory, the ones missing from api-credentials
+func (cluster *Cluster) IsLdapUser(strUser string) bool {
+	_, ok := cluster.APIUsers[strUser]
+	return !ok && cluster.ldapAuth != nil
+}
+
+// GetLdapGrants returns the grants of a user logged in with its directory password, the user is looked up
+// again with the bind account so a user removed from the directory or from a group loses its grants
+func (cluster *Cluster) GetLdapGrants(strUser string) (map[string]bool, bool) {
+	if !cluster.IsLdapUser(strUser) {
+		return nil, false
+	}
+	groups, err := cluster.ldapAuth.Lookup(strUser)
+	if err != nil {
+		cluster.LogPrintf(LvlInfo, "LDAP lookup failed for user %s: %s", strUser, err)
+		return nil, false
+	}
+	return cluster.getGroupsGrants(cluster.Conf.APILdapGroupsACL, groups), true
+}
+
+// IsValidLdapACL checks an URL for a user logged in with its directory password
+func (cluster *Cluster) IsValidLdapACL(strUser string, URL string) bool {
+	grants, ok := cluster.GetLdapGrants(strUser)
+	if !ok {
 		return false
 	}
-	//	for key, value := range cluster.Grants {
+	return cluster.IsURLPassGrantsACL(strUser, grants, URL)
+}
 
-	return false
+// IsValidGroupsACL checks an URL for a user authenticated by the OpenID provider with the grants of its groups
+func (cluster *Cluster) IsValidGroupsACL(strUser string, groups []string, URL string) bool {
+	return cluster.IsURLPassGrantsACL(strUser, cluster.GetGroupsGrants(groups), URL)
+}
+
+// GetGroupsGrants returns the grants mapped to a list of groups by api-oidc-groups-acl
+func (cluster *Cluster) GetGroupsGrants(groups []string) map[string]bool {
+	return cluster.getGroupsGrants(cluster.Conf.APIOIDCGroupsACL, groups)
+}
+
+// getGroupsGrants returns the grants of a list of groups, a group acl is a list of grant prefixes like the acls
+// of api-credentials-acl-allow, the group names are case insensitive
+func (cluster *Cluster) getGroupsGrants(groupsACL string, groups []string) map[string]bool {
+	grants := make(map[string]bool)
+	for _, groupACL := range strings.Split(groupsACL, ",") {
+		group, listacls := misc.SplitPair(groupACL)
+		found := false
+		for _, g := range groups {
+			if strings.EqualFold(g, group) && group != "" {
+				found = true
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+		for _, acl := range strings.Split(listacls, " ") {
+			if acl == "" {
+				continue
+			}
+			for key, value := range cluster.Grants {
+				if strings.HasPrefix(key, acl) {
+					grants[value] = true
+				}
+			}
+		}
+	}
+	return grants
 }
 
 func (cluster *Cluster) SaveAcls() {
@@ -49,6 +137,7 @@ func (cluster *Cluster) SaveAcls() {
 	}
 	cluster.Conf.APIUsersACLAllow = strings.Join(aUserAcls, ",")
 	cluster.Conf.APIUsersACLDiscard = ""
+	cluster.SaveAPITokens()
 }
 
 func (cluster *Cluster) SetGrant(user string, grant string, enable bool) {
@@ -111,49 +200,82 @@ func (cluster *Cluster) LoadAPIUsers() error {
 		meUsers[newapiuser.User] = newapiuser
 	}
 	cluster.APIUsers = meUsers
+	cluster.LoadAPITokens()
+	return cluster.loadLdapAuthenticator()
+}
+
+// loadLdapAuthenticator sets the LDAP authentication of the users missing from api-credentials
+func (cluster *Cluster) loadLdapAuthenticator() error {
+	if cluster.Conf.APILdapURL == "" {
+		cluster.ldapAuth = nil
+		return nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: cluster.Conf.APILdapTLSSkipVerify}
+	if cluster.Conf.APILdapTLSCA != "" {
+		pem, err := ioutil.ReadFile(cluster.Conf.APILdapTLSCA)
+		if err != nil {
+			cluster.LogPrintf(LvlErr, "Could not read LDAP CA %s: %s", cluster.Conf.APILdapTLSCA, err)
+			return err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		tlsConfig.RootCAs.AppendCertsFromPEM(pem)
+	}
+	cluster.ldapAuth = &ldap.Authenticator{
+		URL:            cluster.Conf.APILdapURL,
+		StartTLS:       cluster.Conf.APILdapStartTLS,
+		TLSConfig:      tlsConfig,
+		BindDN:         cluster.Conf.APILdapBindDN,
+		BindPassword:   cluster.Conf.APILdapBindPassword,
+		UserBase:       cluster.Conf.APILdapUserBase,
+		UserFilter:     cluster.Conf.APILdapUserFilter,
+		GroupAttribute: cluster.Conf.APILdapGroupAttribute,
+		GroupBase:      cluster.Conf.APILdapGroupBase,
+		GroupFilter:    cluster.Conf.APILdapGroupFilter,
+		CacheTTL:       time.Duration(cluster.Conf.APILdapCacheTTL) * time.Second,
+	}
 	return nil
 }
 
-func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
+func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, grants map[string]bool, URL string) bool {
 	/*
 		missing "/api/clusters/{clusterName}/servers/{serverName}/service-opensvc"
 	*/
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterProcess] {
+	if grants[config.GrantClusterProcess] {
 		if strings.Contains(URL, "/actions/run-jobs") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantProvDBProvision] {
+	if grants[config.GrantProvDBProvision] {
 		if strings.Contains(URL, "/actions/provision") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantProvDBUnprovision] {
+	if grants[config.GrantProvDBUnprovision] {
 		if strings.Contains(URL, "/actions/unprovision") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBStart] {
+	if grants[config.GrantDBStart] {
 		if strings.Contains(URL, "/actions/start") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBStop] {
+	if grants[config.GrantDBStop] {
 		if strings.Contains(URL, "/actions/stop") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBKill] {
+	if grants[config.GrantDBKill] {
 		if strings.Contains(URL, "/actions/kill") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBOptimize] {
+	if grants[config.GrantDBOptimize] {
 		if strings.Contains(URL, "/actions/analyze-pfs") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBAnalyse] {
+	if grants[config.GrantDBAnalyse] {
 		if strings.Contains(URL, "/actions/analyze-pfs") {
 			return true
 		}
@@ -164,7 +286,7 @@ func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBReplication] {
+	if grants[config.GrantDBReplication] {
 		if strings.Contains(URL, "/all-slaves-status") {
 			return true
 		}
@@ -187,7 +309,7 @@ func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBBackup] {
+	if grants[config.GrantDBBackup] {
 		if strings.Contains(URL, "/actions/backup-logical") {
 			return true
 		}
@@ -204,22 +326,28 @@ func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBRestore] {
+	if grants[config.GrantDBRestore] {
 		if strings.Contains(URL, "/actions/reseed/") {
 			return true
 		}
+		if strings.Contains(URL, "/actions/pitr") {
+			return true
+		}
+		if strings.Contains(URL, "/actions/delayed-") {
+			return true
+		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBReadOnly] {
+	if grants[config.GrantDBReadOnly] {
 		if strings.Contains(URL, "actions/toogle-read-only") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantProxyConfigFlag] {
+	if grants[config.GrantProxyConfigFlag] {
 		if strings.Contains(URL, "/config") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBLogs] {
+	if grants[config.GrantDBLogs] {
 		if strings.Contains(URL, "/processlist") {
 			return true
 		}
@@ -244,6 +372,9 @@ func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
 		if strings.Contains(URL, "/digest-statements-slow") {
 			return true
 		}
+		if strings.Contains(URL, "/digests") {
+			return true
+		}
 		if strings.Contains(URL, "/actions/toogle-sql-error-log") {
 			return true
 		}
@@ -284,12 +415,12 @@ func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBCapture] {
+	if grants[config.GrantDBCapture] {
 		if strings.Contains(URL, "/actions/toogle-slow-query-capture") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBMaintenance] {
+	if grants[config.GrantDBMaintenance] {
 		if strings.Contains(URL, "/actions/optimize") {
 			return true
 		}
@@ -300,27 +431,27 @@ func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
 			return true
 		}
 	}
-	/*	if cluster.APIUsers[strUser].Grants[config.GrantDBConfigCreate] {
+	/*	if grants[config.GrantDBConfigCreate] {
 			if strings.Contains(URL, "/kill") {
 				return true
 			}
 		}
-		if cluster.APIUsers[strUser].Grants[config.GrantDBConfigGet] {
+		if grants[config.GrantDBConfigGet] {
 			if strings.Contains(URL, "/kill") {
 				return true
 			}
 		}
-		if cluster.APIUsers[strUser].Grants[config.GrantDBConfigFlag] {
+		if grants[config.GrantDBConfigFlag] {
 			if strings.Contains(URL, "/kill") {
 				return true
 			}
 		}*/
-	if cluster.APIUsers[strUser].Grants[config.GrantDBShowVariables] {
+	if grants[config.GrantDBShowVariables] {
 		if strings.Contains(URL, "/variables") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBShowSchema] {
+	if grants[config.GrantDBShowSchema] {
 		if strings.Contains(URL, "/tables") {
 			return true
 		}
@@ -334,7 +465,7 @@ func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBShowStatus] {
+	if grants[config.GrantDBShowStatus] {
 		if strings.Contains(URL, "/status") {
 			return true
 		}
@@ -346,34 +477,44 @@ func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
 	return false
 }
 
-func (cluster *Cluster) IsURLPassProxiesACL(strUser string, URL string) bool {
+func (cluster *Cluster) IsURLPassProxiesACL(strUser string, grants map[string]bool, URL string) bool {
 
-	if cluster.APIUsers[strUser].Grants[config.GrantProvProxyProvision] {
+	if grants[config.GrantProvProxyProvision] {
 		if strings.Contains(URL, "/actions/provision") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantProvProxyUnprovision] {
+	if grants[config.GrantProvProxyUnprovision] {
 		if strings.Contains(URL, "/actions/unprovision") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantProxyStart] {
+	if grants[config.GrantProxyStart] {
 		if strings.Contains(URL, "/actions/start") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantProxyStop] {
+	if grants[config.GrantProxyStop] {
 		if strings.Contains(URL, "/actions/stop") {
 			return true
 		}
 	}
+	if grants[config.GrantProxyConfigGet] {
+		if strings.Contains(URL, "/xds-nodes") {
+			return true
+		}
+	}
 	cluster.LogPrintf(LvlInfo, "ACL proxy check failed for user %s : %s ", strUser, URL)
 
 	return false
 }
 
 func (cluster *Cluster) IsURLPassACL(strUser string, URL string) bool {
+	return cluster.IsURLPassGrantsACL(strUser, cluster.APIUsers[strUser].Grants, URL)
+}
+
+// IsURLPassGrantsACL checks an URL against a set of grants, the grants of an API user or the ones mapped to its groups
+func (cluster *Cluster) IsURLPassGrantsACL(strUser string, grants map[string]bool, URL string) bool {
 	switch URL {
 	case "/api/login":
 		return true
@@ -387,12 +528,12 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string) bool {
 		return true
 	}
 	if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/servers") {
-		return cluster.IsURLPassDatabasesACL(strUser, URL)
+		return cluster.IsURLPassDatabasesACL(strUser, grants, URL)
 	}
 	if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/proxies") {
-		return cluster.IsURLPassProxiesACL(strUser, URL)
+		return cluster.IsURLPassProxiesACL(strUser, grants, URL)
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterSharding] {
+	if grants[config.GrantClusterSharding] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/schema") {
 			return true
 		}
@@ -400,42 +541,52 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string) bool {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterShowBackups] {
+	if grants[config.GrantClusterShowBackups] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/backups") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterShowRoutes] {
-		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/queryrules") {
+	if grants[config.GrantClusterShowRoutes] {
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/queryrules") && !strings.Contains(URL, "/actions/") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterShowCertificates] {
+	if grants[config.GrantClusterShowCertificates] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/certificates") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterResetSLA] {
+	if grants[config.GrantClusterShowAudit] {
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/audit") {
+			return true
+		}
+	}
+	if grants[config.GrantClusterAlerts] {
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/alerts") {
+			return true
+		}
+	}
+	if grants[config.GrantClusterResetSLA] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/reset-sla") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterCreateMonitor] {
+	if grants[config.GrantClusterCreateMonitor] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/addserver") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterSwitchover] {
+	if grants[config.GrantClusterSwitchover] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/switchover") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterRotateKey] {
+	if grants[config.GrantClusterRotateKey] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/rotatekeys") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterTraffic] {
+	if grants[config.GrantClusterTraffic] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/stop-traffic") {
 			return true
 
@@ -444,30 +595,33 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string) bool {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBBackup] {
+	if grants[config.GrantDBBackup] {
 		if strings.Contains(URL, "/actions/master-logical-backup") {
 			return true
 		}
 		if strings.Contains(URL, "/actions/master-physical-backup") {
 			return true
 		}
+		if strings.Contains(URL, "/actions/backup-verify") {
+			return true
+		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterBench] {
+	if grants[config.GrantClusterBench] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/sysbench") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterTest] {
+	if grants[config.GrantClusterTest] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/sysbench") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterFailover] {
+	if grants[config.GrantClusterFailover] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/failover") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterReplication] {
+	if grants[config.GrantClusterReplication] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/replication/bootstrap") {
 			return true
 		}
@@ -476,7 +630,7 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string) bool {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterRolling] {
+	if grants[config.GrantClusterRolling] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/optimize") {
 			return true
 		}
@@ -490,7 +644,7 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string) bool {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBConfigFlag] {
+	if grants[config.GrantDBConfigFlag] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/settings/actions/drop-db-tag") {
 			return true
 		}
@@ -498,7 +652,10 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string) bool {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantProxyConfigFlag] {
+	if grants[config.GrantProxyConfigFlag] {
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/queryrules/") {
+			return true
+		}
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/settings/actions/drop-proxy-tag") {
 			return true
 		}
@@ -506,7 +663,7 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string) bool {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterSettings] {
+	if grants[config.GrantClusterSettings] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/settings/actions/reload") {
 			return true
 		}
@@ -523,13 +680,13 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string) bool {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterChecksum] {
+	if grants[config.GrantClusterChecksum] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/checksum-all-tables") {
 			return true
 		}
 	}
 
-	if cluster.APIUsers[strUser].Grants[config.GrantProvCluster] {
+	if grants[config.GrantProvCluster] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/services/actions/provision") {
 			return true
 		}
@@ -537,21 +694,21 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string) bool {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantProvClusterUnprovision] {
+	if grants[config.GrantProvClusterUnprovision] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/services/actions/unprovision") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterCreate] {
+	if grants[config.GrantClusterCreate] {
 		if strings.Contains(URL, "/api/clusters/actions/add") {
 			return true
 		}
 	}
-	/*	case cluster.APIUsers[strUser].Grants[config.GrantClusterGrant] == true:
+	/*	case grants[config.GrantClusterGrant] == true:
 			return false
-		case cluster.APIUsers[strUser].Grants[config.GrantClusterDropMonitor] == true:
+		case grants[config.GrantClusterDropMonitor] == true:
 			return false
-		case cluster.APIUsers[strUser].Grants[config.GrantClusterCreate] == true:
+		case grants[config.GrantClusterCreate] == true:
 			return false
 	*/
 
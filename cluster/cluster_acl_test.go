@@ -0,0 +1,107 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/signal18/replication-manager/config"
+)
+
+func TestGroupsACL(t *testing.T) {
+	cluster := new(Cluster)
+	cluster.Name = "c1"
+	cluster.Conf.APIOIDCGroupsACL = "dba:db cluster-show,backup:db-backup,nobody:"
+	cluster.Grants = cluster.Conf.GetGrantType()
+
+	grants := cluster.GetGroupsGrants([]string{"backup"})
+	if !grants[config.GrantDBBackup] || grants[config.GrantDBStart] || grants[config.GrantClusterShowBackups] {
+		t.Errorf("Unexpected backup group grants %v", grants)
+	}
+	if len(cluster.GetGroupsGrants([]string{"nobody", "unknown"})) != 0 {
+		t.Error("Groups without acl granted")
+	}
+	if !cluster.IsValidGroupsACL("alice", []string{"dba"}, "/api/clusters/c1/backups") {
+		t.Error("dba group denied the backups")
+	}
+	if cluster.IsValidGroupsACL("bob", []string{"backup"}, "/api/clusters/c1/backups") {
+		t.Error("backup group granted the backups list")
+	}
+}
+
+func TestAPIToken(t *testing.T) {
+	cluster := new(Cluster)
+	cluster.Name = "c1"
+	cluster.Grants = cluster.Conf.GetGrantType()
+	dir, err := ioutil.TempDir("", "repman")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cluster.Conf.WorkingDir = dir
+	if err := os.MkdirAll(dir+"/c1", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	token, secret, err := NewAPIToken("ci", "admin", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token.Grants = cluster.GetGrantsFromACL([]string{"db-backup", "cluster-switchover"})
+	cluster.AddAPIToken(token, map[string]bool{config.GrantDBBackup: true})
+	if GetAPITokenId(secret) != token.Id {
+		t.Errorf("Unexpected token id %s", GetAPITokenId(secret))
+	}
+	if !cluster.IsValidTokenACL(secret, "/api/clusters/c1/servers/db1/actions/backup-logical") {
+		t.Error("Token denied its grant")
+	}
+	if cluster.IsValidTokenACL(secret, "/api/clusters/c1/actions/switchover") {
+		t.Error("Token granted a grant its creator does not hold")
+	}
+	if _, err := cluster.GetAPIToken(secret + "0"); err != ErrAPITokenInvalid {
+		t.Errorf("Wrong secret accepted: %v", err)
+	}
+
+	if err := cluster.SaveAPITokens(); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(cluster.getAPITokensFile())
+	if err := cluster.SaveAPITokens(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cluster.getAPITokensFile()); !os.IsNotExist(err) {
+		t.Error("Unchanged tokens written again")
+	}
+	cluster.GetAPIToken(secret)
+	if err := cluster.SaveAPITokens(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cluster.LoadAPITokens(); err != nil {
+		t.Fatal(err)
+	}
+	if tokens := cluster.GetAPITokens(); len(tokens) != 1 || tokens[0].Hash != "" || tokens[0].LastUsed.IsZero() {
+		t.Errorf("Unexpected saved tokens %v", tokens)
+	}
+	cluster.RevokeAPIToken(token.Id, "admin")
+	if _, err := cluster.GetAPIToken(secret); err != ErrAPITokenRevoked {
+		t.Errorf("Revoked token accepted: %v", err)
+	}
+
+	expired, secret, _ := NewAPIToken("old", "admin", time.Nanosecond)
+	expired.Grants = []string{config.GrantDBBackup}
+	cluster.AddAPIToken(expired, map[string]bool{config.GrantDBBackup: true})
+	time.Sleep(time.Millisecond)
+	if _, err := cluster.GetAPIToken(secret); err != ErrAPITokenExpired {
+		t.Errorf("Expired token accepted: %v", err)
+	}
+}
@@ -0,0 +1,271 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 Cloud SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package cluster
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// APITokenPrefix starts the secret of an API token, it tells a token from a JWT in the Authorization header
+const APITokenPrefix = "rmt_"
+
+var (
+	ErrAPITokenInvalid = errors.New("API token is not valid")
+	ErrAPITokenExpired = errors.New("API token expired")
+	ErrAPITokenRevoked = errors.New("API token revoked")
+)
+
+// APIToken is a long lived credential of an automation bound to a set of grants, a token created for several
+// clusters is stored in each of them under the same id, only the hash of its secret is kept
+type APIToken struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	User      string    `json:"user"`
+	Hash      string    `json:"hash,omitempty"`
+	Grants    []string  `json:"grants"`
+	Clusters  []string  `json:"clusters"`
+	Created   time.Time `json:"created"`
+	Expire    time.Time `json:"expire"`
+	LastUsed  time.Time `json:"lastUsed"`
+	Revoked   bool      `json:"revoked"`
+	RevokedBy string    `json:"revokedBy,omitempty"`
+}
+
+// IsExpired returns true when the token has an expiry in the past
+func (t *APIToken) IsExpired() bool {
+	return !t.Expire.IsZero() && time.Now().After(t.Expire)
+}
+
+// GetGrantsMap returns the grants of the token as checked by IsURLPassGrantsACL
+func (t *APIToken) GetGrantsMap() map[string]bool {
+	grants := make(map[string]bool)
+	for _, g := range t.Grants {
+		grants[g] = true
+	}
+	return grants
+}
+
+// NewAPIToken returns a token and its secret, the secret is returned once and can not be recovered
+func NewAPIToken(name string, user string, ttl time.Duration) (*APIToken, string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	t := &APIToken{
+		Id:      hex.EncodeToString(id),
+		Name:    name,
+		User:    user,
+		Created: time.Now(),
+	}
+	if ttl > 0 {
+		t.Expire = t.Created.Add(ttl)
+	}
+	plain := APITokenPrefix + t.Id + "_" + hex.EncodeToString(secret)
+	t.Hash = hashAPIToken(plain)
+	return t, plain, nil
+}
+
+func hashAPIToken(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
+
+// GetAPITokenId returns the id embedded in a token secret
+func GetAPITokenId(secret string) string {
+	if !strings.HasPrefix(secret, APITokenPrefix) {
+		return ""
+	}
+	id, _ := splitAPITokenSecret(secret)
+	return id
+}
+
+func splitAPITokenSecret(secret string) (string, string) {
+	s := strings.TrimPrefix(secret, APITokenPrefix)
+	i := strings.IndexByte(s, '_')
+	if i < 0 {
+		return "", ""
+	}
+	return s[:i], s[i+1:]
+}
+
+func (cluster *Cluster) getAPITokensFile() string {
+	return cluster.Conf.WorkingDir + "/" + cluster.Name + "/apitokens.json"
+}
+
+// LoadAPITokens reads the tokens of the cluster from its working directory
+func (cluster *Cluster) LoadAPITokens() error {
+	tokens := make(map[string]*APIToken)
+	content, err := ioutil.ReadFile(cluster.getAPITokensFile())
+	if err != nil && !os.IsNotExist(err) {
+		cluster.LogPrintf(LvlErr, "Could not read API tokens: %s", err)
+		return err
+	}
+	if err == nil {
+		var list []*APIToken
+		if err := json.Unmarshal(content, &list); err != nil {
+			cluster.LogPrintf(LvlErr, "Could not decode API tokens: %s", err)
+			return err
+		}
+		for _, t := range list {
+			tokens[t.Id] = t
+		}
+	}
+	cluster.apiTokensMutex.Lock()
+	cluster.apiTokens = tokens
+	cluster.apiTokensDirty = false
+	cluster.apiTokensMutex.Unlock()
+	return nil
+}
+
+// SaveAPITokens writes the tokens of the cluster with their last use when they changed since the last
+// write, nothing is written when the tokens could not be loaded
+func (cluster *Cluster) SaveAPITokens() error {
+	cluster.apiTokensMutex.Lock()
+	if cluster.apiTokens == nil || !cluster.apiTokensDirty {
+		cluster.apiTokensMutex.Unlock()
+		return nil
+	}
+	list := make([]*APIToken, 0, len(cluster.apiTokens))
+	for _, t := range cluster.apiTokens {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	content, err := json.MarshalIndent(list, "", "\t")
+	if err == nil {
+		cluster.apiTokensDirty = false
+	}
+	cluster.apiTokensMutex.Unlock()
+	if err == nil {
+		err = ioutil.WriteFile(cluster.getAPITokensFile(), content, 0600)
+	}
+	if err != nil {
+		cluster.apiTokensMutex.Lock()
+		cluster.apiTokensDirty = true
+		cluster.apiTokensMutex.Unlock()
+		cluster.LogPrintf(LvlErr, "Could not save API tokens: %s", err)
+	}
+	return err
+}
+
+// GetAPITokens returns a copy of the tokens of the cluster without their hash
+func (cluster *Cluster) GetAPITokens() []APIToken {
+	cluster.apiTokensMutex.Lock()
+	defer cluster.apiTokensMutex.Unlock()
+	var list []APIToken
+	for _, t := range cluster.apiTokens {
+		c := *t
+		c.Hash = ""
+		list = append(list, c)
+	}
+	return list
+}
+
+// AddAPIToken stores a token for the cluster, its grants are restricted to the ones given in grants
+func (cluster *Cluster) AddAPIToken(t *APIToken, grants map[string]bool) {
+	c := *t
+	c.Grants = nil
+	for _, g := range t.Grants {
+		if grants[g] {
+			c.Grants = append(c.Grants, g)
+		}
+	}
+	cluster.apiTokensMutex.Lock()
+	if cluster.apiTokens == nil {
+		cluster.apiTokens = make(map[string]*APIToken)
+	}
+	cluster.apiTokens[c.Id] = &c
+	cluster.apiTokensDirty = true
+	cluster.apiTokensMutex.Unlock()
+	cluster.LogPrintf(LvlInfo, "API token %s (%s) created by %s with grants %s", c.Id, c.Name, c.User, strings.Join(c.Grants, " "))
+	cluster.SaveAcls()
+}
+
+// HasAPIToken returns true when a token id is stored in the cluster
+func (cluster *Cluster) HasAPIToken(id string) bool {
+	cluster.apiTokensMutex.Lock()
+	defer cluster.apiTokensMutex.Unlock()
+	_, ok := cluster.apiTokens[id]
+	return ok
+}
+
+// RevokeAPIToken revokes a token of the cluster, the token is kept to be listed
+func (cluster *Cluster) RevokeAPIToken(id string, user string) bool {
+	cluster.apiTokensMutex.Lock()
+	t, ok := cluster.apiTokens[id]
+	if ok {
+		t.Revoked = true
+		t.RevokedBy = user
+		cluster.apiTokensDirty = true
+	}
+	cluster.apiTokensMutex.Unlock()
+	if !ok {
+		return false
+	}
+	cluster.LogPrintf(LvlInfo, "API token %s revoked by %s", id, user)
+	cluster.SaveAcls()
+	return true
+}
+
+// GetAPIToken returns the token of a secret when it is valid for the cluster and records its use
+func (cluster *Cluster) GetAPIToken(secret string) (*APIToken, error) {
+	id, _ := splitAPITokenSecret(secret)
+	cluster.apiTokensMutex.Lock()
+	defer cluster.apiTokensMutex.Unlock()
+	t, ok := cluster.apiTokens[id]
+	if !ok || id == "" || subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hashAPIToken(secret))) != 1 {
+		return nil, ErrAPITokenInvalid
+	}
+	if t.Revoked {
+		return nil, ErrAPITokenRevoked
+	}
+	if t.IsExpired() {
+		return nil, ErrAPITokenExpired
+	}
+	t.LastUsed = time.Now()
+	cluster.apiTokensDirty = true
+	c := *t
+	c.Hash = ""
+	return &c, nil
+}
+
+// IsValidTokenACL checks an URL for an API token of the cluster
+func (cluster *Cluster) IsValidTokenACL(secret string, URL string) bool {
+	t, err := cluster.GetAPIToken(secret)
+	if err != nil {
+		return false
+	}
+	return cluster.IsURLPassGrantsACL("token:"+t.Id, t.GetGrantsMap(), URL)
+}
+
+// GetGrantsFromACL expands a list of acl prefixes like the ones of api-credentials-acl-allow to grant names
+func (cluster *Cluster) GetGrantsFromACL(acls []string) []string {
+	var grants []string
+	for key, value := range cluster.Grants {
+		for _, acl := range acls {
+			if acl != "" && strings.HasPrefix(key, acl) {
+				grants = append(grants, value)
+				break
+			}
+		}
+	}
+	sort.Strings(grants)
+	return grants
+}
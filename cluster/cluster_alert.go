@@ -0,0 +1,233 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	"github.com/signal18/replication-manager/utils/alert"
+	"github.com/signal18/replication-manager/utils/state"
+)
+
+// initAlertDispatcher creates the alert sinks from the configuration
+func (cluster *Cluster) initAlertDispatcher() {
+	d := alert.NewDispatcher(cluster.Conf.AlertRetry, time.Duration(cluster.Conf.AlertRetryBackoff)*time.Second, time.Duration(cluster.Conf.AlertDedupWindow)*time.Second)
+	d.Log = cluster.LogPrintf
+	routes, err := alert.ParseRoutes(cluster.Conf.AlertRoutes)
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Could not parse alert routes: %s", err)
+	}
+	d.Routes = routes
+	if cluster.Conf.AlertScript != "" && cluster.Conf.AlertScriptDispatch {
+		d.AddChannel(&alert.Script{Path: cluster.Conf.AlertScript}, cluster.Conf.AlertScriptSeverity)
+	}
+	if cluster.Conf.AlertWebhookURL != "" {
+		d.AddChannel(&alert.Webhook{URL: cluster.Conf.AlertWebhookURL, Secret: cluster.Conf.AlertWebhookSecret}, cluster.Conf.AlertWebhookSeverity)
+	}
+	if cluster.Conf.AlertPagerDutyRoutingKey != "" {
+		d.AddChannel(&alert.PagerDuty{URL: cluster.Conf.AlertPagerDutyURL, RoutingKey: cluster.Conf.AlertPagerDutyRoutingKey}, cluster.Conf.AlertPagerDutySeverity)
+	}
+	if cluster.Conf.AlertOpsgenieAPIKey != "" {
+		d.AddChannel(&alert.Opsgenie{URL: cluster.Conf.AlertOpsgenieURL, APIKey: cluster.Conf.AlertOpsgenieAPIKey}, cluster.Conf.AlertOpsgenieSeverity)
+	}
+	if cluster.Conf.AlertTeamsURL != "" {
+		d.AddChannel(&alert.Teams{URL: cluster.Conf.AlertTeamsURL}, cluster.Conf.AlertTeamsSeverity)
+	}
+	cluster.alertDispatcher = d
+}
+
+// SendAlertEvent dispatches an alert to the configured sinks
+func (cluster *Cluster) SendAlertEvent(e *alert.Event) {
+	if cluster.alertDispatcher == nil || !cluster.prepareAlertEvent(e) {
+		return
+	}
+	cluster.alertDispatcher.Dispatch(e)
+}
+
+// prepareAlertEvent fills the cluster, the time and the server tags of an alert, it returns false when the alert
+// must not be sent because the monitor is not active or a silence matches it
+func (cluster *Cluster) prepareAlertEvent(e *alert.Event) bool {
+	if cluster.Status != ConstMonitorActif && cluster.IsDiscovered() {
+		return false
+	}
+	e.Cluster = cluster.Name
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.Tags == nil {
+		if server := cluster.GetServerFromURL(e.Origin); server != nil {
+			e.Tags = server.GetTags()
+		}
+	}
+	if s := cluster.getAlertSilence(e); s != nil {
+		cluster.LogPrintf(LvlDbg, "Alert %s silenced by %s: %s", e.DedupKey(), s.Id, s.Comment)
+		return false
+	}
+	return true
+}
+
+// isAlertRouted is true when the alert routes send an alert to a sink, the mail and the alert script
+// called on state changes are the sinks mail and script
+func (cluster *Cluster) isAlertRouted(sink string, e *alert.Event) bool {
+	if cluster.alertDispatcher == nil {
+		return true
+	}
+	return cluster.alertDispatcher.IsRouted(sink, e)
+}
+
+// GetAlertRoutes returns the alert routes of the dispatcher
+func (cluster *Cluster) GetAlertRoutes() []alert.Route {
+	if cluster.alertDispatcher == nil {
+		return nil
+	}
+	return cluster.alertDispatcher.Routes
+}
+
+func (cluster *Cluster) getAlertSilence(e *alert.Event) *alert.Silence {
+	cluster.alertSilencesMutex.Lock()
+	defer cluster.alertSilencesMutex.Unlock()
+	for k, s := range cluster.AlertSilences {
+		if s.Match(e) {
+			return &cluster.AlertSilences[k]
+		}
+	}
+	return nil
+}
+
+// GetAlertSilences returns the active and upcoming silences, expired ones are purged
+func (cluster *Cluster) GetAlertSilences() []alert.Silence {
+	cluster.alertSilencesMutex.Lock()
+	defer cluster.alertSilencesMutex.Unlock()
+	now := time.Now()
+	silences := []alert.Silence{}
+	for _, s := range cluster.AlertSilences {
+		if !s.IsExpired(now) {
+			silences = append(silences, s)
+		}
+	}
+	if len(silences) != len(cluster.AlertSilences) {
+		cluster.AlertSilences = silences
+		cluster.saveAlertSilences()
+	}
+	return silences
+}
+
+// AddAlertSilence records a silence and persists the silence list
+func (cluster *Cluster) AddAlertSilence(s alert.Silence) (alert.Silence, error) {
+	if s.Start.IsZero() {
+		s.Start = time.Now()
+	}
+	if !s.End.After(s.Start) {
+		return s, errors.New("Silence end must be after start")
+	}
+	cluster.alertSilencesMutex.Lock()
+	defer cluster.alertSilencesMutex.Unlock()
+	s.Id = strconv.FormatInt(time.Now().UnixNano(), 36)
+	cluster.AlertSilences = append(cluster.AlertSilences, s)
+	cluster.LogPrintf(LvlInfo, "Alert silence %s added by %s until %s: %s", s.Id, s.User, s.End.Format(time.RFC3339), s.Comment)
+	return s, cluster.saveAlertSilences()
+}
+
+// DeleteAlertSilence removes a silence by id
+func (cluster *Cluster) DeleteAlertSilence(id string) error {
+	cluster.alertSilencesMutex.Lock()
+	defer cluster.alertSilencesMutex.Unlock()
+	for k, s := range cluster.AlertSilences {
+		if s.Id == id {
+			cluster.AlertSilences = append(cluster.AlertSilences[:k], cluster.AlertSilences[k+1:]...)
+			cluster.LogPrintf(LvlInfo, "Alert silence %s deleted", id)
+			return cluster.saveAlertSilences()
+		}
+	}
+	return errors.New("Silence not found")
+}
+
+func (cluster *Cluster) saveAlertSilences() error {
+	saveJson, _ := json.MarshalIndent(cluster.AlertSilences, "", "\t")
+	err := ioutil.WriteFile(cluster.WorkingDir+"/silences.json", saveJson, 0644)
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Could not save alert silences: %s", err)
+	}
+	return err
+}
+
+func (cluster *Cluster) loadAlertSilences() error {
+	file, err := ioutil.ReadFile(cluster.WorkingDir + "/silences.json")
+	if err != nil {
+		return err
+	}
+	var silences []alert.Silence
+	err = json.Unmarshal(file, &silences)
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "File error: %v\n", err)
+		return err
+	}
+	cluster.AlertSilences = silences
+	return nil
+}
+
+func getStateSeverity(s state.State) string {
+	switch s.ErrType {
+	case LvlErr:
+		return alert.SeverityError
+	case LvlWarn, "WARNING":
+		return alert.SeverityWarn
+	}
+	return alert.SeverityInfo
+}
+
+// sendStateAlerts dispatches the states opened and resolved during the last monitoring loop
+func (cluster *Cluster) sendStateAlerts() {
+	for _, s := range cluster.sme.GetNewStates() {
+		cluster.SendAlertEvent(&alert.Event{Origin: s.ServerUrl, Severity: getStateSeverity(s), ErrKey: s.ErrKey, ErrFrom: s.ErrFrom, Desc: s.ErrDesc})
+	}
+	for _, s := range cluster.sme.GetResolvedStates() {
+		cluster.SendAlertEvent(&alert.Event{Origin: s.ServerUrl, Severity: getStateSeverity(s), ErrKey: s.ErrKey, ErrFrom: s.ErrFrom, Desc: s.ErrDesc, Resolved: true})
+	}
+}
+
+func (server *ServerMonitor) getAlertSeverity() string {
+	if server.State == stateFailed && (server.PrevState == stateMaster || server.IsMaster()) {
+		return alert.SeverityCritical
+	}
+	return getServerStateSeverity(server.State)
+}
+
+func getServerStateSeverity(st string) string {
+	switch st {
+	case stateFailed, stateErrorAuth:
+		return alert.SeverityError
+	case stateSuspect:
+		return alert.SeverityWarn
+	}
+	return alert.SeverityInfo
+}
+
+// getStateChangeAlert returns the alert of a server state change, leaving a failed, suspect or error auth
+// state resolves the incident of the server
+func (server *ServerMonitor) getStateChangeAlert() *alert.Event {
+	e := &alert.Event{
+		Origin:    server.URL,
+		State:     server.State,
+		PrevState: server.PrevState,
+		Severity:  server.getAlertSeverity(),
+		Desc:      fmt.Sprintf("Server %s state changed from %s to %s", server.URL, server.PrevState, server.State),
+	}
+	if prev := getServerStateSeverity(server.PrevState); e.Severity == alert.SeverityInfo && prev != alert.SeverityInfo {
+		e.Resolved = true
+		e.Severity = prev
+	}
+	return e
+}
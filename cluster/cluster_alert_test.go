@@ -0,0 +1,61 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/alert"
+	"github.com/signal18/replication-manager/utils/state"
+)
+
+func TestSendAlertSilencesAndRoutes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	calls := filepath.Join(dir, "calls")
+	script := filepath.Join(dir, "alert.sh")
+	if err := ioutil.WriteFile(script, []byte("#!/bin/sh\necho \"$1 $2 $3\" >> "+calls+"\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	cluster := &Cluster{Name: "cluster1", Status: ConstMonitorActif, Conf: config.Config{AlertScript: script}, sme: new(state.StateMachine)}
+	cluster.sme.Init()
+	cluster.initAlertDispatcher()
+	cluster.alertDispatcher.Routes, _ = alert.ParseRoutes("sink=script,severity=ERROR")
+	now := time.Now()
+	cluster.AlertSilences = []alert.Silence{{Id: "s1", Server: "db3:*", Start: now.Add(-time.Minute), End: now.Add(time.Hour)}}
+	for _, c := range []struct {
+		url   string
+		prev  string
+		state string
+	}{
+		{"db1:3306", stateSlave, stateFailed},
+		{"db2:3306", stateSlave, stateSuspect},
+		{"db3:3306", stateSlave, stateFailed},
+	} {
+		server := &ServerMonitor{URL: c.url, ClusterGroup: cluster, PrevState: c.prev, State: c.state}
+		server.SendAlert()
+	}
+	out, err := ioutil.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(out)), "\n"); len(lines) != 1 || lines[0] != "db1:3306 "+stateSlave+" "+stateFailed {
+		t.Fatalf("Expected the alert script called only for the routed and not silenced alert, got %q", lines)
+	}
+}
@@ -7,19 +7,25 @@
 package cluster
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/signal18/replication-manager/config"
 	"github.com/signal18/replication-manager/utils/state"
+	"github.com/signal18/replication-manager/utils/stream"
 )
 
 type Backup struct {
@@ -181,3 +187,313 @@ func (cluster *Cluster) ResticFetchRepo() error {
 
 	return nil
 }
+
+// getBackupStreamOptions returns the compression and encryption of the backups, the compression of the
+// backup path is used when backup-compression is empty
+func (cluster *Cluster) getBackupStreamOptions(defaultCompression string) (stream.Options, error) {
+	o := stream.Options{
+		Compression: cluster.Conf.BackupCompression,
+		Encryption:  cluster.Conf.BackupEncryption,
+		ZstdPath:    cluster.Conf.BackupZstdPath,
+	}
+	if o.Compression == "" {
+		o.Compression = defaultCompression
+	}
+	if o.Encryption == stream.EncryptAESGCM {
+		k, err := cluster.getBackupKey()
+		if err != nil {
+			return o, fmt.Errorf("Backup encryption key: %s", err)
+		}
+		o.Key = k
+	}
+	return o, o.Validate()
+}
+
+// getBackupReadOptions returns the options to read a backup, the key is only needed by encrypted backups
+// and its error is returned to be reported when a backup is encrypted
+func (cluster *Cluster) getBackupReadOptions() (stream.Options, error) {
+	o := stream.Options{ZstdPath: cluster.Conf.BackupZstdPath}
+	k, err := cluster.getBackupKey()
+	if err != nil {
+		return o, fmt.Errorf("Backup encryption key: %s", err)
+	}
+	o.Key = k
+	return o, nil
+}
+
+// backupDumpName is the mysqldump file of a backup directory, followed by the extension of its compression
+const backupDumpName = "mysqldump.sql"
+
+// isBackupDumpFile is true for the mysqldump file of a backup directory whatever its compression
+func isBackupDumpFile(name string) bool {
+	return name == backupDumpName || name == backupDumpName+".gz" || name == backupDumpName+".zst"
+}
+
+// getBackupDumpFile returns the most recent mysqldump file of a backup directory, the gzip one when there is
+// none as the backups were named before the compression was configurable
+func getBackupDumpFile(dir string) string {
+	path := dir + backupDumpName + ".gz"
+	var latest time.Time
+	for _, ext := range []string{"", ".gz", ".zst"} {
+		if st, err := os.Stat(dir + backupDumpName + ext); err == nil && st.ModTime().After(latest) {
+			latest = st.ModTime()
+			path = dir + backupDumpName + ext
+		}
+	}
+	return path
+}
+
+// backupPipe compresses and encrypts to a backup file or stream
+type backupPipe struct {
+	io.WriteCloser
+	out io.WriteCloser
+}
+
+// newBackupPipe returns a writer encoding to out, closing it closes out
+func (cluster *Cluster) newBackupPipe(out io.WriteCloser, defaultCompression string) (io.WriteCloser, error) {
+	o, err := cluster.getBackupStreamOptions(defaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	if o.IsPlain() {
+		return out, nil
+	}
+	enc, err := stream.NewWriter(out, o)
+	if err != nil {
+		return nil, err
+	}
+	return &backupPipe{WriteCloser: enc, out: out}, nil
+}
+
+func (p *backupPipe) Close() error {
+	return p.CloseWithError(nil)
+}
+
+// CloseWithError flushes the encoding and closes the output, a non nil error aborts a stream output
+func (p *backupPipe) CloseWithError(err error) error {
+	if cerr := p.WriteCloser.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if cerr := closeBackupWriter(p.out, err); cerr != nil && err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// openBackupFile returns the decrypted and decompressed content of a backup file
+func (cluster *Cluster) openBackupFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	o, kerr := cluster.getBackupReadOptions()
+	r, err := stream.NewReader(f, o)
+	if err != nil {
+		f.Close()
+		if kerr != nil {
+			return nil, fmt.Errorf("%s: %s", err, kerr)
+		}
+		return nil, err
+	}
+	return &backupFileReader{ReadCloser: r, file: f}, nil
+}
+
+type backupFileReader struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func (r *backupFileReader) Close() error {
+	r.ReadCloser.Close()
+	return r.file.Close()
+}
+
+// encodeBackupFile compresses and encrypts a backup file in place
+func (cluster *Cluster) encodeBackupFile(path string, o stream.Options) error {
+	if o.IsPlain() {
+		return nil
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(path+".encoding", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	enc, err := stream.NewWriter(out, o)
+	if err == nil {
+		_, err = io.Copy(enc, in)
+		if cerr := enc.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path + ".encoding")
+		return err
+	}
+	return os.Rename(path+".encoding", path)
+}
+
+// openBackupBinlog returns the mysqlbinlog file argument of an archived binlog and the standard input feeding it,
+// an encoded binlog is decoded into the standard input and is never written in plain on the monitor
+func (cluster *Cluster) openBackupBinlog(path string) (string, io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	encoded := stream.IsEncoded(f)
+	f.Close()
+	if !encoded {
+		return path, nil, nil
+	}
+	r, err := cluster.openBackupFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	return "-", r, nil
+}
+
+// encryptBackupDir encrypts the data files of a dump directory in place, the tools keep their own compression
+// and the metadata stays readable for the binlog coordinates
+func (cluster *Cluster) encryptBackupDir(meta *BackupMeta) error {
+	o, err := cluster.getBackupStreamOptions(stream.CompressNone)
+	if err != nil || o.Encryption != stream.EncryptAESGCM {
+		return err
+	}
+	o.Compression = stream.CompressNone
+	files, err := ioutil.ReadDir(meta.Dest)
+	if err != nil {
+		return err
+	}
+	for _, fi := range files {
+		if fi.IsDir() || fi.Name() == "metadata" || !isBackupFile(meta, fi.Name()) {
+			continue
+		}
+		if err := cluster.encodeBackupFile(filepath.Join(meta.Dest, fi.Name()), o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decryptBackupDir returns a directory with the dump files of a backup directory for myloader. When some files are
+// encrypted a temporary directory links the plain files and serves the encrypted ones through named pipes fed with
+// their decrypted content, so the plain content is never written on the monitor. The cleanup function stops the
+// pipes myloader did not read, removes the directory and returns the first decryption error, a load fed by a
+// failed decryption is incomplete.
+func (cluster *Cluster) decryptBackupDir(dir string) (string, func() error, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", nil, err
+	}
+	encrypted := make(map[string]bool)
+	for _, fi := range files {
+		if fi.IsDir() || !isDumpDirFile(fi.Name()) {
+			continue
+		}
+		f, err := os.Open(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return "", nil, err
+		}
+		if stream.IsEncrypted(bufio.NewReader(f)) {
+			encrypted[fi.Name()] = true
+		}
+		f.Close()
+	}
+	if len(encrypted) == 0 {
+		return dir, func() error { return nil }, nil
+	}
+	o, err := cluster.getBackupReadOptions()
+	if err != nil {
+		return "", nil, err
+	}
+	tmp, err := ioutil.TempDir(cluster.WorkingDir, "decrypt-")
+	if err != nil {
+		return "", nil, err
+	}
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		derr   error
+		fifos  []string
+		closed bool
+	)
+	cleanup := func() error {
+		mu.Lock()
+		closed = true
+		mu.Unlock()
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		// a writer blocks until its pipe is opened, the pipes myloader did not read are opened until the writers return
+		for {
+			for _, fifo := range fifos {
+				if f, err := os.OpenFile(fifo, os.O_RDONLY|syscall.O_NONBLOCK, 0); err == nil {
+					f.Close()
+				}
+			}
+			select {
+			case <-done:
+				os.RemoveAll(tmp)
+				mu.Lock()
+				defer mu.Unlock()
+				return derr
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+	for _, fi := range files {
+		if fi.IsDir() || !isDumpDirFile(fi.Name()) {
+			continue
+		}
+		src := filepath.Join(dir, fi.Name())
+		dst := filepath.Join(tmp, fi.Name())
+		if !encrypted[fi.Name()] {
+			err = os.Symlink(src, dst)
+		} else if err = syscall.Mkfifo(dst, 0600); err == nil {
+			fifos = append(fifos, dst)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := decryptToPipe(src, dst, o)
+				mu.Lock()
+				if err != nil && derr == nil && !closed {
+					derr = fmt.Errorf("Could not decrypt %s: %s", src, err)
+				}
+				mu.Unlock()
+			}()
+		}
+		if err != nil {
+			cleanup()
+			return "", nil, err
+		}
+	}
+	return tmp, cleanup, nil
+}
+
+// decryptToPipe writes the decrypted content of a file to a named pipe, it returns when the content is read
+func decryptToPipe(src string, fifo string, o stream.Options) error {
+	out, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r, err := stream.NewDecrypter(in, o)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, r)
+	return err
+}
@@ -0,0 +1,587 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+)
+
+const (
+	ConstBackupTypeLogical  string = "logical"
+	ConstBackupTypePhysical string = "physical"
+)
+
+// BackupMeta is one record of the backup catalog
+type BackupMeta struct {
+	Id         string    `json:"id"`
+	Cluster    string    `json:"cluster"`
+	Type       string    `json:"type"`
+	Tool       string    `json:"tool"`
+	Source     string    `json:"source"`
+	Dest       string    `json:"dest"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Duration   int64     `json:"durationMs"`
+	Size       int64     `json:"size"`
+	Checksum   string    `json:"checksum"`
+	BinLogFile string    `json:"binLogFile"`
+	BinLogPos  uint64    `json:"binLogPos"`
+	Gtid       string    `json:"gtid"`
+	Completed  bool      `json:"completed"`
+	Error      string    `json:"error,omitempty"`
+	// Tables are the table checksums of the source at backup time, recorded with backup-checksum-tables
+	Tables       []BackupVerifiedTable `json:"tables,omitempty"`
+	Verification *BackupVerification   `json:"verification,omitempty"`
+}
+
+// BackupVerification is the result of restoring a backup into a scratch instance
+type BackupVerification struct {
+	Start         time.Time             `json:"start"`
+	End           time.Time             `json:"end"`
+	Server        string                `json:"server"`
+	ChecksumMatch bool                  `json:"checksumMatch"`
+	Tables        []BackupVerifiedTable `json:"tables"`
+	Success       bool                  `json:"success"`
+	Error         string                `json:"error,omitempty"`
+}
+
+// BackupVerifiedTable is the checksum of a table of the restored backup, the status is OK, NA without primary
+// key, KO when it differs from the checksum recorded at backup time and ER on error
+type BackupVerifiedTable struct {
+	Table    string `json:"table"`
+	Chunks   int    `json:"chunks"`
+	Checksum uint64 `json:"checksum"`
+	Status   string `json:"status"`
+}
+
+type backupCatalog []*BackupMeta
+
+func (cluster *Cluster) newBackupMeta(backupType string, tool string, source *ServerMonitor, dest string) *BackupMeta {
+	meta := new(BackupMeta)
+	meta.Start = time.Now()
+	meta.Id = meta.Start.Format("20060102150405.000")
+	meta.Cluster = cluster.Name
+	meta.Type = backupType
+	meta.Tool = tool
+	meta.Source = source.URL
+	meta.Dest = dest
+	return meta
+}
+
+// isBackupFile filters the files of a dump directory, it is shared with binlogs and other backups of the server
+func isBackupFile(meta *BackupMeta, name string) bool {
+	if meta.Tool == config.ConstBackupLogicalTypeMysqldump || meta.Type == ConstBackupTypePhysical {
+		return true
+	}
+	return isDumpDirFile(name)
+}
+
+// isDumpDirFile is true for the metadata and the table files of mydumper and dumpling
+func isDumpDirFile(name string) bool {
+	return name == "metadata" || (strings.Contains(name, ".sql") && !isBackupDumpFile(name))
+}
+
+// getBackupChecksum returns the size and the sha256 of the backup files, directories are read in lexical order
+func getBackupChecksum(meta *BackupMeta) (int64, string, error) {
+	var size int64
+	h := sha256.New()
+	err := filepath.Walk(meta.Dest, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != meta.Dest {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isBackupFile(meta, info.Name()) {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		io.WriteString(h, info.Name())
+		n, err := io.Copy(h, f)
+		size += n
+		return err
+	})
+	return size, hex.EncodeToString(h.Sum(nil)), err
+}
+
+func (cluster *Cluster) closeBackupMeta(meta *BackupMeta, err error) {
+	meta.End = time.Now()
+	meta.Duration = meta.End.Sub(meta.Start).Nanoseconds() / int64(time.Millisecond)
+	// remote backups get their checksum while streaming or before upload
+	if err == nil && !meta.IsRemote() {
+		meta.Size, meta.Checksum, err = getBackupChecksum(meta)
+		if err == nil && meta.BinLogFile == "" {
+			cluster.readBackupCoordinates(meta)
+		}
+	}
+	if err != nil {
+		meta.Error = err.Error()
+	}
+	meta.Completed = err == nil
+	cluster.LogPrintf(LvlInfo, "Backup catalog %s %s %s of %s completed: %t size: %d", meta.Id, meta.Type, meta.Tool, meta.Source, meta.Completed, meta.Size)
+
+	cluster.backupCatalogMutex.Lock()
+	cluster.BackupCatalog = append(cluster.BackupCatalog, meta)
+	if keep := cluster.Conf.BackupCatalogKeep; keep > 0 && len(cluster.BackupCatalog) > keep {
+		cluster.BackupCatalog = cluster.BackupCatalog[len(cluster.BackupCatalog)-keep:]
+	}
+	cluster.backupCatalogMutex.Unlock()
+	cluster.saveBackupCatalog()
+	if meta.Completed && meta.IsRemote() {
+		if source := cluster.GetServerFromURL(meta.Source); source != nil {
+			cluster.purgeBackupS3(source, meta.Tool)
+		}
+	}
+}
+
+// readBackupCoordinates reads the binlog position of the master at backup time from the local backup files
+func (cluster *Cluster) readBackupCoordinates(meta *BackupMeta) {
+	switch meta.Tool {
+	case config.ConstBackupLogicalTypeMysqldump:
+		if b, err := cluster.readPitrDumpHead(meta.Dest); err == nil {
+			meta.BinLogFile, meta.BinLogPos, meta.Gtid = b.BinLogFile, b.BinLogPos, b.Gtid
+		}
+	case config.ConstBackupLogicalTypeMydumper:
+		if source := cluster.GetServerFromURL(meta.Source); source != nil {
+			if m, err := source.JobMyLoaderParseMeta(meta.Dest); err == nil {
+				meta.BinLogFile, meta.BinLogPos, meta.Gtid = m.BinLogFileName, m.BinLogFilePos, m.BinLogUuid
+			}
+		}
+	}
+}
+
+// xbstreamBinlogInfoFiles are the files of xtrabackup and mariabackup with the binlog coordinates of the backup
+var xbstreamBinlogInfoFiles = []string{"xtrabackup_binlog_info", "mariadb_backup_binlog_info"}
+
+const (
+	xbstreamMagic       = "XBSTCK01"
+	xbstreamMaxPathLen  = 4096
+	xbstreamMaxInfoSize = 64 * 1024
+)
+
+// readXbstreamBinlogInfo returns the binlog coordinates of the binlog info file of an xbstream or mbstream archive,
+// the chunks are a header with the magic, flags, type and path, then for the payloads their length, offset,
+// checksum and data, the sparse payloads have their map before the data
+func readXbstreamBinlogInfo(r io.Reader) (PitrBackup, error) {
+	var b PitrBackup
+	br := bufio.NewReader(r)
+	header := make([]byte, 14)
+	for {
+		if _, err := io.ReadFull(br, header); err != nil {
+			return b, err
+		}
+		if string(header[:8]) != xbstreamMagic {
+			return b, errors.New("Invalid xbstream chunk")
+		}
+		chunkType := header[9]
+		pathLen := binary.LittleEndian.Uint32(header[10:])
+		if pathLen > xbstreamMaxPathLen {
+			return b, errors.New("Invalid xbstream path length")
+		}
+		path := make([]byte, pathLen)
+		if _, err := io.ReadFull(br, path); err != nil {
+			return b, err
+		}
+		if chunkType == 'E' {
+			continue
+		}
+		var sparseMapLen uint32
+		if chunkType == 'S' {
+			n := make([]byte, 4)
+			if _, err := io.ReadFull(br, n); err != nil {
+				return b, err
+			}
+			sparseMapLen = binary.LittleEndian.Uint32(n) * 8
+		} else if chunkType != 'P' {
+			return b, fmt.Errorf("Unknown xbstream chunk type %q", chunkType)
+		}
+		payload := make([]byte, 20)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return b, err
+		}
+		length := binary.LittleEndian.Uint64(payload[:8])
+		if _, err := io.CopyN(ioutil.Discard, br, int64(sparseMapLen)); err != nil {
+			return b, err
+		}
+		name := filepath.Base(string(path))
+		if chunkType == 'P' && length <= xbstreamMaxInfoSize && (name == xbstreamBinlogInfoFiles[0] || name == xbstreamBinlogInfoFiles[1]) {
+			data := make([]byte, length)
+			if _, err := io.ReadFull(br, data); err != nil {
+				return b, err
+			}
+			return parseBinlogInfo(string(data))
+		}
+		if _, err := io.CopyN(ioutil.Discard, br, int64(length)); err != nil {
+			return b, err
+		}
+	}
+}
+
+// parseBinlogInfo reads the binlog file, position and GTID of a binlog info file, the fields are separated
+// by tabs and a MySQL GTID set can span several lines
+func parseBinlogInfo(info string) (PitrBackup, error) {
+	var b PitrBackup
+	fields := strings.SplitN(strings.TrimSpace(info), "\t", 3)
+	if len(fields) < 2 {
+		return b, errors.New("No binlog coordinates in binlog info")
+	}
+	pos, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return b, err
+	}
+	b.BinLogFile, b.BinLogPos = fields[0], pos
+	if len(fields) == 3 {
+		b.Gtid = strings.Replace(strings.TrimSpace(fields[2]), "\n", "", -1)
+	}
+	return b, nil
+}
+
+// backupCoordinatesWriter passes a backup stream to its output and reads the binlog coordinates of the source
+// from the plain stream, the head of a mysqldump or the binlog info file of a physical backup, they are set in
+// the meta on close. It is used by the backups streamed to the object storage or received from the hosts.
+type backupCoordinatesWriter struct {
+	io.WriteCloser
+	meta   *BackupMeta
+	pw     *io.PipeWriter
+	read   bool
+	result chan PitrBackup
+}
+
+func (cluster *Cluster) newBackupCoordinatesWriter(out io.WriteCloser, meta *BackupMeta) *backupCoordinatesWriter {
+	pr, pw := io.Pipe()
+	w := &backupCoordinatesWriter{WriteCloser: out, meta: meta, pw: pw, result: make(chan PitrBackup, 1)}
+	go func() {
+		var b PitrBackup
+		var err error
+		if meta.Type == ConstBackupTypePhysical {
+			b, err = readXbstreamBinlogInfo(pr)
+		} else {
+			scanPitrDumpHead(bufio.NewReader(pr), &b)
+		}
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			cluster.LogPrintf(LvlWarn, "Backup %s binlog coordinates not found: %s", meta.Id, err)
+		}
+		// the stream is no longer read, the writes to the pipe fail and stop
+		pr.Close()
+		w.result <- b
+	}()
+	return w
+}
+
+func (w *backupCoordinatesWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	if !w.read {
+		if _, perr := w.pw.Write(p[:n]); perr != nil {
+			w.read = true
+		}
+	}
+	return n, err
+}
+
+func (w *backupCoordinatesWriter) Close() error {
+	return w.CloseWithError(nil)
+}
+
+// CloseWithError sets the coordinates read from the stream and closes the output
+func (w *backupCoordinatesWriter) CloseWithError(err error) error {
+	w.pw.Close()
+	if b := <-w.result; b.BinLogFile != "" {
+		w.meta.BinLogFile, w.meta.BinLogPos, w.meta.Gtid = b.BinLogFile, b.BinLogPos, b.Gtid
+	}
+	return closeBackupWriter(w.WriteCloser, err)
+}
+
+// GetBackupCatalog returns a copy of the logical and physical backups taken by the cluster
+func (cluster *Cluster) GetBackupCatalog() backupCatalog {
+	cluster.backupCatalogMutex.RLock()
+	defer cluster.backupCatalogMutex.RUnlock()
+	catalog := make(backupCatalog, 0, len(cluster.BackupCatalog))
+	for _, meta := range cluster.BackupCatalog {
+		m := *meta
+		catalog = append(catalog, &m)
+	}
+	return catalog
+}
+
+// GetBackupMeta returns a copy of a backup of the catalog by id
+func (cluster *Cluster) GetBackupMeta(id string) *BackupMeta {
+	cluster.backupCatalogMutex.RLock()
+	defer cluster.backupCatalogMutex.RUnlock()
+	for _, meta := range cluster.BackupCatalog {
+		if meta.Id == id {
+			m := *meta
+			return &m
+		}
+	}
+	return nil
+}
+
+// GetLastRestorableBackup returns a copy of the latest completed local logical backup, the ones a scratch
+// instance can load
+func (cluster *Cluster) GetLastRestorableBackup() *BackupMeta {
+	cluster.backupCatalogMutex.RLock()
+	defer cluster.backupCatalogMutex.RUnlock()
+	for i := len(cluster.BackupCatalog) - 1; i >= 0; i-- {
+		meta := cluster.BackupCatalog[i]
+		if meta.Completed && !meta.IsRemote() && (meta.Tool == config.ConstBackupLogicalTypeMysqldump || meta.Tool == config.ConstBackupLogicalTypeMydumper) {
+			m := *meta
+			return &m
+		}
+	}
+	return nil
+}
+
+// setBackupVerification records the verification of a backup in the catalog
+func (cluster *Cluster) setBackupVerification(id string, v *BackupVerification) {
+	cluster.backupCatalogMutex.Lock()
+	for _, meta := range cluster.BackupCatalog {
+		if meta.Id == id {
+			meta.Verification = v
+		}
+	}
+	cluster.backupCatalogMutex.Unlock()
+	cluster.saveBackupCatalog()
+}
+
+func (cluster *Cluster) saveBackupCatalog() {
+	cluster.backupCatalogMutex.Lock()
+	defer cluster.backupCatalogMutex.Unlock()
+	err := cluster.BackupCatalog.Save(cluster.WorkingDir + "/backups.json")
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Could not save backup catalog: %s", err)
+	}
+}
+
+func (cluster *Cluster) loadBackupCatalog() error {
+	file, err := ioutil.ReadFile(cluster.WorkingDir + "/backups.json")
+	if err != nil {
+		return err
+	}
+	var catalog backupCatalog
+	err = json.Unmarshal(file, &catalog)
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "File error: %v\n", err)
+		return err
+	}
+	cluster.backupCatalogMutex.Lock()
+	cluster.BackupCatalog = catalog
+	cluster.backupCatalogMutex.Unlock()
+	return nil
+}
+
+func (catalog backupCatalog) Save(path string) error {
+	saveJson, _ := json.MarshalIndent(catalog, "", "\t")
+	return ioutil.WriteFile(path, saveJson, 0644)
+}
+
+// JobVerifyBackup restores the latest logical backup into a scratch localhost instance and checksums
+// every restored table, the result is kept in the backup catalog
+func (cluster *Cluster) JobVerifyBackup() (*BackupMeta, error) {
+	meta := cluster.GetLastRestorableBackup()
+	if meta == nil {
+		return nil, errors.New("No logical backup to verify in the backup catalog")
+	}
+	if cluster.IsInFailover() {
+		return meta, errors.New("Cancel backup verification during failover")
+	}
+	v := &BackupVerification{Start: time.Now()}
+	defer func() {
+		v.End = time.Now()
+		meta.Verification = v
+		cluster.setBackupVerification(meta.Id, v)
+		if v.Success {
+			cluster.LogPrintf(LvlInfo, "Backup %s verified, %d tables restored and checksummed on %s", meta.Id, len(v.Tables), v.Server)
+		} else {
+			cluster.LogPrintf(LvlErr, "Backup %s verification failed: %s", meta.Id, v.Error)
+		}
+	}()
+	_, checksum, err := getBackupChecksum(meta)
+	if err != nil {
+		v.Error = err.Error()
+		return meta, err
+	}
+	v.ChecksumMatch = checksum == meta.Checksum
+	if !v.ChecksumMatch {
+		v.Error = "Backup files checksum differs from the catalog"
+		return meta, errors.New(v.Error)
+	}
+
+	scratch, err := cluster.newServerMonitor("127.0.0.1:"+cluster.Conf.BackupVerifyPort, cluster.dbUser, cluster.dbPass, true, "")
+	if err != nil {
+		v.Error = err.Error()
+		return meta, err
+	}
+	v.Server = scratch.URL
+	defer func() {
+		go cluster.LocalhostUnprovisionDatabaseService(scratch)
+		if err := cluster.waitBackupVerifyService(); err != nil {
+			cluster.LogPrintf(LvlErr, "Unprovision scratch instance %s: %s", scratch.URL, err)
+		}
+		scratch.ErrorLogTailer.Stop()
+		scratch.SlowLogTailer.Stop()
+	}()
+	go cluster.LocalhostProvisionDatabaseService(scratch)
+	if err = cluster.waitBackupVerifyService(); err != nil {
+		v.Error = "Provision scratch instance: " + err.Error()
+		return meta, err
+	}
+	if meta.Tool == config.ConstBackupLogicalTypeMydumper {
+		err = scratch.restorePitrMyLoader(meta.Dest)
+	} else {
+		err = scratch.restorePitrMysqldump(meta.Dest)
+	}
+	if err != nil {
+		v.Error = "Restore: " + err.Error()
+		return meta, err
+	}
+	v.Tables, err = scratch.getTableChecksums()
+	if err != nil {
+		v.Error = err.Error()
+		return meta, err
+	}
+	if err = compareBackupTableChecksums(meta.Tables, v.Tables); err != nil {
+		v.Error = err.Error()
+		return meta, err
+	}
+	v.Success = true
+	return meta, nil
+}
+
+// waitBackupVerifyService waits for the result of the provisioning or the unprovisioning of the scratch instance
+func (cluster *Cluster) waitBackupVerifyService() error {
+	select {
+	case err := <-cluster.errorChan:
+		return err
+	case <-time.After(time.Duration(cluster.Conf.BackupVerifyTimeout) * time.Second):
+		return fmt.Errorf("Timeout after %d seconds", cluster.Conf.BackupVerifyTimeout)
+	}
+}
+
+// getTableChecksums returns the chunk checksums of the tables of the server, a table without primary key has
+// the NA status
+func (server *ServerMonitor) getTableChecksums() ([]BackupVerifiedTable, error) {
+	_, tables, logs, err := dbhelper.GetTables(server.Conn, server.DBVersion)
+	server.ClusterGroup.LogSQL(logs, err, server.URL, "getTableChecksums", LvlDbg, "GetTables")
+	if err != nil {
+		return nil, errors.New("List tables: " + err.Error())
+	}
+	var checksums []BackupVerifiedTable
+	for _, t := range tables {
+		if t.Table_schema == "replication_manager_schema" {
+			continue
+		}
+		vt := BackupVerifiedTable{Table: t.Table_schema + "." + t.Table_name, Status: "OK"}
+		err := server.ChecksumTable(t.Table_schema, t.Table_name)
+		if err == errChecksumNoPK {
+			vt.Status = "NA"
+		} else if err != nil {
+			return checksums, errors.New("Checksum " + vt.Table + ": " + err.Error())
+		} else {
+			chunks, logs, err := dbhelper.GetTableChecksumResult(server.Conn)
+			server.ClusterGroup.LogSQL(logs, err, server.URL, "getTableChecksums", LvlDbg, "GetTableChecksumResult")
+			if err != nil {
+				return checksums, errors.New("Checksum " + vt.Table + ": " + err.Error())
+			}
+			vt.Chunks = len(chunks)
+			for _, c := range chunks {
+				vt.Checksum += c.ChunkCheckSum
+			}
+		}
+		checksums = append(checksums, vt)
+	}
+	return checksums, nil
+}
+
+// compareBackupTableChecksums sets the KO status on the restored tables differing from the checksums recorded
+// at backup time, nothing is compared when the backup has no checksums
+func compareBackupTableChecksums(recorded []BackupVerifiedTable, restored []BackupVerifiedTable) error {
+	if len(recorded) == 0 {
+		return nil
+	}
+	expected := make(map[string]BackupVerifiedTable)
+	for _, t := range recorded {
+		expected[t.Table] = t
+	}
+	var failed []string
+	for i := range restored {
+		t := &restored[i]
+		e, ok := expected[t.Table]
+		delete(expected, t.Table)
+		if !ok || t.Status != "OK" || e.Status != "OK" {
+			continue
+		}
+		if t.Chunks != e.Chunks || t.Checksum != e.Checksum {
+			t.Status = "KO"
+			failed = append(failed, t.Table)
+		}
+	}
+	for name := range expected {
+		failed = append(failed, name)
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return errors.New("Checksum differs from the backup for " + strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// checksumBackupSource stops the SQL thread of a slave source and records its table checksums in the meta of a
+// logical backup, the dump taken next is at the same position, it returns false when the source is not stopped
+func (server *ServerMonitor) checksumBackupSource(meta *BackupMeta) bool {
+	if !server.ClusterGroup.Conf.BackupChecksumTables {
+		return false
+	}
+	if server.IsMaster() {
+		server.ClusterGroup.LogPrintf(LvlInfo, "No table checksums recorded for the backup of master %s", server.URL)
+		return false
+	}
+	logs, err := server.StopSlaveSQLThread()
+	server.ClusterGroup.LogSQL(logs, err, server.URL, "checksumBackupSource", LvlErr, "Could not stop the SQL thread of %s: %s", server.URL, err)
+	if err != nil {
+		return false
+	}
+	meta.Tables, err = server.getTableChecksums()
+	if err != nil {
+		meta.Tables = nil
+		server.ClusterGroup.LogPrintf(LvlErr, "Could not record the table checksums of the backup of %s: %s", server.URL, err)
+	}
+	return true
+}
+
+// startBackupSource restarts the slave stopped by checksumBackupSource, mysqldump with --dump-slave may already
+// have restarted it
+func (server *ServerMonitor) startBackupSource() {
+	logs, err := server.StartSlave()
+	server.ClusterGroup.LogSQL(logs, err, server.URL, "startBackupSource", LvlErr, "Could not start slave %s: %s", server.URL, err)
+}
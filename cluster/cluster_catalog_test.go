@@ -0,0 +1,199 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/crypto"
+	"github.com/signal18/replication-manager/utils/stream"
+)
+
+func TestCompareBackupTableChecksums(t *testing.T) {
+	recorded := []BackupVerifiedTable{
+		{Table: "app.users", Chunks: 2, Checksum: 100, Status: "OK"},
+		{Table: "app.orders", Chunks: 1, Checksum: 42, Status: "OK"},
+		{Table: "app.logs", Status: "NA"},
+	}
+	restored := []BackupVerifiedTable{
+		{Table: "app.users", Chunks: 2, Checksum: 100, Status: "OK"},
+		{Table: "app.orders", Chunks: 1, Checksum: 42, Status: "OK"},
+		{Table: "app.logs", Status: "NA"},
+	}
+	if err := compareBackupTableChecksums(recorded, restored); err != nil {
+		t.Fatalf("Expected matching checksums, got %s", err)
+	}
+	restored[1].Checksum = 43
+	if err := compareBackupTableChecksums(recorded, restored); err == nil || restored[1].Status != "KO" {
+		t.Fatalf("Expected a differing checksum, got %v %s", err, restored[1].Status)
+	}
+	if err := compareBackupTableChecksums(recorded, restored[:1]); err == nil {
+		t.Fatal("Expected an error for the tables missing from the restore")
+	}
+	if err := compareBackupTableChecksums(nil, restored); err != nil {
+		t.Fatalf("Expected no comparison without recorded checksums, got %s", err)
+	}
+}
+
+func TestBackupDumpFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir += "/"
+	if f := getBackupDumpFile(dir); f != dir+"mysqldump.sql.gz" {
+		t.Fatalf("Expected the gzip dump without backup, got %s", f)
+	}
+	old := time.Now().Add(-time.Hour)
+	for _, name := range []string{"mysqldump.sql.gz", "mysqldump.sql.zst"} {
+		if err := ioutil.WriteFile(dir+name, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(dir+name, old, old)
+		old = old.Add(time.Minute)
+	}
+	if f := getBackupDumpFile(dir); f != dir+"mysqldump.sql.zst" {
+		t.Fatalf("Expected the most recent dump, got %s", f)
+	}
+	if isDumpDirFile("mysqldump.sql.zst") || !isDumpDirFile("db.t1.00000.sql.gz") {
+		t.Fatal("Expected the mysqldump file out of the dump directory files")
+	}
+}
+
+func TestDecryptBackupDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cluster := &Cluster{Conf: config.Config{MonitoringKeyPath: filepath.Join(dir, ".replication-manager.key"), BackupEncryption: stream.EncryptAESGCM}, WorkingDir: dir}
+	if err := crypto.WriteKey(bytes.Repeat([]byte{7}, 16), cluster.Conf.MonitoringKeyPath, false); err != nil {
+		t.Fatal(err)
+	}
+	dump := filepath.Join(dir, "dump")
+	os.Mkdir(dump, 0700)
+	content := map[string][]byte{
+		"db.t1.00000.sql": bytes.Repeat([]byte("INSERT INTO t1 VALUES (1);\n"), 10000),
+		"db.t2.00000.sql": []byte("INSERT INTO t2 VALUES (2);\n"),
+		"db.t3.00000.sql": []byte("INSERT INTO t3 VALUES (3);\n"),
+	}
+	for name, data := range content {
+		if err := ioutil.WriteFile(filepath.Join(dump, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cluster.encryptBackupDir(&BackupMeta{Dest: dump, Tool: config.ConstBackupLogicalTypeMydumper}); err != nil {
+		t.Fatal(err)
+	}
+	tmp, cleanup, err := cluster.decryptBackupDir(dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"db.t1.00000.sql", "db.t2.00000.sql"} {
+		data, err := ioutil.ReadFile(filepath.Join(tmp, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, content[name]) {
+			t.Fatalf("Unexpected decrypted content of %s", name)
+		}
+	}
+	// db.t3 is not read, the cleanup releases its pipe
+	if err := cleanup(); err != nil {
+		t.Fatalf("Expected no decryption error, got %s", err)
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Fatal("Expected the pipes directory removed")
+	}
+}
+
+func TestBackupCatalogCopies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cluster := &Cluster{WorkingDir: dir}
+	cluster.BackupCatalog = backupCatalog{
+		{Id: "b1", Tool: config.ConstBackupLogicalTypeMydumper, Dest: dir, Completed: true},
+		{Id: "b2", Tool: config.ConstBackupLogicalTypeMysqldump, Dest: dir, Completed: false},
+	}
+	meta := cluster.GetLastRestorableBackup()
+	if meta == nil || meta.Id != "b1" {
+		t.Fatalf("Expected the last completed backup b1, got %v", meta)
+	}
+	meta.Completed = false
+	cluster.GetBackupCatalog()[0].Error = "changed"
+	if m := cluster.GetBackupMeta("b1"); m == nil || !m.Completed || m.Error != "" {
+		t.Fatalf("Expected the catalog not changed by its copies, got %v", m)
+	}
+	cluster.setBackupVerification("b1", &BackupVerification{Success: true})
+	if m := cluster.GetBackupMeta("b1"); m.Verification == nil || !m.Verification.Success {
+		t.Fatalf("Expected the verification recorded in the catalog, got %v", m.Verification)
+	}
+}
+
+func xbstreamChunk(path string, data []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("XBSTCK01")
+	b.Write([]byte{0, 'P'})
+	binary.Write(&b, binary.LittleEndian, uint32(len(path)))
+	b.WriteString(path)
+	binary.Write(&b, binary.LittleEndian, uint64(len(data)))
+	binary.Write(&b, binary.LittleEndian, uint64(0))
+	binary.Write(&b, binary.LittleEndian, uint32(0))
+	b.Write(data)
+	return b.Bytes()
+}
+
+func TestXbstreamBinlogInfo(t *testing.T) {
+	var archive []byte
+	archive = append(archive, xbstreamChunk("ibdata1", bytes.Repeat([]byte{1}, 1000))...)
+	archive = append(archive, xbstreamChunk("xtrabackup_binlog_info", []byte("mysql-bin.000003\t1234\t3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,\n4e11fa47-71ca-11e1-9e33-c80aa9429562:1-2\n"))...)
+	b, err := readXbstreamBinlogInfo(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.BinLogFile != "mysql-bin.000003" || b.BinLogPos != 1234 || b.Gtid != "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,4e11fa47-71ca-11e1-9e33-c80aa9429562:1-2" {
+		t.Fatalf("Unexpected binlog coordinates %v", b)
+	}
+	if _, err := readXbstreamBinlogInfo(bytes.NewReader(archive[:1000])); err == nil {
+		t.Fatal("Expected an error without binlog info")
+	}
+}
+
+func TestBackupCoordinatesWriter(t *testing.T) {
+	cluster := &Cluster{}
+	meta := &BackupMeta{Type: ConstBackupTypeLogical}
+	var out bytes.Buffer
+	w := cluster.newBackupCoordinatesWriter(nopWriteCloser{&out}, meta)
+	w.Write([]byte("-- MySQL dump\nCHANGE MASTER TO MASTER_LOG_FILE='mysql-bin.000002', MASTER_LOG_POS=42;\n"))
+	w.Write(bytes.Repeat([]byte("INSERT INTO t VALUES (1);\n"), 1000))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if meta.BinLogFile != "mysql-bin.000002" || meta.BinLogPos != 42 || out.Len() < 26000 {
+		t.Fatalf("Unexpected coordinates %s %d or output of %d bytes", meta.BinLogFile, meta.BinLogPos, out.Len())
+	}
+}
+
+type nopWriteCloser struct {
+	*bytes.Buffer
+}
+
+func (nopWriteCloser) Close() error { return nil }
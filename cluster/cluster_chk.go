@@ -263,7 +263,7 @@ func (cluster *Cluster) isMaxscaleSupectRunning() bool {
 
 func (cluster *Cluster) isFoundCandidateMaster() bool {
 
-	key := cluster.electFailoverCandidate(cluster.slaves, false)
+	key, _ := cluster.electFailoverCandidate(cluster.slaves, cluster.Conf.PrefMaster, false)
 	if key == -1 {
 		cluster.sme.AddState("ERR00032", state.State{ErrType: LvlErr, ErrDesc: fmt.Sprintf(clusterError["ERR00032"]), ErrFrom: "CHECK"})
 		return false
@@ -404,6 +404,15 @@ func (cluster *Cluster) isValidConfig() error {
 		}
 	}
 
+	// Check the delays of the delayed hosts
+	if cluster.Conf.HostsDelayed != "" {
+		for _, entry := range strings.Split(cluster.Conf.HostsDelayed, ",") {
+			if _, _, err := parseDelayedHost(entry, cluster.Conf.HostsDelayedTime); err != nil {
+				cluster.LogPrintf(LvlErr, "Invalid delay in replication-delayed-hosts %s", entry)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -459,23 +468,84 @@ func (cluster *Cluster) CheckTableChecksum(schema string, table string) {
 
 	cluster.LogPrintf(LvlInfo, "Checksum master table %s.%s %s", schema, table, cluster.master.URL)
 
-	Conn, err := cluster.master.GetNewDBConn()
+	err := cluster.master.ChecksumTable(schema, table)
+	if err == errChecksumNoPK {
+		t := cluster.master.DictTables[schema+"."+table]
+		t.Table_sync = "NA"
+		cluster.master.DictTables[schema+"."+table] = t
+		return
+	}
 	if err != nil {
-		cluster.master.ClusterGroup.LogPrintf(LvlErr, "Error connection in exec query no log %s", err)
 		return
 	}
+	cluster.master.Refresh()
+	masterSeq := cluster.master.CurrentGtid.GetSeqServerIdNos(uint64(cluster.master.ServerID))
+	cluster.LogPrintf(LvlInfo, "Wait sync: Master sequence %d", masterSeq)
+
+	for _, s := range cluster.slaves {
+		if !s.IsFailed() && !s.IsReplicationBroken() {
+			for true {
+				slaveSeq := s.SlaveGtid.GetSeqServerIdNos(uint64(cluster.master.ServerID))
+				cluster.LogPrintf(LvlInfo, "Wait sync on slave %s sequence %d", s.URL, slaveSeq)
+				if slaveSeq >= masterSeq {
+					break
+				} else {
+					cluster.SetState("WARN0086", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["WARN0086"], s.URL), ErrFrom: "MON", ServerUrl: s.URL})
+				}
+				time.Sleep(1 * time.Second)
+			}
+
+		}
+	}
+	// check slave result
+	masterChecksums, logs, err := dbhelper.GetTableChecksumResult(cluster.master.Conn)
+	cluster.LogSQL(logs, err, cluster.master.URL, "CheckTableChecksum", LvlDbg, "GetTableChecksumResult")
+	for _, s := range cluster.slaves {
+		slaveChecksums, logs, err := dbhelper.GetTableChecksumResult(s.Conn)
+		cluster.LogSQL(logs, err, s.URL, "CheckTableChecksum", LvlDbg, "GetTableChecksumResult")
+		checkok := true
+		for _, chunk := range masterChecksums {
+			if chunk.ChunkCheckSum != slaveChecksums[chunk.ChunkId].ChunkCheckSum {
+				checkok = false
+				cluster.LogPrintf(LvlInfo, "Checksum table failed chunk(%s,%s) %s.%s %s", chunk.ChunkMinKey, chunk.ChunkMaxKey, schema, table, s.URL)
+				t := cluster.master.DictTables[schema+"."+table]
+				t.Table_sync = "ER"
+				cluster.master.DictTables[schema+"."+table] = t
+			}
+
+		}
+		if checkok {
+			cluster.LogPrintf(LvlInfo, "Checksum table succeed %s.%s %s", schema, table, s.URL)
+			t := cluster.master.DictTables[schema+"."+table]
+			t.Table_sync = "OK"
+			cluster.master.DictTables[schema+"."+table] = t
+		}
+	}
+}
+
+var errChecksumNoPK = errors.New("No primary key")
+
+// ChecksumTable fills replication_manager_schema.table_checksum with the chunk checksums of the table,
+// on a master the statements are replicated to compute the same chunks on the slaves
+func (server *ServerMonitor) ChecksumTable(schema string, table string) error {
+	Conn, err := server.GetNewDBConn()
+	if err != nil {
+		server.ClusterGroup.LogPrintf(LvlErr, "Error connection in exec query no log %s", err)
+		return err
+	}
 	defer Conn.Close()
 	Conn.SetConnMaxLifetime(3595 * time.Second)
-	pk, _ := cluster.master.GetTablePK(schema, table)
+	pk, _ := server.GetTablePK(schema, table)
 	if pk == "" {
-		cluster.master.ClusterGroup.LogPrintf(LvlErr, "Checksum, no primary key for table %s.%s", schema, table)
-		t := cluster.master.DictTables[schema+"."+table]
-		t.Table_sync = "NA"
-		cluster.master.DictTables[schema+"."+table] = t
-		return
+		server.ClusterGroup.LogPrintf(LvlErr, "Checksum, no primary key for table %s.%s", schema, table)
+		return errChecksumNoPK
 	}
 	if strings.Contains(pk, ",") {
-		cluster.master.ClusterGroup.LogPrintf(LvlInfo, "Checksum, composit primary key for table %s.%s", schema, table)
+		server.ClusterGroup.LogPrintf(LvlInfo, "Checksum, composit primary key for table %s.%s", schema, table)
+	}
+	if !server.IsMaster() {
+		// the checksums of a slave are local, writing them to its binlog would add errant transactions
+		Conn.Exec("SET SESSION sql_log_bin = 0")
 	}
 	Conn.Exec("CREATE DATABASE IF NOT EXISTS replication_manager_schema")
 	Conn.Exec("USE replication_manager_schema")
@@ -487,14 +557,14 @@ func (cluster *Cluster) CheckTableChecksum(schema string, table string) {
 	_, err = Conn.Exec(query)
 	Conn.Exec("SET SESSION binlog_format = 'STATEMENT'")
 	if err != nil {
-		cluster.LogPrintf(LvlErr, "ERROR: Could not process chunck %s %s", query, err)
-		return
+		server.ClusterGroup.LogPrintf(LvlErr, "ERROR: Could not process chunck %s %s", query, err)
+		return err
 	}
 	var md5Sum string
 	err = Conn.QueryRowx("SELECT CONCAT( \"SUM(CRC32(CONCAT(\" , GROUP_CONCAT( CONCAT( \"IFNULL(\" , COLUMN_NAME, \",'N')\")),\")))\") as fields FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA ='" + schema + "' AND TABLE_NAME='" + table + "'").Scan(&md5Sum)
 	if err != nil {
-		cluster.LogPrintf(LvlErr, "ERROR: Could not get SQL md5Sum", err)
-		return
+		server.ClusterGroup.LogPrintf(LvlErr, "ERROR: Could not get SQL md5Sum", err)
+		return err
 	}
 
 	// build predicate iterating over each pk columns
@@ -519,22 +589,22 @@ func (cluster *Cluster) CheckTableChecksum(schema string, table string) {
 		query := "INSERT INTO replication_manager_schema.table_checksum SELECT chunkId, chunkMinKey , chunkMaxKey," + md5Sum + " as chunkCheckSum FROM " + schema + "." + table + " A inner join (select * from replication_manager_schema.table_chunck limit 1) B on " + predicate
 		_, err := Conn.Exec(query)
 		if err != nil {
-			cluster.LogPrintf(LvlErr, "ERROR: Could not process chunck %s %s", query, err)
-			return
+			server.ClusterGroup.LogPrintf(LvlErr, "ERROR: Could not process chunck %s %s", query, err)
+			return err
 		}
 		res, err2 := Conn.Exec("DELETE FROM replication_manager_schema.table_chunck limit 1")
 		if err2 != nil {
-			cluster.LogPrintf(LvlErr, "Checksum error deleting chunck %s", err)
-			return
+			server.ClusterGroup.LogPrintf(LvlErr, "Checksum error deleting chunck %s", err)
+			return err2
 		}
 
 		i, err3 := res.RowsAffected()
 		if err3 != nil {
-			cluster.LogPrintf(LvlErr, "Checksum can't fetch rows affected ", err)
-			return
+			server.ClusterGroup.LogPrintf(LvlErr, "Checksum can't fetch rows affected ", err)
+			return err3
 		}
 		if i == 0 {
-			cluster.LogPrintf(LvlInfo, "Finished checksum table %s.%s", schema, table)
+			server.ClusterGroup.LogPrintf(LvlInfo, "Finished checksum table %s.%s", schema, table)
 			break
 		}
 		/*	slave := cluster.GetFirstWorkingSlave()
@@ -544,49 +614,7 @@ func (cluster *Cluster) CheckTableChecksum(schema string, table string) {
 				}
 			}*/
 	}
-	cluster.master.Refresh()
-	masterSeq := cluster.master.CurrentGtid.GetSeqServerIdNos(uint64(cluster.master.ServerID))
-	cluster.LogPrintf(LvlInfo, "Wait sync: Master sequence %d", masterSeq)
-
-	for _, s := range cluster.slaves {
-		if !s.IsFailed() && !s.IsReplicationBroken() {
-			for true {
-				slaveSeq := s.SlaveGtid.GetSeqServerIdNos(uint64(cluster.master.ServerID))
-				cluster.LogPrintf(LvlInfo, "Wait sync on slave %s sequence %d", s.URL, slaveSeq)
-				if slaveSeq >= masterSeq {
-					break
-				} else {
-					cluster.SetState("WARN0086", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["WARN0086"], s.URL), ErrFrom: "MON", ServerUrl: s.URL})
-				}
-				time.Sleep(1 * time.Second)
-			}
-
-		}
-	}
-	// check slave result
-	masterChecksums, logs, err := dbhelper.GetTableChecksumResult(cluster.master.Conn)
-	cluster.LogSQL(logs, err, cluster.master.URL, "CheckTableChecksum", LvlDbg, "GetTableChecksumResult")
-	for _, s := range cluster.slaves {
-		slaveChecksums, logs, err := dbhelper.GetTableChecksumResult(s.Conn)
-		cluster.LogSQL(logs, err, s.URL, "CheckTableChecksum", LvlDbg, "GetTableChecksumResult")
-		checkok := true
-		for _, chunk := range masterChecksums {
-			if chunk.ChunkCheckSum != slaveChecksums[chunk.ChunkId].ChunkCheckSum {
-				checkok = false
-				cluster.LogPrintf(LvlInfo, "Checksum table failed chunk(%s,%s) %s.%s %s", chunk.ChunkMinKey, chunk.ChunkMaxKey, schema, table, s.URL)
-				t := cluster.master.DictTables[schema+"."+table]
-				t.Table_sync = "ER"
-				cluster.master.DictTables[schema+"."+table] = t
-			}
-
-		}
-		if checkok {
-			cluster.LogPrintf(LvlInfo, "Checksum table succeed %s.%s %s", schema, table, s.URL)
-			t := cluster.master.DictTables[schema+"."+table]
-			t.Table_sync = "OK"
-			cluster.master.DictTables[schema+"."+table] = t
-		}
-	}
+	return nil
 }
 
 //CheckSameServerID Check against the servers that all server id are differents
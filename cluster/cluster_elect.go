@@ -0,0 +1,354 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ElectionRule scores an election candidate between 0 and 1, the score is multiplied by the rule weight
+type ElectionRule interface {
+	Name() string
+	Score(cluster *Cluster, sl *ServerMonitor, candidates []*ServerMonitor) float64
+}
+
+// ElectionScore is the per rule score breakdown of a candidate
+type ElectionScore struct {
+	URL   string             `json:"url"`
+	Score float64            `json:"score"`
+	Rules map[string]float64 `json:"rules"`
+}
+
+var electionRulesMutex sync.Mutex
+
+var electionRules = map[string]ElectionRule{
+	"lag":        electionRuleLag{},
+	"datacenter": electionRuleDatacenter{},
+	"hardware":   electionRuleHardware{},
+	"semisync":   electionRuleSemiSync{},
+	"relaylog":   electionRuleRelayLog{},
+	"weight":     electionRuleWeight{},
+}
+
+// RegisterElectionRule makes a rule usable by name in failover-election-rules
+func RegisterElectionRule(rule ElectionRule) {
+	electionRulesMutex.Lock()
+	defer electionRulesMutex.Unlock()
+	electionRules[rule.Name()] = rule
+}
+
+func getElectionRule(name string) ElectionRule {
+	electionRulesMutex.Lock()
+	defer electionRulesMutex.Unlock()
+	return electionRules[name]
+}
+
+// GetElectionRuleWeights parse failover-election-rules in the rule:weight format
+func (cluster *Cluster) GetElectionRuleWeights() map[string]float64 {
+	weights := make(map[string]float64)
+	for _, r := range strings.Split(cluster.Conf.FailElectionRules, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		name := r
+		weight := float64(1)
+		if i := strings.Index(r, ":"); i > 0 {
+			name = r[:i]
+			w, err := strconv.ParseFloat(r[i+1:], 64)
+			if err != nil {
+				cluster.LogPrintf(LvlWarn, "Election rule %s has invalid weight: %s", name, err)
+				continue
+			}
+			weight = w
+		}
+		if getElectionRule(name) == nil {
+			cluster.LogPrintf(LvlWarn, "Election rule %s is not registered", name)
+			continue
+		}
+		weights[name] = weight
+	}
+	return weights
+}
+
+// GetElectionScores returns the candidates sorted by descending weighted score
+func (cluster *Cluster) GetElectionScores(candidates []*ServerMonitor) []ElectionScore {
+	weights := cluster.GetElectionRuleWeights()
+	scores := make([]ElectionScore, 0, len(candidates))
+	for _, sl := range candidates {
+		es := ElectionScore{URL: sl.URL, Rules: make(map[string]float64)}
+		for name, weight := range weights {
+			s := getElectionRule(name).Score(cluster, sl, candidates) * weight
+			es.Rules[name] = s
+			es.Score += s
+		}
+		scores = append(scores, es)
+	}
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].Score > scores[j].Score
+	})
+	return scores
+}
+
+// GetElectionCandidatesScores scores the electable slaves of the cluster without running an election
+func (cluster *Cluster) GetElectionCandidatesScores() []ElectionScore {
+	var candidates []*ServerMonitor
+	for _, sl := range cluster.slaves {
+		if sl.IsIgnored() || sl.IsRelay || !cluster.isSlaveElectable(sl, false) {
+			continue
+		}
+		candidates = append(candidates, sl)
+	}
+	return cluster.GetElectionScores(candidates)
+}
+
+// electByScore returns the key in l of the best scored candidate among keys or -1 and the scores, they are
+// logged when forcingLog is set by a failover or a switchover
+func (cluster *Cluster) electByScore(l []*ServerMonitor, keys []int, forcingLog bool) (int, []ElectionScore) {
+	if len(keys) == 0 {
+		return -1, nil
+	}
+	var candidates []*ServerMonitor
+	for _, k := range keys {
+		candidates = append(candidates, l[k])
+	}
+	scores := cluster.GetElectionScores(candidates)
+	if forcingLog {
+		data, _ := json.MarshalIndent(scores, "", "\t")
+		cluster.LogPrintf(LvlInfo, "Election scores: %s ", data)
+	}
+	for _, k := range keys {
+		if l[k].URL == scores[0].URL {
+			return k, scores
+		}
+	}
+	return -1, scores
+}
+
+// setElectionScores records the scores of a failover or a switchover election, the checks and the plans
+// elect without recording them
+func (cluster *Cluster) setElectionScores(scores []ElectionScore) {
+	cluster.electionScoresMutex.Lock()
+	defer cluster.electionScoresMutex.Unlock()
+	cluster.electionScores = scores
+}
+
+// GetLastElectionScores returns a copy of the scores of the last scored election
+func (cluster *Cluster) GetLastElectionScores() []ElectionScore {
+	cluster.electionScoresMutex.Lock()
+	defer cluster.electionScoresMutex.Unlock()
+	return append([]ElectionScore(nil), cluster.electionScores...)
+}
+
+// GetElectionDatacenter returns the datacenter to prefer in election
+func (cluster *Cluster) GetElectionDatacenter() string {
+	if cluster.Conf.FailElectionDatacenter != "" {
+		return cluster.Conf.FailElectionDatacenter
+	}
+	if cluster.master != nil {
+		return cluster.master.GetElectionDatacenter()
+	}
+	return ""
+}
+
+func (server *ServerMonitor) getElectionServerValue(list string) string {
+	for _, hv := range strings.Split(list, ",") {
+		i := strings.LastIndex(hv, "=")
+		if i < 0 {
+			continue
+		}
+		host := strings.TrimSpace(hv[:i])
+		if host == server.URL || host == server.Name || host == server.Host {
+			return strings.TrimSpace(hv[i+1:])
+		}
+	}
+	return ""
+}
+
+// GetElectionDatacenter returns the datacenter of the server from failover-election-server-datacenters, or
+// its tag naming failover-election-datacenter
+func (server *ServerMonitor) GetElectionDatacenter() string {
+	if dc := server.getElectionServerValue(server.ClusterGroup.Conf.FailElectionServerDatacenters); dc != "" {
+		return dc
+	}
+	if dc := server.ClusterGroup.Conf.FailElectionDatacenter; dc != "" && server.HaveTag(dc) {
+		return dc
+	}
+	return ""
+}
+
+// GetTags returns the tags of the server from db-servers-tags
+func (server *ServerMonitor) GetTags() []string {
+	return strings.Fields(server.getElectionServerValue(server.ClusterGroup.Conf.DBServersTags))
+}
+
+// HaveTag returns true when the server has a tag in db-servers-tags
+func (server *ServerMonitor) HaveTag(tag string) bool {
+	for _, t := range server.GetTags() {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// GetElectionWeight returns the custom weight of the server from failover-election-server-weights
+func (server *ServerMonitor) GetElectionWeight() float64 {
+	w, _ := strconv.ParseFloat(server.getElectionServerValue(server.ClusterGroup.Conf.FailElectionServerWeights), 64)
+	return w
+}
+
+func (server *ServerMonitor) getElectionDelay() int64 {
+	ss, err := server.GetSlaveStatus(server.ReplicationSourceName)
+	if err != nil {
+		return 0
+	}
+	return ss.SecondsBehindMaster.Int64
+}
+
+type electionRuleLag struct{}
+
+func (electionRuleLag) Name() string { return "lag" }
+
+func (electionRuleLag) Score(cluster *Cluster, sl *ServerMonitor, candidates []*ServerMonitor) float64 {
+	var max int64
+	for _, c := range candidates {
+		if d := c.getElectionDelay(); d > max {
+			max = d
+		}
+	}
+	if max == 0 {
+		return 1
+	}
+	return 1 - float64(sl.getElectionDelay())/float64(max)
+}
+
+type electionRuleDatacenter struct{}
+
+func (electionRuleDatacenter) Name() string { return "datacenter" }
+
+func (electionRuleDatacenter) Score(cluster *Cluster, sl *ServerMonitor, candidates []*ServerMonitor) float64 {
+	if dc := cluster.GetElectionDatacenter(); dc != "" {
+		if sl.GetElectionDatacenter() == dc {
+			return 1
+		}
+		return 0
+	}
+	// without datacenter the candidates sharing the tags of the old master are the closest to it
+	if cluster.master == nil {
+		return 0
+	}
+	return getElectionTagsAffinity(cluster.master.GetTags(), sl.GetTags())
+}
+
+// getElectionTagsAffinity returns the share of the reference tags found in tags
+func getElectionTagsAffinity(ref []string, tags []string) float64 {
+	if len(ref) == 0 {
+		return 0
+	}
+	var n int
+	for _, r := range ref {
+		for _, t := range tags {
+			if r == t {
+				n++
+				break
+			}
+		}
+	}
+	return float64(n) / float64(len(ref))
+}
+
+type electionRuleHardware struct{}
+
+func (electionRuleHardware) Name() string { return "hardware" }
+
+func (electionRuleHardware) getAgent(cluster *Cluster, sl *ServerMonitor) *Agent {
+	for k, a := range cluster.Agents {
+		if a.HostName == sl.Host || a.HostName == sl.Name {
+			return &cluster.Agents[k]
+		}
+	}
+	return nil
+}
+
+func (r electionRuleHardware) Score(cluster *Cluster, sl *ServerMonitor, candidates []*ServerMonitor) float64 {
+	var maxCpu, maxMem int64
+	for _, c := range candidates {
+		if a := r.getAgent(cluster, c); a != nil {
+			if a.CpuCores > maxCpu {
+				maxCpu = a.CpuCores
+			}
+			if a.MemBytes > maxMem {
+				maxMem = a.MemBytes
+			}
+		}
+	}
+	a := r.getAgent(cluster, sl)
+	if a == nil {
+		return 0
+	}
+	var score float64
+	if maxCpu > 0 {
+		score += 0.5 * float64(a.CpuCores) / float64(maxCpu)
+	}
+	if maxMem > 0 {
+		score += 0.5 * float64(a.MemBytes) / float64(maxMem)
+	}
+	return score
+}
+
+type electionRuleSemiSync struct{}
+
+func (electionRuleSemiSync) Name() string { return "semisync" }
+
+func (electionRuleSemiSync) Score(cluster *Cluster, sl *ServerMonitor, candidates []*ServerMonitor) float64 {
+	if sl.HaveSemiSync && sl.SemiSyncSlaveStatus {
+		return 1
+	}
+	return 0
+}
+
+type electionRuleRelayLog struct{}
+
+func (electionRuleRelayLog) Name() string { return "relaylog" }
+
+func (electionRuleRelayLog) Score(cluster *Cluster, sl *ServerMonitor, candidates []*ServerMonitor) float64 {
+	var max uint64
+	for _, c := range candidates {
+		if c.RelayLogSize > max {
+			max = c.RelayLogSize
+		}
+	}
+	if max == 0 {
+		return 1
+	}
+	return 1 - float64(sl.RelayLogSize)/float64(max)
+}
+
+type electionRuleWeight struct{}
+
+func (electionRuleWeight) Name() string { return "weight" }
+
+func (electionRuleWeight) Score(cluster *Cluster, sl *ServerMonitor, candidates []*ServerMonitor) float64 {
+	var max float64
+	for _, c := range candidates {
+		if w := c.GetElectionWeight(); w > max {
+			max = w
+		}
+	}
+	if max <= 0 {
+		return 0
+	}
+	return sl.GetElectionWeight() / max
+}
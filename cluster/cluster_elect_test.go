@@ -0,0 +1,129 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+)
+
+func newElectionTestCluster(conf config.Config, urls ...string) (*Cluster, []*ServerMonitor) {
+	cluster := &Cluster{Conf: conf}
+	var servers []*ServerMonitor
+	for _, url := range urls {
+		servers = append(servers, &ServerMonitor{URL: url, Host: url[:len(url)-5], ClusterGroup: cluster})
+	}
+	return cluster, servers
+}
+
+func TestElectionRuleWeights(t *testing.T) {
+	cluster := &Cluster{Conf: config.Config{FailElectionRules: "lag:10, datacenter ,weight:0.5"}}
+	weights := cluster.GetElectionRuleWeights()
+	for name, weight := range map[string]float64{"lag": 10, "datacenter": 1, "weight": 0.5} {
+		if weights[name] != weight {
+			t.Fatalf("Expected rule %s weight %v, got %v", name, weight, weights[name])
+		}
+	}
+	if len(weights) != 3 {
+		t.Fatalf("Expected 3 rules, got %v", weights)
+	}
+}
+
+func TestElectionRuleLag(t *testing.T) {
+	cluster, servers := newElectionTestCluster(config.Config{}, "db1:3306", "db2:3306", "db3:3306")
+	for i, delay := range []int64{0, 5, 10} {
+		servers[i].Replications = []dbhelper.SlaveStatus{{SecondsBehindMaster: sql.NullInt64{Int64: delay, Valid: true}}}
+	}
+	for i, score := range []float64{1, 0.5, 0} {
+		if s := (electionRuleLag{}).Score(cluster, servers[i], servers); s != score {
+			t.Fatalf("Expected %s lag score %v, got %v", servers[i].URL, score, s)
+		}
+	}
+	if s := (electionRuleLag{}).Score(cluster, servers[0], servers[:1]); s != 1 {
+		t.Fatalf("Expected lag score 1 without delay, got %v", s)
+	}
+}
+
+func TestElectionRuleDatacenter(t *testing.T) {
+	for _, c := range []struct {
+		conf   config.Config
+		scores []float64
+	}{
+		{config.Config{FailElectionServerDatacenters: "db1:3306=paris,db2:3306=paris,db3:3306=lyon"}, []float64{1, 0}},
+		{config.Config{FailElectionDatacenter: "lyon", FailElectionServerDatacenters: "db3:3306=lyon"}, []float64{0, 1}},
+		{config.Config{FailElectionDatacenter: "lyon", DBServersTags: "db2:3306=ssd,db3=lyon ssd"}, []float64{0, 1}},
+		{config.Config{DBServersTags: "db1=rack1 ssd,db2=rack1 ssd,db3=ssd"}, []float64{1, 0.5}},
+		{config.Config{DBServersTags: "db2=rack1"}, []float64{0, 0}},
+	} {
+		cluster, servers := newElectionTestCluster(c.conf, "db1:3306", "db2:3306", "db3:3306")
+		cluster.master = servers[0]
+		for i, score := range c.scores {
+			if s := (electionRuleDatacenter{}).Score(cluster, servers[i+1], servers[1:]); s != score {
+				t.Fatalf("Expected %s datacenter score %v with %+v, got %v", servers[i+1].URL, score, c.conf, s)
+			}
+		}
+	}
+}
+
+func TestElectionRuleWeight(t *testing.T) {
+	cluster, servers := newElectionTestCluster(config.Config{FailElectionServerWeights: "db1:3306=10,db2=5"}, "db1:3306", "db2:3306", "db3:3306")
+	for i, score := range []float64{1, 0.5, 0} {
+		if s := (electionRuleWeight{}).Score(cluster, servers[i], servers); s != score {
+			t.Fatalf("Expected %s weight score %v, got %v", servers[i].URL, score, s)
+		}
+	}
+	if s := (electionRuleWeight{}).Score(cluster, servers[2], servers[2:]); s != 0 {
+		t.Fatalf("Expected weight score 0 without weights, got %v", s)
+	}
+}
+
+func TestElectionRuleRelayLogAndSemiSync(t *testing.T) {
+	cluster, servers := newElectionTestCluster(config.Config{}, "db1:3306", "db2:3306")
+	servers[0].RelayLogSize = 100
+	servers[1].HaveSemiSync = true
+	servers[1].SemiSyncSlaveStatus = true
+	if s := (electionRuleRelayLog{}).Score(cluster, servers[0], servers); s != 0 {
+		t.Fatalf("Expected relaylog score 0 for the largest backlog, got %v", s)
+	}
+	if s := (electionRuleRelayLog{}).Score(cluster, servers[1], servers); s != 1 {
+		t.Fatalf("Expected relaylog score 1 without backlog, got %v", s)
+	}
+	if (electionRuleSemiSync{}).Score(cluster, servers[0], servers) != 0 || (electionRuleSemiSync{}).Score(cluster, servers[1], servers) != 1 {
+		t.Fatal("Expected semisync score only for the semisync slave")
+	}
+}
+
+func TestElectionScores(t *testing.T) {
+	cluster, servers := newElectionTestCluster(config.Config{
+		FailElectionRules:             "datacenter:50,weight:10",
+		FailElectionDatacenter:        "paris",
+		FailElectionServerDatacenters: "db2:3306=paris",
+		FailElectionServerWeights:     "db1:3306=10,db2:3306=1",
+	}, "db1:3306", "db2:3306", "db3:3306")
+	scores := cluster.GetElectionScores(servers)
+	for i, url := range []string{"db2:3306", "db1:3306", "db3:3306"} {
+		if scores[i].URL != url {
+			t.Fatalf("Expected %s ranked %d, got %+v", url, i, scores)
+		}
+	}
+	if scores[0].Score != 51 || scores[0].Rules["datacenter"] != 50 || scores[0].Rules["weight"] != 1 {
+		t.Fatalf("Expected db2:3306 scored 51 with its rules breakdown, got %+v", scores[0])
+	}
+	key, elected := cluster.electByScore(servers, []int{0, 2}, false)
+	if key != 0 || len(elected) != 2 || elected[0].URL != "db1:3306" {
+		t.Fatalf("Expected db1:3306 elected among db1:3306 and db3:3306, got %d %+v", key, elected)
+	}
+	if last := cluster.GetLastElectionScores(); len(last) != 0 {
+		t.Fatalf("Expected the scores recorded only by a failover or a switchover, got %+v", last)
+	}
+}
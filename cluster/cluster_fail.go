@@ -31,6 +31,9 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 		return res
 	}
 	cluster.sme.SetFailoverState()
+	event := cluster.newFailoverEvent(fail)
+	success := false
+	defer func() { cluster.closeFailoverEvent(event, success) }()
 	// Phase 1: Cleanup and election
 	var err error
 	if fail == false {
@@ -40,16 +43,20 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 		cluster.LogPrintf(LvlInfo, "Checking long running updates on master %d", cluster.Conf.SwitchWaitWrite)
 		if cluster.master == nil {
 			cluster.LogPrintf(LvlErr, "Cannot switchover without a master")
+			event.setError("Cannot switchover without a master")
 			return false
 		}
 		if cluster.master.Conn == nil {
 			cluster.LogPrintf(LvlErr, "Cannot switchover without a master connection")
+			event.setError("Cannot switchover without a master connection")
 			return false
 		}
 		qt, logs, err := dbhelper.CheckLongRunningWrites(cluster.master.Conn, cluster.Conf.SwitchWaitWrite)
 		cluster.LogSQL(logs, err, cluster.master.URL, "MasterFailover", LvlDbg, "CheckLongRunningWrites")
+		event.addStep("cleanup", cluster.master.URL, "CheckLongRunningWrites", err)
 		if qt > 0 {
 			cluster.LogPrintf(LvlErr, "Long updates running on master. Cannot switchover")
+			event.setError("Long updates running on master")
 			cluster.sme.RemoveFailoverState()
 			return false
 		}
@@ -79,8 +86,10 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 			if err != nil {
 				cluster.LogPrintf(LvlWarn, "Could not flush tables on master", err)
 			}
+			event.addStep("cleanup", cluster.master.URL, "FlushTablesNoLog", err)
 		case <-time.After(time.Second * time.Duration(cluster.Conf.SwitchWaitTrx)):
 			cluster.LogPrintf(LvlErr, "Long running trx on master at least %d, can not switchover ", cluster.Conf.SwitchWaitTrx)
+			event.setError("Long running trx on master at least %d", cluster.Conf.SwitchWaitTrx)
 			cluster.sme.RemoveFailoverState()
 			return false
 		}
@@ -94,21 +103,28 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 	for _, s := range cluster.slaves {
 		s.Refresh()
 	}
+	event.setSlavesBefore(cluster.slaves)
 	key := -1
+	var scores []ElectionScore
 	if fail {
-		key = cluster.electFailoverCandidate(cluster.slaves, true)
+		key, scores = cluster.electFailoverCandidate(cluster.slaves, cluster.Conf.PrefMaster, true)
 	} else {
-		key = cluster.electSwitchoverCandidate(cluster.slaves, true)
+		key, scores = cluster.electSwitchoverCandidate(cluster.slaves, cluster.Conf.PrefMaster, true)
 	}
+	cluster.setElectionScores(scores)
 	if key == -1 {
 		cluster.LogPrintf(LvlErr, "No candidates found")
+		event.setError("No candidates found")
 		cluster.sme.RemoveFailoverState()
 		return false
 	}
 
 	cluster.LogPrintf(LvlInfo, "Slave %s has been elected as a new master", cluster.slaves[key].URL)
+	cluster.setFailoverElection(event, cluster.slaves[key], scores)
+	event.addStep("election", cluster.slaves[key].URL, "ElectNewMaster", nil)
 	if fail && !cluster.isSlaveElectable(cluster.slaves[key], true) {
 		cluster.LogPrintf(LvlInfo, "Elected slave have issue cancelling failover", cluster.slaves[key].URL)
+		event.setError("Elected slave have issue cancelling failover")
 		cluster.sme.RemoveFailoverState()
 		return false
 	}
@@ -135,10 +151,13 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 			cluster.LogPrintf(LvlErr, "%s", err)
 		}
 		cluster.LogPrintf(LvlInfo, "Pre-failover script complete:", string(out))
+		event.addStep("election", "", "PreFailoverScript", err)
 	}
 
 	// Phase 2: Reject updates and sync slaves on switchover
 	if fail == false {
+		cluster.pauseMyProxies()
+		defer cluster.resumeMyProxies()
 		if cluster.Conf.FailEventStatus {
 			for _, v := range cluster.master.EventStatus {
 				if v.Status == 3 {
@@ -155,8 +174,10 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 		}
 		cluster.oldMaster.freeze()
 		cluster.LogPrintf(LvlInfo, "Rejecting updates on %s (old master)", cluster.oldMaster.URL)
+		event.setWriteUnavailable()
 		logs, err := dbhelper.FlushTablesWithReadLock(cluster.oldMaster.Conn, cluster.oldMaster.DBVersion)
 		cluster.LogSQL(logs, err, cluster.oldMaster.URL, "MasterFailover", LvlErr, "Could not lock tables on %s (old master) %s", cluster.oldMaster.URL, err)
+		event.addStep("reject", cluster.oldMaster.URL, "FlushTablesWithReadLock", err)
 
 	}
 	// Sync candidate depending on the master status.
@@ -183,6 +204,7 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 	if err != nil {
 		cluster.LogPrintf(LvlErr, "Error while reading relay logs on candidate: %s", err)
 	}
+	event.addStep("sync", cluster.master.URL, "ReadAllRelayLogs", err)
 	cluster.LogPrintf(LvlDbg, "Save replication status before electing")
 	ms, err := cluster.master.GetSlaveStatus(cluster.master.ReplicationSourceName)
 	if err != nil {
@@ -252,6 +274,7 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 		if cluster.master.DBVersion.IsMariaDB() || (cluster.master.DBVersion.IsMariaDB() == false && cluster.master.DBVersion.Minor < 7) {
 			logs, err := cluster.master.StopSlave()
 			cluster.LogSQL(logs, err, cluster.master.URL, "MasterFailover", LvlErr, "Failed stopping slave on new master %s %s", cluster.master.URL, err)
+			event.addStep("prepare", cluster.master.URL, "StopSlave", err)
 		}
 	}
 	cluster.Crashes = append(cluster.Crashes, crash)
@@ -268,6 +291,7 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 			cluster.LogPrintf(LvlErr, "%s", err)
 		}
 		cluster.LogPrintf(LvlInfo, "Post-failover script complete", string(out))
+		event.addStep("prepare", "", "PostFailoverScript", err)
 	}
 
 	if cluster.Conf.MultiMaster == false {
@@ -280,6 +304,7 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 
 		logs, err := cluster.master.ResetSlave()
 		cluster.LogSQL(logs, err, cluster.master.URL, "MasterFailover", LvlErr, "Failed reset slave on new master %s %s", cluster.master.URL, err)
+		event.addStep("prepare", cluster.master.URL, "ResetSlave", err)
 	}
 	if fail == false {
 		// Get Fresh GTID pos before open traffic
@@ -289,10 +314,18 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 	if err != nil {
 		cluster.LogPrintf(LvlErr, "Could not set new master as read-write")
 	}
+	event.addStep("prepare", cluster.master.URL, "SetReadWrite", err)
 	cluster.LogPrintf(LvlInfo, "Failover proxies")
 	cluster.failoverProxies()
+	for _, pr := range cluster.Proxies {
+		event.addProxy(pr)
+	}
+	event.setWriteAvailable()
 	cluster.LogPrintf(LvlInfo, "Waiting %ds for unmanaged proxy to monitor route change", cluster.Conf.SwitchSlaveWaitRouteChange)
 	time.Sleep(time.Duration(cluster.Conf.SwitchSlaveWaitRouteChange) * time.Second)
+	if fail == false {
+		cluster.resumeMyProxies()
+	}
 	if cluster.Conf.FailEventScheduler {
 		cluster.LogPrintf(LvlInfo, "Enable Event Scheduler on the new master")
 		logs, err := dbhelper.SetEventScheduler(cluster.master.Conn, true, cluster.master.DBVersion)
@@ -311,6 +344,7 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 	cluster.LogPrintf(LvlInfo, "Inject fake transaction on new master %s ", cluster.master.URL)
 	logs, err := dbhelper.FlushTables(cluster.master.Conn)
 	cluster.LogSQL(logs, err, cluster.master.URL, "MasterFailover", LvlErr, "Could not flush tables on new master for fake trx %s", err)
+	event.addStep("prepare", cluster.master.URL, "FlushTables", err)
 
 	if fail == false {
 		// Get latest GTID pos
@@ -352,7 +386,7 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 				SSL:         cluster.Conf.ReplicationSSL,
 				Channel:     cluster.Conf.MasterConn,
 				IsDelayed:   cluster.oldMaster.IsDelayed,
-				Delay:       strconv.Itoa(cluster.oldMaster.ClusterGroup.Conf.HostsDelayedTime),
+				Delay:       strconv.Itoa(cluster.oldMaster.GetReplicationDelayedTime()),
 				PostgressDB: cluster.master.PostgressDB,
 			}, cluster.oldMaster.DBVersion)
 			cluster.LogSQL(logs, changeMasterErr, cluster.oldMaster.URL, "MasterFailover", LvlErr, "Change master failed on old master, reason:%s ", changeMasterErr)
@@ -374,7 +408,7 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 				SSL:         cluster.Conf.ReplicationSSL,
 				Channel:     cluster.Conf.MasterConn,
 				IsDelayed:   cluster.oldMaster.IsDelayed,
-				Delay:       strconv.Itoa(cluster.oldMaster.ClusterGroup.Conf.HostsDelayedTime),
+				Delay:       strconv.Itoa(cluster.oldMaster.GetReplicationDelayedTime()),
 				PostgressDB: cluster.master.PostgressDB,
 			}, cluster.oldMaster.DBVersion)
 			cluster.LogSQL(logs, changeMasterErr, cluster.oldMaster.URL, "MasterFailover", LvlErr, "Change master failed on old master %s", logs)
@@ -396,7 +430,7 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 					SSL:         cluster.Conf.ReplicationSSL,
 					Channel:     cluster.Conf.MasterConn,
 					IsDelayed:   cluster.oldMaster.IsDelayed,
-					Delay:       strconv.Itoa(cluster.oldMaster.ClusterGroup.Conf.HostsDelayedTime),
+					Delay:       strconv.Itoa(cluster.oldMaster.GetReplicationDelayedTime()),
 					PostgressDB: cluster.master.PostgressDB,
 				}, cluster.oldMaster.DBVersion)
 			} else {
@@ -411,7 +445,7 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 					SSL:         cluster.Conf.ReplicationSSL,
 					Channel:     cluster.Conf.MasterConn,
 					IsDelayed:   cluster.oldMaster.IsDelayed,
-					Delay:       strconv.Itoa(cluster.oldMaster.ClusterGroup.Conf.HostsDelayedTime),
+					Delay:       strconv.Itoa(cluster.oldMaster.GetReplicationDelayedTime()),
 					PostgressDB: cluster.master.PostgressDB,
 				}, cluster.oldMaster.DBVersion)
 			}
@@ -434,7 +468,7 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 					SSL:         cluster.Conf.ReplicationSSL,
 					Channel:     cluster.Conf.MasterConn,
 					IsDelayed:   cluster.oldMaster.IsDelayed,
-					Delay:       strconv.Itoa(cluster.oldMaster.ClusterGroup.Conf.HostsDelayedTime),
+					Delay:       strconv.Itoa(cluster.oldMaster.GetReplicationDelayedTime()),
 					PostgressDB: relaymaster.PostgressDB,
 				}, cluster.oldMaster.DBVersion)
 			} else {
@@ -451,12 +485,17 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 					SSL:         cluster.Conf.ReplicationSSL,
 					Channel:     cluster.Conf.MasterConn,
 					IsDelayed:   cluster.oldMaster.IsDelayed,
-					Delay:       strconv.Itoa(cluster.oldMaster.ClusterGroup.Conf.HostsDelayedTime),
+					Delay:       strconv.Itoa(cluster.oldMaster.GetReplicationDelayedTime()),
 					PostgressDB: relaymaster.PostgressDB,
 				}, cluster.oldMaster.DBVersion)
 			}
 		}
 		cluster.LogSQL(logs, err, cluster.oldMaster.URL, "MasterFailover", LvlErr, "Change master failed on old master %s", err)
+		if changeMasterErr != nil {
+			event.addStep("demote", cluster.oldMaster.URL, "ChangeMaster", changeMasterErr)
+		} else {
+			event.addStep("demote", cluster.oldMaster.URL, "ChangeMaster", err)
+		}
 
 		if cluster.Conf.ReadOnly {
 			logs, err = dbhelper.SetReadOnly(cluster.oldMaster.Conn, true)
@@ -543,7 +582,7 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 					SSL:         cluster.Conf.ReplicationSSL,
 					Channel:     cluster.Conf.MasterConn,
 					IsDelayed:   sl.IsDelayed,
-					Delay:       strconv.Itoa(sl.ClusterGroup.Conf.HostsDelayedTime),
+					Delay:       strconv.Itoa(sl.GetReplicationDelayedTime()),
 					PostgressDB: cluster.master.PostgressDB,
 				}, sl.DBVersion)
 			} else {
@@ -563,7 +602,7 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 				SSL:         cluster.Conf.ReplicationSSL,
 				Channel:     cluster.Conf.MasterConn,
 				IsDelayed:   sl.IsDelayed,
-				Delay:       strconv.Itoa(sl.ClusterGroup.Conf.HostsDelayedTime),
+				Delay:       strconv.Itoa(sl.GetReplicationDelayedTime()),
 				PostgressDB: cluster.master.PostgressDB,
 			}, sl.DBVersion)
 		} else if cluster.Conf.MxsBinlogOn == false {
@@ -580,7 +619,7 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 				SSL:         cluster.Conf.ReplicationSSL,
 				Channel:     cluster.Conf.MasterConn,
 				IsDelayed:   sl.IsDelayed,
-				Delay:       strconv.Itoa(sl.ClusterGroup.Conf.HostsDelayedTime),
+				Delay:       strconv.Itoa(sl.GetReplicationDelayedTime()),
 				PostgressDB: cluster.master.PostgressDB,
 			}, sl.DBVersion)
 		} else { // We deduct we are in maxscale binlog server , but can have support for GTID or not
@@ -598,7 +637,7 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 					SSL:         cluster.Conf.ReplicationSSL,
 					Channel:     cluster.Conf.MasterConn,
 					IsDelayed:   sl.IsDelayed,
-					Delay:       strconv.Itoa(sl.ClusterGroup.Conf.HostsDelayedTime),
+					Delay:       strconv.Itoa(sl.GetReplicationDelayedTime()),
 					PostgressDB: cluster.master.PostgressDB,
 				}, sl.DBVersion)
 			} else {
@@ -615,8 +654,10 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 			}
 		}
 		cluster.LogSQL(logs, changeMasterErr, sl.URL, "MasterFailover", LvlErr, "Change master failed on slave %s, %s", sl.URL, changeMasterErr)
+		event.addStep("slaves", sl.URL, "ChangeMaster", changeMasterErr)
 		logs, err = sl.StartSlave()
 		cluster.LogSQL(logs, err, sl.URL, "MasterFailover", LvlErr, "Could not start slave on server %s, %s", sl.URL, err)
+		event.addStep("slaves", sl.URL, "StartSlave", err)
 		// now start the old master as relay is ready
 		if cluster.Conf.MxsBinlogOn && fail == false {
 			cluster.LogPrintf(LvlInfo, "Restarting old master replication relay server ready")
@@ -636,6 +677,11 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 	}
 	// if consul or internal proxy need to adapt read only route to new slaves
 	cluster.backendStateChangeProxies()
+	for _, sl := range cluster.slaves {
+		sl.Refresh()
+	}
+	cluster.master.Refresh()
+	event.setSlavesAfter(cluster.Servers)
 
 	if fail == true && cluster.Conf.PrefMaster != cluster.oldMaster.URL && cluster.master.URL != cluster.Conf.PrefMaster && cluster.Conf.PrefMaster != "" {
 		prm := cluster.foundPreferedMaster(cluster.slaves)
@@ -646,6 +692,7 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 	}
 
 	cluster.LogPrintf(LvlInfo, "Master switch on %s complete", cluster.master.URL)
+	success = true
 	cluster.master.FailCount = 0
 	if fail == true {
 		cluster.FailoverCtr++
@@ -656,7 +703,9 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 }
 
 // Returns a candidate from a list of slaves. If there's only one slave it will be the de facto candidate.
-func (cluster *Cluster) electSwitchoverCandidate(l []*ServerMonitor, forcingLog bool) int {
+// prefMaster is the preferred master rigging the election, the scores are returned when the candidates were scored.
+func (cluster *Cluster) electSwitchoverCandidate(l []*ServerMonitor, prefMaster string, forcingLog bool) (int, []ElectionScore) {
+	var scores []ElectionScore
 	ll := len(l)
 	seqList := make([]uint64, ll)
 	posList := make([]uint64, ll)
@@ -664,6 +713,7 @@ func (cluster *Cluster) electSwitchoverCandidate(l []*ServerMonitor, forcingLog
 	hiseq := 0
 	var max uint64
 	var maxpos uint64
+	var electable []int
 
 	for i, sl := range l {
 
@@ -695,11 +745,11 @@ func (cluster *Cluster) electSwitchoverCandidate(l []*ServerMonitor, forcingLog
 		}
 
 		/* Rig the election if the examined slave is preferred candidate master in switchover */
-		if sl.URL == cluster.Conf.PrefMaster {
+		if sl.URL == prefMaster {
 			if (cluster.Conf.LogLevel > 1 || forcingLog) && cluster.IsInFailover() {
 				cluster.LogPrintf(LvlDbg, "Election rig: %s elected as preferred master", sl.URL)
 			}
-			return i
+			return i, scores
 		}
 		if sl.HaveNoMasterOnStart == true && cluster.Conf.FailRestartUnsafe == false {
 			cluster.sme.AddState("ERR00084", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00084"], sl.URL), ServerUrl: sl.URL, ErrFrom: "CHECK"})
@@ -752,21 +802,38 @@ func (cluster *Cluster) electSwitchoverCandidate(l []*ServerMonitor, forcingLog
 			maxpos = posList[i]
 			hipos = i
 		}
+		electable = append(electable, i)
 
 	} //end loop all slaves
+	/* Only the most up to date slaves are scored, the score does not override the replication position */
+	if cluster.Conf.FailElectionScoring && len(electable) > 0 {
+		var keys []int
+		for _, i := range electable {
+			if (max > 0 && seqList[i] == max) || (max == 0 && maxpos > 0 && posList[i] == maxpos) {
+				keys = append(keys, i)
+			}
+		}
+		var key int
+		if key, scores = cluster.electByScore(l, keys, forcingLog); key >= 0 {
+			return key, scores
+		}
+	}
 	if max > 0 {
 		/* Return key of slave with the highest seqno. */
-		return hiseq
+		return hiseq, scores
 	}
 	if maxpos > 0 {
 		/* Return key of slave with the highest pos. */
-		return hipos
+		return hipos, scores
 	}
-	return -1
+	return -1, scores
 }
 
-func (cluster *Cluster) electFailoverCandidate(l []*ServerMonitor, forcingLog bool) int {
+// electFailoverCandidate returns the most up to date slave, prefMaster lists the preferred masters sent when equal,
+// the scores are returned when the candidates were scored
+func (cluster *Cluster) electFailoverCandidate(l []*ServerMonitor, prefMaster string, forcingLog bool) (int, []ElectionScore) {
 	//Found the most uptodate and look after a possibility to failover on it
+	var scores []ElectionScore
 	ll := len(l)
 	seqList := make([]uint64, ll)
 	posList := make([]uint64, ll)
@@ -789,7 +856,7 @@ func (cluster *Cluster) electFailoverCandidate(l []*ServerMonitor, forcingLog bo
 	for i, sl := range l {
 		trackposList[i].URL = sl.URL
 		trackposList[i].Indice = i
-		trackposList[i].Prefered = sl.IsPrefered()
+		trackposList[i].Prefered = isInPreferedList(prefMaster, sl)
 		trackposList[i].Ignoredconf = sl.IsIgnored()
 		trackposList[i].Ignoredrelay = sl.IsRelay
 
@@ -812,7 +879,7 @@ func (cluster *Cluster) electFailoverCandidate(l []*ServerMonitor, forcingLog bo
 
 				continue
 			} else if sl.State == stateWsrep {
-				return i
+				return i, scores
 			} else {
 				continue
 			}
@@ -886,13 +953,26 @@ func (cluster *Cluster) electFailoverCandidate(l []*ServerMonitor, forcingLog bo
 		//send the prefered if equal max
 		for _, p := range trackposList {
 			if p.Seq == maxseq && p.Ignoredrelay == false && p.Ignoredmultimaster == false && p.Ignoredreplication == false && p.Ignoredconf == false && p.Prefered == true {
-				return p.Indice
+				return p.Indice, scores
+			}
+		}
+		//send the best scored with maxseq
+		if cluster.Conf.FailElectionScoring {
+			var keys []int
+			for _, p := range trackposList {
+				if p.Seq == maxseq && p.Ignoredrelay == false && p.Ignoredmultimaster == false && p.Ignoredreplication == false && p.Ignoredconf == false {
+					keys = append(keys, p.Indice)
+				}
+			}
+			var key int
+			if key, scores = cluster.electByScore(l, keys, forcingLog); key >= 0 {
+				return key, scores
 			}
 		}
 		//send one with maxseq
 		for _, p := range trackposList {
 			if p.Seq == maxseq && p.Ignoredrelay == false && p.Ignoredmultimaster == false && p.Ignoredreplication == false && p.Ignoredconf == false {
-				return p.Indice
+				return p.Indice, scores
 			}
 		}
 		//send one with maxseq but also ignored
@@ -901,7 +981,7 @@ func (cluster *Cluster) electFailoverCandidate(l []*ServerMonitor, forcingLog bo
 				if forcingLog {
 					cluster.LogPrintf(LvlInfo, "Ignored server is the most up to date ")
 				}
-				return p.Indice
+				return p.Indice, scores
 			}
 
 		}
@@ -910,7 +990,7 @@ func (cluster *Cluster) electFailoverCandidate(l []*ServerMonitor, forcingLog bo
 			data, _ := json.MarshalIndent(trackposList, "", "\t")
 			cluster.LogPrintf(LvlInfo, "Election matrice maxseq >0: %s ", data)
 		}
-		return -1
+		return -1, scores
 	}
 	sort.Slice(trackposList[:], func(i, j int) bool {
 		return trackposList[i].Pos > trackposList[j].Pos
@@ -919,13 +999,26 @@ func (cluster *Cluster) electFailoverCandidate(l []*ServerMonitor, forcingLog bo
 		/* Return key of slave with the highest pos. */
 		for _, p := range trackposList {
 			if p.Pos == maxpos && p.Ignoredrelay == false && p.Ignoredmultimaster == false && p.Ignoredreplication == false && p.Ignoredconf == false && p.Prefered == true {
-				return p.Indice
+				return p.Indice, scores
+			}
+		}
+		//send the best scored with maxpos
+		if cluster.Conf.FailElectionScoring {
+			var keys []int
+			for _, p := range trackposList {
+				if p.Pos == maxpos && p.Ignoredrelay == false && p.Ignoredmultimaster == false && p.Ignoredreplication == false && p.Ignoredconf == false {
+					keys = append(keys, p.Indice)
+				}
+			}
+			var key int
+			if key, scores = cluster.electByScore(l, keys, forcingLog); key >= 0 {
+				return key, scores
 			}
 		}
 		//send one with maxpos
 		for _, p := range trackposList {
 			if p.Pos == maxpos && p.Ignoredrelay == false && p.Ignoredmultimaster == false && p.Ignoredreplication == false && p.Ignoredconf == false {
-				return p.Indice
+				return p.Indice, scores
 			}
 		}
 		//send one with maxpos and ignored
@@ -934,20 +1027,20 @@ func (cluster *Cluster) electFailoverCandidate(l []*ServerMonitor, forcingLog bo
 				if forcingLog {
 					cluster.LogPrintf(LvlInfo, "Ignored server is the most up to date ")
 				}
-				return p.Indice
+				return p.Indice, scores
 			}
 		}
 		if cluster.Conf.LogFailedElection {
 			data, _ := json.MarshalIndent(trackposList, "", "\t")
 			cluster.LogPrintf(LvlInfo, "Election matrice maxpos>0: %s ", data)
 		}
-		return -1
+		return -1, scores
 	}
 	if cluster.Conf.LogFailedElection {
 		data, _ := json.MarshalIndent(trackposList, "", "\t")
 		cluster.LogPrintf(LvlInfo, "Election matrice: %s ", data)
 	}
-	return -1
+	return -1, scores
 }
 
 func (cluster *Cluster) isSlaveElectable(sl *ServerMonitor, forcingLog bool) bool {
@@ -1073,7 +1166,9 @@ func (cluster *Cluster) VMasterFailover(fail bool) bool {
 	if cluster.GetTopology() != topoMultiMasterWsrep {
 		key = cluster.electVirtualCandidate(cluster.oldMaster, true)
 	} else {
-		key = cluster.electFailoverCandidate(cluster.slaves, true)
+		var scores []ElectionScore
+		key, scores = cluster.electFailoverCandidate(cluster.slaves, cluster.Conf.PrefMaster, true)
+		cluster.setElectionScores(scores)
 	}
 	if key == -1 {
 		cluster.LogPrintf(LvlErr, "No candidates found")
@@ -81,6 +81,18 @@ func (cluster *Cluster) GetPersitentState() error {
 	}
 
 	var clsave Save
+	if err := cluster.loadFailoverJournal(); err == nil {
+		cluster.LogPrintf(LvlInfo, "Restoring %d failovers from file: %s\n", len(cluster.GetFailoverJournal()), cluster.WorkingDir+"/failovers.json")
+	}
+	if err := cluster.loadBackupCatalog(); err == nil {
+		cluster.LogPrintf(LvlInfo, "Restoring %d backups from file: %s\n", len(cluster.GetBackupCatalog()), cluster.WorkingDir+"/backups.json")
+	}
+	if err := cluster.loadAlertSilences(); err == nil {
+		cluster.LogPrintf(LvlInfo, "Restoring %d alert silences from file: %s\n", len(cluster.AlertSilences), cluster.WorkingDir+"/silences.json")
+	}
+	if err := cluster.loadQueryRules(); err == nil {
+		cluster.LogPrintf(LvlInfo, "Restoring %d query rules from file: %s\n", len(cluster.QueryRules), cluster.WorkingDir+"/queryrules.json")
+	}
 	file, err := ioutil.ReadFile(cluster.WorkingDir + "/clusterstate.json")
 	if err != nil {
 		cluster.LogPrintf(LvlInfo, "No file found: %v\n", err)
@@ -754,9 +766,14 @@ func (cluster *Cluster) GetConfigInnoDBIOCapacityMax() string {
 	return s10
 }
 
+// GetQueryRules returns the query rules with the number of queries they matched on MyProxy
 func (cluster *Cluster) GetQueryRules() []config.QueryRule {
+	hits := cluster.getMyProxyQueryRuleHits()
+	cluster.queryRulesMutex.Lock()
+	defer cluster.queryRulesMutex.Unlock()
 	r := make([]config.QueryRule, 0, len(cluster.QueryRules))
 	for _, value := range cluster.QueryRules {
+		value.Hits = hits[value.Id]
 		r = append(r, value)
 	}
 	sort.Sort(QueryRuleSorter(r))
@@ -92,7 +92,12 @@ func (cluster *Cluster) IsInIgnoredReadonly(server *ServerMonitor) bool {
 }
 
 func (cluster *Cluster) IsInPreferedHosts(server *ServerMonitor) bool {
-	ihosts := strings.Split(cluster.Conf.PrefMaster, ",")
+	return isInPreferedList(cluster.Conf.PrefMaster, server)
+}
+
+// isInPreferedList returns true when the server is in a list of hosts like db-servers-prefered-master
+func isInPreferedList(list string, server *ServerMonitor) bool {
+	ihosts := strings.Split(list, ",")
 	for _, ihost := range ihosts {
 		if server.URL == ihost || server.Name == ihost {
 			return true
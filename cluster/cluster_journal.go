@@ -0,0 +1,252 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// FailoverEvent is one record of the failover journal, it keeps the timeline of a switchover or failover
+type FailoverEvent struct {
+	Id                 string                 `json:"id"`
+	Cluster            string                 `json:"cluster"`
+	Type               string                 `json:"type"`
+	Start              time.Time              `json:"start"`
+	End                time.Time              `json:"end"`
+	Duration           int64                  `json:"durationMs"`
+	Success            bool                   `json:"success"`
+	Error              string                 `json:"error,omitempty"`
+	OldMaster          string                 `json:"oldMaster"`
+	NewMaster          string                 `json:"newMaster"`
+	Election           FailoverElection       `json:"election"`
+	Steps              []FailoverEventStep    `json:"steps"`
+	Slaves             []FailoverSlaveHistory `json:"slaves"`
+	Proxies            []FailoverEventStep    `json:"proxies"`
+	WriteUnavailable   time.Time              `json:"writeUnavailable"`
+	WriteAvailable     time.Time              `json:"writeAvailable"`
+	WriteUnavailableMs int64                  `json:"writeUnavailableMs"`
+}
+
+// FailoverElection keeps the reasoning of the election
+type FailoverElection struct {
+	Elected    string          `json:"elected"`
+	Reason     string          `json:"reason"`
+	Candidates []PlanCandidate `json:"candidates"`
+	Scores     []ElectionScore `json:"scores,omitempty"`
+}
+
+// FailoverEventStep is a timestamped action of the failover
+type FailoverEventStep struct {
+	Time   time.Time `json:"time"`
+	Phase  string    `json:"phase"`
+	Server string    `json:"server"`
+	Action string    `json:"action"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// FailoverSlaveHistory keeps replication positions of a slave before and after the failover
+type FailoverSlaveHistory struct {
+	URL    string                 `json:"url"`
+	Before *FailoverSlavePosition `json:"before"`
+	After  *FailoverSlavePosition `json:"after"`
+}
+
+// FailoverSlavePosition is a snapshot of the replication position of a server
+type FailoverSlavePosition struct {
+	Master        string `json:"master"`
+	MasterLogFile string `json:"masterLogFile"`
+	MasterLogPos  string `json:"masterLogPos"`
+	GtidIOPos     string `json:"gtidIOPos"`
+	GtidSlavePos  string `json:"gtidSlavePos"`
+	Delay         int64  `json:"delay"`
+}
+
+type failoverJournal []*FailoverEvent
+
+func (cluster *Cluster) newFailoverEvent(fail bool) *FailoverEvent {
+	event := new(FailoverEvent)
+	event.Start = time.Now()
+	event.Id = event.Start.Format("20060102150405.000")
+	event.Cluster = cluster.Name
+	event.Type = ConstPlanSwitchover
+	if fail {
+		event.Type = ConstPlanFailover
+	}
+	if cluster.master != nil {
+		event.OldMaster = cluster.master.URL
+		if fail && cluster.master.FailSuspectHeartbeat > 0 {
+			// writes are lost since the master was first suspected
+			suspect := (cluster.sme.GetHeartbeats() - cluster.master.FailSuspectHeartbeat) * cluster.Conf.MonitoringTicker
+			event.WriteUnavailable = event.Start.Add(-time.Duration(suspect) * time.Second)
+		}
+	}
+	if fail && event.WriteUnavailable.IsZero() {
+		event.WriteUnavailable = event.Start
+	}
+	return event
+}
+
+func (event *FailoverEvent) addStep(phase string, server string, action string, err error) {
+	step := FailoverEventStep{Time: time.Now(), Phase: phase, Server: server, Action: action}
+	if err != nil {
+		step.Error = err.Error()
+	}
+	event.Steps = append(event.Steps, step)
+}
+
+func (event *FailoverEvent) addProxy(pr *Proxy) {
+	event.Proxies = append(event.Proxies, FailoverEventStep{Time: time.Now(), Phase: "proxies", Server: pr.Host + ":" + pr.Port, Action: pr.Type})
+}
+
+func (event *FailoverEvent) setError(format string, args ...interface{}) {
+	event.Error = fmt.Sprintf(format, args...)
+}
+
+func (event *FailoverEvent) setWriteUnavailable() {
+	if event.WriteUnavailable.IsZero() {
+		event.WriteUnavailable = time.Now()
+	}
+}
+
+func (event *FailoverEvent) setWriteAvailable() {
+	event.WriteAvailable = time.Now()
+	if !event.WriteUnavailable.IsZero() {
+		event.WriteUnavailableMs = event.WriteAvailable.Sub(event.WriteUnavailable).Nanoseconds() / int64(time.Millisecond)
+	}
+}
+
+func (server *ServerMonitor) getFailoverSlavePosition() *FailoverSlavePosition {
+	pos := new(FailoverSlavePosition)
+	ss, err := server.GetSlaveStatus(server.ReplicationSourceName)
+	if err != nil {
+		if server.GTIDBinlogPos != nil {
+			pos.GtidIOPos = server.GTIDBinlogPos.Sprint()
+		}
+		pos.MasterLogFile = server.BinaryLogFile
+		pos.MasterLogPos = server.BinaryLogPos
+		return pos
+	}
+	pos.Master = ss.MasterHost.String + ":" + ss.MasterPort.String
+	pos.MasterLogFile = ss.MasterLogFile.String
+	pos.MasterLogPos = ss.ReadMasterLogPos.String
+	pos.GtidIOPos = ss.GtidIOPos.String
+	pos.GtidSlavePos = planGtid(server.SlaveGtid)
+	pos.Delay = ss.SecondsBehindMaster.Int64
+	return pos
+}
+
+func (event *FailoverEvent) setSlavesBefore(slaves serverList) {
+	for _, sl := range slaves {
+		event.Slaves = append(event.Slaves, FailoverSlaveHistory{URL: sl.URL, Before: sl.getFailoverSlavePosition()})
+	}
+}
+
+func (event *FailoverEvent) setSlavesAfter(servers serverList) {
+	for _, sv := range servers {
+		found := false
+		for k := range event.Slaves {
+			if event.Slaves[k].URL == sv.URL {
+				event.Slaves[k].After = sv.getFailoverSlavePosition()
+				found = true
+			}
+		}
+		if !found && sv.URL == event.OldMaster {
+			event.Slaves = append(event.Slaves, FailoverSlaveHistory{URL: sv.URL, After: sv.getFailoverSlavePosition()})
+		}
+	}
+}
+
+// setFailoverElection records the election from the state it was computed on: the slaves as refreshed
+// before the election, their electable checks and the scores of the election.
+func (cluster *Cluster) setFailoverElection(event *FailoverEvent, elected *ServerMonitor, scores []ElectionScore) {
+	event.Election.Elected = elected.URL
+	event.NewMaster = elected.URL
+	event.Election.Candidates = cluster.getPlanCandidates(event.Type == ConstPlanFailover, cluster.Conf.PrefMaster)
+	switch {
+	case isInPreferedList(cluster.Conf.PrefMaster, elected):
+		event.Election.Reason = "Preferred master"
+	case len(scores) > 0:
+		event.Election.Reason = "Best election score"
+		event.Election.Scores = scores
+	default:
+		event.Election.Reason = "Most up to date slave"
+	}
+}
+
+// closeFailoverEvent ends the event and saves the journal
+func (cluster *Cluster) closeFailoverEvent(event *FailoverEvent, success bool) {
+	event.End = time.Now()
+	event.Duration = event.End.Sub(event.Start).Nanoseconds() / int64(time.Millisecond)
+	event.Success = success
+	if !success && !event.WriteUnavailable.IsZero() && event.WriteAvailable.IsZero() && event.Type == ConstPlanSwitchover {
+		// switchover was cancelled and the old master unlocked
+		event.setWriteAvailable()
+	}
+	cluster.failoverJournalMutex.Lock()
+	defer cluster.failoverJournalMutex.Unlock()
+	cluster.FailoverJournal = append(cluster.FailoverJournal, event)
+	if keep := cluster.Conf.FailoverJournalKeep; keep > 0 && len(cluster.FailoverJournal) > keep {
+		cluster.FailoverJournal = append(failoverJournal(nil), cluster.FailoverJournal[len(cluster.FailoverJournal)-keep:]...)
+	}
+	err := cluster.FailoverJournal.Save(cluster.WorkingDir + "/failovers.json")
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Could not save failover journal: %s", err)
+	}
+}
+
+// GetFailoverJournal returns a copy of the failover and switchover history
+func (cluster *Cluster) GetFailoverJournal() failoverJournal {
+	cluster.failoverJournalMutex.Lock()
+	defer cluster.failoverJournalMutex.Unlock()
+	journal := make(failoverJournal, 0, len(cluster.FailoverJournal))
+	for _, event := range cluster.FailoverJournal {
+		e := *event
+		journal = append(journal, &e)
+	}
+	return journal
+}
+
+// GetFailoverEvent returns a copy of a failover of the journal by id
+func (cluster *Cluster) GetFailoverEvent(id string) *FailoverEvent {
+	cluster.failoverJournalMutex.Lock()
+	defer cluster.failoverJournalMutex.Unlock()
+	for _, event := range cluster.FailoverJournal {
+		if event.Id == id {
+			e := *event
+			return &e
+		}
+	}
+	return nil
+}
+
+func (cluster *Cluster) loadFailoverJournal() error {
+	file, err := ioutil.ReadFile(cluster.WorkingDir + "/failovers.json")
+	if err != nil {
+		return err
+	}
+	var journal failoverJournal
+	err = json.Unmarshal(file, &journal)
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "File error: %v\n", err)
+		return err
+	}
+	cluster.failoverJournalMutex.Lock()
+	cluster.FailoverJournal = journal
+	cluster.failoverJournalMutex.Unlock()
+	return nil
+}
+
+func (journal failoverJournal) Save(path string) error {
+	saveJson, _ := json.MarshalIndent(journal, "", "\t")
+	return ioutil.WriteFile(path, saveJson, 0644)
+}
@@ -0,0 +1,84 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/signal18/replication-manager/config"
+)
+
+func newJournalTestCluster(t *testing.T, keep int) *Cluster {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster := newPlanTestCluster(config.Config{FailoverJournalKeep: keep, PrefMaster: "db3:3306"})
+	cluster.WorkingDir = dir
+	return cluster
+}
+
+func TestFailoverJournalEvent(t *testing.T) {
+	cluster := newJournalTestCluster(t, 10)
+	defer os.RemoveAll(cluster.WorkingDir)
+	event := cluster.newFailoverEvent(false)
+	event.addStep("election", "db3:3306", "ElectNewMaster", nil)
+	cluster.setFailoverElection(event, cluster.Servers[2], nil)
+	event.setWriteUnavailable()
+	cluster.closeFailoverEvent(event, false)
+
+	journal := cluster.GetFailoverJournal()
+	if len(journal) != 1 || journal[0].Id != event.Id || journal[0].OldMaster != "db1:3306" || journal[0].NewMaster != "db3:3306" {
+		t.Fatalf("Expected the switchover recorded, got %+v", journal)
+	}
+	if journal[0].Success || journal[0].WriteAvailable.IsZero() || len(journal[0].Steps) != 1 {
+		t.Fatalf("Expected the cancelled switchover to unlock the writes, got %+v", journal[0])
+	}
+	if e := journal[0].Election; e.Reason != "Preferred master" || len(e.Candidates) != 2 {
+		t.Fatalf("Expected the preferred master election of 2 candidates, got %+v", e)
+	}
+	for _, pc := range journal[0].Election.Candidates {
+		if pc.Electable {
+			t.Fatalf("Expected the electable checks recorded for %s without connection", pc.URL)
+		}
+	}
+	journal[0].NewMaster = "changed"
+	if e := cluster.GetFailoverEvent(event.Id); e == nil || e.NewMaster != "db3:3306" {
+		t.Fatalf("Expected the journal not changed by its copy, got %+v", e)
+	}
+	if _, err := os.Stat(cluster.WorkingDir + "/failovers.json"); err != nil {
+		t.Fatalf("Expected the journal saved, got %s", err)
+	}
+	cluster.FailoverJournal = nil
+	if err := cluster.loadFailoverJournal(); err != nil || cluster.GetFailoverEvent(event.Id) == nil {
+		t.Fatalf("Expected the journal restored, got %v", err)
+	}
+}
+
+func TestFailoverJournalKeep(t *testing.T) {
+	cluster := newJournalTestCluster(t, 3)
+	defer os.RemoveAll(cluster.WorkingDir)
+	var ids []string
+	for i := 0; i < 5; i++ {
+		event := cluster.newFailoverEvent(true)
+		event.Id = string(rune('a' + i))
+		cluster.closeFailoverEvent(event, true)
+		ids = append(ids, event.Id)
+	}
+	journal := cluster.GetFailoverJournal()
+	if len(journal) != 3 || journal[0].Id != ids[2] || journal[2].Id != ids[4] {
+		t.Fatalf("Expected the 3 last events kept, got %d events", len(journal))
+	}
+	if cluster.GetFailoverEvent(ids[0]) != nil {
+		t.Fatal("Expected the oldest event trimmed")
+	}
+}
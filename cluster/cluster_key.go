@@ -7,8 +7,10 @@
 package cluster
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
@@ -19,6 +21,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/signal18/replication-manager/utils/crypto"
 	"github.com/signal18/replication-manager/utils/misc"
 )
 
@@ -308,3 +311,15 @@ func (cluster *Cluster) GeneratePassword() (string, error) {
 	}
 	return string(password), nil
 }
+
+// getBackupKey derives the backup encryption key from the monitoring key file, rotating the
+// key file makes the existing encrypted backups unreadable
+func (cluster *Cluster) getBackupKey() ([]byte, error) {
+	k, err := crypto.ReadKey(cluster.Conf.MonitoringKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, k)
+	mac.Write([]byte("replication-manager backup"))
+	return mac.Sum(nil), nil
+}
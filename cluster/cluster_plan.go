@@ -0,0 +1,255 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"fmt"
+
+	"github.com/signal18/replication-manager/utils/gtid"
+)
+
+// FailoverPlan describes what MasterFailover would do without executing anything
+type FailoverPlan struct {
+	Cluster    string          `json:"cluster"`
+	Type       string          `json:"type"`
+	OldMaster  string          `json:"oldMaster"`
+	Candidate  string          `json:"candidate"`
+	IsPossible bool            `json:"isPossible"`
+	Candidates []PlanCandidate `json:"candidates"`
+	Steps      []PlanStep      `json:"steps"`
+	Errors     []string        `json:"errors"`
+}
+
+// PlanCandidate reports the electable status of a slave
+type PlanCandidate struct {
+	URL       string `json:"url"`
+	Electable bool   `json:"electable"`
+	Ignored   bool   `json:"ignored"`
+	Prefered  bool   `json:"prefered"`
+	Delay     int64  `json:"delay"`
+	Gtid      string `json:"gtid"`
+}
+
+// PlanStep is one ordered action of the plan
+type PlanStep struct {
+	Order  int    `json:"order"`
+	Phase  string `json:"phase"`
+	Server string `json:"server"`
+	Action string `json:"action"`
+	Mode   string `json:"mode,omitempty"`
+	Gtid   string `json:"gtid,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+const (
+	ConstPlanSwitchover string = "switchover"
+	ConstPlanFailover   string = "failover"
+)
+
+func (plan *FailoverPlan) addStep(phase string, server string, action string, detail string) *PlanStep {
+	plan.Steps = append(plan.Steps, PlanStep{Order: len(plan.Steps) + 1, Phase: phase, Server: server, Action: action, Detail: detail})
+	return &plan.Steps[len(plan.Steps)-1]
+}
+
+func planGtid(l *gtid.List) string {
+	if l == nil {
+		return ""
+	}
+	return l.Sprint()
+}
+
+func (cluster *Cluster) getPlanCandidates(fail bool, prefMaster string) []PlanCandidate {
+	var candidates []PlanCandidate
+	for _, sl := range cluster.slaves {
+		pc := newPlanCandidate(sl)
+		pc.Prefered = isInPreferedList(prefMaster, sl)
+		pc.Electable = cluster.isSlaveElectable(sl, false)
+		if !fail && pc.Electable {
+			pc.Electable = cluster.isSlaveElectableForSwitchover(sl, false)
+		}
+		candidates = append(candidates, pc)
+	}
+	return candidates
+}
+
+// newPlanCandidate returns a candidate from the last monitored state of a slave, without checking it
+func newPlanCandidate(sl *ServerMonitor) PlanCandidate {
+	pc := PlanCandidate{URL: sl.URL, Ignored: sl.IsIgnored(), Prefered: sl.IsPrefered(), Gtid: planGtid(sl.SlaveGtid)}
+	if ss, err := sl.GetSlaveStatus(sl.ReplicationSourceName); err == nil {
+		pc.Delay = ss.SecondsBehindMaster.Int64
+	}
+	return pc
+}
+
+// GetFailoverPlan runs the election and the electable checks of MasterFailover and returns the ordered
+// list of steps a switchover (fail=false) or a failover (fail=true) would execute, without changing anything.
+// The election prefers prefMaster, or db-servers-prefered-master when empty.
+func (cluster *Cluster) GetFailoverPlan(fail bool, prefMaster string) *FailoverPlan {
+	plan := new(FailoverPlan)
+	plan.Cluster = cluster.Name
+	plan.Type = ConstPlanSwitchover
+	if fail {
+		plan.Type = ConstPlanFailover
+	}
+	if cluster.GetTopology() == topoMultiMasterRing || cluster.GetTopology() == topoMultiMasterWsrep {
+		plan.Errors = append(plan.Errors, "Plan not available for virtual master topology "+cluster.GetTopology())
+		return plan
+	}
+	if cluster.IsInFailover() {
+		plan.Errors = append(plan.Errors, "Cluster is already in failover")
+		return plan
+	}
+	oldMaster := cluster.master
+	if oldMaster == nil {
+		plan.Errors = append(plan.Errors, "No master found")
+		return plan
+	}
+	plan.OldMaster = oldMaster.URL
+	if !fail {
+		if oldMaster.Conn == nil {
+			plan.Errors = append(plan.Errors, "Cannot switchover without a master connection")
+			return plan
+		}
+		plan.addStep("cleanup", oldMaster.URL, "CheckLongRunningWrites", fmt.Sprintf("Cancel if writes running for more than %d s", cluster.Conf.SwitchWaitWrite))
+		plan.addStep("cleanup", oldMaster.URL, "FlushTablesNoLog", fmt.Sprintf("Cancel if flush takes more than %d s", cluster.Conf.SwitchWaitTrx))
+	}
+
+	if prefMaster == "" {
+		prefMaster = cluster.Conf.PrefMaster
+	}
+	key := -1
+	if fail {
+		key, _ = cluster.electFailoverCandidate(cluster.slaves, prefMaster, false)
+	} else {
+		key, _ = cluster.electSwitchoverCandidate(cluster.slaves, prefMaster, false)
+	}
+	plan.Candidates = cluster.getPlanCandidates(fail, prefMaster)
+	if key == -1 {
+		plan.Errors = append(plan.Errors, "No candidates found")
+		return plan
+	}
+	candidate := cluster.slaves[key]
+	if fail && !cluster.isSlaveElectable(candidate, false) {
+		plan.Errors = append(plan.Errors, "Elected slave have issue cancelling failover "+candidate.URL)
+		return plan
+	}
+	plan.Candidate = candidate.URL
+	plan.IsPossible = true
+	plan.addStep("election", candidate.URL, "ElectNewMaster", "Slave elected as new master")
+
+	if cluster.Conf.PreScript != "" {
+		plan.addStep("election", "", "PreFailoverScript", cluster.Conf.PreScript)
+	}
+	if !fail {
+		if cluster.Conf.FailEventStatus {
+			plan.addStep("reject", oldMaster.URL, "SetEventStatus", "DISABLE ON SLAVE for enabled events")
+		}
+		if cluster.Conf.FailEventScheduler {
+			plan.addStep("reject", oldMaster.URL, "SetEventScheduler", "OFF")
+		}
+		plan.addStep("reject", oldMaster.URL, "FlushTablesWithReadLock", "Rejecting updates on old master")
+	}
+	plan.addStep("sync", candidate.URL, "ReadAllRelayLogs", "Wait candidate to apply relay logs")
+	if cluster.Conf.MxsBinlogOn || cluster.Conf.MultiTierSlave {
+		relay := cluster.GetRelayServer()
+		if relay != nil {
+			plan.addStep("sync", candidate.URL, "ResetMaster", "Catch up binlog file number of relay server "+relay.URL)
+		} else {
+			plan.Errors = append(plan.Errors, "No relay server found")
+		}
+	}
+	if cluster.Conf.MultiMaster == false {
+		plan.addStep("prepare", candidate.URL, "StopSlave", "")
+	}
+	if cluster.Conf.PostScript != "" {
+		plan.addStep("prepare", "", "PostFailoverScript", cluster.Conf.PostScript)
+	}
+	if cluster.Conf.MultiMaster == false {
+		plan.addStep("prepare", candidate.URL, "ResetSlave", "")
+	}
+	plan.addStep("prepare", candidate.URL, "SetReadWrite", "")
+	for _, pr := range cluster.Proxies {
+		plan.addStep("proxies", pr.Host+":"+pr.Port, "FailoverProxy", pr.Type)
+	}
+	plan.addStep("proxies", "", "WaitRouteChange", fmt.Sprintf("%d s", cluster.Conf.SwitchSlaveWaitRouteChange))
+	if cluster.Conf.FailEventScheduler {
+		plan.addStep("prepare", candidate.URL, "SetEventScheduler", "ON")
+	}
+	if cluster.Conf.FailEventStatus {
+		plan.addStep("prepare", candidate.URL, "SetEventStatus", "ENABLE for events disabled on slave")
+	}
+	plan.addStep("prepare", candidate.URL, "FlushTables", "Inject fake transaction")
+
+	if !fail {
+		plan.addStep("demote", oldMaster.URL, "KillThreads", "")
+		plan.addStep("demote", oldMaster.URL, "UnlockTables", "")
+		step := plan.addStep("demote", oldMaster.URL, "ChangeMaster", "Point old master to "+candidate.URL)
+		switch {
+		case oldMaster.HasMariaDBGTID() == false && oldMaster.HasMySQLGTID() == false:
+			step.Mode = "POSITIONAL"
+			step.Detail = fmt.Sprintf("Point old master to %s at %s:%s", candidate.URL, candidate.BinaryLogFile, candidate.BinaryLogPos)
+		case oldMaster.HasMySQLGTID():
+			step.Mode = "MASTER_AUTO_POSITION"
+			step.Gtid = candidate.GTIDExecuted
+		case cluster.Conf.MxsBinlogOn == false:
+			step.Mode = "CURRENT_POS"
+			step.Gtid = planGtid(candidate.GTIDBinlogPos)
+		default:
+			step.Mode = "SLAVE_POS"
+			step.Detail = "Point old master to relay server"
+		}
+		if cluster.Conf.ReadOnly {
+			plan.addStep("demote", oldMaster.URL, "SetReadOnly", "ON")
+		} else {
+			plan.addStep("demote", oldMaster.URL, "SetReadOnly", "OFF")
+		}
+	}
+
+	for _, sl := range cluster.slaves {
+		if sl.URL == candidate.URL || sl.URL == oldMaster.URL || sl.State == stateMaster || (sl.IsRelay == false && cluster.Conf.MxsBinlogOn == true) {
+			continue
+		}
+		if !fail && cluster.Conf.MxsBinlogOn == false && cluster.Conf.SwitchSlaveWaitCatch {
+			plan.addStep("slaves", sl.URL, "WaitSyncToMaster", "Wait slave to catch old master").Gtid = planGtid(oldMaster.GTIDBinlogPos)
+		}
+		plan.addStep("slaves", sl.URL, "StopSlave", "")
+		step := plan.addStep("slaves", sl.URL, "ChangeMaster", "Point slave to "+candidate.URL)
+		switch {
+		case sl.HasMariaDBGTID() == false && candidate.HasMySQLGTID() == false:
+			if cluster.Conf.AutorejoinSlavePositionalHeartbeat {
+				step.Mode = "POSITIONAL"
+				step.Detail = "Point slave to " + candidate.URL + " at coordinates found from last pseudo GTID"
+			} else {
+				step.Action = "SetMaintenance"
+				step.Detail = "No GTID and no pseudo GTID, slave stays on old master"
+			}
+		case oldMaster.DBVersion.IsMySQLOrPerconaGreater57() && candidate.HasMySQLGTID():
+			step.Mode = "MASTER_AUTO_POSITION"
+			step.Gtid = sl.GTIDExecuted
+		case cluster.Conf.MxsBinlogOn == false:
+			step.Mode = "SLAVE_POS"
+			if !fail && cluster.Conf.SwitchSlaveWaitCatch {
+				step.Gtid = planGtid(oldMaster.GTIDBinlogPos)
+			} else {
+				step.Gtid = planGtid(sl.SlaveGtid)
+			}
+		default:
+			step.Mode = "MXS"
+		}
+		plan.addStep("slaves", sl.URL, "StartSlave", "")
+		if cluster.Conf.ReadOnly && cluster.Conf.MxsBinlogOn == false && !cluster.IsInIgnoredReadonly(sl) {
+			plan.addStep("slaves", sl.URL, "SetReadOnly", "ON")
+		}
+	}
+	if cluster.Conf.RegistryConsul {
+		plan.addStep("proxies", "", "BackendStateChange", "Consul")
+	}
+	return plan
+}
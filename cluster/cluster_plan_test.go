@@ -0,0 +1,75 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"testing"
+
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/state"
+)
+
+func newPlanTestCluster(conf config.Config) *Cluster {
+	cluster := &Cluster{Name: "cluster1", Conf: conf, sme: new(state.StateMachine)}
+	cluster.sme.Init()
+	for _, url := range []string{"db1:3306", "db2:3306", "db3:3306"} {
+		server := &ServerMonitor{URL: url, ClusterGroup: cluster}
+		server.SetPrefered(cluster.IsInPreferedHosts(server))
+		cluster.Servers = append(cluster.Servers, server)
+	}
+	cluster.master = cluster.Servers[0]
+	cluster.master.State = stateFailed
+	cluster.slaves = cluster.Servers[1:]
+	return cluster
+}
+
+func TestFailoverPlanErrors(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		fail  bool
+		setup func(cluster *Cluster)
+		err   string
+	}{
+		{"virtual master", true, func(cluster *Cluster) { cluster.Conf.MultiMasterWsrep = true }, "Plan not available for virtual master topology " + topoMultiMasterWsrep},
+		{"in failover", true, func(cluster *Cluster) { cluster.sme.SetFailoverState() }, "Cluster is already in failover"},
+		{"no master", true, func(cluster *Cluster) { cluster.master = nil }, "No master found"},
+		{"no master connection", false, func(cluster *Cluster) {}, "Cannot switchover without a master connection"},
+		{"no candidate", true, func(cluster *Cluster) {}, "No candidates found"},
+	} {
+		cluster := newPlanTestCluster(config.Config{})
+		c.setup(cluster)
+		plan := cluster.GetFailoverPlan(c.fail, "")
+		if plan.IsPossible || len(plan.Errors) != 1 || plan.Errors[0] != c.err {
+			t.Fatalf("Expected %s plan error %q, got %+v", c.name, c.err, plan)
+		}
+		if c.fail && plan.Type != ConstPlanFailover || !c.fail && plan.Type != ConstPlanSwitchover {
+			t.Fatalf("Expected %s plan type for failover %t, got %s", c.name, c.fail, plan.Type)
+		}
+	}
+}
+
+func TestFailoverPlanPreferedMaster(t *testing.T) {
+	cluster := newPlanTestCluster(config.Config{PrefMaster: "db2:3306"})
+	for prefMaster, prefered := range map[string]string{"": "db2:3306", "db3:3306": "db3:3306"} {
+		plan := cluster.GetFailoverPlan(true, prefMaster)
+		if plan.OldMaster != "db1:3306" || len(plan.Candidates) != 2 {
+			t.Fatalf("Expected the candidates of db1:3306, got %+v", plan)
+		}
+		for _, pc := range plan.Candidates {
+			if pc.Prefered != (pc.URL == prefered) || pc.Electable {
+				t.Fatalf("Expected %s prefered and no electable candidate with %q, got %+v", prefered, prefMaster, plan.Candidates)
+			}
+		}
+	}
+	// the plan does not change the preferred master of the cluster
+	if cluster.Conf.PrefMaster != "db2:3306" || !cluster.Servers[1].IsPrefered() || cluster.Servers[2].IsPrefered() {
+		t.Fatalf("Expected db2:3306 still preferred, got %s", cluster.Conf.PrefMaster)
+	}
+}
@@ -0,0 +1,159 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"strings"
+
+	"github.com/signal18/replication-manager/utils/prometheus"
+)
+
+// CollectPrometheusMetrics adds the metrics of the cluster, its servers, its proxies and its jobs to a scrape
+func (cluster *Cluster) CollectPrometheusMetrics(reg *prometheus.Registry) {
+	labels := prometheus.Labels{"cluster": cluster.Name}
+	reg.Counter("replication_manager_cluster_failover_total", "Number of failovers of the cluster", float64(cluster.FailoverCtr), labels)
+	reg.Gauge("replication_manager_cluster_split_brain", "Cluster is in split brain", prometheus.Bool(cluster.IsSplitBrain), labels)
+	reg.Gauge("replication_manager_cluster_in_failover", "Cluster is in failover", prometheus.Bool(cluster.IsInFailover()), labels)
+	reg.Gauge("replication_manager_cluster_servers", "Number of database servers of the cluster", float64(len(cluster.Servers)), labels)
+	reg.AddString("replication_manager_cluster_sla_percent", prometheus.Gauge, "Percentage of the monitoring time the cluster met the SLA", cluster.Uptime, prometheus.Labels{"cluster": cluster.Name, "sla": "uptime"})
+	reg.AddString("replication_manager_cluster_sla_percent", prometheus.Gauge, "", cluster.UptimeFailable, prometheus.Labels{"cluster": cluster.Name, "sla": "failable"})
+	reg.AddString("replication_manager_cluster_sla_percent", prometheus.Gauge, "", cluster.UptimeSemiSync, prometheus.Labels{"cluster": cluster.Name, "sla": "semisync"})
+	errors := cluster.sme.GetOpenErrors()
+	warnings := cluster.sme.GetOpenWarnings()
+	reg.Gauge("replication_manager_cluster_open_states", "Number of open states of the cluster", float64(len(errors)), prometheus.Labels{"cluster": cluster.Name, "level": "error"})
+	reg.Gauge("replication_manager_cluster_open_states", "", float64(len(warnings)), prometheus.Labels{"cluster": cluster.Name, "level": "warning"})
+	for _, s := range errors {
+		reg.Gauge("replication_manager_cluster_state", "Open state of the cluster", 1, prometheus.Labels{"cluster": cluster.Name, "level": "error", "code": s.ErrNumber, "from": s.ErrFrom})
+	}
+	for _, s := range warnings {
+		reg.Gauge("replication_manager_cluster_state", "Open state of the cluster", 1, prometheus.Labels{"cluster": cluster.Name, "level": "warning", "code": s.ErrNumber, "from": s.ErrFrom})
+	}
+
+	for _, server := range cluster.Servers {
+		server.collectPrometheusMetrics(reg)
+	}
+	for _, proxy := range cluster.Proxies {
+		cluster.collectProxyPrometheusMetrics(reg, proxy)
+	}
+	cluster.collectJobPrometheusMetrics(reg)
+}
+
+// getPrometheusRole returns the role label of a server, the role does not change when a slave is late or in error
+func (server *ServerMonitor) getPrometheusRole() string {
+	switch {
+	case server.IsMaster():
+		return "master"
+	case server.IsSlave:
+		return "slave"
+	case server.IsDown():
+		return "failed"
+	}
+	return "standalone"
+}
+
+func (server *ServerMonitor) collectPrometheusMetrics(reg *prometheus.Registry) {
+	labels := prometheus.Labels{"cluster": server.ClusterGroup.Name, "server": server.URL, "role": server.getPrometheusRole()}
+	reg.Gauge("replication_manager_server_up", "Server is up", prometheus.Bool(!server.IsDown()), labels)
+	reg.Gauge("replication_manager_server_maintenance", "Server is in maintenance", prometheus.Bool(server.IsMaintenance), labels)
+	reg.Gauge("replication_manager_server_state", "State of the server", 1, prometheus.Labels{"cluster": server.ClusterGroup.Name, "server": server.URL, "role": labels["role"], "state": server.State})
+	reg.Gauge("replication_manager_server_failures", "Number of consecutive failed checks of the server, reset when a check succeeds", float64(server.FailCount), labels)
+	if server.IsDown() {
+		return
+	}
+	if server.IsSlave {
+		reg.Gauge("mysql_slave_status_seconds_behind_master", "Replication delay of the slave", float64(server.SlaveStatus.SecondsBehindMaster.Int64), labels)
+		reg.Gauge("mysql_slave_status_slave_sql_running", "Replication SQL thread is running", prometheus.Bool(server.SlaveStatus.SlaveSQLRunning.String == "Yes"), labels)
+		reg.Gauge("mysql_slave_status_slave_io_running", "Replication IO thread is running", prometheus.Bool(server.SlaveStatus.SlaveIORunning.String == "Yes"), labels)
+		reg.AddString("mysql_slave_status_exec_master_log_pos", prometheus.Gauge, "Executed position in the master binary log", server.SlaveStatus.ExecMasterLogPos.String, labels)
+		reg.AddString("mysql_slave_status_read_master_log_pos", prometheus.Gauge, "Read position in the master binary log", server.SlaveStatus.ReadMasterLogPos.String, labels)
+		reg.AddString("mysql_slave_status_last_errno", prometheus.Gauge, "Last replication SQL error", server.SlaveStatus.LastSQLErrno.String, labels)
+	}
+	// status and engine counters and gauges are mixed and left untyped as mysqld_exporter does
+	for k, v := range server.Status {
+		reg.AddString("mysql_global_status_"+strings.ToLower(k), prometheus.Untyped, "", v, labels)
+	}
+	for k, v := range server.Variables {
+		reg.AddString("mysql_global_variables_"+strings.ToLower(k), prometheus.Gauge, "", v, labels)
+	}
+	for k, v := range server.EngineInnoDB {
+		reg.AddString("mysql_engine_innodb_"+strings.ToLower(k), prometheus.Untyped, "", v, labels)
+	}
+	for _, q := range server.PFSQueries {
+		qlabels := prometheus.Labels{"cluster": labels["cluster"], "server": server.URL, "role": labels["role"], "digest": q.Digest, "schema": q.Schema_name}
+		reg.AddString("mysql_perf_schema_digest_seconds_total", prometheus.Counter, "Total execution time of the statements of a digest", q.Value, qlabels)
+		reg.Counter("mysql_perf_schema_digest_exec_total", "Number of executions of the statements of a digest", float64(q.Exec_count), qlabels)
+	}
+}
+
+func (cluster *Cluster) collectProxyPrometheusMetrics(reg *prometheus.Registry, proxy *Proxy) {
+	labels := prometheus.Labels{"cluster": cluster.Name, "proxy": proxy.Name, "proxy_type": proxy.Type}
+	reg.Gauge("replication_manager_proxy_up", "Proxy is up", prometheus.Bool(proxy.State != stateFailed), labels)
+	reg.Gauge("replication_manager_proxy_failures", "Number of consecutive failed checks of the proxy, reset when a check succeeds", float64(proxy.FailCount), labels)
+	backends := func(group string, bkes []Backend) {
+		for _, bke := range bkes {
+			blabels := prometheus.Labels{"cluster": cluster.Name, "proxy": proxy.Name, "proxy_type": proxy.Type, "server": bke.Host + ":" + bke.Port, "group": group}
+			if bke.PrxHostgroup != "" {
+				blabels["hostgroup"] = bke.PrxHostgroup
+			}
+			reg.Gauge("replication_manager_proxy_backend_maintenance", "Backend is in maintenance in the proxy", prometheus.Bool(bke.PrxMaintenance), blabels)
+			reg.AddString("replication_manager_proxy_backend_connections", prometheus.Gauge, "Connections of the proxy to the backend", bke.PrxConnections, blabels)
+			reg.AddString("replication_manager_proxy_backend_sent_bytes_total", prometheus.Counter, "Bytes sent by the proxy to the backend", bke.PrxByteOut, blabels)
+			reg.AddString("replication_manager_proxy_backend_received_bytes_total", prometheus.Counter, "Bytes received by the proxy from the backend", bke.PrxByteIn, blabels)
+			reg.AddString("replication_manager_proxy_backend_latency_microseconds", prometheus.Gauge, "Latency of the backend measured by the proxy", bke.PrxLatency, blabels)
+		}
+	}
+	backends("write", proxy.BackendsWrite)
+	backends("read", proxy.BackendsRead)
+}
+
+func (cluster *Cluster) collectJobPrometheusMetrics(reg *prometheus.Registry) {
+	// last backup of each type and tool
+	last := make(map[string]*BackupMeta)
+	var order []string
+	for _, meta := range cluster.GetBackupCatalog() {
+		key := meta.Type + "/" + meta.Tool
+		if _, ok := last[key]; !ok {
+			order = append(order, key)
+		}
+		last[key] = meta
+	}
+	for _, key := range order {
+		meta := last[key]
+		labels := prometheus.Labels{"cluster": cluster.Name, "type": meta.Type, "tool": meta.Tool, "server": meta.Source}
+		reg.Gauge("replication_manager_backup_last_duration_seconds", "Duration of the last backup", float64(meta.Duration)/1000, labels)
+		reg.Gauge("replication_manager_backup_last_success", "Last backup completed", prometheus.Bool(meta.Completed), labels)
+		reg.Gauge("replication_manager_backup_last_timestamp_seconds", "End time of the last backup", float64(meta.End.Unix()), labels)
+		reg.Gauge("replication_manager_backup_last_size_bytes", "Size of the last backup", float64(meta.Size), labels)
+	}
+	for url, res := range cluster.JobResults {
+		if res.Pitr != nil && res.Pitr.Done {
+			cluster.collectJobDuration(reg, "pitr", url, res.Pitr.Start.Unix(), res.Pitr.End.Unix(), res.Pitr.Error == "")
+		}
+		if res.Delayed != nil && res.Delayed.Done {
+			cluster.collectJobDuration(reg, "delayed", url, res.Delayed.Start.Unix(), res.Delayed.End.Unix(), res.Delayed.Error == "")
+		}
+	}
+}
+
+func (cluster *Cluster) collectJobDuration(reg *prometheus.Registry, job string, url string, start int64, end int64, success bool) {
+	labels := prometheus.Labels{"cluster": cluster.Name, "job": job, "server": url}
+	reg.Gauge("replication_manager_job_last_duration_seconds", "Duration of the last job", float64(end-start), labels)
+	reg.Gauge("replication_manager_job_last_success", "Last job succeeded", prometheus.Bool(success), labels)
+	reg.Gauge("replication_manager_job_last_timestamp_seconds", "End time of the last job", float64(end), labels)
+}
+
+// GetPrometheusMetrics returns the metrics of a server in the text exposition format
+func (server *ServerMonitor) GetPrometheusMetrics() string {
+	reg := prometheus.NewRegistry()
+	server.collectPrometheusMetrics(reg)
+	var s strings.Builder
+	reg.WriteTo(&s)
+	return s.String()
+}
@@ -0,0 +1,45 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/signal18/replication-manager/utils/prometheus"
+)
+
+func TestPrometheusFailuresGauges(t *testing.T) {
+	cluster := &Cluster{Name: "c1"}
+	server := &ServerMonitor{URL: "db1:3306", ClusterGroup: cluster, State: stateFailed, FailCount: 3}
+	proxy := &Proxy{Name: "px1", Type: "haproxy", State: stateFailed, FailCount: 2}
+	reg := prometheus.NewRegistry()
+	server.collectPrometheusMetrics(reg)
+	cluster.collectProxyPrometheusMetrics(reg, proxy)
+	var b bytes.Buffer
+	if _, err := reg.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, line := range []string{
+		"# TYPE replication_manager_server_failures gauge",
+		`replication_manager_server_failures{cluster="c1",role="failed",server="db1:3306"} 3`,
+		"# TYPE replication_manager_proxy_failures gauge",
+		`replication_manager_proxy_failures{cluster="c1",proxy="px1",proxy_type="haproxy"} 2`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Fatalf("Expected %s in:\n%s", line, out)
+		}
+	}
+	if strings.Contains(out, "failures_total") {
+		t.Fatal("Expected the failures reset by a successful check not exported as counters")
+	}
+}
@@ -0,0 +1,94 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"regexp"
+
+	"github.com/signal18/replication-manager/config"
+)
+
+// AddQueryRule records a query rule enforced by MyProxy and persists the rule list, a rule with
+// an existing id replaces it, a rule without id gets the next free id
+func (cluster *Cluster) AddQueryRule(rule config.QueryRule) (config.QueryRule, error) {
+	if rule.Match_Digest.Valid {
+		if _, err := regexp.Compile(rule.Match_Digest.String); err != nil {
+			return rule, err
+		}
+	}
+	if rule.Match_Pattern.Valid {
+		if _, err := regexp.Compile(rule.Match_Pattern.String); err != nil {
+			return rule, err
+		}
+	}
+	if rule.ReplacePattern.Valid && !rule.Match_Pattern.Valid {
+		return rule, errors.New("Rewrite rule needs a match pattern")
+	}
+	if rule.RateLimit < 0 {
+		return rule, errors.New("Rate limit must be positive")
+	}
+	cluster.queryRulesMutex.Lock()
+	if rule.Id == 0 {
+		for id := range cluster.QueryRules {
+			if id > rule.Id {
+				rule.Id = id
+			}
+		}
+		rule.Id++
+	}
+	cluster.QueryRules[rule.Id] = rule
+	cluster.queryRulesMutex.Unlock()
+	cluster.LogPrintf(LvlInfo, "Query rule %d added", rule.Id)
+	return rule, cluster.saveQueryRules()
+}
+
+// DeleteQueryRule removes a query rule by id
+func (cluster *Cluster) DeleteQueryRule(id uint32) error {
+	cluster.queryRulesMutex.Lock()
+	if _, ok := cluster.QueryRules[id]; !ok {
+		cluster.queryRulesMutex.Unlock()
+		return errors.New("Query rule not found")
+	}
+	delete(cluster.QueryRules, id)
+	cluster.queryRulesMutex.Unlock()
+	cluster.LogPrintf(LvlInfo, "Query rule %d deleted", id)
+	return cluster.saveQueryRules()
+}
+
+func (cluster *Cluster) saveQueryRules() error {
+	cluster.queryRulesMutex.Lock()
+	saveJson, _ := json.MarshalIndent(cluster.QueryRules, "", "\t")
+	cluster.queryRulesMutex.Unlock()
+	err := ioutil.WriteFile(cluster.WorkingDir+"/queryrules.json", saveJson, 0644)
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Could not save query rules: %s", err)
+	}
+	return err
+}
+
+func (cluster *Cluster) loadQueryRules() error {
+	file, err := ioutil.ReadFile(cluster.WorkingDir + "/queryrules.json")
+	if err != nil {
+		return err
+	}
+	rules := make(map[uint32]config.QueryRule)
+	err = json.Unmarshal(file, &rules)
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "File error: %v\n", err)
+		return err
+	}
+	cluster.queryRulesMutex.Lock()
+	cluster.QueryRules = rules
+	cluster.queryRulesMutex.Unlock()
+	return nil
+}
@@ -0,0 +1,195 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/signal18/replication-manager/utils/objstore"
+)
+
+// getBackupStore returns the object storage of the backups
+func (cluster *Cluster) getBackupStore() (*objstore.Store, error) {
+	return objstore.New(objstore.Config{
+		Endpoint:    cluster.Conf.BackupS3Endpoint,
+		Region:      cluster.Conf.BackupS3Region,
+		Bucket:      cluster.Conf.BackupS3Bucket,
+		AccessKey:   cluster.Conf.BackupS3AwsAccessKeyId,
+		SecretKey:   cluster.Conf.BackupS3AwsAccessSecret,
+		PathStyle:   cluster.Conf.BackupS3PathStyle,
+		SSE:         cluster.Conf.BackupS3SSE,
+		SSEKmsKeyId: cluster.Conf.BackupS3SSEKmsKeyId,
+		PartSize:    int64(cluster.Conf.BackupS3PartSize) * 1024 * 1024,
+		Concurrency: cluster.Conf.BackupS3Concurrency,
+	})
+}
+
+// getBackupS3Prefix returns the key prefix of the backups of a server and tool, one sub directory per backup id
+func (cluster *Cluster) getBackupS3Prefix(server *ServerMonitor, tool string) string {
+	prefix := cluster.Name + "/" + server.Host + "_" + server.Port + "/" + tool + "/"
+	if p := strings.Trim(cluster.Conf.BackupS3Prefix, "/"); p != "" {
+		prefix = p + "/" + prefix
+	}
+	return prefix
+}
+
+// IsRemote is true when the backup is stored in the object storage
+func (meta *BackupMeta) IsRemote() bool {
+	return strings.HasPrefix(meta.Dest, "s3://")
+}
+
+// backupS3Writer streams what is written to an object, the checksum and size of the backup are
+// recorded on close
+type backupS3Writer struct {
+	pw   *io.PipeWriter
+	hash hash.Hash
+	meta *BackupMeta
+	done chan error
+}
+
+// newBackupS3Writer starts the upload of a backup file, the meta destination becomes the object url
+func (cluster *Cluster) newBackupS3Writer(meta *BackupMeta, source *ServerMonitor, filename string) (*backupS3Writer, error) {
+	store, err := cluster.getBackupStore()
+	if err != nil {
+		return nil, err
+	}
+	key := cluster.getBackupS3Prefix(source, meta.Tool) + meta.Id + "/" + filename
+	meta.Dest = store.URL(key)
+	meta.Size = 0
+	pr, pw := io.Pipe()
+	w := &backupS3Writer{pw: pw, hash: sha256.New(), meta: meta, done: make(chan error, 1)}
+	go func() {
+		err := store.Upload(key, pr)
+		// unblock the writer when the upload stops before the end of the stream
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+	cluster.LogPrintf(LvlInfo, "Streaming backup to %s", meta.Dest)
+	return w, nil
+}
+
+func (w *backupS3Writer) Write(p []byte) (int, error) {
+	n, err := w.pw.Write(p)
+	w.hash.Write(p[:n])
+	w.meta.Size += int64(n)
+	return n, err
+}
+
+func (w *backupS3Writer) Close() error {
+	return w.CloseWithError(nil)
+}
+
+// CloseWithError ends the stream, a non nil error aborts the upload
+func (w *backupS3Writer) CloseWithError(err error) error {
+	w.pw.CloseWithError(err)
+	uploadErr := <-w.done
+	if err != nil {
+		return err
+	}
+	if uploadErr == nil {
+		w.meta.Checksum = hex.EncodeToString(w.hash.Sum(nil))
+	}
+	return uploadErr
+}
+
+// closeBackupWriter closes a backup file or stream, aborting a stream when the backup failed
+func closeBackupWriter(w io.WriteCloser, err error) error {
+	if a, ok := w.(interface{ CloseWithError(error) error }); ok && err != nil {
+		return a.CloseWithError(err)
+	}
+	return w.Close()
+}
+
+// uploadBackupDir uploads the files of a dump directory, checksum and binlog coordinates are
+// read from the local files before the meta destination becomes the object prefix
+func (cluster *Cluster) uploadBackupDir(meta *BackupMeta, source *ServerMonitor) error {
+	store, err := cluster.getBackupStore()
+	if err != nil {
+		return err
+	}
+	meta.Size, meta.Checksum, err = getBackupChecksum(meta)
+	if err != nil {
+		return err
+	}
+	cluster.readBackupCoordinates(meta)
+	files, err := ioutil.ReadDir(meta.Dest)
+	if err != nil {
+		return err
+	}
+	prefix := cluster.getBackupS3Prefix(source, meta.Tool) + meta.Id + "/"
+	for _, fi := range files {
+		if fi.IsDir() || !isBackupFile(meta, fi.Name()) {
+			continue
+		}
+		f, err := os.Open(filepath.Join(meta.Dest, fi.Name()))
+		if err != nil {
+			return err
+		}
+		err = store.Upload(prefix+fi.Name(), f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	cluster.LogPrintf(LvlInfo, "Backup %s uploaded to %s", meta.Dest, store.URL(prefix))
+	meta.Dest = store.URL(prefix)
+	return nil
+}
+
+// purgeBackupS3 deletes the backups of a server and tool expired by the backup-keep-* settings
+func (cluster *Cluster) purgeBackupS3(source *ServerMonitor, tool string) {
+	store, err := cluster.getBackupStore()
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Backup S3 retention: %s", err)
+		return
+	}
+	retention := objstore.Retention{
+		Hourly:  cluster.Conf.BackupKeepHourly,
+		Daily:   cluster.Conf.BackupKeepDaily,
+		Weekly:  cluster.Conf.BackupKeepWeekly,
+		Monthly: cluster.Conf.BackupKeepMonthly,
+		Yearly:  cluster.Conf.BackupKeepYearly,
+	}
+	snapshots, err := store.ListSnapshots(cluster.getBackupS3Prefix(source, tool))
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Backup S3 retention list: %s", err)
+		return
+	}
+	_, expired := retention.Apply(snapshots)
+	for _, s := range expired {
+		if err := store.DeleteSnapshot(s); err != nil {
+			cluster.LogPrintf(LvlErr, "Backup S3 retention delete %s: %s", store.URL(s.Prefix), err)
+			continue
+		}
+		cluster.LogPrintf(LvlInfo, "Backup S3 retention deleted %s of %s", store.URL(s.Prefix), s.Time)
+		cluster.deleteBackupMetaByDest(store.URL(s.Prefix))
+	}
+}
+
+// deleteBackupMetaByDest removes the catalog entries of a deleted object prefix
+func (cluster *Cluster) deleteBackupMetaByDest(prefix string) {
+	cluster.backupCatalogMutex.Lock()
+	var catalog backupCatalog
+	for _, meta := range cluster.BackupCatalog {
+		if !strings.HasPrefix(meta.Dest, prefix) {
+			catalog = append(catalog, meta)
+		}
+	}
+	cluster.BackupCatalog = catalog
+	cluster.backupCatalogMutex.Unlock()
+	cluster.saveBackupCatalog()
+}
@@ -218,6 +218,23 @@ func (cluster *Cluster) SetSchedulerDbJobsSsh() {
 	}
 }
 
+func (cluster *Cluster) SetSchedulerBackupVerify() {
+	if cluster.HasSchedulerEntry("backupverify") {
+		cluster.LogPrintf(LvlInfo, "Disable backup verification")
+		cluster.scheduler.Remove(cluster.idSchedulerBackupVerify)
+	}
+	if cluster.Conf.SchedulerBackupVerify {
+		var err error
+		cluster.LogPrintf(LvlInfo, "Schedule backup verification at: %s", cluster.Conf.BackupVerifyCron)
+		cluster.idSchedulerBackupVerify, err = cluster.scheduler.AddFunc(cluster.Conf.BackupVerifyCron, func() {
+			cluster.JobVerifyBackup()
+		})
+		if err == nil {
+			cluster.Schedule["backupverify"] = cluster.scheduler.Entry(cluster.idSchedulerBackupVerify)
+		}
+	}
+}
+
 func (cluster *Cluster) SetCfgGroupDisplay(cfgGroup string) {
 	cluster.cfgGroupDisplay = cfgGroup
 }
@@ -779,6 +796,12 @@ func (cluster *Cluster) SetSchedulerDbServersPhysicalBackupCron(value string) er
 	return nil
 }
 
+func (cluster *Cluster) SetSchedulerDbServersBackupVerifyCron(value string) error {
+	cluster.Conf.BackupVerifyCron = value
+	cluster.SetSchedulerBackupVerify()
+	return nil
+}
+
 func (cluster *Cluster) SetSchedulerDbServersOptimizeCron(value string) error {
 	cluster.Conf.BackupDatabaseOptimizeCron = value
 	cluster.SetSchedulerOptimize()
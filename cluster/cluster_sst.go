@@ -7,11 +7,13 @@
 package cluster
 
 import (
+	"compress/gzip"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"time"
@@ -24,8 +26,10 @@ type SST struct {
 	tcplistener     *net.TCPListener
 	outfilewriter   io.Writer
 	outresticreader io.WriteCloser
+	outcloser       io.WriteCloser
 	cluster         *Cluster
 	port            int
+	callback        func(err error)
 }
 
 type ProtectedSSTconnections struct {
@@ -146,6 +150,36 @@ func (cluster *Cluster) SSTRunReceiverToFile(filename string, openfile string) (
 	return strconv.Itoa(destinationPort), nil
 }
 
+// SSTRunReceiverToWriter receives a stream into a writer closed at the end of the stream, the callback
+// gets the close error
+func (cluster *Cluster) SSTRunReceiverToWriter(w io.WriteCloser, callback func(err error)) (string, error) {
+	sst := new(SST)
+	sst.cluster = cluster
+	sst.callback = callback
+	sst.outfilewriter = w
+	sst.outcloser = w
+
+	var err error
+	sst.listener, err = net.Listen("tcp", cluster.Conf.BindAddr+":0")
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Exiting SST on socket listen %s", err)
+		closeBackupWriter(w, err)
+		return "", err
+	}
+	sst.tcplistener = sst.listener.(*net.TCPListener)
+	sst.tcplistener.SetDeadline(time.Now().Add(time.Second * 120))
+	destinationPort := sst.listener.Addr().(*net.TCPAddr).Port
+	if sst.cluster.Conf.LogSST {
+		cluster.LogPrintf(LvlInfo, "Listening for SST on port %d", destinationPort)
+	}
+	SSTs.Lock()
+	SSTs.SSTconnections[destinationPort] = sst
+	SSTs.Unlock()
+	go sst.tcp_con_handle_to_file()
+
+	return strconv.Itoa(destinationPort), nil
+}
+
 func (sst *SST) tcp_con_handle_to_file() {
 
 	var err error
@@ -156,11 +190,21 @@ func (sst *SST) tcp_con_handle_to_file() {
 		}
 		port := sst.listener.Addr().(*net.TCPAddr).Port
 		sst.tcplistener.Close()
-		sst.file.Close()
+		if sst.file != nil {
+			sst.file.Close()
+		}
+		if sst.outcloser != nil {
+			if cerr := closeBackupWriter(sst.outcloser, err); cerr != nil {
+				err = cerr
+			}
+		}
 		sst.listener.Close()
 		SSTs.Lock()
 		delete(SSTs.SSTconnections, port)
 		SSTs.Unlock()
+		if sst.callback != nil {
+			sst.callback(err)
+		}
 	}()
 
 	sst.in, err = sst.listener.Accept()
@@ -295,25 +339,31 @@ func (cluster *Cluster) SSTRunSender(backupfile string, sv *ServerMonitor) {
 		return
 	}
 	defer client.Close()
-	file, err := os.Open(backupfile)
+	// backups are decrypted and sent as the host job expects them, gzip for mysqldump and plain for physical
+	file, err := cluster.openBackupFile(backupfile)
 	if err != nil {
 		cluster.LogPrintf(LvlErr, "SST failed to open backup file server %s %s ", sv.URL, err)
 		return
 	}
+	defer file.Close()
 	/*fileInfo, err := file.Stat()
 	if err != nil {
 		fmt.Println(err)
 		return
 	}*/
 
-	sendBuffer := make([]byte, 16384)
+	var out io.WriteCloser = client
+	if isBackupDumpFile(filepath.Base(backupfile)) {
+		out = gzip.NewWriter(client)
+	}
 	fmt.Println("Start sending file!")
-	for {
-		_, err = file.Read(sendBuffer)
-		if err == io.EOF {
-			break
-		}
-		client.Write(sendBuffer)
+	_, err = io.CopyBuffer(out, file, make([]byte, 16384))
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "SST failed sending backup file to server %s %s ", sv.URL, err)
+		return
 	}
 	cluster.LogPrintf(LvlInfo, "Backup has been sent, closing connection!")
 
@@ -27,6 +27,9 @@ func (cluster *Cluster) SwitchProvDockerDaemonPrivate() {
 func (cluster *Cluster) SwitchBackupRestic() {
 	cluster.Conf.BackupRestic = !cluster.Conf.BackupRestic
 }
+func (cluster *Cluster) SwitchBackupS3() {
+	cluster.Conf.BackupS3 = !cluster.Conf.BackupS3
+}
 func (cluster *Cluster) SwitchBackupBinlogs() {
 	cluster.Conf.BackupBinlogs = !cluster.Conf.BackupBinlogs
 }
@@ -132,6 +135,11 @@ func (cluster *Cluster) SwitchSchedulerBackupPhysical() {
 	cluster.SetSchedulerBackupPhysical()
 }
 
+func (cluster *Cluster) SwitchSchedulerBackupVerify() {
+	cluster.Conf.SchedulerBackupVerify = !cluster.Conf.SchedulerBackupVerify
+	cluster.SetSchedulerBackupVerify()
+}
+
 func (cluster *Cluster) SwitchSchedulerDbJobsSsh() {
 	cluster.Conf.SchedulerJobsSSH = !cluster.Conf.SchedulerJobsSSH
 	cluster.SetSchedulerDbJobsSsh()
@@ -15,41 +15,12 @@ import (
 func (cluster *Cluster) LocalhostProvisionProxyService(prx *Proxy) error {
 	prx.GetProxyConfig()
 
-	switch prx.Type {
-	case config.ConstProxySpider:
-		cluster.LogPrintf(LvlInfo, "Bootstrap MariaDB Sharding Cluster")
-		srv, _ := cluster.newServerMonitor(prx.Host+":"+prx.Port, prx.User, prx.Pass, true, "")
-		err := srv.Refresh()
-		if err == nil {
-			cluster.LogPrintf(LvlWarn, "Can connect to requested signal18 sharding proxy")
-			//that's ok a sharding proxy can be decalre in multiple cluster , should not block provisionning
-			cluster.errorChan <- err
-			return nil
-		}
-		srv.ClusterGroup = cluster
-		err = cluster.LocalhostProvisionDatabaseService(srv)
-		if err != nil {
-			cluster.LogPrintf(LvlErr, "Bootstrap MariaDB Sharding Cluster Failed")
-			cluster.errorChan <- err
-			return err
-		}
-		srv.Close()
-		cluster.ShardProxyBootstrap(prx)
-
-	case config.ConstProxySqlproxy:
-		err := cluster.LocalhostProvisionProxySQLService(prx)
-		if err != nil {
-			cluster.LogPrintf(LvlErr, "Bootstrap Proxysql Failed")
-			cluster.errorChan <- err
-			return err
-		}
-	case config.ConstProxyHaproxy:
-		err := cluster.LocalhostProvisionHaProxyService(prx)
-		cluster.errorChan <- err
-		return err
+	var err error
+	if d := GetProxyDriver(prx.Type); d != nil {
+		err = d.Provision(cluster, prx)
 	}
-	cluster.errorChan <- nil
-	return nil
+	cluster.errorChan <- err
+	return err
 }
 
 func (cluster *Cluster) LocalhostUnprovisionProxyService(prx *Proxy) error {
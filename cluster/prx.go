@@ -19,6 +19,7 @@ import (
 
 	"github.com/signal18/replication-manager/config"
 	"github.com/signal18/replication-manager/graphite"
+	"github.com/signal18/replication-manager/router/envoy"
 	"github.com/signal18/replication-manager/router/myproxy"
 	"github.com/signal18/replication-manager/router/proxysql"
 	"github.com/signal18/replication-manager/utils/crypto"
@@ -50,6 +51,7 @@ type Proxy struct {
 	BackendsRead    []Backend            `json:"backendsRead"`
 	Version         string               `json:"version"`
 	InternalProxy   *myproxy.Server      `json:"internalProxy"`
+	XdsServer       *envoy.Server        `json:"-"`
 	ShardProxy      *ServerMonitor       `json:"shardProxy"`
 	ClusterGroup    *Cluster             `json:"-"`
 	Datadir         string               `json:"datadir"`
@@ -334,6 +336,7 @@ func (cluster *Cluster) newProxyList() error {
 		cluster.Proxies[ctproxy], err = cluster.newProxy(prx)
 		ctproxy++
 	}
+	cluster.newDriverProxies()
 
 	return nil
 }
@@ -417,33 +420,22 @@ func (cluster *Cluster) IsProxyEqualMaster() bool {
 
 func (cluster *Cluster) SetProxyServerMaintenance(serverid uint64) {
 	// Found server from ServerId
+	server := cluster.GetServerFromId(serverid)
 	for _, pr := range cluster.Proxies {
-		server := cluster.GetServerFromId(serverid)
-		if cluster.Conf.HaproxyOn && pr.Type == config.ConstProxyHaproxy {
-			if cluster.Conf.HaproxyMode == "runtimeapi" {
-				cluster.setMaintenanceHaproxy(pr, server)
-			}
-			if cluster.Conf.HaproxyMode == "standby" {
-				cluster.initHaproxy(pr)
-			}
-		}
-		if cluster.Conf.MxsOn && pr.Type == config.ConstProxyMaxscale {
-			if cluster.GetMaster() != nil {
-				cluster.setMaintenanceMaxscale(pr, server)
-			}
-		}
-		if cluster.Conf.ProxysqlOn && pr.Type == config.ConstProxySqlproxy {
-			if cluster.GetMaster() != nil {
-				cluster.setMaintenanceProxysql(pr, server)
-			}
+		if d := cluster.getProxyDriver(pr); d != nil {
+			d.SetMaintenance(cluster, pr, server)
 		}
 	}
-	cluster.initConsul()
+	for _, d := range cluster.getDiscoveryDrivers() {
+		d.SetMaintenance(cluster, nil, server)
+	}
 }
 
 // called  by server monitor if state change
 func (cluster *Cluster) backendStateChangeProxies() {
-	cluster.initConsul()
+	for _, d := range cluster.getDiscoveryDrivers() {
+		d.Failover(cluster, nil)
+	}
 }
 
 // Used to monitor proxies call by main monitor loop
@@ -452,20 +444,8 @@ func (cluster *Cluster) refreshProxies(wcg *sync.WaitGroup) {
 
 	for _, pr := range cluster.Proxies {
 		var err error
-		if cluster.Conf.MxsOn && pr.Type == config.ConstProxyMaxscale {
-			err = cluster.refreshMaxscale(pr)
-		}
-		if cluster.Conf.MdbsProxyOn && pr.Type == config.ConstProxySpider {
-			err = cluster.refreshMdbsproxy(nil, pr)
-		}
-		if cluster.Conf.ProxysqlOn && pr.Type == config.ConstProxySqlproxy {
-			err = cluster.refreshProxysql(pr)
-		}
-		if cluster.Conf.HaproxyOn && pr.Type == config.ConstProxyHaproxy {
-			err = cluster.refreshHaproxy(pr)
-		}
-		if cluster.Conf.SphinxOn && pr.Type == config.ConstProxySphinx {
-			err = cluster.refreshSphinx(pr)
+		if d := cluster.getProxyDriver(pr); d != nil {
+			err = d.Refresh(cluster, pr)
 		}
 		if err == nil {
 			pr.FailCount = 0
@@ -499,47 +479,25 @@ func (cluster *Cluster) refreshProxies(wcg *sync.WaitGroup) {
 func (cluster *Cluster) failoverProxies() {
 	for _, pr := range cluster.Proxies {
 		cluster.LogPrintf(LvlInfo, "Failover Proxy Type: %s Host: %s Port: %s", pr.Type, pr.Host, pr.Port)
-		if cluster.Conf.HaproxyOn && pr.Type == config.ConstProxyHaproxy {
-			if cluster.Conf.HaproxyMode == "runtimeapi" {
-				cluster.refreshHaproxy(pr)
-			}
-			if cluster.Conf.HaproxyMode == "standby" {
-				cluster.initHaproxy(pr)
-			}
-		}
-		if cluster.Conf.MxsOn && pr.Type == config.ConstProxyMaxscale {
-			cluster.initMaxscale(nil, pr)
-		}
-		if cluster.Conf.MdbsProxyOn && pr.Type == config.ConstProxySpider {
-			cluster.failoverMdbsproxy(nil, pr)
-		}
-		if cluster.Conf.ProxysqlOn && pr.Type == config.ConstProxySqlproxy {
-			cluster.failoverProxysql(pr)
+		if d := cluster.getProxyDriver(pr); d != nil {
+			d.Failover(cluster, pr)
 		}
 	}
-	cluster.initConsul()
+	for _, d := range cluster.getDiscoveryDrivers() {
+		d.Failover(cluster, nil)
+	}
 }
 
 func (cluster *Cluster) initProxies() {
 	for _, pr := range cluster.Proxies {
 		cluster.LogPrintf(LvlInfo, "New proxy monitored: %s %s:%s", pr.Type, pr.Host, pr.Port)
-		if cluster.Conf.HaproxyOn && pr.Type == config.ConstProxyHaproxy {
-			cluster.initHaproxy(pr)
-		}
-		if cluster.Conf.MxsOn && pr.Type == config.ConstProxyMaxscale {
-			cluster.initMaxscale(nil, pr)
-		}
-		if cluster.Conf.MdbsProxyOn && pr.Type == config.ConstProxySpider {
-			cluster.initMdbsproxy(nil, pr)
-		}
-		if cluster.Conf.ProxysqlOn && pr.Type == config.ConstProxySqlproxy {
-			cluster.initProxysql(pr)
-		}
-		if cluster.Conf.MyproxyOn && pr.Type == config.ConstProxyMyProxy {
-			cluster.initMyProxy(pr)
+		if d := cluster.getProxyDriver(pr); d != nil {
+			d.Init(cluster, pr)
 		}
 	}
-	cluster.initConsul()
+	for _, d := range cluster.getDiscoveryDrivers() {
+		d.Init(cluster, nil)
+	}
 }
 
 func (cluster *Cluster) SendProxyStats(proxy *Proxy) error {
@@ -567,6 +525,11 @@ func (cluster *Cluster) SendProxyStats(proxy *Proxy) error {
 		metrics[3] = graphite.NewMetric(fmt.Sprintf("proxy.%s%s.%s.latency", proxy.Type, proxy.Id, server), wbackend.PrxLatency, time.Now().Unix())
 		graph.SendMetrics(metrics)
 	}
+	if d := cluster.getProxyDriver(proxy); d != nil {
+		if metrics := d.Stats(cluster, proxy); len(metrics) > 0 {
+			graph.SendMetrics(metrics)
+		}
+	}
 
 	graph.Disconnect()
 
@@ -0,0 +1,423 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"fmt"
+	"hash/crc64"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/graphite"
+	"github.com/signal18/replication-manager/router/myproxy"
+)
+
+// ProxyDriver is the set of operations the monitor calls on the proxies of a type, a driver is
+// registered for each proxy type with RegisterProxyDriver
+type ProxyDriver interface {
+	// Enabled returns true when the proxy type is turned on in the cluster configuration
+	Enabled(cluster *Cluster) bool
+	// Init configures a proxy at startup or after a configuration change
+	Init(cluster *Cluster, proxy *Proxy)
+	// Refresh is called by the monitor loop, an error counts as a proxy failure
+	Refresh(cluster *Cluster, proxy *Proxy) error
+	// Failover routes the writes to the new master after a switchover or a failover
+	Failover(cluster *Cluster, proxy *Proxy)
+	// SetMaintenance reflects the maintenance state of a database server on the proxy
+	SetMaintenance(cluster *Cluster, proxy *Proxy, server *ServerMonitor)
+	// Stats returns the metrics of the proxy sent to graphite in addition to the backend metrics
+	Stats(cluster *Cluster, proxy *Proxy) []graphite.Metric
+	// Provision deploys the proxy service on localhost
+	Provision(cluster *Cluster, proxy *Proxy) error
+}
+
+// ProxyLister is implemented by the drivers declaring their own proxies, the proxies of the
+// built-in types are declared from their configuration by newProxyList
+type ProxyLister interface {
+	NewProxies(cluster *Cluster) []*Proxy
+}
+
+// ProxyDiscovery is implemented by the drivers publishing the routes of the cluster without
+// managing proxies, like consul, their operations are called once per cluster with a nil proxy
+type ProxyDiscovery interface {
+	IsDiscovery() bool
+}
+
+var (
+	proxyDriversMutex sync.RWMutex
+	proxyDrivers      = make(map[string]ProxyDriver)
+)
+
+func init() {
+	RegisterProxyDriver(config.ConstProxyHaproxy, haproxyDriver{})
+	RegisterProxyDriver(config.ConstProxyMaxscale, maxscaleDriver{})
+	RegisterProxyDriver(config.ConstProxySqlproxy, proxysqlDriver{})
+	RegisterProxyDriver(config.ConstProxySpider, shardproxyDriver{})
+	RegisterProxyDriver(config.ConstProxySphinx, sphinxDriver{})
+	RegisterProxyDriver(config.ConstProxyMyProxy, myproxyDriver{})
+	RegisterProxyDriver(config.ConstProxyEnvoy, envoyDriver{})
+	RegisterProxyDriver(config.ConstProxyConsul, consulDriver{})
+}
+
+// RegisterProxyDriver sets the driver of a proxy type, registering a type again replaces its driver
+func RegisterProxyDriver(proxyType string, driver ProxyDriver) {
+	proxyDriversMutex.Lock()
+	defer proxyDriversMutex.Unlock()
+	proxyDrivers[proxyType] = driver
+}
+
+// GetProxyDriver returns the driver of a proxy type, nil for a type without driver
+func GetProxyDriver(proxyType string) ProxyDriver {
+	proxyDriversMutex.RLock()
+	defer proxyDriversMutex.RUnlock()
+	return proxyDrivers[proxyType]
+}
+
+// GetProxyDriverTypes returns the registered proxy types
+func GetProxyDriverTypes() []string {
+	proxyDriversMutex.RLock()
+	defer proxyDriversMutex.RUnlock()
+	types := make([]string, 0, len(proxyDrivers))
+	for t := range proxyDrivers {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func isDiscoveryDriver(d ProxyDriver) bool {
+	dd, ok := d.(ProxyDiscovery)
+	return ok && dd.IsDiscovery()
+}
+
+// getProxyDriver returns the driver of an enabled proxy
+func (cluster *Cluster) getProxyDriver(proxy *Proxy) ProxyDriver {
+	d := GetProxyDriver(proxy.Type)
+	if d == nil || isDiscoveryDriver(d) || !d.Enabled(cluster) {
+		return nil
+	}
+	return d
+}
+
+// getDiscoveryDrivers returns the enabled discovery drivers
+func (cluster *Cluster) getDiscoveryDrivers() []ProxyDriver {
+	var drivers []ProxyDriver
+	for _, t := range GetProxyDriverTypes() {
+		d := GetProxyDriver(t)
+		if isDiscoveryDriver(d) && d.Enabled(cluster) {
+			drivers = append(drivers, d)
+		}
+	}
+	return drivers
+}
+
+// newDriverProxies appends the proxies declared by the enabled drivers implementing ProxyLister
+func (cluster *Cluster) newDriverProxies() {
+	for _, t := range GetProxyDriverTypes() {
+		d := GetProxyDriver(t)
+		l, ok := d.(ProxyLister)
+		if !ok || !d.Enabled(cluster) {
+			continue
+		}
+		for _, prx := range l.NewProxies(cluster) {
+			prx.Type = t
+			if prx.Name == "" {
+				prx.Name = prx.Host
+			}
+			if prx.Id == "" {
+				prx.Id = "px" + strconv.FormatUint(crc64.Checksum([]byte(cluster.Name+prx.Name+":"+prx.Port), crc64.MakeTable(crc64.ECMA)), 10)
+			}
+			prx.ClusterGroup = cluster
+			prx.SetDataDir()
+			cluster.LogPrintf(LvlInfo, "New proxy monitored %s: %s:%s", prx.Type, prx.Host, prx.Port)
+			p, _ := cluster.newProxy(prx)
+			cluster.Proxies = append(cluster.Proxies, p)
+		}
+	}
+}
+
+type haproxyDriver struct{}
+
+func (haproxyDriver) Enabled(cluster *Cluster) bool {
+	return cluster.Conf.HaproxyOn
+}
+
+func (haproxyDriver) Init(cluster *Cluster, proxy *Proxy) {
+	cluster.initHaproxy(proxy)
+}
+
+func (haproxyDriver) Refresh(cluster *Cluster, proxy *Proxy) error {
+	return cluster.refreshHaproxy(proxy)
+}
+
+func (haproxyDriver) Failover(cluster *Cluster, proxy *Proxy) {
+	if cluster.Conf.HaproxyMode == "runtimeapi" {
+		cluster.refreshHaproxy(proxy)
+	}
+	if cluster.Conf.HaproxyMode == "standby" {
+		cluster.initHaproxy(proxy)
+	}
+}
+
+func (haproxyDriver) SetMaintenance(cluster *Cluster, proxy *Proxy, server *ServerMonitor) {
+	if cluster.Conf.HaproxyMode == "runtimeapi" {
+		cluster.setMaintenanceHaproxy(proxy, server)
+	}
+	if cluster.Conf.HaproxyMode == "standby" {
+		cluster.initHaproxy(proxy)
+	}
+}
+
+func (haproxyDriver) Stats(cluster *Cluster, proxy *Proxy) []graphite.Metric {
+	return nil
+}
+
+func (haproxyDriver) Provision(cluster *Cluster, proxy *Proxy) error {
+	return cluster.LocalhostProvisionHaProxyService(proxy)
+}
+
+type maxscaleDriver struct{}
+
+func (maxscaleDriver) Enabled(cluster *Cluster) bool {
+	return cluster.Conf.MxsOn
+}
+
+func (maxscaleDriver) Init(cluster *Cluster, proxy *Proxy) {
+	cluster.initMaxscale(nil, proxy)
+}
+
+func (maxscaleDriver) Refresh(cluster *Cluster, proxy *Proxy) error {
+	return cluster.refreshMaxscale(proxy)
+}
+
+func (maxscaleDriver) Failover(cluster *Cluster, proxy *Proxy) {
+	cluster.initMaxscale(nil, proxy)
+}
+
+func (maxscaleDriver) SetMaintenance(cluster *Cluster, proxy *Proxy, server *ServerMonitor) {
+	if cluster.GetMaster() != nil {
+		cluster.setMaintenanceMaxscale(proxy, server)
+	}
+}
+
+func (maxscaleDriver) Stats(cluster *Cluster, proxy *Proxy) []graphite.Metric {
+	return nil
+}
+
+func (maxscaleDriver) Provision(cluster *Cluster, proxy *Proxy) error {
+	return nil
+}
+
+type proxysqlDriver struct{}
+
+func (proxysqlDriver) Enabled(cluster *Cluster) bool {
+	return cluster.Conf.ProxysqlOn
+}
+
+func (proxysqlDriver) Init(cluster *Cluster, proxy *Proxy) {
+	cluster.initProxysql(proxy)
+}
+
+func (proxysqlDriver) Refresh(cluster *Cluster, proxy *Proxy) error {
+	return cluster.refreshProxysql(proxy)
+}
+
+func (proxysqlDriver) Failover(cluster *Cluster, proxy *Proxy) {
+	cluster.failoverProxysql(proxy)
+}
+
+func (proxysqlDriver) SetMaintenance(cluster *Cluster, proxy *Proxy, server *ServerMonitor) {
+	if cluster.GetMaster() != nil {
+		cluster.setMaintenanceProxysql(proxy, server)
+	}
+}
+
+func (proxysqlDriver) Stats(cluster *Cluster, proxy *Proxy) []graphite.Metric {
+	return nil
+}
+
+func (proxysqlDriver) Provision(cluster *Cluster, proxy *Proxy) error {
+	err := cluster.LocalhostProvisionProxySQLService(proxy)
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Bootstrap Proxysql Failed")
+	}
+	return err
+}
+
+type shardproxyDriver struct{}
+
+func (shardproxyDriver) Enabled(cluster *Cluster) bool {
+	return cluster.Conf.MdbsProxyOn
+}
+
+func (shardproxyDriver) Init(cluster *Cluster, proxy *Proxy) {
+	cluster.initMdbsproxy(nil, proxy)
+}
+
+func (shardproxyDriver) Refresh(cluster *Cluster, proxy *Proxy) error {
+	return cluster.refreshMdbsproxy(nil, proxy)
+}
+
+func (shardproxyDriver) Failover(cluster *Cluster, proxy *Proxy) {
+	cluster.failoverMdbsproxy(nil, proxy)
+}
+
+func (shardproxyDriver) SetMaintenance(cluster *Cluster, proxy *Proxy, server *ServerMonitor) {
+}
+
+func (shardproxyDriver) Stats(cluster *Cluster, proxy *Proxy) []graphite.Metric {
+	return nil
+}
+
+func (shardproxyDriver) Provision(cluster *Cluster, proxy *Proxy) error {
+	cluster.LogPrintf(LvlInfo, "Bootstrap MariaDB Sharding Cluster")
+	srv, _ := cluster.newServerMonitor(proxy.Host+":"+proxy.Port, proxy.User, proxy.Pass, true, "")
+	err := srv.Refresh()
+	if err == nil {
+		cluster.LogPrintf(LvlWarn, "Can connect to requested signal18 sharding proxy")
+		//that's ok a sharding proxy can be decalre in multiple cluster , should not block provisionning
+		return nil
+	}
+	srv.ClusterGroup = cluster
+	err = cluster.LocalhostProvisionDatabaseService(srv)
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Bootstrap MariaDB Sharding Cluster Failed")
+		return err
+	}
+	srv.Close()
+	cluster.ShardProxyBootstrap(proxy)
+	return nil
+}
+
+type sphinxDriver struct{}
+
+func (sphinxDriver) Enabled(cluster *Cluster) bool {
+	return cluster.Conf.SphinxOn
+}
+
+func (sphinxDriver) Init(cluster *Cluster, proxy *Proxy) {
+}
+
+func (sphinxDriver) Refresh(cluster *Cluster, proxy *Proxy) error {
+	return cluster.refreshSphinx(proxy)
+}
+
+func (sphinxDriver) Failover(cluster *Cluster, proxy *Proxy) {
+}
+
+func (sphinxDriver) SetMaintenance(cluster *Cluster, proxy *Proxy, server *ServerMonitor) {
+}
+
+func (sphinxDriver) Stats(cluster *Cluster, proxy *Proxy) []graphite.Metric {
+	return nil
+}
+
+func (sphinxDriver) Provision(cluster *Cluster, proxy *Proxy) error {
+	return nil
+}
+
+type myproxyDriver struct{}
+
+func (myproxyDriver) Enabled(cluster *Cluster) bool {
+	return cluster.Conf.MyproxyOn
+}
+
+func (myproxyDriver) Init(cluster *Cluster, proxy *Proxy) {
+	cluster.initMyProxy(proxy)
+}
+
+func (myproxyDriver) Refresh(cluster *Cluster, proxy *Proxy) error {
+	return cluster.refreshMyProxy(proxy)
+}
+
+func (myproxyDriver) Failover(cluster *Cluster, proxy *Proxy) {
+	cluster.refreshMyProxy(proxy)
+}
+
+func (myproxyDriver) SetMaintenance(cluster *Cluster, proxy *Proxy, server *ServerMonitor) {
+	cluster.refreshMyProxy(proxy)
+}
+
+// Stats returns the statistics of the query digests, a digest is recorded per user and schema
+func (myproxyDriver) Stats(cluster *Cluster, proxy *Proxy) []graphite.Metric {
+	if proxy.InternalProxy == nil {
+		return nil
+	}
+	var metrics []graphite.Metric
+	now := time.Now().Unix()
+	for _, d := range proxy.InternalProxy.GetDigestStats() {
+		digest := getMyproxyDigestPath(d)
+		metrics = append(metrics,
+			graphite.NewMetric(fmt.Sprintf("proxy.%s%s.%s.count", proxy.Type, proxy.Id, digest), strconv.FormatUint(d.CountStar, 10), now),
+			graphite.NewMetric(fmt.Sprintf("proxy.%s%s.%s.sum_time", proxy.Type, proxy.Id, digest), strconv.FormatUint(d.SumTime, 10), now),
+			graphite.NewMetric(fmt.Sprintf("proxy.%s%s.%s.max_time", proxy.Type, proxy.Id, digest), strconv.FormatUint(d.MaxTime, 10), now),
+			graphite.NewMetric(fmt.Sprintf("proxy.%s%s.%s.rows_sent", proxy.Type, proxy.Id, digest), strconv.FormatUint(d.RowsSent, 10), now),
+			graphite.NewMetric(fmt.Sprintf("proxy.%s%s.%s.errors", proxy.Type, proxy.Id, digest), strconv.FormatUint(d.Errors, 10), now))
+	}
+	return metrics
+}
+
+var myproxyGraphiteReplacer = strings.NewReplacer(".", "_", " ", "_", "/", "_", "*", "_", "`", "", "'", "", "\"", "")
+
+// getMyproxyDigestPath returns the graphite path of a digest under its user and schema, the digest other and the
+// queries without schema have the user or the schema none
+func getMyproxyDigestPath(d myproxy.DigestStats) string {
+	path := "digests"
+	for _, name := range []string{d.UserName, d.SchemaName, d.Digest} {
+		if name == "" {
+			name = "none"
+		}
+		path += "." + myproxyGraphiteReplacer.Replace(name)
+	}
+	return path
+}
+
+func (myproxyDriver) Provision(cluster *Cluster, proxy *Proxy) error {
+	return nil
+}
+
+// consulDriver registers the write and read services of the cluster in consul
+type consulDriver struct{}
+
+func (consulDriver) IsDiscovery() bool {
+	return true
+}
+
+func (consulDriver) Enabled(cluster *Cluster) bool {
+	return cluster.Conf.RegistryConsul
+}
+
+func (consulDriver) Init(cluster *Cluster, proxy *Proxy) {
+	cluster.initConsul()
+}
+
+func (consulDriver) Refresh(cluster *Cluster, proxy *Proxy) error {
+	return nil
+}
+
+func (consulDriver) Failover(cluster *Cluster, proxy *Proxy) {
+	cluster.initConsul()
+}
+
+func (consulDriver) SetMaintenance(cluster *Cluster, proxy *Proxy, server *ServerMonitor) {
+	cluster.initConsul()
+}
+
+func (consulDriver) Stats(cluster *Cluster, proxy *Proxy) []graphite.Metric {
+	return nil
+}
+
+func (consulDriver) Provision(cluster *Cluster, proxy *Proxy) error {
+	return nil
+}
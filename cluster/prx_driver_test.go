@@ -0,0 +1,105 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/signal18/replication-manager/graphite"
+	"github.com/signal18/replication-manager/router/myproxy"
+)
+
+type testProxyDriver struct {
+	inits     int
+	refreshes int
+	failovers int
+	fail      bool
+}
+
+func (d *testProxyDriver) Enabled(cluster *Cluster) bool       { return true }
+func (d *testProxyDriver) Init(cluster *Cluster, proxy *Proxy) { d.inits++ }
+func (d *testProxyDriver) Refresh(cluster *Cluster, proxy *Proxy) error {
+	d.refreshes++
+	if d.fail {
+		return errors.New("proxy down")
+	}
+	return nil
+}
+func (d *testProxyDriver) Failover(cluster *Cluster, proxy *Proxy) { d.failovers++ }
+func (d *testProxyDriver) SetMaintenance(cluster *Cluster, proxy *Proxy, server *ServerMonitor) {
+}
+func (d *testProxyDriver) Stats(cluster *Cluster, proxy *Proxy) []graphite.Metric { return nil }
+func (d *testProxyDriver) Provision(cluster *Cluster, proxy *Proxy) error         { return nil }
+func (d *testProxyDriver) NewProxies(cluster *Cluster) []*Proxy {
+	return []*Proxy{{Host: "127.0.0.1", Port: "6033"}}
+}
+
+func TestProxyDriver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prxdriver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := &testProxyDriver{}
+	RegisterProxyDriver("testproxy", d)
+	defer func() {
+		proxyDriversMutex.Lock()
+		delete(proxyDrivers, "testproxy")
+		proxyDriversMutex.Unlock()
+	}()
+
+	cluster := &Cluster{Name: "test"}
+	cluster.Conf.WorkingDir = dir
+	cluster.Conf.MaxFail = 2
+	cluster.newProxyList()
+	if len(cluster.Proxies) != 1 || cluster.Proxies[0].Type != "testproxy" || cluster.Proxies[0].Id == "" {
+		t.Fatalf("Proxy of the driver not declared: %v", cluster.Proxies)
+	}
+	cluster.initProxies()
+	cluster.failoverProxies()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	cluster.refreshProxies(&wg)
+	if d.inits != 1 || d.failovers != 1 || d.refreshes != 1 {
+		t.Fatalf("Unexpected driver calls init %d failover %d refresh %d", d.inits, d.failovers, d.refreshes)
+	}
+	if cluster.Proxies[0].State != stateProxyRunning {
+		t.Fatalf("Proxy state %s, expected %s", cluster.Proxies[0].State, stateProxyRunning)
+	}
+	d.fail = true
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		cluster.refreshProxies(&wg)
+	}
+	if cluster.Proxies[0].State != stateFailed {
+		t.Fatalf("Proxy state %s, expected %s", cluster.Proxies[0].State, stateFailed)
+	}
+}
+
+func TestMyproxyDigestPath(t *testing.T) {
+	for _, c := range []struct {
+		d    myproxy.DigestStats
+		path string
+	}{
+		{myproxy.DigestStats{UserName: "app", SchemaName: "shop", Digest: "3f2a"}, "digests.app.shop.3f2a"},
+		{myproxy.DigestStats{UserName: "report.ro", SchemaName: "shop", Digest: "3f2a"}, "digests.report_ro.shop.3f2a"},
+		{myproxy.DigestStats{UserName: "app", Digest: "3f2a"}, "digests.app.none.3f2a"},
+		{myproxy.DigestStats{Digest: myproxy.DigestOther}, "digests.none.none.other"},
+	} {
+		if path := getMyproxyDigestPath(c.d); path != c.path {
+			t.Fatalf("Expected %s, got %s", c.path, path)
+		}
+	}
+}
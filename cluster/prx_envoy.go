@@ -0,0 +1,135 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/signal18/replication-manager/graphite"
+	"github.com/signal18/replication-manager/router/envoy"
+)
+
+// envoyDriver serves the routing of the cluster to the Envoy nodes from the xDS control plane shared by
+// the clusters, the routing is stored under the cluster name for the nodes having it as node id or node cluster
+type envoyDriver struct{}
+
+func (envoyDriver) Enabled(cluster *Cluster) bool {
+	return cluster.Conf.EnvoyOn
+}
+
+func (envoyDriver) NewProxies(cluster *Cluster) []*Proxy {
+	prx := new(Proxy)
+	prx.Host = "0.0.0.0"
+	prx.Port = strconv.Itoa(cluster.Conf.EnvoyXdsPort)
+	prx.WritePort = cluster.Conf.EnvoyWritePort
+	prx.ReadPort = cluster.Conf.EnvoyReadPort
+	prx.ReadWritePort = cluster.Conf.EnvoyWritePort
+	return []*Proxy{prx}
+}
+
+func (envoyDriver) Init(cluster *Cluster, proxy *Proxy) {
+	cluster.initEnvoy(proxy)
+}
+
+func (envoyDriver) Refresh(cluster *Cluster, proxy *Proxy) error {
+	return cluster.refreshEnvoy(proxy)
+}
+
+func (envoyDriver) Failover(cluster *Cluster, proxy *Proxy) {
+	cluster.refreshEnvoy(proxy)
+}
+
+func (envoyDriver) SetMaintenance(cluster *Cluster, proxy *Proxy, server *ServerMonitor) {
+	cluster.refreshEnvoy(proxy)
+}
+
+func (envoyDriver) Stats(cluster *Cluster, proxy *Proxy) []graphite.Metric {
+	return nil
+}
+
+func (envoyDriver) Provision(cluster *Cluster, proxy *Proxy) error {
+	return nil
+}
+
+// SetEnvoyServer sets the xDS control plane serving the routing of the cluster
+func (cluster *Cluster) SetEnvoyServer(xds *envoy.Server) {
+	cluster.xdsServer = xds
+}
+
+func (cluster *Cluster) initEnvoy(proxy *Proxy) {
+	proxy.XdsServer = cluster.xdsServer
+	if proxy.XdsServer == nil {
+		cluster.LogPrintf(LvlErr, "Envoy xDS control plane not started")
+		return
+	}
+	cluster.LogPrintf(LvlInfo, "Envoy routing of the nodes with id or cluster %s served on port %s", cluster.Name, proxy.Port)
+	cluster.refreshEnvoy(proxy)
+}
+
+// refreshEnvoy pushes the writer and the reader clusters to the Envoy nodes, the writer endpoint is the
+// master and the reader endpoints are the slaves replicating with a lag under envoy-read-max-lag, or the
+// master when no slave can serve the reads
+func (cluster *Cluster) refreshEnvoy(proxy *Proxy) error {
+	if proxy.XdsServer == nil {
+		return errors.New("Envoy xDS control plane not started")
+	}
+	writer := envoy.Cluster{Name: cluster.Name + "-write"}
+	reader := envoy.Cluster{Name: cluster.Name + "-read"}
+	proxy.BackendsWrite = nil
+	proxy.BackendsRead = nil
+	master := cluster.GetMaster()
+	if master != nil && !master.IsDown() && !master.IsMaintenance {
+		writer.Endpoints = append(writer.Endpoints, cluster.getEnvoyEndpoint(master))
+		proxy.BackendsWrite = append(proxy.BackendsWrite, cluster.getEnvoyBackend(master))
+	}
+	for _, s := range cluster.slaves {
+		if s.IsMaintenance || s.IsIgnored() || s.IsDelayed || (s.State != stateSlave && s.State != stateRelay) {
+			continue
+		}
+		if cluster.Conf.EnvoyReadMaxLag > 0 && s.GetReplicationDelay() > cluster.Conf.EnvoyReadMaxLag {
+			continue
+		}
+		reader.Endpoints = append(reader.Endpoints, cluster.getEnvoyEndpoint(s))
+		proxy.BackendsRead = append(proxy.BackendsRead, cluster.getEnvoyBackend(s))
+	}
+	if len(reader.Endpoints) == 0 {
+		reader.Endpoints = writer.Endpoints
+	}
+	snap := envoy.Snapshot{
+		Clusters: []envoy.Cluster{writer, reader},
+		Listeners: []envoy.Listener{
+			{Name: writer.Name, Host: "0.0.0.0", Port: proxy.WritePort, Cluster: writer.Name},
+			{Name: reader.Name, Host: "0.0.0.0", Port: proxy.ReadPort, Cluster: reader.Name},
+		},
+	}
+	if proxy.XdsServer.SetSnapshot(cluster.Name, snap) {
+		_, version := proxy.XdsServer.GetSnapshot(cluster.Name)
+		cluster.LogPrintf(LvlInfo, "Envoy routing version %s pushed to %d nodes, writer %d endpoints, reader %d endpoints", version, len(proxy.XdsServer.GetNodes(cluster.Name)), len(writer.Endpoints), len(reader.Endpoints))
+	}
+	return nil
+}
+
+func (cluster *Cluster) getEnvoyEndpoint(s *ServerMonitor) envoy.Endpoint {
+	port, _ := strconv.Atoi(s.Port)
+	return envoy.Endpoint{Host: s.Host, Port: port}
+}
+
+func (cluster *Cluster) getEnvoyBackend(s *ServerMonitor) Backend {
+	return Backend{Host: s.Host, Port: s.Port, Status: s.State, PrxName: s.URL, PrxStatus: "ONLINE", PrxMaintenance: s.IsMaintenance}
+}
+
+// GetEnvoyNodes returns the Envoy nodes served the routing of the cluster by the xDS control plane of a proxy
+func (cluster *Cluster) GetEnvoyNodes(proxy *Proxy) ([]envoy.Node, error) {
+	if proxy.XdsServer == nil {
+		return nil, errors.New("Envoy xDS control plane not started")
+	}
+	return proxy.XdsServer.GetNodes(cluster.Name), nil
+}
@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -22,6 +23,9 @@ import (
 	"github.com/signal18/replication-manager/utils/state"
 )
 
+// haproxySlotPrefix is the prefix of the read server slots
+const haproxySlotPrefix = "slot"
+
 func (cluster *Cluster) initHaproxy(proxy *Proxy) {
 	haproxydatadir := proxy.Datadir + "/var"
 
@@ -113,19 +117,25 @@ func (cluster *Cluster) initHaproxy(proxy *Proxy) {
 		cluster.LogPrintf(LvlErr, "Haproxy failed to add backend for service_read")
 	}
 
-	//var checksum64 string
-	//	crcHost := crc64.MakeTable(crc64.ECMA)
-	for _, server := range cluster.Servers {
-		if server.IsMaintenance == false {
-			p, _ := strconv.Atoi(server.Port)
-			//		checksum64 := fmt.Sprintf("%d", crc64.Checksum([]byte(server.Host+":"+server.Port), crcHost))
-			s := haproxy.ServerDetail{Name: server.Id, Host: server.Host, Port: p, Weight: 100, MaxConn: 2000, Check: true, CheckInterval: 1000}
-			if err := haConfig.AddServer("service_read", &s); err != nil {
-				cluster.LogPrintf(LvlErr, "Failed to add server in Haproxy for service_read")
+	if cluster.useHaproxySlots() {
+		// the read servers are assigned to the slots with the runtime API by refreshHaproxy
+		ber.ServerTemplate = &haproxy.ServerTemplate{Prefix: haproxySlotPrefix, Slots: cluster.getHaproxySlots(), Host: "127.0.0.1", Port: 3306, Weight: 100, MaxConn: 2000, Check: true, CheckInterval: 1000}
+	} else {
+		//var checksum64 string
+		//	crcHost := crc64.MakeTable(crc64.ECMA)
+		for _, server := range cluster.Servers {
+			if server.IsMaintenance == false {
+				p, _ := strconv.Atoi(server.Port)
+				//		checksum64 := fmt.Sprintf("%d", crc64.Checksum([]byte(server.Host+":"+server.Port), crcHost))
+				s := haproxy.ServerDetail{Name: server.Id, Host: server.Host, Port: p, Weight: 100, MaxConn: 2000, Check: true, CheckInterval: 1000}
+				if err := haConfig.AddServer("service_read", &s); err != nil {
+					cluster.LogPrintf(LvlErr, "Failed to add server in Haproxy for service_read")
+				}
 			}
 		}
 	}
 
+	prevConfig, _ := ioutil.ReadFile(haConfig.ConfigFile)
 	err = haConfig.Render()
 	if err != nil {
 		cluster.LogPrintf(LvlErr, "Could not render initial haproxy config, exiting...")
@@ -135,6 +145,12 @@ func (cluster *Cluster) initHaproxy(proxy *Proxy) {
 	} else {
 		cluster.LogPrintf(LvlInfo, "Haproxy reload config on pid %s", haConfig.PidFile)
 	}
+	if newConfig, _ := ioutil.ReadFile(haConfig.ConfigFile); prevConfig != nil && bytes.Equal(prevConfig, newConfig) {
+		if pid, _ := ioutil.ReadFile(haConfig.PidFile); len(bytes.TrimSpace(pid)) > 0 {
+			cluster.LogPrintf(LvlInfo, "Haproxy config unchanged, no reload")
+			return
+		}
+	}
 
 	err = haRuntime.Reload(&haConfig)
 	if err != nil {
@@ -143,6 +159,58 @@ func (cluster *Cluster) initHaproxy(proxy *Proxy) {
 
 }
 
+// useHaproxySlots returns true when the read servers are managed in server template slots with the runtime API
+func (cluster *Cluster) useHaproxySlots() bool {
+	return cluster.Conf.HaproxyMode == "runtimeapi" && cluster.Conf.HaproxyServerSlots > 0
+}
+
+// getHaproxySlots returns the number of read server slots, at least the number of database servers
+func (cluster *Cluster) getHaproxySlots() int {
+	if len(cluster.Servers) > cluster.Conf.HaproxyServerSlots {
+		return len(cluster.Servers)
+	}
+	return cluster.Conf.HaproxyServerSlots
+}
+
+// setHaproxySlots assigns the read servers out of maintenance to the slots, the configuration is
+// regenerated with more slots only when the slots are exhausted
+func (cluster *Cluster) setHaproxySlots(proxy *Proxy, haRuntime haproxy.Runtime, slots []haproxy.Slot) {
+	var wanted []string
+	for _, server := range cluster.Servers {
+		if server.IsMaintenance {
+			continue
+		}
+		host := server.Host
+		if net.ParseIP(host) == nil {
+			// the runtime API only sets IP addresses
+			addrs, err := net.LookupHost(host)
+			if err != nil || len(addrs) == 0 {
+				cluster.LogPrintf(LvlErr, "Haproxy could not resolve server %s for a slot: %s", server.URL, err)
+				continue
+			}
+			host = addrs[0]
+		}
+		wanted = append(wanted, net.JoinHostPort(host, server.Port))
+	}
+	changes, err := haproxy.PlanSlots(slots, wanted)
+	for _, c := range changes {
+		host, port := "", ""
+		if c.Addr != "" {
+			host, port, _ = net.SplitHostPort(c.Addr)
+			cluster.LogPrintf(LvlInfo, "Haproxy %s assign slot %s to server %s", proxy.Host+":"+proxy.Port, c.Slot, c.Addr)
+		} else {
+			cluster.LogPrintf(LvlInfo, "Haproxy %s free slot %s", proxy.Host+":"+proxy.Port, c.Slot)
+		}
+		if err := haRuntime.SetSlot(c.Slot, "service_read", host, port); err != nil {
+			cluster.LogPrintf(LvlErr, "Haproxy %s could not set slot %s: %s", proxy.Host+":"+proxy.Port, c.Slot, err)
+		}
+	}
+	if err == haproxy.ErrNoFreeSlot {
+		cluster.LogPrintf(LvlInfo, "Haproxy %s has no free slot for %d servers, regenerating config", proxy.Host+":"+proxy.Port, len(wanted))
+		cluster.initHaproxy(proxy)
+	}
+}
+
 func (cluster *Cluster) refreshHaproxy(proxy *Proxy) error {
 
 	// if proxy.ClusterGroup.Conf.HaproxyStatHttp {
@@ -194,6 +262,7 @@ func (cluster *Cluster) refreshHaproxy(proxy *Proxy) error {
 
 	proxy.BackendsWrite = nil
 	proxy.BackendsRead = nil
+	var slots []haproxy.Slot
 
 	for {
 		line, error := reader.Read()
@@ -236,6 +305,12 @@ func (cluster *Cluster) refreshHaproxy(proxy *Proxy) error {
 
 		}
 		if strings.Contains(strings.ToLower(line[0]), "read") {
+			if cluster.useHaproxySlots() && strings.HasPrefix(line[1], haproxySlotPrefix) {
+				slots = append(slots, haproxy.Slot{Name: line[1], Addr: line[73], Status: line[17]})
+				if strings.HasPrefix(line[17], "MAINT") {
+					continue
+				}
+			}
 			srv := cluster.GetServerFromURL(line[73])
 			if srv != nil {
 
@@ -252,20 +327,27 @@ func (cluster *Cluster) refreshHaproxy(proxy *Proxy) error {
 				})
 				if (srv.State == stateSlaveErr || srv.State == stateRelayErr || srv.State == stateSlaveLate || srv.State == stateRelayLate || srv.IsIgnored()) && line[17] == "UP" {
 					cluster.LogPrintf(LvlInfo, "Detecting broken resplication and UP state in haproxy %s drain  server %s", proxy.Host+":"+proxy.Port, srv.URL)
-					haRuntime.SetDrain(srv.Id, "service_read")
+					haRuntime.SetDrain(line[1], "service_read")
 				}
 				if (srv.State == stateSlave || srv.State == stateRelay) && line[17] == "DRAIN" {
 					cluster.LogPrintf(LvlInfo, "Detecting valid resplication and DRAIN state in haproxy %s enable traffic on server %s", proxy.Host+":"+proxy.Port, srv.URL)
-					haRuntime.SetReady(srv.Id, "service_read")
+					haRuntime.SetReady(line[1], "service_read")
 				}
 			}
 		}
 	}
+	if cluster.useHaproxySlots() {
+		cluster.setHaproxySlots(proxy, haRuntime, slots)
+	}
 
 	return nil
 }
 
 func (cluster *Cluster) setMaintenanceHaproxy(pr *Proxy, server *ServerMonitor) {
+	if cluster.useHaproxySlots() {
+		cluster.refreshHaproxy(pr)
+		return
+	}
 	haRuntime := haproxy.Runtime{
 		Binary:   cluster.Conf.HaproxyBinaryPath,
 		SockFile: filepath.Join(pr.Datadir+"/var", "/haproxy.stats.sock"),
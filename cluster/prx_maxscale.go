@@ -9,9 +9,15 @@
 package cluster
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"strconv"
+	"strings"
 
+	"github.com/signal18/replication-manager/config"
 	"github.com/signal18/replication-manager/router/maxscale"
 	"github.com/signal18/replication-manager/utils/state"
 )
@@ -20,6 +26,9 @@ func (cluster *Cluster) refreshMaxscale(proxy *Proxy) error {
 	if cluster.Conf.MxsOn == false {
 		return nil
 	}
+	if cluster.Conf.MxsGetInfoMethod == "rest" {
+		return cluster.refreshMaxscaleRest(proxy)
+	}
 	var m maxscale.MaxScale
 	if proxy.Tunnel {
 		m = maxscale.MaxScale{Host: "localhost", Port: strconv.Itoa(proxy.TunnelPort), User: proxy.User, Pass: proxy.Pass}
@@ -87,6 +96,10 @@ func (cluster *Cluster) initMaxscale(oldmaster *ServerMonitor, proxy *Proxy) {
 	if cluster.Conf.MxsOn == false {
 		return
 	}
+	if cluster.Conf.MxsGetInfoMethod == "rest" {
+		cluster.initMaxscaleRest(oldmaster, proxy)
+		return
+	}
 
 	var m maxscale.MaxScale
 	if proxy.Tunnel {
@@ -209,6 +222,10 @@ func (cluster *Cluster) initMaxscale(oldmaster *ServerMonitor, proxy *Proxy) {
 }
 
 func (cluster *Cluster) setMaintenanceMaxscale(pr *Proxy, server *ServerMonitor) {
+	if cluster.Conf.MxsGetInfoMethod == "rest" {
+		cluster.setMaintenanceMaxscaleRest(pr, server)
+		return
+	}
 	m := maxscale.MaxScale{Host: pr.Host, Port: pr.Port, User: pr.User, Pass: pr.Pass}
 	err := m.Connect()
 	if err != nil {
@@ -225,3 +242,198 @@ func (cluster *Cluster) setMaintenanceMaxscale(pr *Proxy, server *ServerMonitor)
 	}
 	m.Close()
 }
+
+// mxsRestClient is the REST client of a proxy with the settings it was made with
+type mxsRestClient struct {
+	settings string
+	client   *maxscale.RestClient
+}
+
+// getMaxscaleRestClient returns the REST client of a proxy, a client and its connections are kept per proxy
+// until the settings of the proxy change
+func (cluster *Cluster) getMaxscaleRestClient(proxy *Proxy) (*maxscale.RestClient, error) {
+	port := strconv.Itoa(cluster.Conf.MxsRestPort)
+	settings := strings.Join([]string{proxy.Host, port, proxy.User, proxy.Pass, strconv.FormatBool(cluster.Conf.MxsRestSsl), strconv.FormatBool(cluster.Conf.MxsRestTLSSkipVerify), cluster.Conf.MxsRestTLSCA}, "|")
+	cluster.mxsRestClientsMutex.Lock()
+	defer cluster.mxsRestClientsMutex.Unlock()
+	if c, ok := cluster.mxsRestClients[proxy.Id]; ok && c.settings == settings {
+		return c.client, nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: cluster.Conf.MxsRestTLSSkipVerify}
+	if cluster.Conf.MxsRestTLSCA != "" {
+		pem, err := ioutil.ReadFile(cluster.Conf.MxsRestTLSCA)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read MaxScale REST API CA %s: %s", cluster.Conf.MxsRestTLSCA, err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificate found in MaxScale REST API CA %s", cluster.Conf.MxsRestTLSCA)
+		}
+	}
+	if cluster.mxsRestClients == nil {
+		cluster.mxsRestClients = make(map[string]mxsRestClient)
+	}
+	r := maxscale.NewRestClient(proxy.Host, port, proxy.User, proxy.Pass, cluster.Conf.MxsRestSsl, tlsConfig)
+	cluster.mxsRestClients[proxy.Id] = mxsRestClient{settings: settings, client: r}
+	return r, nil
+}
+
+// GetMaxscaleResources returns a collection of the REST API of a MaxScale proxy: servers, monitors, services,
+// listeners or filters
+func (cluster *Cluster) GetMaxscaleResources(proxy *Proxy, collection string) ([]maxscale.RestResource, error) {
+	if proxy.Type != config.ConstProxyMaxscale || cluster.Conf.MxsGetInfoMethod != "rest" {
+		return nil, errors.New("Proxy is not a MaxScale monitored with maxscale-get-info-method rest")
+	}
+	r, err := cluster.getMaxscaleRestClient(proxy)
+	if err != nil {
+		return nil, err
+	}
+	switch collection {
+	case "servers":
+		return r.GetServers()
+	case "monitors":
+		return r.GetMonitors()
+	case "services":
+		return r.GetServices()
+	case "listeners":
+		return r.GetListeners()
+	case "filters":
+		return r.GetFilters()
+	}
+	return nil, errors.New("Unknown MaxScale collection " + collection)
+}
+
+// refreshMaxscaleRest maps the database servers to the MaxScale servers with the REST API
+func (cluster *Cluster) refreshMaxscaleRest(proxy *Proxy) error {
+	r, err := cluster.getMaxscaleRestClient(proxy)
+	var servers []maxscale.RestResource
+	if err == nil {
+		servers, err = r.GetServers()
+	}
+	if err != nil {
+		cluster.sme.AddState("ERR00018", state.State{ErrType: "ERROR", ErrDesc: fmt.Sprintf(clusterError["ERR00018"], err), ErrFrom: "CONF"})
+		cluster.sme.CopyOldStateFromUnknowServer(proxy.Name)
+		return err
+	}
+	proxy.BackendsWrite = nil
+	for _, server := range cluster.Servers {
+		var bke = Backend{
+			Host:   server.Host,
+			Port:   server.Port,
+			Status: server.State,
+		}
+		if s := maxscale.FindServer(servers, server.Host, server.Port, cluster.Conf.MxsServerMatchPort); s != nil {
+			bke.PrxName = s.Id
+			bke.PrxStatus = s.Attributes.State
+			bke.PrxConnections = maxscale.ServerConnections(*s)
+			bke.PrxMaintenance = strings.Contains(s.Attributes.State, "Maintenance")
+		}
+		server.MxsServerStatus = bke.PrxStatus
+		server.MxsServerName = bke.PrxName
+		proxy.BackendsWrite = append(proxy.BackendsWrite, bke)
+	}
+	return nil
+}
+
+// initMaxscaleRest hands the failover to replication-manager: the monitor is stopped and the server states
+// are set with maxscale-disable-monitor, or else the monitor is started again if it was stopped, the automatic
+// failover and rejoin of the monitor are turned off with maxscale-monitor-passive and the running monitor
+// follows the new topology
+func (cluster *Cluster) initMaxscaleRest(oldmaster *ServerMonitor, proxy *Proxy) {
+	r, err := cluster.getMaxscaleRestClient(proxy)
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "MaxScale REST API %s", err)
+		return
+	}
+	monitors, err := r.GetMonitors()
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "MaxScale REST API could not list monitors %s", err)
+		return
+	}
+	monitor := maxscale.FindMonitor(monitors)
+	if monitor == nil {
+		cluster.sme.AddState("ERR00017", state.State{ErrType: "ERROR", ErrDesc: clusterError["ERR00017"], ErrFrom: "TOPO", ServerUrl: proxy.Name})
+	}
+	if cluster.Conf.MxsDisableMonitor {
+		if monitor != nil && maxscale.IsRunning(*monitor) {
+			cluster.LogPrintf(LvlInfo, "MaxScale stop monitor %s", monitor.Id)
+			if err := r.StopMonitor(monitor.Id); err != nil {
+				cluster.LogPrintf(LvlErr, "MaxScale REST API could not stop monitor %s", err)
+			}
+		}
+		cluster.setMaxscaleRestStates(r, oldmaster)
+		return
+	}
+	if monitor != nil && !maxscale.IsRunning(*monitor) {
+		cluster.LogPrintf(LvlInfo, "MaxScale start monitor %s", monitor.Id)
+		if err := r.StartMonitor(monitor.Id); err != nil {
+			cluster.LogPrintf(LvlErr, "MaxScale REST API could not start monitor %s", err)
+		}
+	}
+	if monitor != nil && cluster.Conf.MxsMonitorPassive && !maxscale.IsMonitorPassive(*monitor) {
+		cluster.LogPrintf(LvlInfo, "MaxScale set monitor %s passive, turning off auto_failover and auto_rejoin", monitor.Id)
+		if err := r.SetMonitorPassive(monitor.Id, true); err != nil {
+			cluster.LogPrintf(LvlErr, "MaxScale REST API could not set monitor passive %s", err)
+		}
+	}
+}
+
+// setMaxscaleRestStates sets the master and slave states of the servers when the monitor is stopped
+func (cluster *Cluster) setMaxscaleRestStates(r *maxscale.RestClient, oldmaster *ServerMonitor) {
+	master := cluster.GetMaster()
+	if master == nil || master.MxsServerName == "" {
+		return
+	}
+	set := func(s *ServerMonitor, state string, on bool) {
+		if s.MxsServerName == "" {
+			return
+		}
+		var err error
+		if on {
+			err = r.SetServerState(s.MxsServerName, state)
+		} else {
+			err = r.ClearServerState(s.MxsServerName, state)
+		}
+		if err != nil {
+			cluster.LogPrintf(LvlErr, "MaxScale REST API could not set server %s state %s: %s", s.MxsServerName, state, err)
+		}
+	}
+	set(master, maxscale.RestStateMaster, true)
+	set(master, maxscale.RestStateRunning, true)
+	set(master, maxscale.RestStateSlave, false)
+	if cluster.Conf.MxsBinlogOn {
+		return
+	}
+	for _, s := range cluster.Servers {
+		if s == master {
+			continue
+		}
+		set(s, maxscale.RestStateMaster, false)
+		set(s, maxscale.RestStateSlave, s.State == stateSlave)
+		set(s, maxscale.RestStateRunning, s.State == stateSlave)
+	}
+	if oldmaster != nil && oldmaster != master {
+		set(oldmaster, maxscale.RestStateMaster, false)
+		set(oldmaster, maxscale.RestStateSlave, oldmaster.State == stateSlave)
+		set(oldmaster, maxscale.RestStateRunning, oldmaster.State == stateSlave)
+	}
+}
+
+func (cluster *Cluster) setMaintenanceMaxscaleRest(pr *Proxy, server *ServerMonitor) {
+	if server.MxsServerName == "" {
+		return
+	}
+	r, err := cluster.getMaxscaleRestClient(pr)
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Could not set server %s in maintenance %s", server.MxsServerName, err)
+		return
+	}
+	if server.IsMaintenance {
+		err = r.SetServerState(server.MxsServerName, maxscale.RestStateMaintenance)
+	} else {
+		err = r.ClearServerState(server.MxsServerName, maxscale.RestStateMaintenance)
+	}
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Could not set server %s in maintenance %s", server.MxsServerName, err)
+	}
+}
@@ -0,0 +1,36 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"testing"
+
+	"github.com/signal18/replication-manager/config"
+)
+
+func TestMaxscaleRestClientCache(t *testing.T) {
+	cluster := &Cluster{Conf: config.Config{MxsRestPort: 8989}}
+	proxy := &Proxy{Id: "mx1", Host: "10.0.0.10", User: "admin", Pass: "mariadb"}
+	r, err := cluster.getMaxscaleRestClient(proxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := cluster.getMaxscaleRestClient(proxy); again != r {
+		t.Fatal("Expected the client of the proxy kept")
+	}
+	cluster.Conf.MxsRestSsl = true
+	if again, _ := cluster.getMaxscaleRestClient(proxy); again == r || !again.Ssl {
+		t.Fatal("Expected a new client when the settings change")
+	}
+	cluster.Conf.MxsRestTLSCA = "/nonexistent/ca.pem"
+	if _, err := cluster.getMaxscaleRestClient(proxy); err == nil {
+		t.Fatal("Expected an error for a missing CA file")
+	}
+}
@@ -1,9 +1,14 @@
 package cluster
 
 import (
-	"database/sql"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/signal18/replication-manager/config"
 	"github.com/signal18/replication-manager/router/myproxy"
 )
 
@@ -11,11 +16,182 @@ func (cluster *Cluster) initMyProxy(proxy *Proxy) {
 	if proxy.InternalProxy != nil {
 		proxy.InternalProxy.Close()
 	}
-	db, err := sql.Open("mysql", cluster.master.DSN)
-	if err != nil {
-		cluster.LogPrintf(LvlErr, "Could not connect to Master for MyProxy %s", err)
-		return
+	proxy.InternalProxy, _ = myproxy.NewProxyServer("0.0.0.0:"+proxy.Port, proxy.User, proxy.Pass)
+	proxy.InternalProxy.SetReadWriteSplit(cluster.Conf.MyproxyReadWriteSplit)
+	proxy.InternalProxy.SetDigestStats(cluster.Conf.MyproxyDigestStats, cluster.Conf.MyproxyDigestMax)
+	if err := cluster.refreshMyProxy(proxy); err != nil {
+		cluster.LogPrintf(LvlErr, "Could not set MyProxy backends %s", err)
 	}
-	proxy.InternalProxy, _ = myproxy.NewProxyServer("0.0.0.0:"+proxy.Port, proxy.User, proxy.Pass, db)
 	go proxy.InternalProxy.Run()
 }
+
+// refreshMyProxy routes the writes to the master and the reads to the slaves replicating with a lag
+// under myproxy-read-max-lag, delayed slaves are never readers
+func (cluster *Cluster) refreshMyProxy(proxy *Proxy) error {
+	if proxy.InternalProxy == nil {
+		return errors.New("MyProxy not started")
+	}
+	master := cluster.GetMaster()
+	if master == nil || master.IsDown() {
+		return errors.New("No master for MyProxy")
+	}
+	if err := proxy.InternalProxy.SetWriter(master.URL, master.DSN); err != nil {
+		return err
+	}
+	var readers []*myproxy.Backend
+	for _, s := range cluster.slaves {
+		if s.IsMaintenance || s.IsIgnored() || s.IsDelayed || (s.State != stateSlave && s.State != stateRelay) {
+			continue
+		}
+		lag := s.GetReplicationDelay()
+		if cluster.Conf.MyproxyReadMaxLag > 0 && lag > cluster.Conf.MyproxyReadMaxLag {
+			continue
+		}
+		readers = append(readers, &myproxy.Backend{URL: s.URL, DSN: s.DSN, Lag: lag})
+	}
+	err := proxy.InternalProxy.SetReaders(readers)
+	proxy.InternalProxy.SetQueryRules(cluster.getMyProxyQueryRules(proxy))
+	if shard := cluster.getMyProxyShard(); shard != nil {
+		proxy.InternalProxy.SetShard(shard.URL, shard.DSN)
+	} else {
+		proxy.InternalProxy.SetShard("", "")
+	}
+
+	writer, pool := proxy.InternalProxy.GetBackends()
+	proxy.BackendsWrite = []Backend{cluster.getMyProxyBackend(writer)}
+	proxy.BackendsRead = nil
+	for _, b := range pool {
+		proxy.BackendsRead = append(proxy.BackendsRead, cluster.getMyProxyBackend(b))
+	}
+	return err
+}
+
+// getMyProxyQueryRules converts the active cluster query rules of the proxy, the destination hostgroup
+// is the writer or the reader hostgroup of ProxySQL, or the shard hostgroup 999
+func (cluster *Cluster) getMyProxyQueryRules(proxy *Proxy) []*myproxy.QueryRule {
+	writerHG, _ := strconv.ParseInt(cluster.Conf.ProxysqlWriterHostgroup, 10, 64)
+	readerHG, _ := strconv.ParseInt(cluster.Conf.ProxysqlReaderHostgroup, 10, 64)
+	cluster.queryRulesMutex.Lock()
+	defer cluster.queryRulesMutex.Unlock()
+	var rules []*myproxy.QueryRule
+	for _, qr := range cluster.QueryRules {
+		if qr.Active != 1 {
+			continue
+		}
+		if qr.Proxies != "" && !strings.Contains(","+qr.Proxies+",", ","+proxy.Id+",") {
+			continue
+		}
+		rule := &myproxy.QueryRule{
+			Id:             qr.Id,
+			User:           qr.UserName.String,
+			Schema:         qr.SchemaName.String,
+			Digest:         qr.Digest.String,
+			ReplacePattern: qr.ReplacePattern.String,
+			ErrorMsg:       qr.ErrorMsg.String,
+			RateLimit:      qr.RateLimit,
+			Apply:          qr.Apply == 1,
+		}
+		var err error
+		if qr.Match_Digest.Valid && qr.Match_Digest.String != "" {
+			if rule.MatchDigest, err = regexp.Compile(qr.Match_Digest.String); err != nil {
+				cluster.LogPrintf(LvlDbg, "Skipping query rule %d: %s", qr.Id, err)
+				continue
+			}
+		}
+		if qr.Match_Pattern.Valid && qr.Match_Pattern.String != "" {
+			if rule.MatchPattern, err = regexp.Compile(qr.Match_Pattern.String); err != nil {
+				cluster.LogPrintf(LvlDbg, "Skipping query rule %d: %s", qr.Id, err)
+				continue
+			}
+		}
+		if qr.DestinationHostgroup.Valid {
+			switch qr.DestinationHostgroup.Int64 {
+			case writerHG:
+				rule.Route = myproxy.RouteWriter
+			case readerHG:
+				rule.Route = myproxy.RouteReader
+			case 999:
+				rule.Route = myproxy.RouteShard
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// getMyProxyShard returns the shard proxy database of the cluster
+func (cluster *Cluster) getMyProxyShard() *ServerMonitor {
+	for _, pr := range cluster.Proxies {
+		if pr.Type == config.ConstProxySpider && pr.ShardProxy != nil {
+			return pr.ShardProxy
+		}
+	}
+	return nil
+}
+
+// getMyProxyQueryRuleHits sums the hits of the query rules on the MyProxy proxies
+func (cluster *Cluster) getMyProxyQueryRuleHits() map[uint32]uint64 {
+	hits := make(map[uint32]uint64)
+	for _, pr := range cluster.Proxies {
+		if pr.Type != config.ConstProxyMyProxy || pr.InternalProxy == nil {
+			continue
+		}
+		for id, h := range pr.InternalProxy.GetQueryRuleHits() {
+			hits[id] += h
+		}
+	}
+	return hits
+}
+
+// GetProxyDigests returns the query digest statistics recorded by a MyProxy proxy
+func (cluster *Cluster) GetProxyDigests(proxy *Proxy) ([]myproxy.DigestStats, error) {
+	if proxy.Type != config.ConstProxyMyProxy || proxy.InternalProxy == nil {
+		return nil, errors.New("Query digests are recorded by MyProxy only")
+	}
+	return proxy.InternalProxy.GetDigestStats(), nil
+}
+
+func (cluster *Cluster) getMyProxyBackend(b *myproxy.Backend) Backend {
+	bke := Backend{PrxName: b.URL, PrxStatus: "ONLINE", PrxConnections: strconv.Itoa(b.OpenConnections()), PrxLatency: strconv.FormatInt(b.Lag, 10)}
+	if s := cluster.GetServerFromURL(b.URL); s != nil {
+		bke.Host = s.Host
+		bke.Port = s.Port
+		bke.Status = s.State
+		bke.PrxMaintenance = s.IsMaintenance
+	}
+	return bke
+}
+
+// pauseMyProxies holds the new queries on MyProxy during a switchover and waits up to switchover-wait-trx
+// for the running transactions to end on the old master
+func (cluster *Cluster) pauseMyProxies() {
+	if !cluster.Conf.MyproxyOn || !cluster.Conf.MyproxySwitchoverPause {
+		return
+	}
+	for _, pr := range cluster.Proxies {
+		if pr.Type != config.ConstProxyMyProxy || pr.InternalProxy == nil {
+			continue
+		}
+		cluster.LogPrintf(LvlInfo, "Pausing MyProxy %s for %ds", pr.Name, cluster.Conf.MyproxySwitchoverMaxPause)
+		pr.InternalProxy.Pause(time.Duration(cluster.Conf.MyproxySwitchoverMaxPause)*time.Second, cluster.Conf.MyproxySwitchoverMaxQueue)
+	}
+	for _, pr := range cluster.Proxies {
+		if pr.Type != config.ConstProxyMyProxy || pr.InternalProxy == nil {
+			continue
+		}
+		if !pr.InternalProxy.WaitDrain(time.Duration(cluster.Conf.SwitchWaitTrx) * time.Second) {
+			cluster.LogPrintf(LvlWarn, "MyProxy %s still has %d transactions running on the old master", pr.Name, pr.InternalProxy.GetActiveTransactions())
+		}
+	}
+}
+
+// resumeMyProxies releases the queries held by the switchover to the new master
+func (cluster *Cluster) resumeMyProxies() {
+	for _, pr := range cluster.Proxies {
+		if pr.Type != config.ConstProxyMyProxy || pr.InternalProxy == nil || !pr.InternalProxy.IsPaused() {
+			continue
+		}
+		cluster.LogPrintf(LvlInfo, "Resuming MyProxy %s with %d queries held", pr.Name, pr.InternalProxy.GetHeldQueries())
+		pr.InternalProxy.Resume()
+	}
+}
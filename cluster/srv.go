@@ -1191,7 +1191,7 @@ func (server *ServerMonitor) ChangeMasterTo(master *ServerMonitor, master_use_gi
 			Mode:        master_use_gitd,
 			Channel:     server.ClusterGroup.Conf.MasterConn,
 			IsDelayed:   server.IsDelayed,
-			Delay:       strconv.Itoa(server.ClusterGroup.Conf.HostsDelayedTime),
+			Delay:       strconv.Itoa(server.GetReplicationDelayedTime()),
 			SSL:         server.ClusterGroup.Conf.ReplicationSSL,
 			PostgressDB: server.PostgressDB,
 		}, server.DBVersion)
@@ -1207,7 +1207,7 @@ func (server *ServerMonitor) ChangeMasterTo(master *ServerMonitor, master_use_gi
 			Heartbeat:   strconv.Itoa(server.ClusterGroup.Conf.ForceSlaveHeartbeatTime),
 			Mode:        "MASTER_AUTO_POSITION",
 			IsDelayed:   server.IsDelayed,
-			Delay:       strconv.Itoa(server.ClusterGroup.Conf.HostsDelayedTime),
+			Delay:       strconv.Itoa(server.GetReplicationDelayedTime()),
 			SSL:         server.ClusterGroup.Conf.ReplicationSSL,
 			Channel:     server.ClusterGroup.Conf.MasterConn,
 			PostgressDB: server.PostgressDB,
@@ -1227,7 +1227,7 @@ func (server *ServerMonitor) ChangeMasterTo(master *ServerMonitor, master_use_gi
 			Logpos:      master.BinaryLogPos,
 			Channel:     server.ClusterGroup.Conf.MasterConn,
 			IsDelayed:   server.IsDelayed,
-			Delay:       strconv.Itoa(server.ClusterGroup.Conf.HostsDelayedTime),
+			Delay:       strconv.Itoa(server.GetReplicationDelayedTime()),
 			SSL:         server.ClusterGroup.Conf.ReplicationSSL,
 			PostgressDB: server.PostgressDB,
 		}, server.DBVersion)
@@ -0,0 +1,574 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/gtid"
+	"github.com/signal18/replication-manager/utils/misc"
+)
+
+// DelayedJob reports the progress of a recovery from a delayed replica in the job results of the server.
+// The replica is rolled forward until just before the target, tables are copied to the master and
+// the delay is armed again.
+type DelayedJob struct {
+	Until      string          `json:"until"`
+	UntilFile  string          `json:"untilFile"`
+	UntilPos   uint64          `json:"untilPos"`
+	Step       string          `json:"step"`
+	ExecFile   string          `json:"execFile"`
+	ExecPos    string          `json:"execPos"`
+	Table      string          `json:"table"`
+	Filters    []DelayedFilter `json:"filters"`
+	NewTable   string          `json:"newTable"`
+	RowsCopied int64           `json:"rowsCopied"`
+	Delay      int             `json:"delay"`
+	Rearmed    bool            `json:"rearmed"`
+	Start      time.Time       `json:"start"`
+	End        time.Time       `json:"end"`
+	Done       bool            `json:"done"`
+	Error      string          `json:"error"`
+}
+
+const (
+	delayedStepRollForward string = "roll forward"
+	delayedStepStopped     string = "stopped"
+	delayedStepExtract     string = "extract"
+	delayedStepRearm       string = "rearm"
+	delayedStepDone        string = "done"
+	delayedStepFailed      string = "failed"
+	delayedBinlogTimeFmt   string = "060102 15:04:05"
+	delayedCopyBatchRows   int    = 500
+)
+
+// DelayedFilter selects the rows of an extract by comparing a column to a value bound to the query,
+// the operators are eq, ne, lt, le, gt, ge, like, null and notnull
+type DelayedFilter struct {
+	Column string `json:"column"`
+	Op     string `json:"op"`
+	Value  string `json:"value,omitempty"`
+}
+
+var delayedFilterOps = map[string]string{
+	"eq":      " = ?",
+	"ne":      " <> ?",
+	"lt":      " < ?",
+	"le":      " <= ?",
+	"gt":      " > ?",
+	"ge":      " >= ?",
+	"like":    " LIKE ?",
+	"null":    " IS NULL",
+	"notnull": " IS NOT NULL",
+}
+
+var (
+	delayedBinlogAtRegex    = regexp.MustCompile(`^# at ([0-9]+)$`)
+	delayedBinlogTrxRegex   = regexp.MustCompile(`^#([0-9]{6}\s+[0-9]{1,2}:[0-9]{2}:[0-9]{2})\s+server id [0-9]+\s+end_log_pos [0-9]+.*\t(?:GTID|Anonymous_GTID)\s([0-9]+-[0-9]+-[0-9]+)?`)
+	delayedTableNameRegex   = regexp.MustCompile("^[0-9a-zA-Z$_]+$")
+	delayedCreateTableRegex = regexp.MustCompile("^CREATE TABLE `(?:[^`]|``)+`")
+	delayedForeignKeyRegex  = regexp.MustCompile("^\\s*CONSTRAINT `(?:[^`]|``)+` FOREIGN KEY ")
+	delayedConstraintRegex  = regexp.MustCompile("^(\\s*)CONSTRAINT `(?:[^`]|``)+` ")
+	delayedGeneratedRegex   = regexp.MustCompile(`(?i)\b(VIRTUAL|STORED|PERSISTENT) GENERATED\b`)
+)
+
+// GetDelayedJob returns the last delayed replica recovery of the server
+func (server *ServerMonitor) GetDelayedJob() *DelayedJob {
+	if res, ok := server.ClusterGroup.JobResults[server.URL]; ok {
+		return res.Delayed
+	}
+	return nil
+}
+
+func (server *ServerMonitor) setDelayedJob(job *DelayedJob) {
+	res, ok := server.ClusterGroup.JobResults[server.URL]
+	if !ok {
+		res = new(JobResult)
+		server.ClusterGroup.JobResults[server.URL] = res
+	}
+	res.Delayed = job
+}
+
+func (job *DelayedJob) fail(cluster *Cluster, server *ServerMonitor, err error) {
+	job.Step = delayedStepFailed
+	job.Error = err.Error()
+	job.End = time.Now()
+	job.Done = true
+	cluster.LogPrintf(LvlErr, "Delayed replica recovery of %s failed: %s", server.URL, err)
+}
+
+// JobDelayedRollForward removes the delay of a delayed replica and applies the replication events
+// until just before until, a timestamp or a GTID. The stop position is searched in the archived
+// binlogs of the master from the replica position, MySQL GTIDs use SQL_BEFORE_GTIDS.
+func (server *ServerMonitor) JobDelayedRollForward(until string) (*DelayedJob, error) {
+	cluster := server.ClusterGroup
+	if !server.IsDelayed {
+		return nil, errors.New("Server is not in replication-delayed-hosts")
+	}
+	if server.IsMaster() {
+		return nil, errors.New("Delayed replica recovery can't run on the master")
+	}
+	if cluster.IsInFailover() {
+		return nil, errors.New("Cancel delayed replica recovery during failover")
+	}
+	if job := server.GetDelayedJob(); job != nil && !job.Done {
+		return nil, errors.New("Delayed replica recovery already running, rearm the delay to cancel it")
+	}
+	target, err := ParsePitrTarget(until)
+	if err != nil {
+		return nil, err
+	}
+	ss, logs, err := dbhelper.GetSlaveStatus(server.Conn, cluster.Conf.MasterConn, server.DBVersion)
+	cluster.LogSQL(logs, err, server.URL, "Delayed", LvlErr, "Could not get slave status %s %s", server.URL, err)
+	if err != nil {
+		return nil, err
+	}
+	job := &DelayedJob{Until: until, Step: delayedStepRollForward, Delay: server.GetReplicationDelayedTime(), Start: time.Now()}
+	untilClause := ""
+	if strings.Contains(target.Gtid, ":") {
+		untilClause = "SQL_BEFORE_GTIDS='" + target.Gtid + "'"
+	} else {
+		pos, _ := strconv.ParseUint(ss.ExecMasterLogPos.String, 10, 64)
+		job.UntilFile, job.UntilPos, err = server.getDelayedUntil(target, ss.RelayMasterLogFile.String, pos)
+		if err != nil {
+			return nil, err
+		}
+		untilClause = "MASTER_LOG_FILE='" + job.UntilFile + "', MASTER_LOG_POS=" + strconv.FormatUint(job.UntilPos, 10)
+	}
+	server.setDelayedJob(job)
+	cluster.LogPrintf(LvlInfo, "Delayed replica %s roll forward until %s", server.URL, untilClause)
+
+	logs, err = server.StopSlave()
+	cluster.LogSQL(logs, err, server.URL, "Delayed", LvlErr, "Failed stop slave on server: %s %s", server.URL, err)
+	if err == nil {
+		logs, err = dbhelper.SetSlaveDelay(server.Conn, "0", cluster.Conf.MasterConn, server.DBVersion)
+		cluster.LogSQL(logs, err, server.URL, "Delayed", LvlErr, "Failed to remove replication delay on server: %s %s", server.URL, err)
+	}
+	if err == nil {
+		logs, err = dbhelper.StartSlaveUntil(server.Conn, untilClause, cluster.Conf.MasterConn, server.DBVersion)
+		cluster.LogSQL(logs, err, server.URL, "Delayed", LvlErr, "Failed start slave until on server: %s %s", server.URL, err)
+	}
+	if err != nil {
+		job.fail(cluster, server, err)
+		return job, nil
+	}
+	go server.waitDelayedRollForward(job)
+	return job, nil
+}
+
+// waitDelayedRollForward follows the replica until the SQL thread stops
+func (server *ServerMonitor) waitDelayedRollForward(job *DelayedJob) {
+	cluster := server.ClusterGroup
+	for {
+		time.Sleep(time.Second)
+		ss, _, err := dbhelper.GetSlaveStatus(server.Conn, cluster.Conf.MasterConn, server.DBVersion)
+		if err != nil {
+			job.fail(cluster, server, err)
+			return
+		}
+		if job.Step != delayedStepRollForward {
+			// rearmed during the roll forward
+			return
+		}
+		job.ExecFile = ss.RelayMasterLogFile.String
+		job.ExecPos = ss.ExecMasterLogPos.String
+		if ss.SlaveSQLRunning.String == "Yes" {
+			continue
+		}
+		if ss.LastSQLError.String != "" {
+			job.fail(cluster, server, fmt.Errorf("Replication SQL error %s: %s", ss.LastSQLErrno.String, ss.LastSQLError.String))
+			return
+		}
+		break
+	}
+	job.Step = delayedStepStopped
+	cluster.LogPrintf(LvlInfo, "Delayed replica %s stopped at %s:%s before %s, extract tables or rearm the delay", server.URL, job.ExecFile, job.ExecPos, job.Until)
+}
+
+// getDelayedUntil returns the binlog coordinates of the first transaction of the target found in the
+// master binlogs from the replica position, the archived binlogs are read first, then the current
+// binlog of the master from the server
+func (server *ServerMonitor) getDelayedUntil(target PitrTarget, file string, pos uint64) (string, uint64, error) {
+	cluster := server.ClusterGroup
+	master := cluster.GetMaster()
+	dir, binlogs, err := cluster.getPitrBinlogs(PitrBackup{BinLogFile: file, BinLogPos: pos})
+	if err != nil && (master == nil || master.BinaryLogFile != file) {
+		return "", 0, err
+	}
+	for i, binlog := range binlogs {
+		args := []string{}
+		if i == 0 {
+			args = append(args, "--start-position="+strconv.FormatUint(pos, 10))
+		}
+		arg, stdin, err := cluster.openBackupBinlog(dir + binlog)
+		if err != nil {
+			return "", 0, err
+		}
+		at, found, err := server.scanDelayedBinlog(append(args, arg), stdin, target)
+		if stdin != nil {
+			stdin.Close()
+		}
+		if err != nil {
+			return "", 0, err
+		}
+		if found {
+			return binlog, at, nil
+		}
+	}
+	if master != nil && master.BinaryLogFile != "" && (len(binlogs) == 0 || binlogs[len(binlogs)-1] != master.BinaryLogFile) {
+		args := []string{"--read-from-remote-server", "--host=" + misc.Unbracket(master.Host), "--port=" + master.Port, "--user=" + cluster.dbUser, "--password=" + cluster.dbPass}
+		if master.BinaryLogFile == file {
+			args = append(args, "--start-position="+strconv.FormatUint(pos, 10))
+		}
+		at, found, err := server.scanDelayedBinlog(append(args, master.BinaryLogFile), nil, target)
+		if err != nil {
+			return "", 0, err
+		}
+		if found {
+			return master.BinaryLogFile, at, nil
+		}
+	}
+	return "", 0, fmt.Errorf("Target %s not found in the master binlogs after the replica position %s:%d, it may be already applied", target.String(), file, pos)
+}
+
+// scanDelayedBinlog returns the position of the first transaction at or after the target time, or of the target GTID
+func (server *ServerMonitor) scanDelayedBinlog(args []string, stdin io.Reader, target PitrTarget) (uint64, bool, error) {
+	cluster := server.ClusterGroup
+	binlogCmd := exec.Command(cluster.GetMysqlBinlogPath(), args...)
+	binlogCmd.Stdin = stdin
+	stdout, err := binlogCmd.StdoutPipe()
+	if err != nil {
+		return 0, false, err
+	}
+	cluster.LogPrintf(LvlInfo, "Command: %s", strings.Replace(binlogCmd.String(), cluster.dbPass, "XXXX", -1))
+	if err := binlogCmd.Start(); err != nil {
+		return 0, false, err
+	}
+	var targetGtid *gtid.Gtid
+	if target.Gtid != "" {
+		targetGtid = gtid.NewGtid(target.Gtid)
+	}
+	var at uint64
+	rd := bufio.NewReader(stdout)
+	for {
+		line, err := rd.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if m := delayedBinlogAtRegex.FindStringSubmatch(line); m != nil {
+			at, _ = strconv.ParseUint(m[1], 10, 64)
+		} else if m := delayedBinlogTrxRegex.FindStringSubmatch(line); m != nil {
+			found := false
+			if targetGtid != nil {
+				if m[2] != "" {
+					g := gtid.NewGtid(m[2])
+					found = g.DomainID == targetGtid.DomainID && g.SeqNo >= targetGtid.SeqNo
+				}
+			} else if t, perr := time.ParseInLocation(delayedBinlogTimeFmt, strings.Join(strings.Fields(m[1]), " "), time.Local); perr == nil {
+				found = !t.Before(target.Time)
+			}
+			if found {
+				binlogCmd.Process.Kill()
+				binlogCmd.Wait()
+				return at, true, nil
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			binlogCmd.Process.Kill()
+			binlogCmd.Wait()
+			return 0, false, err
+		}
+	}
+	if err := binlogCmd.Wait(); err != nil {
+		return 0, false, err
+	}
+	return 0, false, nil
+}
+
+// String returns the target as given to ParsePitrTarget
+func (target PitrTarget) String() string {
+	if target.Gtid != "" {
+		return target.Gtid
+	}
+	return target.Time.Format(time.RFC3339)
+}
+
+// ParseDelayedFilter returns the filter of a column:op:value parameter, the value can contain colons
+// and is omitted for the null and notnull operators
+func ParseDelayedFilter(param string) (DelayedFilter, error) {
+	p := strings.SplitN(param, ":", 3)
+	if len(p) < 2 {
+		return DelayedFilter{}, errors.New("Expecting a filter as column:op:value")
+	}
+	f := DelayedFilter{Column: p[0], Op: p[1]}
+	if len(p) == 3 {
+		f.Value = p[2]
+	}
+	return f, nil
+}
+
+// getDelayedWhere returns the where clause of the filters joined by AND and the values to bind
+func getDelayedWhere(filters []DelayedFilter) (string, []interface{}, error) {
+	var conds []string
+	var args []interface{}
+	for _, f := range filters {
+		if !delayedTableNameRegex.MatchString(f.Column) {
+			return "", nil, errors.New("Invalid filter column " + f.Column)
+		}
+		op, ok := delayedFilterOps[f.Op]
+		if !ok {
+			return "", nil, errors.New("Invalid filter operator " + f.Op)
+		}
+		conds = append(conds, "`"+f.Column+"`"+op)
+		if strings.HasSuffix(op, "?") {
+			args = append(args, f.Value)
+		}
+	}
+	if len(conds) == 0 {
+		return "", nil, nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args, nil
+}
+
+// JobDelayedExtract copies a table, or the rows matching all the filters, from the delayed replica stopped
+// by a roll forward to newTable on the master and rearms the delay. The table is schema.table,
+// newTable defaults to table_recovered_YYYYMMDDHHMMSS in the same schema.
+func (server *ServerMonitor) JobDelayedExtract(table string, filters []DelayedFilter, newTable string) (*DelayedJob, error) {
+	cluster := server.ClusterGroup
+	job := server.GetDelayedJob()
+	if job == nil || job.Step != delayedStepStopped {
+		return nil, errors.New("Delayed replica is not stopped by a roll forward")
+	}
+	master := cluster.GetMaster()
+	if master == nil {
+		return nil, errors.New("No master to extract the table to")
+	}
+	t := strings.SplitN(table, ".", 2)
+	if len(t) != 2 || !delayedTableNameRegex.MatchString(t[0]) || !delayedTableNameRegex.MatchString(t[1]) {
+		return nil, errors.New("Expecting a table as schema.table")
+	}
+	if newTable == "" {
+		newTable = t[1] + "_recovered_" + time.Now().Format("20060102150405")
+	}
+	if !delayedTableNameRegex.MatchString(newTable) {
+		return nil, errors.New("Invalid new table name " + newTable)
+	}
+	if _, _, err := getDelayedWhere(filters); err != nil {
+		return nil, err
+	}
+	job.Table = table
+	job.Filters = filters
+	job.NewTable = t[0] + "." + newTable
+	job.Step = delayedStepExtract
+	go server.runDelayedExtract(job, master, t[0], t[1], newTable)
+	return job, nil
+}
+
+func (server *ServerMonitor) runDelayedExtract(job *DelayedJob, master *ServerMonitor, schema string, table string, newTable string) {
+	cluster := server.ClusterGroup
+	cluster.LogPrintf(LvlInfo, "Delayed replica %s extract %s filtered by %v to %s on master %s", server.URL, job.Table, job.Filters, job.NewTable, master.URL)
+	if err := server.copyDelayedTable(job, master, schema, table, newTable); err != nil {
+		job.fail(cluster, server, err)
+		return
+	}
+	cluster.LogPrintf(LvlInfo, "Delayed replica %s extracted %d rows of %s to %s", server.URL, job.RowsCopied, job.Table, job.NewTable)
+	if err := server.rearmDelayed(job); err != nil {
+		job.fail(cluster, server, err)
+		return
+	}
+	job.Step = delayedStepDone
+	job.End = time.Now()
+	job.Done = true
+}
+
+// copyDelayedTable creates the new table on the master from the replica definition and copies the rows
+func (server *ServerMonitor) copyDelayedTable(job *DelayedJob, master *ServerMonitor, schema string, table string, newTable string) error {
+	ddl, err := server.GetTableDefinition(schema, table)
+	if err != nil {
+		return err
+	}
+	if !delayedCreateTableRegex.MatchString(ddl) {
+		return fmt.Errorf("%s.%s is not a table", schema, table)
+	}
+	columns, err := server.getDelayedCopyColumns(schema, table)
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("%s.%s has no column to copy", schema, table)
+	}
+	if _, err := master.Conn.Exec(getDelayedTableDDL(ddl, schema, newTable)); err != nil {
+		return err
+	}
+	where, whereArgs, err := getDelayedWhere(job.Filters)
+	if err != nil {
+		return err
+	}
+	list := getDelayedColumnList(columns)
+	rows, err := server.Conn.Query("SELECT "+list+" FROM `"+schema+"`.`"+table+"`"+where, whereArgs...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	batch := delayedCopyBatchRows
+	if len(columns)*batch > 65535 {
+		batch = 65535 / len(columns)
+	}
+	row := "(?" + strings.Repeat(",?", len(columns)-1) + ")"
+	insert := "INSERT INTO `" + schema + "`.`" + newTable + "` (" + list + ") VALUES "
+	var args []interface{}
+	n := 0
+	flush := func() error {
+		if n == 0 {
+			return nil
+		}
+		_, err := master.Conn.Exec(insert+row+strings.Repeat(","+row, n-1), args...)
+		if err != nil {
+			return err
+		}
+		job.RowsCopied += int64(n)
+		args = args[:0]
+		n = 0
+		return nil
+	}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		args = append(args, values...)
+		n++
+		if n == batch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// getDelayedTableDDL returns the definition of the new table from the replica definition of the table. The foreign
+// keys are removed as their names are unique in a schema and the names of the check constraints are left to the
+// server, the new table is a copy of rows that does not need the integrity of the original table.
+func getDelayedTableDDL(ddl string, schema string, newTable string) string {
+	ddl = delayedCreateTableRegex.ReplaceAllLiteralString(ddl, "CREATE TABLE `"+schema+"`.`"+newTable+"`")
+	var lines []string
+	for _, line := range strings.Split(ddl, "\n") {
+		if delayedForeignKeyRegex.MatchString(line) {
+			continue
+		}
+		if strings.HasPrefix(line, ")") && len(lines) > 0 {
+			lines[len(lines)-1] = strings.TrimSuffix(lines[len(lines)-1], ",")
+		}
+		lines = append(lines, delayedConstraintRegex.ReplaceAllString(line, "${1}"))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// getDelayedCopyColumns returns the columns of a table in their order, the generated columns are computed by
+// the new table and cannot be inserted
+func (server *ServerMonitor) getDelayedCopyColumns(schema string, table string) ([]string, error) {
+	rows, err := server.Conn.Query("SELECT COLUMN_NAME, EXTRA FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION", schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var columns []string
+	for rows.Next() {
+		var name, extra string
+		if err := rows.Scan(&name, &extra); err != nil {
+			return nil, err
+		}
+		if !isDelayedGeneratedColumn(extra) {
+			columns = append(columns, name)
+		}
+	}
+	return columns, rows.Err()
+}
+
+// isDelayedGeneratedColumn is true for the extra of a virtual or stored generated column, a MySQL default
+// expression is DEFAULT_GENERATED and is inserted
+func isDelayedGeneratedColumn(extra string) bool {
+	return delayedGeneratedRegex.MatchString(extra)
+}
+
+func getDelayedColumnList(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = "`" + strings.Replace(c, "`", "``", -1) + "`"
+	}
+	return strings.Join(quoted, ",")
+}
+
+// rearmDelayed restores the replication delay of the host and restarts replication
+func (server *ServerMonitor) rearmDelayed(job *DelayedJob) error {
+	cluster := server.ClusterGroup
+	job.Step = delayedStepRearm
+	job.Delay = server.GetReplicationDelayedTime()
+	logs, err := server.StopSlave()
+	cluster.LogSQL(logs, err, server.URL, "Delayed", LvlErr, "Failed stop slave on server: %s %s", server.URL, err)
+	if err != nil {
+		return err
+	}
+	logs, err = dbhelper.SetSlaveDelay(server.Conn, strconv.Itoa(job.Delay), cluster.Conf.MasterConn, server.DBVersion)
+	cluster.LogSQL(logs, err, server.URL, "Delayed", LvlErr, "Failed to set replication delay on server: %s %s", server.URL, err)
+	if err != nil {
+		return err
+	}
+	logs, err = server.StartSlave()
+	cluster.LogSQL(logs, err, server.URL, "Delayed", LvlErr, "Failed start slave on server: %s %s", server.URL, err)
+	if err != nil {
+		return err
+	}
+	job.Rearmed = true
+	cluster.LogPrintf(LvlInfo, "Delayed replica %s rearmed with a delay of %ds", server.URL, job.Delay)
+	return nil
+}
+
+// JobDelayedRearm restores the replication delay to cancel a roll forward, after a roll forward
+// without extracting tables or after a failed recovery
+func (server *ServerMonitor) JobDelayedRearm() (*DelayedJob, error) {
+	if !server.IsDelayed {
+		return nil, errors.New("Server is not in replication-delayed-hosts")
+	}
+	job := server.GetDelayedJob()
+	if job != nil && !job.Done && job.Step != delayedStepStopped && job.Step != delayedStepRollForward {
+		return nil, errors.New("Delayed replica recovery is running step " + job.Step)
+	}
+	if job == nil || job.Done {
+		job = &DelayedJob{Start: time.Now()}
+		server.setDelayedJob(job)
+	}
+	if err := server.rearmDelayed(job); err != nil {
+		job.fail(server.ClusterGroup, server, err)
+		return job, nil
+	}
+	job.Step = delayedStepDone
+	job.End = time.Now()
+	job.Done = true
+	return job, nil
+}
@@ -0,0 +1,126 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/signal18/replication-manager/config"
+)
+
+func TestDelayedHosts(t *testing.T) {
+	cluster := &Cluster{Conf: config.Config{HostsDelayed: "db1:3306=7200, db2:3306", HostsDelayedTime: 3600}}
+	for url, delay := range map[string]int{"db1:3306": 7200, "db2:3306": 3600, "db3:3306": 0} {
+		server := &ServerMonitor{URL: url, ClusterGroup: cluster}
+		if server.IsInDelayedHost() != (delay > 0) || server.GetReplicationDelayedTime() != delay {
+			t.Fatalf("Expected %s delayed by %d, got %t %d", url, delay, server.IsInDelayedHost(), server.GetReplicationDelayedTime())
+		}
+	}
+}
+
+func TestDelayedBinlogTrx(t *testing.T) {
+	for line, gtid := range map[string]string{
+		"#200601 10:00:00 server id 1  end_log_pos 372 CRC32 0x5c0a2c3a \tGTID 0-1-2 trans":                          "0-1-2",
+		"#200601  9:05:01 server id 1  end_log_pos 259 CRC32 0x4ab1bc2e \tGTID\tlast_committed=0\tsequence_number=1": "",
+		"#200601 10:00:00 server id 1  end_log_pos 194 CRC32 0x9c4d7e4b \tAnonymous_GTID\tlast_committed=0":          "",
+	} {
+		m := delayedBinlogTrxRegex.FindStringSubmatch(line)
+		if m == nil || m[2] != gtid {
+			t.Fatalf("Expected transaction %q in %s, got %v", gtid, line, m)
+		}
+	}
+	if delayedBinlogTrxRegex.MatchString("#200601 10:00:00 server id 1  end_log_pos 456 CRC32 0x1d2e3f4a \tQuery\tthread_id=8") {
+		t.Fatal("Expected query event not to start a transaction")
+	}
+}
+
+func TestDelayedWhere(t *testing.T) {
+	for _, test := range []struct {
+		params []string
+		where  string
+		args   int
+		err    bool
+	}{
+		{nil, "", 0, false},
+		{[]string{"id:ge:10", "name:eq:a:b"}, " WHERE `id` >= ? AND `name` = ?", 2, false},
+		{[]string{"deleted_at:null"}, " WHERE `deleted_at` IS NULL", 0, false},
+		{[]string{"id:in:1"}, "", 0, true},
+		{[]string{"id`=1 OR 1:eq:1"}, "", 0, true},
+		{[]string{"(SELECT 1):eq:1"}, "", 0, true},
+	} {
+		var filters []DelayedFilter
+		for _, p := range test.params {
+			f, err := ParseDelayedFilter(p)
+			if err != nil {
+				t.Fatalf("Could not parse %s: %s", p, err)
+			}
+			filters = append(filters, f)
+		}
+		where, args, err := getDelayedWhere(filters)
+		if (err != nil) != test.err || where != test.where || len(args) != test.args {
+			t.Fatalf("Expected %q with %d args for %v, got %q %v %v", test.where, test.args, test.params, where, args, err)
+		}
+	}
+	if _, err := ParseDelayedFilter("id"); err == nil {
+		t.Fatalf("Expected an error for a filter without operator")
+	}
+}
+
+func TestDelayedHostsInvalidDelay(t *testing.T) {
+	if url, delay, err := parseDelayedHost(" db1:3306=abc", 3600); err == nil || url != "db1:3306" || delay != 3600 {
+		t.Fatalf("Expected db1:3306 with the default delay and an error, got %s %d %v", url, delay, err)
+	}
+}
+
+func TestDelayedTableDDL(t *testing.T) {
+	ddl := "CREATE TABLE `orders` (\n" +
+		"  `id` int(11) NOT NULL,\n" +
+		"  `customer_id` int(11) NOT NULL,\n" +
+		"  `qty` int(11) NOT NULL,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  KEY `fk_customer` (`customer_id`),\n" +
+		"  CONSTRAINT `chk_qty` CHECK (`qty` > 0),\n" +
+		"  CONSTRAINT `fk_customer` FOREIGN KEY (`customer_id`) REFERENCES `customers` (`id`) ON DELETE CASCADE\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+	expected := "CREATE TABLE `app`.`orders_restored` (\n" +
+		"  `id` int(11) NOT NULL,\n" +
+		"  `customer_id` int(11) NOT NULL,\n" +
+		"  `qty` int(11) NOT NULL,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  KEY `fk_customer` (`customer_id`),\n" +
+		"  CHECK (`qty` > 0)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+	if got := getDelayedTableDDL(ddl, "app", "orders_restored"); got != expected {
+		t.Fatalf("Expected the constraints names removed:\n%s\ngot:\n%s", expected, got)
+	}
+	if strings.Contains(getDelayedTableDDL(ddl, "app", "orders_restored"), "REFERENCES") {
+		t.Fatal("Expected the foreign key removed")
+	}
+}
+
+func TestDelayedGeneratedColumns(t *testing.T) {
+	for extra, generated := range map[string]bool{
+		"":                  false,
+		"auto_increment":    false,
+		"DEFAULT_GENERATED": false,
+		"DEFAULT_GENERATED on update CURRENT_TIMESTAMP": false,
+		"VIRTUAL GENERATED":                             true,
+		"STORED GENERATED":                              true,
+		"PERSISTENT GENERATED":                          true,
+	} {
+		if isDelayedGeneratedColumn(extra) != generated {
+			t.Fatalf("Expected %q generated %t", extra, generated)
+		}
+	}
+	if list := getDelayedColumnList([]string{"id", "odd`name"}); list != "`id`,`odd``name`" {
+		t.Fatalf("Unexpected column list %s", list)
+	}
+}
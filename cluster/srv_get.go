@@ -36,20 +36,6 @@ func (server *ServerMonitor) GetSchemas() ([]string, string, error) {
 	return dbhelper.GetSchemas(server.Conn)
 }
 
-func (server *ServerMonitor) GetPrometheusMetrics() string {
-	metrics := server.GetDatabaseMetrics()
-	var s string
-	for _, m := range metrics {
-		v := strings.Split(m.Name, ".")
-		if v[2] == "pfs" {
-			s = s + v[2] + "_" + v[3] + "{instance=\"" + v[1] + "\"} " + m.Value + "\n"
-		} else {
-			s = s + v[2] + "{instance=\"" + v[1] + "\"} " + m.Value + "\n"
-		}
-	}
-	return s
-}
-
 func (server *ServerMonitor) GetReplicationServerID() uint64 {
 	ss, sserr := server.GetSlaveStatus(server.ReplicationSourceName)
 	if sserr != nil {
@@ -69,6 +55,12 @@ func (server *ServerMonitor) GetReplicationDelay() int64 {
 	return ss.SecondsBehindMaster.Int64
 }
 
+// GetReplicationDelayedTime returns the configured replication delay of a delayed host in seconds
+func (server *ServerMonitor) GetReplicationDelayedTime() int {
+	_, delay := server.getDelayedHost()
+	return delay
+}
+
 func (server *ServerMonitor) GetReplicationHearbeatPeriod() float64 {
 	ss, sserr := server.GetSlaveStatus(server.ReplicationSourceName)
 	if sserr != nil {
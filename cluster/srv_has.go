@@ -18,13 +18,36 @@ import (
 )
 
 func (server *ServerMonitor) IsInDelayedHost() bool {
-	delayedhosts := strings.Split(server.ClusterGroup.Conf.HostsDelayed, ",")
-	for _, url := range delayedhosts {
+	found, _ := server.getDelayedHost()
+	return found
+}
+
+// getDelayedHost looks up the server in replication-delayed-hosts, an entry can set the delay of
+// the host in seconds with host:port=seconds, replication-delayed-time applies otherwise. The invalid
+// delays are reported once by isValidConfig.
+func (server *ServerMonitor) getDelayedHost() (bool, int) {
+	for _, entry := range strings.Split(server.ClusterGroup.Conf.HostsDelayed, ",") {
+		url, delay, _ := parseDelayedHost(entry, server.ClusterGroup.Conf.HostsDelayedTime)
 		if server.URL == url || server.Name == url {
-			return true
+			return true, delay
 		}
 	}
-	return false
+	return false, 0
+}
+
+// parseDelayedHost returns the host and the delay of a replication-delayed-hosts entry, the default delay
+// is returned with an error when the delay is not a number
+func parseDelayedHost(entry string, defaultDelay int) (string, int, error) {
+	url := strings.TrimSpace(entry)
+	i := strings.LastIndex(url, "=")
+	if i <= 0 {
+		return url, defaultDelay, nil
+	}
+	d, err := strconv.Atoi(url[i+1:])
+	if err != nil {
+		return url[:i], defaultDelay, err
+	}
+	return url[:i], d, nil
 }
 
 func (server *ServerMonitor) IsSlaveOfReplicationSource(name string) bool {
@@ -12,7 +12,6 @@ package cluster
 import (
 	"bufio"
 	"bytes"
-	"compress/gzip"
 	"errors"
 	"fmt"
 	"io"
@@ -36,6 +35,7 @@ import (
 	river "github.com/signal18/replication-manager/utils/river"
 	"github.com/signal18/replication-manager/utils/s18log"
 	"github.com/signal18/replication-manager/utils/state"
+	"github.com/signal18/replication-manager/utils/stream"
 )
 
 func (server *ServerMonitor) JobRun() {
@@ -110,8 +110,29 @@ func (server *ServerMonitor) JobBackupPhysical() (int64, error) {
 			return jobid, err
 		} else {
 	*/
-	port, err := server.ClusterGroup.SSTRunReceiverToFile(server.GetMyBackupDirectory()+server.ClusterGroup.Conf.BackupPhysicalType+".xbtream", ConstJobCreateFile)
+	meta := server.ClusterGroup.newBackupMeta(ConstBackupTypePhysical, server.ClusterGroup.Conf.BackupPhysicalType, server, server.GetMyBackupDirectory()+server.ClusterGroup.Conf.BackupPhysicalType+".xbtream")
+	callback := func(err error) {
+		server.ClusterGroup.closeBackupMeta(meta, err)
+	}
+	var port string
+	var out io.WriteCloser
+	var err error
+	if server.ClusterGroup.Conf.BackupS3 {
+		out, err = server.ClusterGroup.newBackupS3Writer(meta, server, server.ClusterGroup.Conf.BackupPhysicalType+".xbtream")
+	} else {
+		out, err = os.OpenFile(meta.Dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	}
+	if err == nil {
+		var pipe io.WriteCloser
+		pipe, err = server.ClusterGroup.newBackupPipe(out, stream.CompressNone)
+		if err != nil {
+			closeBackupWriter(out, err)
+		} else {
+			port, err = server.ClusterGroup.SSTRunReceiverToWriter(server.ClusterGroup.newBackupCoordinatesWriter(pipe, meta), callback)
+		}
+	}
 	if err != nil {
+		server.ClusterGroup.LogPrintf(LvlErr, "Error physical backup request: %s", err)
 		return 0, nil
 	}
 	jobid, err := server.JobInsertTaks(server.ClusterGroup.Conf.BackupPhysicalType, port, server.ClusterGroup.Conf.MonitorAddress)
@@ -361,7 +382,12 @@ func (server *ServerMonitor) JobZFSSnapBack() (int64, error) {
 func (server *ServerMonitor) JobReseedMyLoader() {
 
 	threads := strconv.Itoa(server.ClusterGroup.Conf.BackupLogicalLoadThreads)
-	dumpCmd := exec.Command(server.ClusterGroup.GetMyLoaderPath(), "--overwrite-tables", "--directory="+server.ClusterGroup.master.GetMasterBackupDirectory(), "--verbose=3", "--threads="+threads, "--host="+misc.Unbracket(server.Host), "--port="+server.Port, "--user="+server.ClusterGroup.dbUser, "--password="+server.ClusterGroup.dbPass)
+	dir, cleanup, err := server.ClusterGroup.decryptBackupDir(server.ClusterGroup.master.GetMasterBackupDirectory())
+	if err != nil {
+		server.ClusterGroup.LogPrintf(LvlErr, "MyLoader: %s", err)
+		return
+	}
+	dumpCmd := exec.Command(server.ClusterGroup.GetMyLoaderPath(), "--overwrite-tables", "--directory="+dir, "--verbose=3", "--threads="+threads, "--host="+misc.Unbracket(server.Host), "--port="+server.Port, "--user="+server.ClusterGroup.dbUser, "--password="+server.ClusterGroup.dbPass)
 	server.ClusterGroup.LogPrintf(LvlInfo, "Command: %s", strings.Replace(dumpCmd.String(), server.ClusterGroup.dbPass, "XXXX", 1))
 
 	stdoutIn, _ := dumpCmd.StdoutPipe()
@@ -378,7 +404,11 @@ func (server *ServerMonitor) JobReseedMyLoader() {
 		server.copyLogs(stderrIn)
 	}()
 	wg.Wait()
-	if err := dumpCmd.Wait(); err != nil {
+	err = dumpCmd.Wait()
+	if cerr := cleanup(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if err != nil {
 		server.ClusterGroup.LogPrintf(LvlErr, "MyLoader: %s", err)
 		return
 	}
@@ -580,6 +610,13 @@ func (server *ServerMonitor) JobBackupLogical() error {
 	if server.IsDown() {
 		return nil
 	}
+	meta := server.ClusterGroup.newBackupMeta(ConstBackupTypeLogical, server.ClusterGroup.Conf.BackupLogicalType, server, server.GetMyBackupDirectory())
+	var backupErr error
+	if meta.Tool == config.ConstBackupLogicalTypeMysqldump || meta.Tool == config.ConstBackupLogicalTypeMydumper {
+		if server.checksumBackupSource(meta) {
+			defer server.startBackupSource()
+		}
+	}
 
 	if server.ClusterGroup.Conf.BackupLogicalType == config.ConstBackupLogicalTypeRiver {
 		cfg := new(river.Config)
@@ -606,7 +643,8 @@ func (server *ServerMonitor) JobBackupLogical() error {
 		//cfg.Sources = []river.SourceConfig{river.SourceConfig{Schema: "test", Tables: []string{"test", "[*]"}}}
 		cfg.Sources = []river.SourceConfig{river.SourceConfig{Schema: "test", Tables: []string{"City"}}}
 
-		river.NewRiver(cfg)
+		meta.Dest = cfg.DumpPath
+		_, backupErr = river.NewRiver(cfg)
 	}
 	if server.ClusterGroup.Conf.BackupLogicalType == config.ConstBackupLogicalTypeMysqldump {
 		usegtid := "--gtid"
@@ -626,19 +664,42 @@ func (server *ServerMonitor) JobBackupLogical() error {
 		dumpCmd := exec.Command(server.ClusterGroup.GetMysqlDumpPath(), "--hex-blob", "--apply-slave-statements", "--single-transaction", "--host="+misc.Unbracket(server.Host), "--port="+server.Port, "--user="+server.ClusterGroup.dbUser, "--password="+server.ClusterGroup.dbPass, "--verbose", "--all-databases", "--add-drop-database", dumpslave, usegtid, events)
 
 		server.ClusterGroup.LogPrintf(LvlInfo, "Command: %s ", strings.Replace(dumpCmd.String(), server.ClusterGroup.dbPass, "XXXX", -1))
-		f, err := os.Create(server.GetMyBackupDirectory() + "mysqldump.sql.gz")
+		o, err := server.ClusterGroup.getBackupStreamOptions(stream.CompressGzip)
+		if err != nil {
+			server.ClusterGroup.LogPrintf(LvlErr, "Error backup request: %s", err)
+			server.ClusterGroup.closeBackupMeta(meta, err)
+			return err
+		}
+		meta.Dest = server.GetMyBackupDirectory() + backupDumpName + o.Extension()
+		var f io.WriteCloser
+		if server.ClusterGroup.Conf.BackupS3 {
+			f, err = server.ClusterGroup.newBackupS3Writer(meta, server, backupDumpName+o.Extension())
+		} else {
+			f, err = os.Create(meta.Dest)
+		}
 		if err != nil {
 			server.ClusterGroup.LogPrintf(LvlErr, "Error backup request: %s", err)
+			server.ClusterGroup.closeBackupMeta(meta, err)
 			return err
 		}
 		wf := bufio.NewWriter(f)
-		gw := gzip.NewWriter(wf)
+		gw, err := stream.NewWriter(wf, o)
+		if err != nil {
+			server.ClusterGroup.LogPrintf(LvlErr, "Error backup request: %s", err)
+			closeBackupWriter(f, err)
+			server.ClusterGroup.closeBackupMeta(meta, err)
+			return err
+		}
 		//fw := bufio.NewWriter(gw)
-		dumpCmd.Stdout = gw
+		cw := server.ClusterGroup.newBackupCoordinatesWriter(gw, meta)
+		dumpCmd.Stdout = cw
 		stderrIn, _ := dumpCmd.StderrPipe()
 		err = dumpCmd.Start()
 		if err != nil {
 			server.ClusterGroup.LogPrintf(LvlErr, "Error backup request: %s", err)
+			cw.Close()
+			closeBackupWriter(f, err)
+			server.ClusterGroup.closeBackupMeta(meta, err)
 			return err
 		}
 		var wg sync.WaitGroup
@@ -653,11 +714,14 @@ func (server *ServerMonitor) JobBackupLogical() error {
 
 			if err != nil {
 				log.Println(err)
+				backupErr = err
 			}
-			gw.Flush()
-			gw.Close()
+			cw.Close()
 			wf.Flush()
-			f.Close()
+			if err := closeBackupWriter(f, backupErr); err != nil {
+				server.ClusterGroup.LogPrintf(LvlErr, "Error backup close: %s", err)
+				backupErr = err
+			}
 		}()
 		wg.Wait()
 
@@ -686,6 +750,13 @@ func (server *ServerMonitor) JobBackupLogical() error {
 
 		err := dumplingext.Dump(conf)
 		server.ClusterGroup.LogPrintf(LvlErr, "Dumpling %s", err)
+		backupErr = err
+		if backupErr == nil {
+			backupErr = server.ClusterGroup.encryptBackupDir(meta)
+		}
+		if backupErr == nil && server.ClusterGroup.Conf.BackupS3 {
+			backupErr = server.ClusterGroup.uploadBackupDir(meta, server)
+		}
 
 	}
 	if server.ClusterGroup.Conf.BackupLogicalType == config.ConstBackupLogicalTypeMydumper {
@@ -729,10 +800,18 @@ func (server *ServerMonitor) JobBackupLogical() error {
 		wg.Wait()
 		if err := dumpCmd.Wait(); err != nil {
 			server.ClusterGroup.LogPrintf(LvlErr, "MyDumper: %s", err)
+			backupErr = err
+		}
+		if backupErr == nil {
+			backupErr = server.ClusterGroup.encryptBackupDir(meta)
+		}
+		if backupErr == nil && server.ClusterGroup.Conf.BackupS3 {
+			backupErr = server.ClusterGroup.uploadBackupDir(meta, server)
 		}
 	}
 
 	server.ClusterGroup.LogPrintf(LvlInfo, "Finish logical backup %s for: %s", server.ClusterGroup.Conf.BackupLogicalType, server.URL)
+	server.ClusterGroup.closeBackupMeta(meta, backupErr)
 	server.BackupRestic()
 	return nil
 }
@@ -849,6 +928,9 @@ func (server *ServerMonitor) JobRunViaSSH() error {
 	res := new(JobResult)
 	val := reflect.ValueOf(res).Elem()
 	for i := 0; i < val.NumField(); i++ {
+		if val.Field(i).Kind() != reflect.Bool {
+			continue
+		}
 		if strings.Contains(strings.ToLower(string(out)), strings.ToLower("no "+val.Type().Field(i).Name)) {
 			val.Field(i).SetBool(false)
 		} else {
@@ -859,6 +941,10 @@ func (server *ServerMonitor) JobRunViaSSH() error {
 	//server.ClusterGroup.LogPrintf(LvlInfo, "Exec via ssh  : %s", res)
 	//server.ClusterGroup.LogPrintf(LvlInfo, "Exec via ssh  : %s", val)
 
+	if prev, ok := server.ClusterGroup.JobResults[server.URL]; ok {
+		res.Pitr = prev.Pitr
+		res.Delayed = prev.Delayed
+	}
 	server.ClusterGroup.JobResults[server.URL] = res
 	return nil
 }
@@ -889,8 +975,14 @@ func (server *ServerMonitor) JobBackupBinlog(binlogfile string) error {
 		server.ClusterGroup.LogPrint(cmdrun.Stdout)
 		return cmdrunErr
 	}
-
-	// Get
+	o, err := server.ClusterGroup.getBackupStreamOptions(stream.CompressNone)
+	if err == nil {
+		err = server.ClusterGroup.encodeBackupFile(server.GetMyBackupDirectory()+binlogfile, o)
+	}
+	if err != nil {
+		server.ClusterGroup.LogPrintf(LvlErr, "Failed to encode backup binlog %s of %s: %s", binlogfile, server.URL, err)
+		return err
+	}
 
 	return nil
 }
@@ -0,0 +1,520 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/gtid"
+	"github.com/signal18/replication-manager/utils/misc"
+)
+
+// PitrJob reports the progress of a point in time recovery in the job results of the server
+type PitrJob struct {
+	Until          string    `json:"until"`
+	Backup         string    `json:"backup"`
+	BackupType     string    `json:"backupType"`
+	BackupTime     time.Time `json:"backupTime"`
+	Step           string    `json:"step"`
+	Binlogs        []string  `json:"binlogs"`
+	BinlogsApplied int       `json:"binlogsApplied"`
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	Done           bool      `json:"done"`
+	Error          string    `json:"error"`
+}
+
+// PitrBackup is a logical backup with the master binlog coordinates of its consistent point
+type PitrBackup struct {
+	Path       string    `json:"path"`
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	BinLogFile string    `json:"binLogFile"`
+	BinLogPos  uint64    `json:"binLogPos"`
+	Gtid       string    `json:"gtid"`
+}
+
+// PitrTarget is the point to recover, either a time or a GTID, the recovery is exclusive: the events
+// from the target time and the transaction of the target GTID are not replayed. A GTID target is
+// located in the binlog stream and the replay stops at its position for all the domains or server
+// UUIDs, the transactions of other domains or UUIDs written after it are not replayed either.
+type PitrTarget struct {
+	Time time.Time
+	Gtid string
+}
+
+const (
+	pitrDumpHeadMaxLines   int    = 200
+	pitrMysqlbinlogTimeFmt string = "2006-01-02 15:04:05"
+)
+
+var (
+	pitrMariaDBGtidRegex  = regexp.MustCompile(`^[0-9]+-[0-9]+-[0-9]+$`)
+	pitrMySQLGtidRegex    = regexp.MustCompile(`^[0-9a-fA-F-]{36}:[0-9]+$`)
+	pitrChangeMasterRegex = regexp.MustCompile(`MASTER_LOG_FILE='([^']+)', MASTER_LOG_POS=([0-9]+)`)
+	pitrGtidSlavePosRegex = regexp.MustCompile(`(?i)gtid_slave_pos='([^']*)'`)
+	pitrGtidPurgedRegex   = regexp.MustCompile(`(?i)GTID_PURGED=(?:/\*!80000 '\+'\*/ )?'([^']*)'`)
+	pitrBinlogAtRegex     = regexp.MustCompile(`^# at ([0-9]+)`)
+	pitrBinlogMariaDBGtid = regexp.MustCompile(`\sGTID\s+([0-9]+-[0-9]+-[0-9]+)`)
+	pitrBinlogMySQLGtid   = regexp.MustCompile(`GTID_NEXT=\s*'([0-9a-fA-F-]{36}:[0-9]+)'`)
+)
+
+// ParsePitrTarget reads a time in RFC3339 or 2006-01-02 15:04:05 format, or a MariaDB or MySQL GTID
+func ParsePitrTarget(until string) (PitrTarget, error) {
+	var target PitrTarget
+	until = strings.TrimSpace(until)
+	if t, err := time.Parse(time.RFC3339, until); err == nil {
+		target.Time = t
+		return target, nil
+	}
+	if t, err := time.ParseInLocation(pitrMysqlbinlogTimeFmt, until, time.Local); err == nil {
+		target.Time = t
+		return target, nil
+	}
+	if pitrMariaDBGtidRegex.MatchString(until) || pitrMySQLGtidRegex.MatchString(until) {
+		target.Gtid = until
+		return target, nil
+	}
+	return target, fmt.Errorf("Invalid point in time recovery target %s, expecting a timestamp or a GTID", until)
+}
+
+// Precedes returns true if the consistent point of the backup is before the target
+func (b PitrBackup) Precedes(target PitrTarget) bool {
+	if !target.Time.IsZero() {
+		return b.Time.Before(target.Time)
+	}
+	if b.Gtid == "" {
+		return false
+	}
+	if strings.Contains(target.Gtid, ":") {
+		g := gtid.NewMySQLGtid(target.Gtid)
+		return gtid.NewMySQLList(b.Gtid).GetSeqServerIdNos(g.ServerID) < g.SeqNo
+	}
+	g := gtid.NewGtid(target.Gtid)
+	for _, bg := range *gtid.NewList(b.Gtid) {
+		if bg.DomainID == g.DomainID {
+			return bg.SeqNo < g.SeqNo
+		}
+	}
+	return true
+}
+
+// readPitrDumpHead extracts the binlog coordinates written by mysqldump at the head of the dump
+func (cluster *Cluster) readPitrDumpHead(path string) (PitrBackup, error) {
+	b := PitrBackup{Path: path, Type: config.ConstBackupLogicalTypeMysqldump}
+	f, err := cluster.openBackupFile(path)
+	if err != nil {
+		return b, err
+	}
+	defer f.Close()
+	scanPitrDumpHead(bufio.NewReader(f), &b)
+	if b.BinLogFile == "" {
+		return b, fmt.Errorf("No binlog coordinates in %s", path)
+	}
+	return b, nil
+}
+
+// scanPitrDumpHead reads the binlog coordinates and the GTID from the head of a plain mysqldump
+func scanPitrDumpHead(rd *bufio.Reader, b *PitrBackup) {
+	for i := 0; i < pitrDumpHeadMaxLines; i++ {
+		line, err := rd.ReadString('\n')
+		if m := pitrChangeMasterRegex.FindStringSubmatch(line); m != nil {
+			b.BinLogFile = m[1]
+			b.BinLogPos, _ = strconv.ParseUint(m[2], 10, 64)
+		}
+		if m := pitrGtidSlavePosRegex.FindStringSubmatch(line); m != nil {
+			b.Gtid = m[1]
+		}
+		if m := pitrGtidPurgedRegex.FindStringSubmatch(line); m != nil {
+			b.Gtid = strings.Replace(m[1], "\\n", "", -1)
+		}
+		if err != nil {
+			break
+		}
+	}
+}
+
+// GetPitrBackups returns the logical backups of the cluster having binlog coordinates, the most recent first
+func (cluster *Cluster) GetPitrBackups() []PitrBackup {
+	var backups []PitrBackup
+	for _, server := range cluster.Servers {
+		dir := server.GetMyBackupDirectory()
+		if st, err := os.Stat(getBackupDumpFile(dir)); err == nil {
+			b, err := cluster.readPitrDumpHead(getBackupDumpFile(dir))
+			if err == nil {
+				b.Time = st.ModTime()
+				backups = append(backups, b)
+			} else {
+				cluster.LogPrintf(LvlDbg, "Skipping backup for point in time recovery: %s", err)
+			}
+		}
+		if meta, err := server.JobMyLoaderParseMeta(dir); err == nil && meta.BinLogFileName != "" {
+			backups = append(backups, PitrBackup{Path: dir, Type: config.ConstBackupLogicalTypeMydumper, Time: meta.StartTimestamp, BinLogFile: meta.BinLogFileName, BinLogPos: meta.BinLogFilePos, Gtid: meta.BinLogUuid})
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Time.After(backups[j].Time)
+	})
+	return backups
+}
+
+// GetPitrBackup returns the latest backup preceding the target
+func (cluster *Cluster) GetPitrBackup(target PitrTarget) (PitrBackup, error) {
+	for _, b := range cluster.GetPitrBackups() {
+		if b.Precedes(target) {
+			return b, nil
+		}
+	}
+	return PitrBackup{}, errors.New("No logical backup preceding the point in time recovery target")
+}
+
+// getPitrBinlogs returns the archive directory and the contiguous archived binlogs starting at the backup coordinates
+func (cluster *Cluster) getPitrBinlogs(b PitrBackup) (string, []string, error) {
+	i := strings.LastIndex(b.BinLogFile, ".")
+	if i < 0 {
+		return "", nil, fmt.Errorf("Invalid binlog file name %s", b.BinLogFile)
+	}
+	prefix := b.BinLogFile[:i+1]
+	start, err := strconv.Atoi(b.BinLogFile[i+1:])
+	if err != nil {
+		return "", nil, fmt.Errorf("Invalid binlog file name %s", b.BinLogFile)
+	}
+	for _, server := range cluster.Servers {
+		dir := server.GetMyBackupDirectory()
+		if _, err := os.Stat(dir + b.BinLogFile); err != nil {
+			continue
+		}
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return "", nil, err
+		}
+		var binlogs []string
+		next := start
+		for _, f := range files {
+			if !strings.HasPrefix(f.Name(), prefix) {
+				continue
+			}
+			n, err := strconv.Atoi(strings.TrimPrefix(f.Name(), prefix))
+			if err != nil || n < start {
+				continue
+			}
+			if n != next {
+				return "", nil, fmt.Errorf("Missing archived binlog %s%06d", prefix, next)
+			}
+			binlogs = append(binlogs, f.Name())
+			next++
+		}
+		return dir, binlogs, nil
+	}
+	return "", nil, fmt.Errorf("Archived binlog %s not found, check backup-binlogs", b.BinLogFile)
+}
+
+// GetPitrJob returns the last point in time recovery of the server
+func (server *ServerMonitor) GetPitrJob() *PitrJob {
+	if res, ok := server.ClusterGroup.JobResults[server.URL]; ok {
+		return res.Pitr
+	}
+	return nil
+}
+
+func (server *ServerMonitor) setPitrJob(job *PitrJob) {
+	res, ok := server.ClusterGroup.JobResults[server.URL]
+	if !ok {
+		res = new(JobResult)
+		server.ClusterGroup.JobResults[server.URL] = res
+	}
+	res.Pitr = job
+}
+
+// JobPitr restores the latest logical backup preceding until, a timestamp or a GTID, and replays
+// the archived binlogs up to it in background. Replication is left stopped on the server.
+func (server *ServerMonitor) JobPitr(until string) (*PitrJob, error) {
+	cluster := server.ClusterGroup
+	if server.IsMaster() {
+		return nil, errors.New("Point in time recovery can't run on the master")
+	}
+	if cluster.IsInFailover() {
+		return nil, errors.New("Cancel point in time recovery during failover")
+	}
+	if job := server.GetPitrJob(); job != nil && !job.Done {
+		return nil, errors.New("Point in time recovery already running")
+	}
+	target, err := ParsePitrTarget(until)
+	if err != nil {
+		return nil, err
+	}
+	backup, err := cluster.GetPitrBackup(target)
+	if err != nil {
+		return nil, err
+	}
+	dir, binlogs, err := cluster.getPitrBinlogs(backup)
+	if err != nil {
+		return nil, err
+	}
+	job := &PitrJob{Until: until, Backup: backup.Path, BackupType: backup.Type, BackupTime: backup.Time, Step: "queued", Binlogs: binlogs, Start: time.Now()}
+	server.setPitrJob(job)
+	cluster.LogPrintf(LvlInfo, "Point in time recovery of %s until %s from %s backup %s and %d binlogs", server.URL, until, backup.Type, backup.Path, len(binlogs))
+	if !target.Time.IsZero() && len(binlogs) > 0 {
+		if st, err := os.Stat(dir + binlogs[len(binlogs)-1]); err == nil && st.ModTime().Before(target.Time) {
+			cluster.LogPrintf(LvlWarn, "Point in time recovery target %s is after the last archived binlog %s, recovery stops at %s", until, binlogs[len(binlogs)-1], st.ModTime().Format(time.RFC3339))
+		}
+	}
+	go server.runPitr(job, target, backup, dir)
+	return job, nil
+}
+
+func (server *ServerMonitor) runPitr(job *PitrJob, target PitrTarget, backup PitrBackup, dir string) {
+	cluster := server.ClusterGroup
+	defer func() {
+		job.End = time.Now()
+		job.Done = true
+	}()
+	logs, err := server.StopSlave()
+	cluster.LogSQL(logs, err, server.URL, "PITR", LvlErr, "Failed stop slave on server: %s %s", server.URL, err)
+
+	job.Step = "restore backup"
+	if backup.Type == config.ConstBackupLogicalTypeMydumper {
+		err = server.restorePitrMyLoader(backup.Path)
+	} else {
+		err = server.restorePitrMysqldump(backup.Path)
+	}
+	if err != nil {
+		job.Step = "failed"
+		job.Error = err.Error()
+		cluster.LogPrintf(LvlErr, "Point in time recovery of %s failed restoring backup: %s", server.URL, err)
+		return
+	}
+
+	job.Step = "replay binlogs"
+	for i, binlog := range job.Binlogs {
+		var startPos, stopPos uint64
+		if i == 0 {
+			startPos = backup.BinLogPos
+		}
+		found := false
+		var err error
+		if target.Gtid != "" {
+			stopPos, found, err = server.locatePitrGtid(dir+binlog, target.Gtid)
+		}
+		if err == nil {
+			err = server.replayPitrBinlog(dir+binlog, target, startPos, stopPos)
+		}
+		if err != nil {
+			job.Step = "failed"
+			job.Error = err.Error()
+			cluster.LogPrintf(LvlErr, "Point in time recovery of %s failed replaying %s: %s", server.URL, binlog, err)
+			return
+		}
+		job.BinlogsApplied = i + 1
+		if found {
+			cluster.LogPrintf(LvlInfo, "Point in time recovery of %s stopped before GTID %s at %s:%d", server.URL, target.Gtid, binlog, stopPos)
+			break
+		}
+		if target.Gtid != "" && i == len(job.Binlogs)-1 {
+			cluster.LogPrintf(LvlWarn, "Point in time recovery target %s not found in the archived binlogs, recovery stops at the end of %s", target.Gtid, binlog)
+		}
+	}
+	job.Step = "done"
+	cluster.LogPrintf(LvlInfo, "Point in time recovery of %s until %s done, replication is left stopped", server.URL, job.Until)
+}
+
+// getPitrBinlogArgs returns the mysqlbinlog arguments replaying a binlog from startPos, up to the target time
+// or up to stopPos, the position of the target GTID event, 0 positions replay the whole binlog
+func getPitrBinlogArgs(target PitrTarget, startPos uint64, stopPos uint64, path string) []string {
+	args := []string{"--disable-log-bin"}
+	if target.Gtid == "" {
+		args = append(args, "--stop-datetime="+target.Time.Local().Format(pitrMysqlbinlogTimeFmt))
+	}
+	if startPos > 0 {
+		args = append(args, "--start-position="+strconv.FormatUint(startPos, 10))
+	}
+	if stopPos > 0 {
+		args = append(args, "--stop-position="+strconv.FormatUint(stopPos, 10))
+	}
+	return append(args, path)
+}
+
+// findPitrGtidPosition returns the position of the first transaction reaching a GTID in the mysqlbinlog
+// output of a binlog, a MariaDB GTID is reached by a transaction of its domain with a greater or equal
+// sequence, a MySQL GTID by a transaction of its server UUID with a greater or equal number
+func findPitrGtidPosition(r io.Reader, target string) (uint64, bool, error) {
+	mysql := strings.Contains(target, ":")
+	var t *gtid.Gtid
+	if mysql {
+		t = gtid.NewMySQLGtid(strings.ToLower(target))
+	} else {
+		t = gtid.NewGtid(target)
+	}
+	var at uint64
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := pitrBinlogAtRegex.FindStringSubmatch(line); m != nil {
+			at, _ = strconv.ParseUint(m[1], 10, 64)
+			continue
+		}
+		if !mysql {
+			if m := pitrBinlogMariaDBGtid.FindStringSubmatch(line); m != nil {
+				g := gtid.NewGtid(m[1])
+				if g.DomainID == t.DomainID && g.SeqNo >= t.SeqNo {
+					return at, true, nil
+				}
+			}
+			continue
+		}
+		if m := pitrBinlogMySQLGtid.FindStringSubmatch(line); m != nil {
+			g := gtid.NewMySQLGtid(strings.ToLower(m[1]))
+			if g.ServerID == t.ServerID && g.SeqNo >= t.SeqNo {
+				return at, true, nil
+			}
+		}
+	}
+	return 0, false, scanner.Err()
+}
+
+// locatePitrGtid decodes a binlog with mysqlbinlog to find the position of the target GTID
+func (server *ServerMonitor) locatePitrGtid(path string, target string) (uint64, bool, error) {
+	arg, stdin, err := server.ClusterGroup.openBackupBinlog(path)
+	if err != nil {
+		return 0, false, err
+	}
+	if stdin != nil {
+		defer stdin.Close()
+	}
+	binlogCmd := exec.Command(server.ClusterGroup.GetMysqlBinlogPath(), arg)
+	binlogCmd.Stdin = stdin
+	var binlogErr bytes.Buffer
+	binlogCmd.Stderr = &binlogErr
+	out, err := binlogCmd.StdoutPipe()
+	if err != nil {
+		return 0, false, err
+	}
+	if err := binlogCmd.Start(); err != nil {
+		return 0, false, err
+	}
+	pos, found, err := findPitrGtidPosition(out, target)
+	// the rest of the binlog is not read once the GTID is found
+	io.Copy(ioutil.Discard, out)
+	if werr := binlogCmd.Wait(); werr != nil && err == nil {
+		err = fmt.Errorf("%s: %s", werr, binlogErr.String())
+	}
+	return pos, found, err
+}
+
+func (server *ServerMonitor) getPitrClientCmd() *exec.Cmd {
+	// do not quote parameters
+	return exec.Command(server.ClusterGroup.GetMysqlclientPath(), `--host=`+misc.Unbracket(server.Host), `--port=`+server.Port, `--user=`+server.ClusterGroup.dbUser, `--password=`+server.ClusterGroup.dbPass, `--batch`, `--init-command=set sql_log_bin=0;`)
+}
+
+// restorePitrMysqldump loads the dump skipping the START SLAVE written by --apply-slave-statements
+func (server *ServerMonitor) restorePitrMysqldump(path string) error {
+	gz, err := server.ClusterGroup.openBackupFile(path)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	pr, pw := io.Pipe()
+	go func() {
+		rd := bufio.NewReader(gz)
+		for {
+			line, err := rd.ReadBytes('\n')
+			if len(line) > 0 && !bytes.HasPrefix(line, []byte("START SLAVE")) {
+				if _, werr := pw.Write(line); werr != nil {
+					pw.CloseWithError(werr)
+					return
+				}
+			}
+			if err == io.EOF {
+				pw.Close()
+				return
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+	clientCmd := server.getPitrClientCmd()
+	clientCmd.Stdin = pr
+	server.ClusterGroup.LogPrintf(LvlInfo, "Command: %s < %s", strings.Replace(clientCmd.String(), server.ClusterGroup.dbPass, "XXXX", -1), path)
+	out, err := clientCmd.CombinedOutput()
+	pr.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %s", err, out)
+	}
+	return nil
+}
+
+func (server *ServerMonitor) restorePitrMyLoader(dir string) (err error) {
+	dir, cleanup, err := server.ClusterGroup.decryptBackupDir(dir)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := cleanup(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+	threads := strconv.Itoa(server.ClusterGroup.Conf.BackupLogicalLoadThreads)
+	loadCmd := exec.Command(server.ClusterGroup.GetMyLoaderPath(), "--overwrite-tables", "--directory="+dir, "--verbose=3", "--threads="+threads, "--host="+misc.Unbracket(server.Host), "--port="+server.Port, "--user="+server.ClusterGroup.dbUser, "--password="+server.ClusterGroup.dbPass)
+	server.ClusterGroup.LogPrintf(LvlInfo, "Command: %s", strings.Replace(loadCmd.String(), server.ClusterGroup.dbPass, "XXXX", 1))
+	out, err := loadCmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %s", err, out)
+	}
+	return nil
+}
+
+// replayPitrBinlog applies an archived binlog to the server, an encoded binlog is decoded into mysqlbinlog
+func (server *ServerMonitor) replayPitrBinlog(path string, target PitrTarget, startPos uint64, stopPos uint64) error {
+	arg, stdin, err := server.ClusterGroup.openBackupBinlog(path)
+	if err != nil {
+		return err
+	}
+	if stdin != nil {
+		defer stdin.Close()
+	}
+	binlogCmd := exec.Command(server.ClusterGroup.GetMysqlBinlogPath(), getPitrBinlogArgs(target, startPos, stopPos, arg)...)
+	binlogCmd.Stdin = stdin
+	var binlogErr bytes.Buffer
+	binlogCmd.Stderr = &binlogErr
+	clientCmd := server.getPitrClientCmd()
+	clientCmd.Stdin, err = binlogCmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	server.ClusterGroup.LogPrintf(LvlInfo, "Command: %s", binlogCmd.String())
+	if err := binlogCmd.Start(); err != nil {
+		return err
+	}
+	out, err := clientCmd.CombinedOutput()
+	if err != nil {
+		binlogCmd.Wait()
+		return fmt.Errorf("%s: %s", err, out)
+	}
+	if err := binlogCmd.Wait(); err != nil {
+		return fmt.Errorf("%s: %s", err, binlogErr.String())
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPitrTarget(t *testing.T) {
+	target, err := ParsePitrTarget("2020-06-01 10:00:00")
+	if err != nil || target.Time.IsZero() {
+		t.Fatalf("Expected a time target, got %v %s", target, err)
+	}
+	backup := PitrBackup{Time: target.Time.Add(-time.Hour), Gtid: "0-1-100,1-2-50"}
+	if !backup.Precedes(target) {
+		t.Fatal("Expected backup to precede the time target")
+	}
+	target, err = ParsePitrTarget("0-1-120")
+	if err != nil || target.Gtid != "0-1-120" {
+		t.Fatalf("Expected a GTID target, got %v %s", target, err)
+	}
+	if !backup.Precedes(target) {
+		t.Fatal("Expected backup to precede the GTID target")
+	}
+	target, _ = ParsePitrTarget("1-2-40")
+	if backup.Precedes(target) {
+		t.Fatal("Expected backup to be after the GTID target")
+	}
+	if _, err = ParsePitrTarget("yesterday"); err == nil {
+		t.Fatal("Expected invalid target error")
+	}
+}
+
+const pitrMariaDBBinlogOutput = `# at 256
+#200601 10:00:00 server id 1  end_log_pos 298 CRC32 0x5e3b2c1a 	GTID 0-1-118 trans
+BEGIN
+# at 298
+#200601 10:00:01 server id 2  end_log_pos 340 CRC32 0x1c2d3e4f 	GTID 1-2-51 trans
+BEGIN
+# at 340
+#200601 10:00:02 server id 1  end_log_pos 382 CRC32 0x7a8b9c0d 	GTID 0-1-120 trans
+BEGIN
+# at 382
+#200601 10:00:03 server id 2  end_log_pos 424 CRC32 0x2b3c4d5e 	GTID 1-2-52 trans
+`
+
+const pitrMySQLBinlogOutput = `# at 194
+#200601 10:00:00 server id 1  end_log_pos 259 CRC32 0x5e3b2c1a 	GTID	last_committed=0	sequence_number=1
+SET @@SESSION.GTID_NEXT= '3E11FA47-71CA-11E1-9E33-C80AA9429562:23'/*!*/;
+# at 259
+#200601 10:00:01 server id 2  end_log_pos 324 CRC32 0x1c2d3e4f 	GTID	last_committed=1	sequence_number=2
+SET @@SESSION.GTID_NEXT= '8b6f0e5a-71ca-11e1-9e33-c80aa9429562:7'/*!*/;
+# at 324
+#200601 10:00:02 server id 1  end_log_pos 389 CRC32 0x7a8b9c0d 	GTID	last_committed=2	sequence_number=3
+SET @@SESSION.GTID_NEXT= '3e11fa47-71ca-11e1-9e33-c80aa9429562:24'/*!*/;
+`
+
+func TestPitrGtidPosition(t *testing.T) {
+	var tests = []struct {
+		output string
+		target string
+		pos    uint64
+		found  bool
+	}{
+		{pitrMariaDBBinlogOutput, "0-1-120", 340, true},
+		{pitrMariaDBBinlogOutput, "0-1-119", 340, true},
+		{pitrMariaDBBinlogOutput, "1-2-51", 298, true},
+		{pitrMariaDBBinlogOutput, "0-1-121", 0, false},
+		{pitrMySQLBinlogOutput, "3e11fa47-71ca-11e1-9e33-c80aa9429562:24", 324, true},
+		{pitrMySQLBinlogOutput, "8B6F0E5A-71CA-11E1-9E33-C80AA9429562:7", 259, true},
+		{pitrMySQLBinlogOutput, "8b6f0e5a-71ca-11e1-9e33-c80aa9429562:8", 0, false},
+	}
+	for _, test := range tests {
+		pos, found, err := findPitrGtidPosition(strings.NewReader(test.output), test.target)
+		if err != nil || pos != test.pos || found != test.found {
+			t.Errorf("Target %s: expected position %d found %t, got %d %t %v", test.target, test.pos, test.found, pos, found, err)
+		}
+	}
+}
+
+func TestPitrBinlogArgs(t *testing.T) {
+	at := time.Date(2020, 6, 1, 10, 0, 0, 0, time.Local)
+	var tests = []struct {
+		target   PitrTarget
+		startPos uint64
+		stopPos  uint64
+		args     string
+	}{
+		{PitrTarget{Time: at}, 4, 0, "--disable-log-bin --stop-datetime=2020-06-01 10:00:00 --start-position=4 bin.000001"},
+		{PitrTarget{Time: at}, 0, 0, "--disable-log-bin --stop-datetime=2020-06-01 10:00:00 bin.000001"},
+		{PitrTarget{Gtid: "0-1-120"}, 4, 340, "--disable-log-bin --start-position=4 --stop-position=340 bin.000001"},
+		{PitrTarget{Gtid: "0-1-120"}, 0, 0, "--disable-log-bin bin.000001"},
+		{PitrTarget{Gtid: "3e11fa47-71ca-11e1-9e33-c80aa9429562:24"}, 0, 324, "--disable-log-bin --stop-position=324 bin.000001"},
+	}
+	for _, test := range tests {
+		args := strings.Join(getPitrBinlogArgs(test.target, test.startPos, test.stopPos, "bin.000001"), " ")
+		if args != test.args {
+			t.Errorf("Expected %q, got %q", test.args, args)
+		}
+	}
+}
@@ -227,7 +227,7 @@ func (server *ServerMonitor) rejoinMasterSync(crash *Crash) error {
 			SSL:         server.ClusterGroup.Conf.ReplicationSSL,
 			Channel:     server.ClusterGroup.Conf.MasterConn,
 			IsDelayed:   server.IsDelayed,
-			Delay:       strconv.Itoa(server.ClusterGroup.Conf.HostsDelayedTime),
+			Delay:       strconv.Itoa(server.GetReplicationDelayedTime()),
 			PostgressDB: server.PostgressDB,
 		}, server.DBVersion)
 		server.ClusterGroup.LogSQL(logs, err, server.URL, "Rejoin", LvlErr, "Change master positional failed in Rejoin old Master in sync %s", err)
@@ -478,7 +478,7 @@ func (server *ServerMonitor) rejoinSlave(ss dbhelper.SlaveStatus) error {
 								Heartbeat:   strconv.Itoa(server.ClusterGroup.Conf.ForceSlaveHeartbeatTime),
 								Channel:     server.ClusterGroup.Conf.MasterConn,
 								IsDelayed:   server.IsDelayed,
-								Delay:       strconv.Itoa(server.ClusterGroup.Conf.HostsDelayedTime),
+								Delay:       strconv.Itoa(server.GetReplicationDelayedTime()),
 								SSL:         server.ClusterGroup.Conf.ReplicationSSL,
 								PostgressDB: server.PostgressDB,
 							}, server.DBVersion)
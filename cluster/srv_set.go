@@ -177,7 +177,7 @@ func (server *ServerMonitor) SetReplicationGTIDSlavePosFromServer(master *Server
 			SSL:         server.ClusterGroup.Conf.ReplicationSSL,
 			Channel:     server.ClusterGroup.Conf.MasterConn,
 			IsDelayed:   server.IsDelayed,
-			Delay:       strconv.Itoa(server.ClusterGroup.Conf.HostsDelayedTime),
+			Delay:       strconv.Itoa(server.GetReplicationDelayedTime()),
 			PostgressDB: server.PostgressDB,
 		}, server.DBVersion)
 	}
@@ -192,7 +192,7 @@ func (server *ServerMonitor) SetReplicationGTIDSlavePosFromServer(master *Server
 		SSL:         server.ClusterGroup.Conf.ReplicationSSL,
 		Channel:     server.ClusterGroup.Conf.MasterConn,
 		IsDelayed:   server.IsDelayed,
-		Delay:       strconv.Itoa(server.ClusterGroup.Conf.HostsDelayedTime),
+		Delay:       strconv.Itoa(server.GetReplicationDelayedTime()),
 		PostgressDB: server.PostgressDB,
 	}, server.DBVersion)
 }
@@ -214,7 +214,7 @@ func (server *ServerMonitor) SetReplicationGTIDCurrentPosFromServer(master *Serv
 			SSL:         server.ClusterGroup.Conf.ReplicationSSL,
 			Channel:     server.ClusterGroup.Conf.MasterConn,
 			IsDelayed:   server.IsDelayed,
-			Delay:       strconv.Itoa(server.ClusterGroup.Conf.HostsDelayedTime),
+			Delay:       strconv.Itoa(server.GetReplicationDelayedTime()),
 			PostgressDB: server.PostgressDB,
 		}, server.DBVersion)
 	} else {
@@ -229,7 +229,7 @@ func (server *ServerMonitor) SetReplicationGTIDCurrentPosFromServer(master *Serv
 			SSL:         server.ClusterGroup.Conf.ReplicationSSL,
 			Channel:     server.ClusterGroup.Conf.MasterConn,
 			IsDelayed:   server.IsDelayed,
-			Delay:       strconv.Itoa(server.ClusterGroup.Conf.HostsDelayedTime),
+			Delay:       strconv.Itoa(server.GetReplicationDelayedTime()),
 			PostgressDB: server.PostgressDB,
 		}, server.DBVersion)
 	}
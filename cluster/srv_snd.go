@@ -95,14 +95,15 @@ func (server *ServerMonitor) SendDatabaseStats() error {
 }
 
 func (server *ServerMonitor) SendAlert() error {
-	if server.ClusterGroup.Status != ConstMonitorActif && server.ClusterGroup.IsDiscovered() {
+	if server.State == server.PrevState {
 		return nil
 	}
-	if server.State == server.PrevState {
+	// silences and routes apply to the mail and the alert script as to the alert channels
+	e := server.getStateChangeAlert()
+	if !server.ClusterGroup.prepareAlertEvent(e) {
 		return nil
 	}
-
-	if server.ClusterGroup.Conf.MailTo != "" {
+	if server.ClusterGroup.Conf.MailTo != "" && server.ClusterGroup.isAlertRouted("mail", e) {
 		a := alert.Alert{
 			From:        server.ClusterGroup.Conf.MailFrom,
 			To:          server.ClusterGroup.Conf.MailTo,
@@ -119,7 +120,7 @@ func (server *ServerMonitor) SendAlert() error {
 			server.ClusterGroup.LogPrintf("ERROR", "Could not send mail alert: %s ", err)
 		}
 	}
-	if server.ClusterGroup.Conf.AlertScript != "" {
+	if server.ClusterGroup.Conf.AlertScript != "" && !server.ClusterGroup.Conf.AlertScriptDispatch && server.ClusterGroup.isAlertRouted("script", e) {
 		server.ClusterGroup.LogPrintf("INFO", "Calling alert script")
 		var out []byte
 		out, err := exec.Command(server.ClusterGroup.Conf.AlertScript, server.URL, server.PrevState, server.State).CombinedOutput()
@@ -129,6 +130,9 @@ func (server *ServerMonitor) SendAlert() error {
 
 		server.ClusterGroup.LogPrintf("INFO", "Alert script complete:", string(out))
 	}
+	if server.ClusterGroup.alertDispatcher != nil {
+		server.ClusterGroup.alertDispatcher.Dispatch(e)
+	}
 
 	return nil
 }
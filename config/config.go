@@ -92,6 +92,7 @@ type Config struct {
 	Timeout                                   int    `mapstructure:"db-servers-connect-timeout" toml:"db-servers-connect-timeout" json:"dbServersConnectTimeout"`
 	ReadTimeout                               int    `mapstructure:"db-servers-read-timeout" toml:"db-servers-read-timeout" json:"dbServersReadTimeout"`
 	DBServersLocality                         string `mapstructure:"db-servers-locality" toml:"db-servers-locality" json:"dbServersLocality"`
+	DBServersTags                             string `mapstructure:"db-servers-tags" toml:"db-servers-tags" json:"dbServersTags"`
 	PRXServersReadOnMaster                    bool   `mapstructure:"proxy-servers-read-on-master" toml:"proxy-servers-read-on-master" json:"proxyServersReadOnMaster"`
 	PRXServersBackendCompression              bool   `mapstructure:"proxy-servers-backend-compression" toml:"proxy-servers-backend-compression" json:"proxyServersBackendCompression"`
 	PRXServersBackendMaxReplicationLag        int    `mapstructure:"proxy-servers-backend-max-replication-lag" toml:"proxy-servers-backend--max-replication-lag" json:"proxyServersBackendMaxReplicationLag"`
@@ -142,6 +143,12 @@ type Config struct {
 	CheckFalsePositiveExternal                bool   `mapstructure:"failover-falsepositive-external" toml:"failover-falsepositive-external" json:"failoverFalsePositiveExternal"`
 	CheckFalsePositiveExternalPort            int    `mapstructure:"failover-falsepositive-external-port" toml:"failover-falsepositive-external-port" json:"failoverFalsePositiveExternalPort"`
 	FailoverLogFileKeep                       int    `mapstructure:"failover-log-file-keep" toml:"failover-log-file-keep" json:"failoverLogFileKeep"`
+	FailoverJournalKeep                       int    `mapstructure:"failover-journal-keep" toml:"failover-journal-keep" json:"failoverJournalKeep"`
+	FailElectionScoring                       bool   `mapstructure:"failover-election-scoring" toml:"failover-election-scoring" json:"failoverElectionScoring"`
+	FailElectionRules                         string `mapstructure:"failover-election-rules" toml:"failover-election-rules" json:"failoverElectionRules"`
+	FailElectionDatacenter                    string `mapstructure:"failover-election-datacenter" toml:"failover-election-datacenter" json:"failoverElectionDatacenter"`
+	FailElectionServerDatacenters             string `mapstructure:"failover-election-server-datacenters" toml:"failover-election-server-datacenters" json:"failoverElectionServerDatacenters"`
+	FailElectionServerWeights                 string `mapstructure:"failover-election-server-weights" toml:"failover-election-server-weights" json:"failoverElectionServerWeights"`
 	Autorejoin                                bool   `mapstructure:"autorejoin" toml:"autorejoin" json:"autorejoin"`
 	Autoseed                                  bool   `mapstructure:"autoseed" toml:"autoseed" json:"autoseed"`
 	AutorejoinFlashback                       bool   `mapstructure:"autorejoin-flashback" toml:"autorejoin-flashback" json:"autorejoinFlashback"`
@@ -223,10 +230,27 @@ type Config struct {
 	MxsGetInfoMethod                          string `mapstructure:"maxscale-get-info-method" toml:"maxscale-get-info-method" json:"maxscaleGetInfoMethod"`
 	MxsServerMatchPort                        bool   `mapstructure:"maxscale-server-match-port" toml:"maxscale-server-match-port" json:"maxscaleServerMatchPort"`
 	MxsBinaryPath                             string `mapstructure:"maxscale-binary-path" toml:"maxscale-binary-path" json:"maxscalemBinaryPath"`
+	MxsRestPort                               int    `mapstructure:"maxscale-rest-port" toml:"maxscale-rest-port" json:"maxscaleRestPort"`
+	MxsRestSsl                                bool   `mapstructure:"maxscale-rest-ssl" toml:"maxscale-rest-ssl" json:"maxscaleRestSsl"`
+	MxsRestTLSSkipVerify                      bool   `mapstructure:"maxscale-rest-tls-skip-verify" toml:"maxscale-rest-tls-skip-verify" json:"maxscaleRestTlsSkipVerify"`
+	MxsRestTLSCA                              string `mapstructure:"maxscale-rest-tls-ca" toml:"maxscale-rest-tls-ca" json:"maxscaleRestTlsCa"`
+	MxsMonitorPassive                         bool   `mapstructure:"maxscale-monitor-passive" toml:"maxscale-monitor-passive" json:"maxscaleMonitorPassive"`
 	MyproxyOn                                 bool   `mapstructure:"myproxy" toml:"myproxy" json:"myproxy"`
 	MyproxyPort                               int    `mapstructure:"myproxy-port" toml:"myproxy-port" json:"myproxyPort"`
 	MyproxyUser                               string `mapstructure:"myproxy-user" toml:"myproxy-user" json:"myproxyUser"`
 	MyproxyPassword                           string `mapstructure:"myproxy-password" toml:"myproxy-password" json:"myproxyPassword"`
+	MyproxyReadWriteSplit                     bool   `mapstructure:"myproxy-read-write-split" toml:"myproxy-read-write-split" json:"myproxyReadWriteSplit"`
+	MyproxyReadMaxLag                         int64  `mapstructure:"myproxy-read-max-lag" toml:"myproxy-read-max-lag" json:"myproxyReadMaxLag"`
+	MyproxySwitchoverPause                    bool   `mapstructure:"myproxy-switchover-pause" toml:"myproxy-switchover-pause" json:"myproxySwitchoverPause"`
+	MyproxySwitchoverMaxPause                 int64  `mapstructure:"myproxy-switchover-max-pause" toml:"myproxy-switchover-max-pause" json:"myproxySwitchoverMaxPause"`
+	MyproxySwitchoverMaxQueue                 int    `mapstructure:"myproxy-switchover-max-queue" toml:"myproxy-switchover-max-queue" json:"myproxySwitchoverMaxQueue"`
+	MyproxyDigestStats                        bool   `mapstructure:"myproxy-digest-stats" toml:"myproxy-digest-stats" json:"myproxyDigestStats"`
+	MyproxyDigestMax                          int    `mapstructure:"myproxy-digest-max" toml:"myproxy-digest-max" json:"myproxyDigestMax"`
+	EnvoyOn                                   bool   `mapstructure:"envoy" toml:"envoy" json:"envoy"`
+	EnvoyXdsPort                              int    `mapstructure:"envoy-xds-port" toml:"envoy-xds-port" json:"envoyXdsPort"`
+	EnvoyWritePort                            int    `mapstructure:"envoy-write-port" toml:"envoy-write-port" json:"envoyWritePort"`
+	EnvoyReadPort                             int    `mapstructure:"envoy-read-port" toml:"envoy-read-port" json:"envoyReadPort"`
+	EnvoyReadMaxLag                           int64  `mapstructure:"envoy-read-max-lag" toml:"envoy-read-max-lag" json:"envoyReadMaxLag"`
 	HaproxyOn                                 bool   `mapstructure:"haproxy" toml:"haproxy" json:"haproxy"`
 	HaproxyUser                               string `mapstructure:"haproxy-user" toml:"haproxy-user" json:"haproxylUser"`
 	HaproxyPassword                           string `mapstructure:"haproxy-password" toml:"haproxy-password" json:"haproxyPassword"`
@@ -239,6 +263,7 @@ type Config struct {
 	HaproxyWriteBindIp                        string `mapstructure:"haproxy-ip-write-bind" toml:"haproxy-ip-write-bind" json:"haproxyIpWriteBind"`
 	HaproxyReadBindIp                         string `mapstructure:"haproxy-ip-read-bind" toml:"haproxy-ip-read-bind" json:"haproxyIpReadBind"`
 	HaproxyBinaryPath                         string `mapstructure:"haproxy-binary-path" toml:"haproxy-binary-path" json:"haproxyBinaryPath"`
+	HaproxyServerSlots                        int    `mapstructure:"haproxy-server-slots" toml:"haproxy-server-slots" json:"haproxyServerSlots"`
 	ProxysqlOn                                bool   `mapstructure:"proxysql" toml:"proxysql" json:"proxysql"`
 	ProxysqlSaveToDisk                        bool   `mapstructure:"proxysql-save-to-disk" toml:"proxysql-save-to-disk" json:"proxysqlSaveToDisk"`
 	ProxysqlHosts                             string `mapstructure:"proxysql-servers" toml:"proxysql-servers" json:"proxysqlServers"`
@@ -402,11 +427,55 @@ type Config struct {
 	APIUsersExternal                          string `mapstructure:"api-credentials-external" toml:"api-credentials-external" json:"apiCredentialsExternal"`
 	APIUsersACLAllow                          string `mapstructure:"api-credentials-acl-allow" toml:"api-credentials-acl-allow" json:"apiCredentialsACLAllow"`
 	APIUsersACLDiscard                        string `mapstructure:"api-credentials-acl-discard" toml:"api-credentials-acl-discard" json:"apiCredentialsACLDiscard"`
+	APIOIDCIssuer                             string `mapstructure:"api-oidc-issuer" toml:"api-oidc-issuer" json:"apiOidcIssuer"`
+	APIOIDCClientId                           string `mapstructure:"api-oidc-client-id" toml:"api-oidc-client-id" json:"apiOidcClientId"`
+	APIOIDCClientSecret                       string `mapstructure:"api-oidc-client-secret" toml:"api-oidc-client-secret" json:"-"`
+	APIOIDCRedirectURL                        string `mapstructure:"api-oidc-redirect-url" toml:"api-oidc-redirect-url" json:"apiOidcRedirectUrl"`
+	APIOIDCJwksURL                            string `mapstructure:"api-oidc-jwks-url" toml:"api-oidc-jwks-url" json:"apiOidcJwksUrl"`
+	APIOIDCAudience                           string `mapstructure:"api-oidc-audience" toml:"api-oidc-audience" json:"apiOidcAudience"`
+	APIOIDCScopes                             string `mapstructure:"api-oidc-scopes" toml:"api-oidc-scopes" json:"apiOidcScopes"`
+	APIOIDCUserClaim                          string `mapstructure:"api-oidc-user-claim" toml:"api-oidc-user-claim" json:"apiOidcUserClaim"`
+	APIOIDCGroupsClaim                        string `mapstructure:"api-oidc-groups-claim" toml:"api-oidc-groups-claim" json:"apiOidcGroupsClaim"`
+	APIOIDCGroupsACL                          string `mapstructure:"api-oidc-groups-acl" toml:"api-oidc-groups-acl" json:"apiOidcGroupsAcl"`
+	APILdapURL                                string `mapstructure:"api-ldap-url" toml:"api-ldap-url" json:"apiLdapUrl"`
+	APILdapStartTLS                           bool   `mapstructure:"api-ldap-starttls" toml:"api-ldap-starttls" json:"apiLdapStarttls"`
+	APILdapTLSSkipVerify                      bool   `mapstructure:"api-ldap-tls-skip-verify" toml:"api-ldap-tls-skip-verify" json:"apiLdapTlsSkipVerify"`
+	APILdapTLSCA                              string `mapstructure:"api-ldap-tls-ca" toml:"api-ldap-tls-ca" json:"apiLdapTlsCa"`
+	APILdapBindDN                             string `mapstructure:"api-ldap-bind-dn" toml:"api-ldap-bind-dn" json:"apiLdapBindDn"`
+	APILdapBindPassword                       string `mapstructure:"api-ldap-bind-password" toml:"api-ldap-bind-password" json:"-"`
+	APILdapUserBase                           string `mapstructure:"api-ldap-user-base" toml:"api-ldap-user-base" json:"apiLdapUserBase"`
+	APILdapUserFilter                         string `mapstructure:"api-ldap-user-filter" toml:"api-ldap-user-filter" json:"apiLdapUserFilter"`
+	APILdapGroupAttribute                     string `mapstructure:"api-ldap-group-attribute" toml:"api-ldap-group-attribute" json:"apiLdapGroupAttribute"`
+	APILdapGroupBase                          string `mapstructure:"api-ldap-group-base" toml:"api-ldap-group-base" json:"apiLdapGroupBase"`
+	APILdapGroupFilter                        string `mapstructure:"api-ldap-group-filter" toml:"api-ldap-group-filter" json:"apiLdapGroupFilter"`
+	APILdapGroupsACL                          string `mapstructure:"api-ldap-groups-acl" toml:"api-ldap-groups-acl" json:"apiLdapGroupsAcl"`
+	APILdapCacheTTL                           int    `mapstructure:"api-ldap-cache-ttl" toml:"api-ldap-cache-ttl" json:"apiLdapCacheTtl"`
+	APITokensMaxTTL                           int    `mapstructure:"api-tokens-max-ttl" toml:"api-tokens-max-ttl" json:"apiTokensMaxTtl"`
+	APIAuditLog                               bool   `mapstructure:"api-audit-log" toml:"api-audit-log" json:"apiAuditLog"`
+	APIAuditFile                              string `mapstructure:"api-audit-file" toml:"api-audit-file" json:"apiAuditFile"`
+	APIAuditSyslog                            bool   `mapstructure:"api-audit-syslog" toml:"api-audit-syslog" json:"apiAuditSyslog"`
 	APISecureConfig                           bool   `mapstructure:"api-credentials-secure-config" toml:"api-credentials-secure-config" json:"apiCredentialsSecureConfig"`
 	APIPort                                   string `mapstructure:"api-port" toml:"api-port" json:"apiPort"`
 	APIBind                                   string `mapstructure:"api-bind" toml:"api-bind" json:"apiBind"`
 	APIHttpsBind                              bool   `mapstructure:"api-https-bind" toml:"api-secure" json:"apiHttpsBind"`
 	AlertScript                               string `mapstructure:"alert-script" toml:"alert-script" json:"alertScript"`
+	AlertScriptSeverity                       string `mapstructure:"alert-script-severity" toml:"alert-script-severity" json:"alertScriptSeverity"`
+	AlertScriptDispatch                       bool   `mapstructure:"alert-script-dispatch" toml:"alert-script-dispatch" json:"alertScriptDispatch"`
+	AlertWebhookURL                           string `mapstructure:"alert-webhook-url" toml:"alert-webhook-url" json:"alertWebhookUrl"`
+	AlertWebhookSecret                        string `mapstructure:"alert-webhook-secret" toml:"alert-webhook-secret" json:"alertWebhookSecret"`
+	AlertWebhookSeverity                      string `mapstructure:"alert-webhook-severity" toml:"alert-webhook-severity" json:"alertWebhookSeverity"`
+	AlertPagerDutyURL                         string `mapstructure:"alert-pagerduty-url" toml:"alert-pagerduty-url" json:"alertPagerdutyUrl"`
+	AlertPagerDutyRoutingKey                  string `mapstructure:"alert-pagerduty-routing-key" toml:"alert-pagerduty-routing-key" json:"alertPagerdutyRoutingKey"`
+	AlertPagerDutySeverity                    string `mapstructure:"alert-pagerduty-severity" toml:"alert-pagerduty-severity" json:"alertPagerdutySeverity"`
+	AlertOpsgenieURL                          string `mapstructure:"alert-opsgenie-url" toml:"alert-opsgenie-url" json:"alertOpsgenieUrl"`
+	AlertOpsgenieAPIKey                       string `mapstructure:"alert-opsgenie-api-key" toml:"alert-opsgenie-api-key" json:"alertOpsgenieApiKey"`
+	AlertOpsgenieSeverity                     string `mapstructure:"alert-opsgenie-severity" toml:"alert-opsgenie-severity" json:"alertOpsgenieSeverity"`
+	AlertTeamsURL                             string `mapstructure:"alert-teams-url" toml:"alert-teams-url" json:"alertTeamsUrl"`
+	AlertTeamsSeverity                        string `mapstructure:"alert-teams-severity" toml:"alert-teams-severity" json:"alertTeamsSeverity"`
+	AlertRetry                                int    `mapstructure:"alert-retry" toml:"alert-retry" json:"alertRetry"`
+	AlertRetryBackoff                         int    `mapstructure:"alert-retry-backoff" toml:"alert-retry-backoff" json:"alertRetryBackoff"`
+	AlertRoutes                               string `mapstructure:"alert-routes" toml:"alert-routes" json:"alertRoutes"`
+	AlertDedupWindow                          int    `mapstructure:"alert-dedup-window" toml:"alert-dedup-window" json:"alertDedupWindow"`
 	ConfigFile                                string `mapstructure:"config" toml:"-" json:"-"`
 	MonitorScheduler                          bool   `mapstructure:"monitoring-scheduler" toml:"monitoring-scheduler" json:"monitoringScheduler"`
 	SchedulerReceiverPorts                    string `mapstructure:"scheduler-db-servers-receiver-ports" toml:"scheduler--db-servers-receiver-ports" json:"schedulerDbServersReceiverPorts"`
@@ -428,6 +497,12 @@ type Config struct {
 	SchedulerRollingReprovCron                string `mapstructure:"scheduler-rolling-reprov-cron" toml:"scheduler-rolling-reprov-cron" json:"schedulerRollingReprovCron"`
 	SchedulerJobsSSH                          bool   `mapstructure:"scheduler-jobs-ssh" toml:"scheduler-jobs-ssh" json:"schedulerJobsSsh"`
 	SchedulerJobsSSHCron                      string `mapstructure:"scheduler-jobs-ssh-cron" toml:"scheduler-jobs-ssh-cron" json:"schedulerJobsSshCron"`
+	SchedulerBackupVerify                     bool   `mapstructure:"scheduler-db-servers-backup-verify" toml:"scheduler-db-servers-backup-verify" json:"schedulerDbServersBackupVerify"`
+	BackupVerifyCron                          string `mapstructure:"scheduler-db-servers-backup-verify-cron" toml:"scheduler-db-servers-backup-verify-cron" json:"schedulerDbServersBackupVerifyCron"`
+	BackupVerifyPort                          string `mapstructure:"backup-verify-port" toml:"backup-verify-port" json:"backupVerifyPort"`
+	BackupVerifyTimeout                       int    `mapstructure:"backup-verify-timeout" toml:"backup-verify-timeout" json:"backupVerifyTimeout"`
+	BackupChecksumTables                      bool   `mapstructure:"backup-checksum-tables" toml:"backup-checksum-tables" json:"backupChecksumTables"`
+	BackupCatalogKeep                         int    `mapstructure:"backup-catalog-keep" toml:"backup-catalog-keep" json:"backupCatalogKeep"`
 	Backup                                    bool   `mapstructure:"backup" toml:"backup" json:"backup"`
 	BackupLogicalType                         string `mapstructure:"backup-logical-type" toml:"backup-logical-type" json:"backupLogicalType"`
 	BackupLogicalLoadThreads                  int    `mapstructure:"backup-logical-load-threads" toml:"backup-logical-load-threads" json:"backupLogicalLoadThreads"`
@@ -453,6 +528,21 @@ type Config struct {
 	BackupStreamingEndpoint                   string `mapstructure:"backup-streaming-endpoint" toml:"backup-streaming-endpoint" json:"backupStreamingEndpoint"`
 	BackupStreamingRegion                     string `mapstructure:"backup-streaming-region" toml:"backup-streaming-region" json:"backupStreamingRegion"`
 	BackupStreamingBucket                     string `mapstructure:"backup-streaming-bucket" toml:"backup-streaming-bucket" json:"backupStreamingBucket"`
+	BackupS3                                  bool   `mapstructure:"backup-s3" toml:"backup-s3" json:"backupS3"`
+	BackupS3Endpoint                          string `mapstructure:"backup-s3-endpoint" toml:"backup-s3-endpoint" json:"backupS3Endpoint"`
+	BackupS3Region                            string `mapstructure:"backup-s3-region" toml:"backup-s3-region" json:"backupS3Region"`
+	BackupS3Bucket                            string `mapstructure:"backup-s3-bucket" toml:"backup-s3-bucket" json:"backupS3Bucket"`
+	BackupS3Prefix                            string `mapstructure:"backup-s3-prefix" toml:"backup-s3-prefix" json:"backupS3Prefix"`
+	BackupS3AwsAccessKeyId                    string `mapstructure:"backup-s3-aws-access-key-id" toml:"backup-s3-aws-access-key-id" json:"-"`
+	BackupS3AwsAccessSecret                   string `mapstructure:"backup-s3-aws-access-secret" toml:"backup-s3-aws-access-secret" json:"-"`
+	BackupS3PathStyle                         bool   `mapstructure:"backup-s3-path-style" toml:"backup-s3-path-style" json:"backupS3PathStyle"`
+	BackupS3SSE                               string `mapstructure:"backup-s3-sse" toml:"backup-s3-sse" json:"backupS3Sse"`
+	BackupS3SSEKmsKeyId                       string `mapstructure:"backup-s3-sse-kms-key-id" toml:"backup-s3-sse-kms-key-id" json:"backupS3SseKmsKeyId"`
+	BackupS3PartSize                          int    `mapstructure:"backup-s3-part-size" toml:"backup-s3-part-size" json:"backupS3PartSize"`
+	BackupS3Concurrency                       int    `mapstructure:"backup-s3-concurrency" toml:"backup-s3-concurrency" json:"backupS3Concurrency"`
+	BackupCompression                         string `mapstructure:"backup-compression" toml:"backup-compression" json:"backupCompression"`
+	BackupEncryption                          string `mapstructure:"backup-encryption" toml:"backup-encryption" json:"backupEncryption"`
+	BackupZstdPath                            string `mapstructure:"backup-zstd-path" toml:"backup-zstd-path" json:"backupZstdPath"`
 	BackupMysqldumpPath                       string `mapstructure:"backup-mysqldump-path" toml:"backup-mysqldump-path" json:"backupMysqldumpPath"`
 	BackupMyDumperPath                        string `mapstructure:"backup-mydumper-path" toml:"backup-mydumper-path" json:"backupMydumperPath"`
 	BackupMyLoaderPath                        string `mapstructure:"backup-myloader-path" toml:"backup-myloader-path" json:"backupMyloaderPath"`
@@ -504,7 +594,12 @@ type QueryRule struct {
 	DestinationHostgroup sql.NullInt64  `json:"destinationHostgroup" db:"destination_hostgroup"`
 	MirrorHostgroup      sql.NullInt64  `json:"mirrorHostgroup" db:"mirror_hostgroup"`
 	Multiplex            sql.NullInt64  `json:"multiplex" db:"multiplex"`
+	ReplacePattern       sql.NullString `json:"replacePattern" db:"replace_pattern"`
+	ErrorMsg             sql.NullString `json:"errorMsg" db:"error_msg"`
+	RateLimit            int64          `json:"rateLimit" db:"rate_limit"`
+	Apply                int            `json:"apply" db:"apply"`
 	Proxies              string         `json:"proxies" db:"proxies"`
+	Hits                 uint64         `json:"hits" db:"hits"`
 }
 
 type MyDumperMetaData struct {
@@ -528,6 +623,8 @@ const (
 	ConstProxyMysqlrouter string = "mysqlrouter"
 	ConstProxySphinx      string = "sphinx"
 	ConstProxyMyProxy     string = "myproxy"
+	ConstProxyConsul      string = "consul"
+	ConstProxyEnvoy       string = "envoy"
 )
 
 type ServicePlan struct {
@@ -607,7 +704,9 @@ const (
 	GrantClusterShowGraphs       string = "cluster-show-graphs"
 	GrantClusterShowAgents       string = "cluster-show-agents"
 	GrantClusterShowCertificates string = "cluster-show-certificates"
+	GrantClusterShowAudit        string = "cluster-show-audit"
 	GrantClusterResetSLA         string = "cluster-reset-sla"
+	GrantClusterAlerts           string = "cluster-alerts"
 	GrantClusterDebug            string = "cluster-debug"
 	GrantProxyConfigCreate       string = "proxy-config-create"
 	GrantProxyConfigGet          string = "proxy-config-get"
@@ -709,6 +808,7 @@ func (conf *Config) GetMonitorType() map[string]string {
 		"shardproxy": "proxy",
 		"haproxy":    "proxy",
 		"myproxy":    "proxy",
+		"envoy":      "proxy",
 		"extproxy":   "proxy",
 		"sphinx":     "proxy",
 	}
@@ -849,7 +949,9 @@ func (conf *Config) GetGrantType() map[string]string {
 		GrantClusterShowGraphs:       GrantClusterShowGraphs,
 		GrantClusterShowRoutes:       GrantClusterShowRoutes,
 		GrantClusterShowCertificates: GrantClusterShowCertificates,
+		GrantClusterShowAudit:        GrantClusterShowAudit,
 		GrantClusterResetSLA:         GrantClusterResetSLA,
+		GrantClusterAlerts:           GrantClusterAlerts,
 		GrantProxyConfigCreate:       GrantProxyConfigCreate,
 		GrantProxyConfigGet:          GrantProxyConfigGet,
 		GrantProxyConfigRessource:    GrantProxyConfigRessource,
@@ -191,6 +191,7 @@ func init() {
 	monitorCmd.Flags().IntVar(&conf.Timeout, "db-servers-connect-timeout", 5, "Database connection timeout in seconds")
 	monitorCmd.Flags().IntVar(&conf.ReadTimeout, "db-servers-read-timeout", 3600, "Database read timeout in seconds")
 	monitorCmd.Flags().StringVar(&conf.PrefMaster, "db-servers-prefered-master", "", "Database preferred candidate in election,  host:[port] format")
+	monitorCmd.Flags().StringVar(&conf.DBServersTags, "db-servers-tags", "", "Database hosts tags in the host:[port]=tag1 tag2 format separated by commas, a host tag can carry its datacenter name")
 	monitorCmd.Flags().StringVar(&conf.IgnoreSrv, "db-servers-ignored-hosts", "", "Database list of hosts to ignore in election")
 	monitorCmd.Flags().StringVar(&conf.IgnoreSrvRO, "db-servers-ignored-readonly", "", "Database list of hosts to ignore set readonly")
 	monitorCmd.Flags().StringVar(&conf.BackupServers, "db-servers-backup-hosts", "", "Database list of hosts to backup when set can backup a slave")
@@ -205,7 +206,7 @@ func init() {
 	monitorCmd.Flags().IntVar(&conf.SwitchSlaveWaitRouteChange, "switchover-wait-route-change", 2, "Switchover wait for unmanged proxy monitor to dicoverd new state")
 	monitorCmd.Flags().StringVar(&conf.MasterConn, "replication-source-name", "", "Replication channel name to use for multisource")
 
-	monitorCmd.Flags().StringVar(&conf.HostsDelayed, "replication-delayed-hosts", "", "Database hosts list that need delayed replication separated by commas")
+	monitorCmd.Flags().StringVar(&conf.HostsDelayed, "replication-delayed-hosts", "", "Database hosts list that need delayed replication separated by commas, host:port=seconds overrides replication-delayed-time for a host")
 	monitorCmd.Flags().IntVar(&conf.HostsDelayedTime, "replication-delayed-time", 3600, "Delayed replication time")
 
 	monitorCmd.Flags().IntVar(&conf.MasterConnectRetry, "replication-master-connect-retry", 10, "Replication is define using this connection retry timeout")
@@ -239,6 +240,12 @@ func init() {
 	monitorCmd.Flags().IntVar(&conf.CheckFalsePositiveExternalPort, "failover-falsepositive-external-port", 80, "Failover checks external port")
 	monitorCmd.Flags().IntVar(&conf.MaxFail, "failover-falsepositive-ping-counter", 5, "Failover after this number of ping failures (interval 1s)")
 	monitorCmd.Flags().IntVar(&conf.FailoverLogFileKeep, "failover-log-file-keep", 5, "Purge log files taken during failover")
+	monitorCmd.Flags().IntVar(&conf.FailoverJournalKeep, "failover-journal-keep", 100, "Number of switchover and failover events kept in the failover journal")
+	monitorCmd.Flags().BoolVar(&conf.FailElectionScoring, "failover-election-scoring", false, "Rank electable candidates with weighted scoring rules, failover only ranks the most up to date ones")
+	monitorCmd.Flags().StringVar(&conf.FailElectionRules, "failover-election-rules", "lag:10,datacenter:50,hardware:5,semisync:20,relaylog:5,weight:10", "Election scoring rules and weights in the rule:weight format separated by commas")
+	monitorCmd.Flags().StringVar(&conf.FailElectionDatacenter, "failover-election-datacenter", "", "Datacenter to prefer in election, default to the datacenter of the old master")
+	monitorCmd.Flags().StringVar(&conf.FailElectionServerDatacenters, "failover-election-server-datacenters", "", "Database hosts datacenters in the host:[port]=datacenter format separated by commas")
+	monitorCmd.Flags().StringVar(&conf.FailElectionServerWeights, "failover-election-server-weights", "", "Database hosts custom election weights in the host:[port]=weight format separated by commas")
 	monitorCmd.Flags().BoolVar(&conf.Autoseed, "autoseed", false, "Automatic join a standalone node")
 	monitorCmd.Flags().BoolVar(&conf.Autorejoin, "autorejoin", true, "Automatic rejoin a failed master")
 	monitorCmd.Flags().BoolVar(&conf.AutorejoinBackupBinlog, "autorejoin-backup-binlog", true, "backup ahead binlogs events when old master rejoin")
@@ -253,6 +260,23 @@ func init() {
 	monitorCmd.Flags().BoolVar(&conf.AutorejoinSlavePositionalHeartbeat, "autorejoin-slave-positional-heartbeat", false, "Automatically rejoin extra slaves via pseudo gtid heartbeat for positional replication")
 
 	monitorCmd.Flags().StringVar(&conf.AlertScript, "alert-script", "", "Path for alerting script server status change")
+	monitorCmd.Flags().BoolVar(&conf.AlertScriptDispatch, "alert-script-dispatch", false, "Send the server state changes and the cluster states to the alert script as alert events, with the severity, routes and dedup of the alert channels")
+	monitorCmd.Flags().StringVar(&conf.AlertScriptSeverity, "alert-script-severity", "INFO", "Minimum severity sent to the alert script with alert-script-dispatch INFO|WARN|ERROR|CRITICAL")
+	monitorCmd.Flags().StringVar(&conf.AlertWebhookURL, "alert-webhook-url", "", "Webhook URL receiving alerts as JSON")
+	monitorCmd.Flags().StringVar(&conf.AlertWebhookSecret, "alert-webhook-secret", "", "Secret to sign webhook alerts with HMAC-SHA256 in the X-Repman-Signature header")
+	monitorCmd.Flags().StringVar(&conf.AlertWebhookSeverity, "alert-webhook-severity", "WARN", "Minimum severity sent to the webhook INFO|WARN|ERROR|CRITICAL")
+	monitorCmd.Flags().StringVar(&conf.AlertPagerDutyURL, "alert-pagerduty-url", "https://events.pagerduty.com/v2/enqueue", "PagerDuty Events API v2 URL")
+	monitorCmd.Flags().StringVar(&conf.AlertPagerDutyRoutingKey, "alert-pagerduty-routing-key", "", "PagerDuty integration routing key")
+	monitorCmd.Flags().StringVar(&conf.AlertPagerDutySeverity, "alert-pagerduty-severity", "ERROR", "Minimum severity sent to PagerDuty INFO|WARN|ERROR|CRITICAL")
+	monitorCmd.Flags().StringVar(&conf.AlertOpsgenieURL, "alert-opsgenie-url", "https://api.opsgenie.com", "Opsgenie API URL")
+	monitorCmd.Flags().StringVar(&conf.AlertOpsgenieAPIKey, "alert-opsgenie-api-key", "", "Opsgenie API integration key")
+	monitorCmd.Flags().StringVar(&conf.AlertOpsgenieSeverity, "alert-opsgenie-severity", "ERROR", "Minimum severity sent to Opsgenie INFO|WARN|ERROR|CRITICAL")
+	monitorCmd.Flags().StringVar(&conf.AlertTeamsURL, "alert-teams-url", "", "Microsoft Teams incoming webhook URL")
+	monitorCmd.Flags().StringVar(&conf.AlertTeamsSeverity, "alert-teams-severity", "WARN", "Minimum severity sent to Microsoft Teams INFO|WARN|ERROR|CRITICAL")
+	monitorCmd.Flags().IntVar(&conf.AlertRetry, "alert-retry", 3, "Number of retries of a failed alert")
+	monitorCmd.Flags().IntVar(&conf.AlertRetryBackoff, "alert-retry-backoff", 2, "Seconds before the first retry of a failed alert, doubled at each retry")
+	monitorCmd.Flags().StringVar(&conf.AlertRoutes, "alert-routes", "", "Alert routing rules separated by semicolons, each a comma list of sink=webhook|pagerduty|opsgenie|teams|script,cluster=name,key=ERR000*,severity=ERROR,tag=name")
+	monitorCmd.Flags().IntVar(&conf.AlertDedupWindow, "alert-dedup-window", 300, "Seconds during which the same alert is not sent again")
 	monitorCmd.Flags().StringVar(&conf.SlackURL, "alert-slack-url", "", "Slack webhook URL to alert")
 	monitorCmd.Flags().StringVar(&conf.SlackChannel, "alert-slack-channel", "#support", "Slack channel to alert")
 	monitorCmd.Flags().StringVar(&conf.SlackUser, "alert-slack-user", "", "Slack user for alert")
@@ -271,6 +295,33 @@ func init() {
 	monitorCmd.Flags().StringVar(&conf.APIUsersExternal, "api-credentials-external", "dba:repman,foo:bar", "Rest API user list user:password,..")
 	monitorCmd.Flags().StringVar(&conf.APIUsersACLAllow, "api-credentials-acl-allow", "admin:cluster proxy db prov,dba:cluster proxy db,foo:", "User acl allow")
 	monitorCmd.Flags().StringVar(&conf.APIUsersACLDiscard, "api-credentials-acl-discard", "", "User acl discard")
+	monitorCmd.Flags().StringVar(&conf.APIOIDCIssuer, "api-oidc-issuer", "", "OpenID Connect issuer URL, enables the OIDC login and the validation of the issuer bearer tokens")
+	monitorCmd.Flags().StringVar(&conf.APIOIDCClientId, "api-oidc-client-id", "", "OpenID Connect client id")
+	monitorCmd.Flags().StringVar(&conf.APIOIDCClientSecret, "api-oidc-client-secret", "", "OpenID Connect client secret")
+	monitorCmd.Flags().StringVar(&conf.APIOIDCRedirectURL, "api-oidc-redirect-url", "", "OpenID Connect redirect URL, https://<api-host>:<api-port>/api/auth/oidc/callback")
+	monitorCmd.Flags().StringVar(&conf.APIOIDCJwksURL, "api-oidc-jwks-url", "", "OpenID Connect JWKS URL, discovered from the issuer when empty")
+	monitorCmd.Flags().StringVar(&conf.APIOIDCAudience, "api-oidc-audience", "", "Audience of the bearer tokens, the client id when empty")
+	monitorCmd.Flags().StringVar(&conf.APIOIDCScopes, "api-oidc-scopes", "openid profile email", "OpenID Connect scopes requested at login")
+	monitorCmd.Flags().StringVar(&conf.APIOIDCUserClaim, "api-oidc-user-claim", "preferred_username", "Token claim holding the user name, sub when missing")
+	monitorCmd.Flags().StringVar(&conf.APIOIDCGroupsClaim, "api-oidc-groups-claim", "groups", "Token claim holding the user groups")
+	monitorCmd.Flags().StringVar(&conf.APIOIDCGroupsACL, "api-oidc-groups-acl", "", "Group acl allow group:acl acl,..")
+	monitorCmd.Flags().StringVar(&conf.APILdapURL, "api-ldap-url", "", "LDAP URL ldap://host:389 or ldaps://host:636 authenticating the users missing from api-credentials")
+	monitorCmd.Flags().BoolVar(&conf.APILdapStartTLS, "api-ldap-starttls", false, "Upgrade the ldap:// connections with StartTLS")
+	monitorCmd.Flags().BoolVar(&conf.APILdapTLSSkipVerify, "api-ldap-tls-skip-verify", false, "Skip the verification of the LDAP server certificate")
+	monitorCmd.Flags().StringVar(&conf.APILdapTLSCA, "api-ldap-tls-ca", "", "CA file verifying the LDAP server certificate")
+	monitorCmd.Flags().StringVar(&conf.APILdapBindDN, "api-ldap-bind-dn", "", "LDAP account searching the users, anonymous search when empty")
+	monitorCmd.Flags().StringVar(&conf.APILdapBindPassword, "api-ldap-bind-password", "", "LDAP account password")
+	monitorCmd.Flags().StringVar(&conf.APILdapUserBase, "api-ldap-user-base", "", "LDAP search base of the users")
+	monitorCmd.Flags().StringVar(&conf.APILdapUserFilter, "api-ldap-user-filter", "(uid=%s)", "LDAP filter of the users, %s is the user name, (sAMAccountName=%s) for AD")
+	monitorCmd.Flags().StringVar(&conf.APILdapGroupAttribute, "api-ldap-group-attribute", "memberOf", "User attribute holding the group DNs")
+	monitorCmd.Flags().StringVar(&conf.APILdapGroupBase, "api-ldap-group-base", "", "LDAP search base of the groups, the group attribute of the user is used when empty")
+	monitorCmd.Flags().StringVar(&conf.APILdapGroupFilter, "api-ldap-group-filter", "(member=%s)", "LDAP filter of the groups of a user, %s is the user DN")
+	monitorCmd.Flags().StringVar(&conf.APILdapGroupsACL, "api-ldap-groups-acl", "", "LDAP group acl allow group:acl acl,..")
+	monitorCmd.Flags().IntVar(&conf.APILdapCacheTTL, "api-ldap-cache-ttl", 0, "Seconds the groups of a logged in LDAP user are reused, 0 searches the directory on each request")
+	monitorCmd.Flags().IntVar(&conf.APITokensMaxTTL, "api-tokens-max-ttl", 8760, "Maximum lifetime in hours of the API tokens, 0 allows tokens without expiry")
+	monitorCmd.Flags().BoolVar(&conf.APIAuditLog, "api-audit-log", true, "Record the API actions in the audit log")
+	monitorCmd.Flags().StringVar(&conf.APIAuditFile, "api-audit-file", "", "Audit log file, audit.log of the working directory when empty")
+	monitorCmd.Flags().BoolVar(&conf.APIAuditSyslog, "api-audit-syslog", false, "Send the audit records to the local syslog")
 	monitorCmd.Flags().StringVar(&conf.APIBind, "api-bind", "0.0.0.0", "Rest API bind ip")
 	monitorCmd.Flags().BoolVar(&conf.APIHttpsBind, "api-https-bind", false, "Bind API call to https Web UI will error with http")
 	monitorCmd.Flags().BoolVar(&conf.APISecureConfig, "api-credentials-secure-config", false, "Need JWT token to download config tar.gz")
@@ -335,7 +386,7 @@ func init() {
 		monitorCmd.Flags().BoolVar(&conf.MxsBinlogOn, "maxscale-binlog", false, "Maxscale binlog server topolgy")
 		monitorCmd.Flags().MarkDeprecated("maxscale-monitor", "Deprecate disable maxscale monitoring for 2 nodes cluster")
 		monitorCmd.Flags().BoolVar(&conf.MxsDisableMonitor, "maxscale-disable-monitor", false, "Disable maxscale monitoring and fully drive server state")
-		monitorCmd.Flags().StringVar(&conf.MxsGetInfoMethod, "maxscale-get-info-method", "maxadmin", "How to get infos from Maxscale maxinfo|maxadmin")
+		monitorCmd.Flags().StringVar(&conf.MxsGetInfoMethod, "maxscale-get-info-method", "maxadmin", "How to get infos from Maxscale maxinfo|maxadmin|rest")
 		monitorCmd.Flags().StringVar(&conf.MxsHost, "maxscale-servers", "", "MaxScale hosts ")
 		monitorCmd.Flags().StringVar(&conf.MxsPort, "maxscale-port", "6603", "MaxScale admin port")
 		monitorCmd.Flags().StringVar(&conf.MxsUser, "maxscale-user", "admin", "MaxScale admin user")
@@ -347,6 +398,11 @@ func init() {
 		monitorCmd.Flags().IntVar(&conf.MxsBinlogPort, "maxscale-binlog-port", 3309, "MaxScale maxinfo plugin http port")
 		monitorCmd.Flags().BoolVar(&conf.MxsServerMatchPort, "maxscale-server-match-port", false, "Match servers running on same host with different port")
 		monitorCmd.Flags().StringVar(&conf.MxsBinaryPath, "maxscale-binary-path", "/usr/sbin/maxscale", "Maxscale binary location")
+		monitorCmd.Flags().IntVar(&conf.MxsRestPort, "maxscale-rest-port", 8989, "MaxScale REST API port used by maxscale-get-info-method rest")
+		monitorCmd.Flags().BoolVar(&conf.MxsRestSsl, "maxscale-rest-ssl", false, "MaxScale REST API over https")
+		monitorCmd.Flags().BoolVar(&conf.MxsRestTLSSkipVerify, "maxscale-rest-tls-skip-verify", false, "Skip the verification of the MaxScale REST API certificate")
+		monitorCmd.Flags().StringVar(&conf.MxsRestTLSCA, "maxscale-rest-tls-ca", "", "CA file verifying the MaxScale REST API certificate")
+		monitorCmd.Flags().BoolVar(&conf.MxsMonitorPassive, "maxscale-monitor-passive", true, "Turn off the automatic failover and rejoin of the MaxScale monitor when the REST API is used")
 	}
 
 	if WithMySQLRouter == "ON" {
@@ -383,11 +439,24 @@ func init() {
 		monitorCmd.Flags().StringVar(&conf.HaproxyBinaryPath, "haproxy-binary-path", "/usr/sbin/haproxy", "HaProxy binary location")
 		monitorCmd.Flags().StringVar(&conf.HaproxyReadBindIp, "haproxy-ip-read-bind", "0.0.0.0", "HaProxy input bind address for read")
 		monitorCmd.Flags().StringVar(&conf.HaproxyWriteBindIp, "haproxy-ip-write-bind", "0.0.0.0", "HaProxy input bind address for write")
+		monitorCmd.Flags().IntVar(&conf.HaproxyServerSlots, "haproxy-server-slots", 16, "HaProxy read server slots managed with the runtime API without reload, 0 to declare the servers in the config")
 	}
 	monitorCmd.Flags().BoolVar(&conf.MyproxyOn, "myproxy", false, "Use Internal Proxy")
 	monitorCmd.Flags().IntVar(&conf.MyproxyPort, "myproxy-port", 4000, "Internal proxy read/write port")
 	monitorCmd.Flags().StringVar(&conf.MyproxyUser, "myproxy-user", "admin", "Myproxy user")
 	monitorCmd.Flags().StringVar(&conf.MyproxyPassword, "myproxy-password", "repman", "Myproxy password")
+	monitorCmd.Flags().BoolVar(&conf.MyproxyReadWriteSplit, "myproxy-read-write-split", false, "Route the SELECT outside transactions to the slaves")
+	monitorCmd.Flags().Int64Var(&conf.MyproxyReadMaxLag, "myproxy-read-max-lag", 30, "Remove from the readers the slaves delayed by more than this number of seconds")
+	monitorCmd.Flags().BoolVar(&conf.MyproxySwitchoverPause, "myproxy-switchover-pause", true, "Hold the new queries during a switchover and release them to the new master")
+	monitorCmd.Flags().Int64Var(&conf.MyproxySwitchoverMaxPause, "myproxy-switchover-max-pause", 10, "Release the queries held by a switchover after this number of seconds")
+	monitorCmd.Flags().IntVar(&conf.MyproxySwitchoverMaxQueue, "myproxy-switchover-max-queue", 1000, "Maximum number of queries held during a switchover, the queries over the limit get an error")
+	monitorCmd.Flags().BoolVar(&conf.MyproxyDigestStats, "myproxy-digest-stats", true, "Record the count, latency, rows sent and errors of the queries per digest")
+	monitorCmd.Flags().IntVar(&conf.MyproxyDigestMax, "myproxy-digest-max", 1000, "Maximum number of digests recorded, the queries of the next digests are counted in the digest other")
+	monitorCmd.Flags().BoolVar(&conf.EnvoyOn, "envoy", false, "Serve the cluster routing over xDS to the Envoy nodes having the cluster name as node id or node cluster")
+	monitorCmd.Flags().IntVar(&conf.EnvoyXdsPort, "envoy-xds-port", 18000, "Envoy xDS control plane gRPC port, the control plane is shared by the clusters")
+	monitorCmd.Flags().IntVar(&conf.EnvoyWritePort, "envoy-write-port", 3306, "Envoy writer listener port")
+	monitorCmd.Flags().IntVar(&conf.EnvoyReadPort, "envoy-read-port", 3307, "Envoy reader listener port")
+	monitorCmd.Flags().Int64Var(&conf.EnvoyReadMaxLag, "envoy-read-max-lag", 30, "Remove from the reader endpoints the slaves delayed by more than this number of seconds")
 
 	if WithProxysql == "ON" {
 		monitorCmd.Flags().BoolVar(&conf.ProxysqlOn, "proxysql", false, "Use ProxySQL")
@@ -466,6 +535,12 @@ func init() {
 	monitorCmd.Flags().StringVar(&conf.SchedulerRollingReprovCron, "scheduler-rolling-reprov-cron", "0 30 10 * * 5", "Rolling reprov cron expression represents a set of times, using 6 space-separated fields.")
 	monitorCmd.Flags().BoolVar(&conf.SchedulerJobsSSH, "scheduler-jobs-ssh", false, "Schedule remote execution of dbjobs via ssh ")
 	monitorCmd.Flags().StringVar(&conf.SchedulerJobsSSHCron, "scheduler-jobs-ssh-cron", "0 * * * * *", "Remote execution of dbjobs via ssh ")
+	monitorCmd.Flags().BoolVar(&conf.SchedulerBackupVerify, "scheduler-db-servers-backup-verify", false, "Schedule restore of the latest logical backup into a scratch localhost instance and checksum its tables")
+	monitorCmd.Flags().StringVar(&conf.BackupVerifyCron, "scheduler-db-servers-backup-verify-cron", "0 0 5 * * 0", "Backup verification cron expression represents a set of times, using 6 space-separated fields.")
+	monitorCmd.Flags().StringVar(&conf.BackupVerifyPort, "backup-verify-port", "3399", "Port of the scratch localhost instance used to verify backups")
+	monitorCmd.Flags().IntVar(&conf.BackupVerifyTimeout, "backup-verify-timeout", 600, "Timeout in seconds to provision and unprovision the scratch localhost instance used to verify backups")
+	monitorCmd.Flags().BoolVar(&conf.BackupChecksumTables, "backup-checksum-tables", false, "Stop the slave SQL thread during the logical backup of a slave to record the table checksums compared by the backup verification")
+	monitorCmd.Flags().IntVar(&conf.BackupCatalogKeep, "backup-catalog-keep", 100, "Number of backups kept in the backup catalog")
 
 	monitorCmd.Flags().BoolVar(&conf.Backup, "backup", false, "Turn on Backup")
 	monitorCmd.Flags().IntVar(&conf.BackupLogicalLoadThreads, "backup-logical-load-threads", 2, "Number of threads to load database")
@@ -487,6 +562,21 @@ func init() {
 	monitorCmd.Flags().StringVar(&conf.BackupStreamingEndpoint, "backup-streaming-endpoint", "https://s3.signal18.io/", "Backup AWS endpoint")
 	monitorCmd.Flags().StringVar(&conf.BackupStreamingRegion, "backup-streaming-region", "fr-1", "Backup AWS region")
 	monitorCmd.Flags().StringVar(&conf.BackupStreamingBucket, "backup-streaming-bucket", "repman", "Backup AWS bucket")
+	monitorCmd.Flags().BoolVar(&conf.BackupS3, "backup-s3", false, "Stream backups to an S3 compatible object storage instead of the local backup directory")
+	monitorCmd.Flags().StringVar(&conf.BackupS3Endpoint, "backup-s3-endpoint", "", "Backup S3 endpoint, empty for AWS")
+	monitorCmd.Flags().StringVar(&conf.BackupS3Region, "backup-s3-region", "us-east-1", "Backup S3 region")
+	monitorCmd.Flags().StringVar(&conf.BackupS3Bucket, "backup-s3-bucket", "repman", "Backup S3 bucket")
+	monitorCmd.Flags().StringVar(&conf.BackupS3Prefix, "backup-s3-prefix", "", "Backup S3 key prefix, backups are stored under prefix/cluster/server/tool/id/")
+	monitorCmd.Flags().StringVar(&conf.BackupS3AwsAccessKeyId, "backup-s3-aws-access-key-id", "", "Backup S3 access key id")
+	monitorCmd.Flags().StringVar(&conf.BackupS3AwsAccessSecret, "backup-s3-aws-access-secret", "", "Backup S3 access secret")
+	monitorCmd.Flags().BoolVar(&conf.BackupS3PathStyle, "backup-s3-path-style", true, "Backup S3 path style addressing, needed by MinIO and most S3 compatible storage")
+	monitorCmd.Flags().StringVar(&conf.BackupS3SSE, "backup-s3-sse", "", "Backup S3 server side encryption AES256|aws:kms")
+	monitorCmd.Flags().StringVar(&conf.BackupS3SSEKmsKeyId, "backup-s3-sse-kms-key-id", "", "Backup S3 KMS key id for aws:kms server side encryption")
+	monitorCmd.Flags().IntVar(&conf.BackupS3PartSize, "backup-s3-part-size", 16, "Backup S3 multipart upload part size in MB, minimum 5")
+	monitorCmd.Flags().IntVar(&conf.BackupS3Concurrency, "backup-s3-concurrency", 4, "Backup S3 number of parts uploaded in parallel")
+	monitorCmd.Flags().StringVar(&conf.BackupCompression, "backup-compression", "", "Compression of mysqldump, physical backups and archived binlogs gzip|zstd|none, empty keeps gzip for mysqldump only")
+	monitorCmd.Flags().StringVar(&conf.BackupEncryption, "backup-encryption", "none", "Encryption of backups and archived binlogs none|aes-gcm, the key is derived from the monitoring key file")
+	monitorCmd.Flags().StringVar(&conf.BackupZstdPath, "backup-zstd-path", "/usr/bin/zstd", "Path to zstd binary")
 
 	//monitorCmd.Flags().StringVar(&conf.BackupResticStoragePolicy, "backup-restic-storage-policy", "--prune --keep-last 10 --keep-hourly 24 --keep-daily 7 --keep-weekly 52 --keep-monthly 120 --keep-yearly 102", "Restic keep backup policy")
 	monitorCmd.Flags().IntVar(&conf.BackupKeepHourly, "backup-keep-hourly", 1, "Keep this number of hourly backup")
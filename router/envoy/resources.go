@@ -0,0 +1,130 @@
+package envoy
+
+import "time"
+
+// Type URLs of the resources served by the control plane
+const (
+	TypeCluster  = "type.googleapis.com/envoy.config.cluster.v3.Cluster"
+	TypeEndpoint = "type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment"
+	TypeListener = "type.googleapis.com/envoy.config.listener.v3.Listener"
+	typeTcpProxy = "type.googleapis.com/envoy.extensions.filters.network.tcp_proxy.v3.TcpProxy"
+)
+
+const (
+	clusterTypeEds    = 3
+	apiVersionV3      = 2
+	healthHealthy     = 1
+	healthDraining    = 3
+	tcpProxyFilter    = "envoy.filters.network.tcp_proxy"
+	defConnectTimeout = 5 * time.Second
+)
+
+// Endpoint is a database server of a cluster, a draining endpoint gets no new connection
+type Endpoint struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Draining bool   `json:"draining"`
+}
+
+// Cluster is an Envoy cluster with its endpoints discovered by EDS
+type Cluster struct {
+	Name      string     `json:"name"`
+	Endpoints []Endpoint `json:"endpoints"`
+}
+
+// Listener is a TCP listener forwarding the connections to a cluster
+type Listener struct {
+	Name    string `json:"name"`
+	Host    string `json:"host"`
+	Port    int    `json:"port"`
+	Cluster string `json:"cluster"`
+}
+
+// Snapshot is the routing served to the Envoy nodes
+type Snapshot struct {
+	Clusters  []Cluster  `json:"clusters"`
+	Listeners []Listener `json:"listeners"`
+}
+
+func (snap Snapshot) copy() Snapshot {
+	c := Snapshot{Listeners: append([]Listener(nil), snap.Listeners...)}
+	for _, cl := range snap.Clusters {
+		c.Clusters = append(c.Clusters, Cluster{Name: cl.Name, Endpoints: append([]Endpoint(nil), cl.Endpoints...)})
+	}
+	return c
+}
+
+func socketAddress(host string, port int) message {
+	return message(nil).message(1, message(nil).string(2, host).varint(3, uint64(port)))
+}
+
+// encodeCluster returns an envoy.config.cluster.v3.Cluster with its endpoints discovered over ADS
+func encodeCluster(c Cluster, timeout time.Duration) message {
+	ads := message(nil).message(3, nil).varint(6, apiVersionV3)
+	eds := message(nil).message(1, ads).string(2, c.Name)
+	duration := message(nil).varint(1, uint64(timeout/time.Second)).varint(2, uint64(timeout%time.Second))
+	return message(nil).string(1, c.Name).varint(2, clusterTypeEds).message(3, eds).message(4, duration)
+}
+
+// encodeLoadAssignment returns the envoy.config.endpoint.v3.ClusterLoadAssignment of a cluster
+func encodeLoadAssignment(c Cluster) message {
+	var locality message
+	for _, e := range c.Endpoints {
+		health := uint64(healthHealthy)
+		if e.Draining {
+			health = healthDraining
+		}
+		endpoint := message(nil).message(1, socketAddress(e.Host, e.Port))
+		locality = locality.message(2, message(nil).message(1, endpoint).varint(2, health))
+	}
+	m := message(nil).string(1, c.Name)
+	if len(c.Endpoints) > 0 {
+		m = m.message(2, locality)
+	}
+	return m
+}
+
+// encodeListener returns an envoy.config.listener.v3.Listener with a tcp_proxy filter
+func encodeListener(l Listener) message {
+	tcpProxy := message(nil).string(1, l.Name).string(2, l.Cluster)
+	filter := message(nil).string(1, tcpProxyFilter).any(4, typeTcpProxy, tcpProxy)
+	chain := message(nil).message(3, filter)
+	return message(nil).string(1, l.Name).message(2, socketAddress(l.Host, l.Port)).message(3, chain)
+}
+
+// resources returns the resources of a type, the resources are filtered by name when names are given
+func (snap Snapshot) resources(typeUrl string, names []string, timeout time.Duration) []message {
+	wanted := func(name string) bool {
+		if len(names) == 0 {
+			return true
+		}
+		for _, n := range names {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	}
+	var res []message
+	switch typeUrl {
+	case TypeCluster:
+		for _, c := range snap.Clusters {
+			if wanted(c.Name) {
+				res = append(res, encodeCluster(c, timeout))
+			}
+		}
+	case TypeEndpoint:
+		for _, c := range snap.Clusters {
+			if wanted(c.Name) {
+				res = append(res, encodeLoadAssignment(c))
+			}
+		}
+	case TypeListener:
+		for _, l := range snap.Listeners {
+			if wanted(l.Name) {
+				res = append(res, encodeListener(l))
+			}
+		}
+	}
+	return res
+}
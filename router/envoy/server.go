@@ -0,0 +1,411 @@
+package envoy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// AdsMethod is the gRPC method of the aggregated discovery service called by the Envoy nodes
+const AdsMethod = "/envoy.service.discovery.v3.AggregatedDiscoveryService/StreamAggregatedResources"
+
+// MaxMessageSize is the largest gRPC message accepted from a node
+const MaxMessageSize = 4 << 20
+
+const (
+	grpcOk            = "0"
+	grpcInternal      = "13"
+	grpcUnimplemented = "12"
+)
+
+// Node is an Envoy node connected to the control plane
+type Node struct {
+	Id        string    `json:"id"`
+	Cluster   string    `json:"cluster"`
+	Address   string    `json:"address"`
+	Connected time.Time `json:"connected"`
+	// Version is the last version acknowledged by the node for each resource type
+	Version map[string]string `json:"version"`
+	// Error is the last configuration rejected by the node
+	Error string `json:"error"`
+}
+
+// Server is a minimal xDS control plane streaming the clusters, endpoints and listeners of
+// snapshots over ADS, a node is served the snapshot stored under its node id, or else the one
+// stored under its node cluster, a new snapshot is pushed to the connected nodes it serves
+type Server struct {
+	Addr           string
+	ConnectTimeout time.Duration
+	listener       net.Listener
+	srv            *http.Server
+	mutex          sync.Mutex
+	snapshots      map[string]versionedSnapshot
+	// version is shared by the snapshots so a node changing of snapshot always gets a new version
+	version uint64
+	changed chan struct{}
+	nodes   map[*Node]bool
+}
+
+type versionedSnapshot struct {
+	snapshot Snapshot
+	version  uint64
+}
+
+// NewServer returns a control plane listening on addr once started
+func NewServer(addr string) *Server {
+	return &Server{
+		Addr:           addr,
+		ConnectTimeout: defConnectTimeout,
+		snapshots:      make(map[string]versionedSnapshot),
+		changed:        make(chan struct{}),
+		nodes:          make(map[*Node]bool),
+	}
+}
+
+// Start listens for the Envoy nodes, the gRPC streams are served over cleartext HTTP/2
+func (s *Server) Start() error {
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleGrpc)
+	s.listener = l
+	s.srv = &http.Server{Handler: h2c.NewHandler(mux, &http2.Server{})}
+	go s.srv.Serve(l)
+	return nil
+}
+
+// Close stops the control plane and ends the streams
+func (s *Server) Close() error {
+	if s.srv == nil {
+		return nil
+	}
+	return s.srv.Close()
+}
+
+// GetAddr returns the address the control plane is listening on
+func (s *Server) GetAddr() string {
+	if s.listener == nil {
+		return s.Addr
+	}
+	return s.listener.Addr().String()
+}
+
+// SetSnapshot replaces the routing served to the nodes of a key, a new version is pushed only when
+// the snapshot differs from the current one
+func (s *Server) SetSnapshot(key string, snap Snapshot) bool {
+	snap = snap.copy()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if cur, ok := s.snapshots[key]; ok && reflect.DeepEqual(snap, cur.snapshot) {
+		return false
+	}
+	s.version++
+	s.snapshots[key] = versionedSnapshot{snapshot: snap, version: s.version}
+	close(s.changed)
+	s.changed = make(chan struct{})
+	return true
+}
+
+// DeleteSnapshot removes the routing of a key, its nodes are served an empty snapshot
+func (s *Server) DeleteSnapshot(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.snapshots[key]; !ok {
+		return
+	}
+	delete(s.snapshots, key)
+	s.version++
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// GetSnapshot returns the snapshot of a key and its version
+func (s *Server) GetSnapshot(key string) (Snapshot, string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	cur := s.snapshots[key]
+	return cur.snapshot, strconv.FormatUint(cur.version, 10)
+}
+
+// getNodeKey returns the key of the snapshot served to a node, called with the mutex held
+func (s *Server) getNodeKey(n *Node) string {
+	if _, ok := s.snapshots[n.Id]; ok {
+		return n.Id
+	}
+	return n.Cluster
+}
+
+// getNodeSnapshot returns the snapshot served to a node and its version, called with the mutex held
+func (s *Server) getNodeSnapshot(n *Node) (Snapshot, string) {
+	cur := s.snapshots[s.getNodeKey(n)]
+	return cur.snapshot, strconv.FormatUint(cur.version, 10)
+}
+
+// GetNodes returns the connected nodes served the snapshot of a key
+func (s *Server) GetNodes(key string) []Node {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var nodes []Node
+	for n := range s.nodes {
+		if s.getNodeKey(n) != key {
+			continue
+		}
+		c := *n
+		c.Version = make(map[string]string)
+		for t, v := range n.Version {
+			c.Version[t] = v
+		}
+		nodes = append(nodes, c)
+	}
+	return nodes
+}
+
+type discoveryRequest struct {
+	versionInfo   string
+	nodeId        string
+	nodeCluster   string
+	resourceNames []string
+	typeUrl       string
+	nonce         string
+	errorDetail   string
+}
+
+func decodeRequest(b []byte) (*discoveryRequest, error) {
+	fields, err := decode(b)
+	if err != nil {
+		return nil, err
+	}
+	req := new(discoveryRequest)
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			req.versionInfo = string(f.data)
+		case 2:
+			node, err := decode(f.data)
+			if err != nil {
+				return nil, err
+			}
+			for _, nf := range node {
+				switch nf.num {
+				case 1:
+					req.nodeId = string(nf.data)
+				case 2:
+					req.nodeCluster = string(nf.data)
+				}
+			}
+		case 3:
+			req.resourceNames = append(req.resourceNames, string(f.data))
+		case 4:
+			req.typeUrl = string(f.data)
+		case 5:
+			req.nonce = string(f.data)
+		case 6:
+			status, err := decode(f.data)
+			if err != nil {
+				return nil, err
+			}
+			req.errorDetail = "rejected"
+			for _, sf := range status {
+				if sf.num == 2 {
+					req.errorDetail = string(sf.data)
+				}
+			}
+		}
+	}
+	return req, nil
+}
+
+func encodeResponse(version string, typeUrl string, nonce string, resources []message) message {
+	m := message(nil).string(1, version)
+	for _, r := range resources {
+		m = m.any(2, typeUrl, r)
+	}
+	return m.string(4, typeUrl).string(5, nonce)
+}
+
+// readMessage reads a length prefixed gRPC message, the length is checked before allocating as the
+// nodes are not authenticated
+func readMessage(r io.Reader) ([]byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if hdr[0] != 0 {
+		return nil, errors.New("Compressed gRPC messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(hdr[1:])
+	if size > MaxMessageSize {
+		return nil, fmt.Errorf("gRPC message of %d bytes exceeds the maximum of %d bytes", size, MaxMessageSize)
+	}
+	b := make([]byte, size)
+	_, err := io.ReadFull(r, b)
+	return b, err
+}
+
+func writeMessage(w io.Writer, m []byte) error {
+	var hdr [5]byte
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(m)))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(m)
+	return err
+}
+
+func (s *Server) handleGrpc(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC over HTTP/2 only", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	if r.URL.Path != AdsMethod {
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Grpc-Status", grpcUnimplemented)
+		w.Header().Set("Grpc-Message", "Only the aggregated discovery service is served")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	if err := s.streamAggregatedResources(w, r); err != nil && err != io.EOF {
+		w.Header().Set("Grpc-Status", grpcInternal)
+		w.Header().Set("Grpc-Message", err.Error())
+		return
+	}
+	w.Header().Set("Grpc-Status", grpcOk)
+}
+
+// typeState is the state of a resource type subscribed on a stream
+type typeState struct {
+	names   []string
+	version string
+	nonce   string
+}
+
+// streamAggregatedResources serves the state of the world ADS protocol: each resource type is
+// sent when subscribed, on a new snapshot and when the requested names change, the acks of the
+// current version and the requests with a stale nonce get no response
+func (s *Server) streamAggregatedResources(w http.ResponseWriter, r *http.Request) error {
+	node := &Node{Address: r.RemoteAddr, Connected: time.Now(), Version: make(map[string]string)}
+	s.mutex.Lock()
+	s.nodes[node] = true
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.nodes, node)
+		s.mutex.Unlock()
+	}()
+
+	reqs := make(chan *discoveryRequest)
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			b, err := readMessage(r.Body)
+			if err == nil {
+				var req *discoveryRequest
+				req, err = decodeRequest(b)
+				if err == nil {
+					select {
+					case reqs <- req:
+						continue
+					case <-r.Context().Done():
+						err = r.Context().Err()
+					}
+				}
+			}
+			errc <- err
+			return
+		}
+	}()
+
+	types := make(map[string]*typeState)
+	var order []string
+	nonce := 0
+	send := func(typeUrl string, st *typeState, snap Snapshot, version string) error {
+		nonce++
+		st.version = version
+		st.nonce = strconv.Itoa(nonce)
+		resp := encodeResponse(version, typeUrl, st.nonce, snap.resources(typeUrl, st.names, s.ConnectTimeout))
+		if err := writeMessage(w, resp); err != nil {
+			return err
+		}
+		w.(http.Flusher).Flush()
+		return nil
+	}
+
+	for {
+		s.mutex.Lock()
+		snap, version := s.getNodeSnapshot(node)
+		changed := s.changed
+		s.mutex.Unlock()
+
+		select {
+		case <-r.Context().Done():
+			return r.Context().Err()
+		case err := <-errc:
+			return err
+		case req := <-reqs:
+			s.mutex.Lock()
+			if req.nodeId != "" {
+				node.Id = req.nodeId
+				node.Cluster = req.nodeCluster
+			}
+			if req.errorDetail != "" {
+				node.Error = req.errorDetail
+			} else if req.nonce != "" {
+				node.Version[req.typeUrl] = req.versionInfo
+			}
+			// the node id is only known from the first request
+			snap, version = s.getNodeSnapshot(node)
+			s.mutex.Unlock()
+
+			st, ok := types[req.typeUrl]
+			if !ok {
+				st = new(typeState)
+				types[req.typeUrl] = st
+				order = append(order, req.typeUrl)
+			} else if req.nonce != st.nonce {
+				continue
+			}
+			namesChanged := !reflect.DeepEqual(req.resourceNames, st.names)
+			st.names = req.resourceNames
+			if !ok || namesChanged || (req.errorDetail == "" && st.version != version) {
+				if err := send(req.typeUrl, st, snap, version); err != nil {
+					return err
+				}
+			}
+		case <-changed:
+			s.mutex.Lock()
+			snap, version = s.getNodeSnapshot(node)
+			s.mutex.Unlock()
+			// clusters are pushed before their endpoints and listeners
+			for _, t := range []string{TypeCluster, TypeEndpoint, TypeListener} {
+				if st, ok := types[t]; ok && st.version != version {
+					if err := send(t, st, snap, version); err != nil {
+						return err
+					}
+				}
+			}
+			for _, t := range order {
+				if st := types[t]; st.version != version {
+					if err := send(t, st, snap, version); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package envoy
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+type adsClient struct {
+	t    *testing.T
+	in   *io.PipeWriter
+	resp *http.Response
+}
+
+func newAdsClient(t *testing.T, addr string) *adsClient {
+	tr := &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}
+	pr, pw := io.Pipe()
+	req, _ := http.NewRequest("POST", "http://"+addr+AdsMethod, pr)
+	req.Header.Set("Content-Type", "application/grpc")
+	c := &adsClient{t: t, in: pw}
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		c.resp, err = tr.RoundTrip(req)
+		done <- err
+	}()
+	// the headers are sent with the first message
+	c.request("", "", TypeCluster, nil, "")
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (c *adsClient) request(version string, nonce string, typeUrl string, names []string, errorDetail string) {
+	m := message(nil).string(1, version).message(2, message(nil).string(1, "sidecar-1").string(2, "app"))
+	for _, n := range names {
+		m = m.string(3, n)
+	}
+	m = m.string(4, typeUrl).string(5, nonce)
+	if errorDetail != "" {
+		m = m.message(6, message(nil).varint(1, 3).string(2, errorDetail))
+	}
+	go writeMessage(c.in, m)
+}
+
+type discoveryResponse struct {
+	version   string
+	typeUrl   string
+	nonce     string
+	resources [][]byte
+}
+
+func (c *adsClient) response() discoveryResponse {
+	type result struct {
+		b   []byte
+		err error
+	}
+	rc := make(chan result, 1)
+	go func() {
+		b, err := readMessage(c.resp.Body)
+		rc <- result{b, err}
+	}()
+	var r result
+	select {
+	case r = <-rc:
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("No response from the control plane")
+	}
+	if r.err != nil {
+		c.t.Fatal(r.err)
+	}
+	fields, err := decode(r.b)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	var resp discoveryResponse
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			resp.version = string(f.data)
+		case 2:
+			any, _ := decode(f.data)
+			resp.resources = append(resp.resources, any[1].data)
+		case 4:
+			resp.typeUrl = string(f.data)
+		case 5:
+			resp.nonce = string(f.data)
+		}
+	}
+	return resp
+}
+
+func field(t *testing.T, b []byte, path ...int) wireField {
+	for i, num := range path {
+		fields, err := decode(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, f := range fields {
+			if f.num == num {
+				if i == len(path)-1 {
+					return f
+				}
+				b = f.data
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("Field %v not found", path[:i+1])
+		}
+	}
+	return wireField{}
+}
+
+func TestAggregatedDiscovery(t *testing.T) {
+	s := NewServer("127.0.0.1:0")
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	snap := Snapshot{
+		Clusters: []Cluster{
+			{Name: "c1-write", Endpoints: []Endpoint{{Host: "db1", Port: 3306}}},
+			{Name: "c1-read", Endpoints: []Endpoint{{Host: "db2", Port: 3306}, {Host: "db3", Port: 3306}}},
+		},
+		Listeners: []Listener{{Name: "c1-write", Host: "0.0.0.0", Port: 3306, Cluster: "c1-write"}},
+	}
+	s.SetSnapshot("app", snap)
+	if s.SetSnapshot("app", snap) {
+		t.Fatal("Same snapshot pushed twice")
+	}
+
+	c := newAdsClient(t, s.GetAddr())
+	cds := c.response()
+	if cds.typeUrl != TypeCluster || cds.version != "1" || len(cds.resources) != 2 {
+		t.Fatalf("Unexpected CDS response %s %s %d", cds.typeUrl, cds.version, len(cds.resources))
+	}
+	if name := string(field(t, cds.resources[0], 1).data); name != "c1-write" {
+		t.Fatalf("Unexpected cluster %s", name)
+	}
+	if typ := field(t, cds.resources[0], 2).varint; typ != clusterTypeEds {
+		t.Fatalf("Unexpected cluster type %d", typ)
+	}
+	c.request(cds.version, cds.nonce, TypeCluster, nil, "")
+	c.request("", "", TypeEndpoint, []string{"c1-read"}, "")
+	eds := c.response()
+	if eds.typeUrl != TypeEndpoint || len(eds.resources) != 1 {
+		t.Fatalf("Unexpected EDS response %s %d", eds.typeUrl, len(eds.resources))
+	}
+	if host := string(field(t, eds.resources[0], 2, 2, 1, 1, 1, 2).data); host != "db2" {
+		t.Fatalf("Unexpected endpoint %s", host)
+	}
+	c.request(eds.version, eds.nonce, TypeEndpoint, []string{"c1-read"}, "")
+
+	nodes := s.GetNodes("app")
+	if len(nodes) != 1 || nodes[0].Id != "sidecar-1" {
+		t.Fatalf("Unexpected nodes %v", nodes)
+	}
+	if nodes = s.GetNodes("other"); len(nodes) != 0 {
+		t.Fatalf("Unexpected nodes of another cluster %v", nodes)
+	}
+
+	// another cluster sharing the control plane is not pushed to the node
+	s.SetSnapshot("other", Snapshot{Clusters: []Cluster{{Name: "c2-write"}}})
+	// failover
+	snap.Clusters[0].Endpoints = []Endpoint{{Host: "db2", Port: 3306}}
+	snap.Clusters[1].Endpoints = []Endpoint{{Host: "db3", Port: 3306}}
+	if !s.SetSnapshot("app", snap) {
+		t.Fatal("New snapshot not pushed")
+	}
+	cds = c.response()
+	if cds.typeUrl != TypeCluster || cds.version != "3" {
+		t.Fatalf("Unexpected CDS push %s %s", cds.typeUrl, cds.version)
+	}
+	eds = c.response()
+	if eds.typeUrl != TypeEndpoint || eds.version != "3" {
+		t.Fatalf("Unexpected EDS push %s %s", eds.typeUrl, eds.version)
+	}
+	if host := string(field(t, eds.resources[0], 2, 2, 1, 1, 1, 2).data); host != "db3" {
+		t.Fatalf("Unexpected endpoint after failover %s", host)
+	}
+	c.request(eds.version, eds.nonce, TypeEndpoint, []string{"c1-read"}, "bad config")
+	time.Sleep(100 * time.Millisecond)
+	if nodes = s.GetNodes("app"); nodes[0].Error != "bad config" {
+		t.Fatalf("NACK not recorded %v", nodes)
+	}
+	c.in.Close()
+}
+
+func TestReadMessageMaxSize(t *testing.T) {
+	var b bytes.Buffer
+	b.Write([]byte{0, 0xff, 0xff, 0xff, 0xff})
+	if _, err := readMessage(&b); err == nil {
+		t.Fatal("Expected a message over the maximum size to be rejected")
+	}
+	b.Reset()
+	writeMessage(&b, []byte("ok"))
+	if m, err := readMessage(&b); err != nil || string(m) != "ok" {
+		t.Fatalf("Unexpected message %q %v", m, err)
+	}
+}
@@ -0,0 +1,107 @@
+package envoy
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// The xDS messages are encoded by hand in the protocol buffers wire format, only the fields
+// used by a TCP routing control plane are supported
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+type message []byte
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+func (m message) tag(field int, wire int) message {
+	return appendUvarint(m, uint64(field)<<3|uint64(wire))
+}
+
+func (m message) varint(field int, v uint64) message {
+	if v == 0 {
+		return m
+	}
+	return appendUvarint(m.tag(field, wireVarint), v)
+}
+
+func (m message) bytes(field int, b []byte) message {
+	m = appendUvarint(m.tag(field, wireBytes), uint64(len(b)))
+	return append(m, b...)
+}
+
+func (m message) string(field int, s string) message {
+	if s == "" {
+		return m
+	}
+	return m.bytes(field, []byte(s))
+}
+
+// message encodes an embedded message, an empty message is kept as it can be meaningful
+func (m message) message(field int, sub message) message {
+	return m.bytes(field, sub)
+}
+
+// any encodes a google.protobuf.Any
+func (m message) any(field int, typeUrl string, value message) message {
+	return m.message(field, message(nil).string(1, typeUrl).bytes(2, value))
+}
+
+type wireField struct {
+	num    int
+	varint uint64
+	data   []byte
+}
+
+// decode splits a message in its fields, fixed size fields are skipped
+func decode(b []byte) ([]wireField, error) {
+	var fields []wireField
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("Malformed field key")
+		}
+		b = b[n:]
+		f := wireField{num: int(key >> 3)}
+		switch key & 7 {
+		case wireVarint:
+			f.varint, n = binary.Uvarint(b)
+			if n <= 0 {
+				return nil, errors.New("Malformed varint")
+			}
+			b = b[n:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return nil, errors.New("Malformed length")
+			}
+			f.data = b[n : n+int(l)]
+			b = b[n+int(l):]
+		case wireFixed64:
+			if len(b) < 8 {
+				return nil, errors.New("Malformed fixed64")
+			}
+			b = b[8:]
+			continue
+		case wireFixed32:
+			if len(b) < 4 {
+				return nil, errors.New("Malformed fixed32")
+			}
+			b = b[4:]
+			continue
+		default:
+			return nil, errors.New("Unsupported wire type")
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
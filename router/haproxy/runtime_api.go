@@ -104,3 +104,31 @@ func (r *Runtime) SetDrain(name string, pool string) (string, error) {
 	}
 	return string(result), nil
 }
+
+// SetServerAddr changes the address of a server, used to assign a server template slot
+func (r *Runtime) SetServerAddr(name string, pool string, host string, port string) (string, error) {
+	return r.ApiCmd("set server " + pool + "/" + name + " addr " + host + " port " + port)
+}
+
+// EnableServer puts a server out of maintenance
+func (r *Runtime) EnableServer(name string, pool string) (string, error) {
+	return r.ApiCmd("enable server " + pool + "/" + name)
+}
+
+// DisableServer puts a server in maintenance, used to free a server template slot
+func (r *Runtime) DisableServer(name string, pool string) (string, error) {
+	return r.ApiCmd("disable server " + pool + "/" + name)
+}
+
+// SetSlot assigns a server template slot to an address and enables it, an empty host frees the slot
+func (r *Runtime) SetSlot(name string, pool string, host string, port string) error {
+	if host == "" {
+		_, err := r.DisableServer(name, pool)
+		return err
+	}
+	if _, err := r.SetServerAddr(name, pool, host, port); err != nil {
+		return err
+	}
+	_, err := r.EnableServer(name, pool)
+	return err
+}
@@ -0,0 +1,73 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package haproxy
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrNoFreeSlot is returned when a backend has more servers than server template slots, the
+// configuration must be regenerated with more slots
+var ErrNoFreeSlot = errors.New("No free server slot")
+
+// Slot is a server of a server template as reported by show stat, a slot in MAINT is free
+type Slot struct {
+	Name   string
+	Addr   string
+	Status string
+}
+
+// SlotChange assigns an address to a slot, an empty address frees the slot
+type SlotChange struct {
+	Slot string
+	Addr string
+}
+
+// SlotName returns the name of the slot n of a server template
+func SlotName(prefix string, n int) string {
+	return prefix + strconv.Itoa(n)
+}
+
+// PlanSlots returns the changes assigning the wanted addresses to the slots: a slot serving a
+// wanted address keeps it, the slots of the addresses no longer wanted are freed and the new
+// addresses take the free slots in order
+func PlanSlots(slots []Slot, wanted []string) ([]SlotChange, error) {
+	want := make(map[string]bool)
+	for _, addr := range wanted {
+		want[addr] = true
+	}
+	var changes []SlotChange
+	var free []string
+	assigned := make(map[string]bool)
+	for _, s := range slots {
+		if want[s.Addr] && !assigned[s.Addr] {
+			assigned[s.Addr] = true
+			if strings.HasPrefix(s.Status, "MAINT") {
+				changes = append(changes, SlotChange{Slot: s.Name, Addr: s.Addr})
+			}
+			continue
+		}
+		if !strings.HasPrefix(s.Status, "MAINT") {
+			changes = append(changes, SlotChange{Slot: s.Name})
+		}
+		free = append(free, s.Name)
+	}
+	for _, addr := range wanted {
+		if assigned[addr] {
+			continue
+		}
+		if len(free) == 0 {
+			return changes, ErrNoFreeSlot
+		}
+		changes = append(changes, SlotChange{Slot: free[0], Addr: addr})
+		free = free[1:]
+		assigned[addr] = true
+	}
+	return changes, nil
+}
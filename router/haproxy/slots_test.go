@@ -0,0 +1,51 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package haproxy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlanSlots(t *testing.T) {
+	slots := []Slot{
+		{Name: "db1", Addr: "10.0.0.1:3306", Status: "UP"},
+		{Name: "db2", Addr: "10.0.0.2:3306", Status: "UP"},
+		{Name: "db3", Addr: "127.0.0.1:3306", Status: "MAINT"},
+		{Name: "db4", Addr: "127.0.0.1:3306", Status: "MAINT"},
+	}
+
+	// 10.0.0.2 removed, 10.0.0.3 added
+	changes, err := PlanSlots(slots, []string{"10.0.0.1:3306", "10.0.0.3:3306"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []SlotChange{{Slot: "db2"}, {Slot: "db2", Addr: "10.0.0.3:3306"}}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("Unexpected changes %v", changes)
+	}
+
+	// unchanged topology
+	changes, err = PlanSlots(slots, []string{"10.0.0.2:3306", "10.0.0.1:3306"})
+	if err != nil || len(changes) != 0 {
+		t.Fatalf("Unexpected changes %v %v", changes, err)
+	}
+
+	// slots are exhausted
+	_, err = PlanSlots(slots, []string{"10.0.0.1:3306", "10.0.0.2:3306", "10.0.0.3:3306", "10.0.0.4:3306", "10.0.0.5:3306"})
+	if err != ErrNoFreeSlot {
+		t.Fatalf("Expected no free slot, got %v", err)
+	}
+
+	// a slot in maintenance on a wanted address is enabled again
+	slots[0].Status = "MAINT"
+	changes, _ = PlanSlots(slots, []string{"10.0.0.1:3306", "10.0.0.2:3306"})
+	expected = []SlotChange{{Slot: "db1", Addr: "10.0.0.1:3306"}}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("Unexpected changes %v", changes)
+	}
+}
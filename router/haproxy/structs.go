@@ -107,13 +107,27 @@ type Config struct {
 	StatPort      string        `json:"statPort"`
 }
 
+// ServerTemplate declares server slots named Prefix1 to PrefixN, the slots start disabled on the
+// placeholder address and are assigned to servers with the runtime API
+type ServerTemplate struct {
+	Prefix        string `json:"prefix" binding:"required"`
+	Slots         int    `json:"slots" binding:"required"`
+	Host          string `json:"host" binding:"required"`
+	Port          int    `json:"port" binding:"required"`
+	Weight        int    `json:"weight" binding:"required"`
+	MaxConn       int    `json:"maxconn"`
+	Check         bool   `json:"check"`
+	CheckInterval int    `json:"checkInterval"`
+}
+
 // Defines a single haproxy "backend".
 type Backend struct {
-	Name      string          `json:"name" binding:"required"`
-	Mode      string          `json:"mode" binding:"required"`
-	Servers   []*ServerDetail `json:"servers" binding:"required"`
-	Options   ProxyOptions    `json:"options"`
-	ProxyMode bool            `json:"proxyMode" binding:"required"`
+	Name           string          `json:"name" binding:"required"`
+	Mode           string          `json:"mode" binding:"required"`
+	Servers        []*ServerDetail `json:"servers" binding:"required"`
+	ServerTemplate *ServerTemplate `json:"serverTemplate,omitempty"`
+	Options        ProxyOptions    `json:"options"`
+	ProxyMode      bool            `json:"proxyMode" binding:"required"`
 }
 
 // Defines a single haproxy "frontend".
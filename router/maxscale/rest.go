@@ -0,0 +1,280 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+// rest.go
+
+package maxscale
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RestClient talks to the REST API of MaxScale 2.2 and later, maxadmin is removed in MaxScale 6
+type RestClient struct {
+	Host   string
+	Port   string
+	User   string
+	Pass   string
+	Ssl    bool
+	client *http.Client
+}
+
+// RestResource is a JSON API resource of the REST API: a server, a monitor, a service, a listener or a filter
+type RestResource struct {
+	Id            string                      `json:"id"`
+	Type          string                      `json:"type"`
+	Attributes    RestAttributes              `json:"attributes"`
+	Relationships map[string]RestRelationship `json:"relationships,omitempty"`
+}
+
+type RestAttributes struct {
+	State      string                 `json:"state,omitempty"`
+	Module     string                 `json:"module,omitempty"`
+	Router     string                 `json:"router,omitempty"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	Statistics map[string]interface{} `json:"statistics,omitempty"`
+}
+
+type RestRelationship struct {
+	Data []RestResourceId `json:"data"`
+}
+
+type RestResourceId struct {
+	Id   string `json:"id"`
+	Type string `json:"type"`
+}
+
+type restDocument struct {
+	Data json.RawMessage `json:"data"`
+}
+
+type restErrors struct {
+	Errors []struct {
+		Detail string `json:"detail"`
+	} `json:"errors"`
+}
+
+const (
+	RestStateMaster      = "master"
+	RestStateSlave       = "slave"
+	RestStateRunning     = "running"
+	RestStateMaintenance = "maintenance"
+	RestStateDrain       = "drain"
+)
+
+// NewRestClient returns a client of the REST API, the https certificate of MaxScale is verified with the
+// tls config, the system roots are used when it is nil
+func NewRestClient(host string, port string, user string, pass string, ssl bool, tlsConfig *tls.Config) *RestClient {
+	return &RestClient{
+		Host: host,
+		Port: port,
+		User: user,
+		Pass: pass,
+		Ssl:  ssl,
+		client: &http.Client{
+			Timeout:   maxDefaultTimeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}
+}
+
+func (r *RestClient) url(path string) string {
+	scheme := "http"
+	if r.Ssl {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + ":" + r.Port + "/v1" + path
+}
+
+// do sends a request and decodes the data of the response in v, the errors reported by MaxScale are returned
+func (r *RestClient) do(method string, path string, body interface{}, v interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, r.url(path), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(r.User, r.Pass)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		var e restErrors
+		if json.Unmarshal(data, &e) == nil && len(e.Errors) > 0 {
+			return errors.New(e.Errors[0].Detail)
+		}
+		return fmt.Errorf("MaxScale REST API %s %s returned %s", method, path, resp.Status)
+	}
+	if v == nil {
+		return nil
+	}
+	var doc restDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	return json.Unmarshal(doc.Data, v)
+}
+
+func (r *RestClient) list(collection string) ([]RestResource, error) {
+	var res []RestResource
+	err := r.do("GET", "/"+collection, nil, &res)
+	return res, err
+}
+
+// GetServers returns the servers with their state and statistics
+func (r *RestClient) GetServers() ([]RestResource, error) {
+	return r.list("servers")
+}
+
+// GetMonitors returns the monitors with their state and parameters
+func (r *RestClient) GetMonitors() ([]RestResource, error) {
+	return r.list("monitors")
+}
+
+// GetServices returns the services with their router and statistics
+func (r *RestClient) GetServices() ([]RestResource, error) {
+	return r.list("services")
+}
+
+// GetListeners returns the listeners, available as a collection since MaxScale 2.4
+func (r *RestClient) GetListeners() ([]RestResource, error) {
+	return r.list("listeners")
+}
+
+// GetFilters returns the filters with their module and parameters
+func (r *RestClient) GetFilters() ([]RestResource, error) {
+	return r.list("filters")
+}
+
+// SetServerState sets a state of a server, master and slave can only be set when the monitor is stopped
+func (r *RestClient) SetServerState(server string, state string) error {
+	return r.do("PUT", "/servers/"+url.PathEscape(server)+"/set?state="+url.QueryEscape(state), nil, nil)
+}
+
+// ClearServerState clears a state of a server
+func (r *RestClient) ClearServerState(server string, state string) error {
+	return r.do("PUT", "/servers/"+url.PathEscape(server)+"/clear?state="+url.QueryEscape(state), nil, nil)
+}
+
+// StopMonitor stops a monitor, the server states are then driven by the client
+func (r *RestClient) StopMonitor(monitor string) error {
+	return r.do("PUT", "/monitors/"+url.PathEscape(monitor)+"/stop", nil, nil)
+}
+
+// StartMonitor starts a monitor
+func (r *RestClient) StartMonitor(monitor string) error {
+	return r.do("PUT", "/monitors/"+url.PathEscape(monitor)+"/start", nil, nil)
+}
+
+// SetMonitorParameters changes the parameters of a running monitor
+func (r *RestClient) SetMonitorParameters(monitor string, parameters map[string]interface{}) error {
+	body := map[string]interface{}{
+		"data": RestResource{Id: monitor, Type: "monitors", Attributes: RestAttributes{Parameters: parameters}},
+	}
+	return r.do("PATCH", "/monitors/"+url.PathEscape(monitor), body, nil)
+}
+
+// SetMonitorPassive turns off the automatic failover and rejoin of a mariadbmon monitor, the monitor
+// keeps following the replication topology while the failover is driven by the client
+func (r *RestClient) SetMonitorPassive(monitor string, passive bool) error {
+	return r.SetMonitorParameters(monitor, map[string]interface{}{
+		"auto_failover": !passive,
+		"auto_rejoin":   !passive,
+	})
+}
+
+// IsMonitorPassive returns true when the automatic failover and rejoin of a monitor are off
+func IsMonitorPassive(monitor RestResource) bool {
+	return !isTrue(monitor.Attributes.Parameters["auto_failover"]) && !isTrue(monitor.Attributes.Parameters["auto_rejoin"])
+}
+
+// IsRunning returns true when a monitor or a server is running
+func IsRunning(res RestResource) bool {
+	return strings.Contains(res.Attributes.State, "Running")
+}
+
+// FindMonitor returns the first mariadbmon monitor or the first monitor
+func FindMonitor(monitors []RestResource) *RestResource {
+	for i := range monitors {
+		if monitors[i].Attributes.Module == "mariadbmon" || monitors[i].Attributes.Module == "mysqlmon" {
+			return &monitors[i]
+		}
+	}
+	if len(monitors) > 0 {
+		return &monitors[0]
+	}
+	return nil
+}
+
+// FindServer returns the server of an address, the port is matched when matchserverport is set
+func FindServer(servers []RestResource, ip string, port string, matchserverport bool) *RestResource {
+	for i, s := range servers {
+		if ServerAddress(s) != ip {
+			continue
+		}
+		if matchserverport && ServerPort(s) != port {
+			continue
+		}
+		return &servers[i]
+	}
+	return nil
+}
+
+func ServerAddress(s RestResource) string {
+	return parameter(s, "address")
+}
+
+func ServerPort(s RestResource) string {
+	return parameter(s, "port")
+}
+
+// ServerConnections returns the number of connections of a server
+func ServerConnections(s RestResource) string {
+	if v, ok := s.Attributes.Statistics["connections"]; ok {
+		return fmt.Sprint(v)
+	}
+	return "0"
+}
+
+func parameter(res RestResource, name string) string {
+	v, ok := res.Attributes.Parameters[name]
+	if !ok || v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+func isTrue(v interface{}) bool {
+	switch b := v.(type) {
+	case bool:
+		return b
+	case string:
+		return b == "true" || b == "on" || b == "yes" || b == "1"
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package maxscale
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRestClient(t *testing.T) {
+	var calls []string
+	var patch map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != "admin" || p != "mariadb" {
+			w.WriteHeader(401)
+			return
+		}
+		calls = append(calls, r.Method+" "+r.URL.RequestURI())
+		switch r.URL.Path {
+		case "/v1/servers":
+			w.Write([]byte(`{"data":[
+				{"id":"server1","type":"servers","attributes":{"state":"Master, Running","parameters":{"address":"10.0.0.1","port":3306},"statistics":{"connections":4}}},
+				{"id":"server2","type":"servers","attributes":{"state":"Slave, Running","parameters":{"address":"10.0.0.2","port":3306},"statistics":{"connections":2}}}]}`))
+		case "/v1/monitors":
+			w.Write([]byte(`{"data":[{"id":"MariaDB-Monitor","type":"monitors","attributes":{"module":"mariadbmon","state":"Running","parameters":{"auto_failover":true,"auto_rejoin":false}}}]}`))
+		case "/v1/monitors/MariaDB-Monitor":
+			b, _ := ioutil.ReadAll(r.Body)
+			json.Unmarshal(b, &patch)
+			w.WriteHeader(204)
+		case "/v1/servers/server3/set":
+			w.WriteHeader(404)
+			w.Write([]byte(`{"errors":[{"detail":"No server named 'server3' found"}]}`))
+		default:
+			w.WriteHeader(204)
+		}
+	}))
+	defer ts.Close()
+	host, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	r := NewRestClient(host, port, "admin", "mariadb", false, nil)
+
+	servers, err := r.GetServers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := FindServer(servers, "10.0.0.2", "3306", true)
+	if s == nil || s.Id != "server2" || ServerConnections(*s) != "2" || !IsRunning(*s) {
+		t.Fatalf("Unexpected server %v", s)
+	}
+	if FindServer(servers, "10.0.0.2", "3307", true) != nil {
+		t.Fatal("Server found on a wrong port")
+	}
+
+	monitors, err := r.GetMonitors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := FindMonitor(monitors)
+	if m == nil || m.Id != "MariaDB-Monitor" || IsMonitorPassive(*m) {
+		t.Fatalf("Unexpected monitor %v", m)
+	}
+	if err := r.SetMonitorPassive(m.Id, true); err != nil {
+		t.Fatal(err)
+	}
+	params := patch["data"].(map[string]interface{})["attributes"].(map[string]interface{})["parameters"].(map[string]interface{})
+	if params["auto_failover"] != false || params["auto_rejoin"] != false {
+		t.Fatalf("Unexpected monitor parameters %v", params)
+	}
+
+	if err := r.SetServerState("server1", RestStateMaintenance); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.StopMonitor(m.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetServerState("server3", RestStateMaster); err == nil || err.Error() != "No server named 'server3' found" {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expected := []string{"PUT /v1/servers/server1/set?state=maintenance", "PUT /v1/monitors/MariaDB-Monitor/stop"}
+	if calls[3] != expected[0] || calls[4] != expected[1] {
+		t.Fatalf("Unexpected calls %v", calls)
+	}
+}
+
+func TestRestClientTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	defer ts.Close()
+	host, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	if _, err := NewRestClient(host, port, "admin", "mariadb", true, nil).GetServers(); err == nil {
+		t.Fatal("Expected the self signed certificate refused")
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+	if _, err := NewRestClient(host, port, "admin", "mariadb", true, &tls.Config{RootCAs: roots}).GetServers(); err != nil {
+		t.Fatalf("Expected the certificate verified with the CA, got %s", err)
+	}
+	if _, err := NewRestClient(host, port, "admin", "mariadb", true, &tls.Config{InsecureSkipVerify: true}).GetServers(); err != nil {
+		t.Fatalf("Expected the certificate not verified, got %s", err)
+	}
+}
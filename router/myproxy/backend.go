@@ -0,0 +1,188 @@
+package myproxy
+
+import (
+	"database/sql"
+	"errors"
+	"math/rand"
+	"sync/atomic"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// Backend is a database server the proxy routes queries to
+type Backend struct {
+	URL string
+	DSN string
+	// Lag is the replication delay of a reader in seconds
+	Lag     int64
+	Queries uint64
+	db      *sql.DB
+}
+
+// DB returns the connection pool of the backend
+func (b *Backend) DB() *sql.DB {
+	return b.db
+}
+
+func (b *Backend) open() error {
+	var err error
+	b.db, err = sql.Open("mysql", b.DSN)
+	return err
+}
+
+func (b *Backend) close() {
+	if b.db != nil {
+		b.db.Close()
+	}
+}
+
+// OpenConnections returns the number of backend connections in use or idle
+func (b *Backend) OpenConnections() int {
+	if b.db == nil {
+		return 0
+	}
+	return b.db.Stats().OpenConnections
+}
+
+// SetWriter routes the writes to the server, the pool of the previous writer is closed
+func (s *Server) SetWriter(url string, dsn string) error {
+	s.backendsMutex.Lock()
+	defer s.backendsMutex.Unlock()
+	if s.writer != nil && s.writer.URL == url && s.writer.DSN == dsn {
+		return nil
+	}
+	b := &Backend{URL: url, DSN: dsn}
+	if err := b.open(); err != nil {
+		return err
+	}
+	if s.writer != nil {
+		s.writer.close()
+	}
+	s.writer = b
+	return nil
+}
+
+// SetReaders replaces the reader pool, the pools of the readers still present are kept
+func (s *Server) SetReaders(readers []*Backend) error {
+	s.backendsMutex.Lock()
+	defer s.backendsMutex.Unlock()
+	current := make(map[string]*Backend)
+	for _, b := range s.readers {
+		current[b.URL] = b
+	}
+	var err error
+	var pool []*Backend
+	for _, r := range readers {
+		if b, ok := current[r.URL]; ok && b.DSN == r.DSN {
+			b.Lag = r.Lag
+			pool = append(pool, b)
+			delete(current, r.URL)
+			continue
+		}
+		b := &Backend{URL: r.URL, DSN: r.DSN, Lag: r.Lag}
+		if oerr := b.open(); oerr != nil {
+			err = oerr
+			continue
+		}
+		pool = append(pool, b)
+	}
+	for _, b := range current {
+		b.close()
+	}
+	s.readers = pool
+	return err
+}
+
+// SetShard routes the queries of the shard rules to the server, an empty url removes the shard backend
+func (s *Server) SetShard(url string, dsn string) error {
+	s.backendsMutex.Lock()
+	defer s.backendsMutex.Unlock()
+	if s.shard != nil && s.shard.URL == url && s.shard.DSN == dsn {
+		return nil
+	}
+	if s.shard != nil {
+		s.shard.close()
+		s.shard = nil
+	}
+	if url == "" {
+		return nil
+	}
+	b := &Backend{URL: url, DSN: dsn}
+	if err := b.open(); err != nil {
+		return err
+	}
+	s.shard = b
+	return nil
+}
+
+// GetShard returns the backend of the shard rules
+func (s *Server) GetShard() (*Backend, error) {
+	s.backendsMutex.RLock()
+	defer s.backendsMutex.RUnlock()
+	if s.shard == nil {
+		return nil, errors.New("No shard backend")
+	}
+	return s.shard, nil
+}
+
+// GetWriter returns the backend of the writes
+func (s *Server) GetWriter() (*Backend, error) {
+	s.backendsMutex.RLock()
+	defer s.backendsMutex.RUnlock()
+	if s.writer == nil {
+		return nil, errors.New("No writer backend")
+	}
+	return s.writer, nil
+}
+
+// GetReader returns a reader picked with a weight decreasing with its lag, the writer when no reader is available
+func (s *Server) GetReader() (*Backend, error) {
+	s.backendsMutex.RLock()
+	readers := s.readers
+	s.backendsMutex.RUnlock()
+	if len(readers) == 0 {
+		return s.GetWriter()
+	}
+	weights := make([]float64, len(readers))
+	total := 0.0
+	for i, b := range readers {
+		weights[i] = 1 / float64(1+b.Lag)
+		total += weights[i]
+	}
+	pick := rand.Float64() * total
+	for i, w := range weights {
+		if pick < w {
+			return readers[i], nil
+		}
+		pick -= w
+	}
+	return readers[len(readers)-1], nil
+}
+
+// GetBackends returns the writer and the readers
+func (s *Server) GetBackends() (*Backend, []*Backend) {
+	s.backendsMutex.RLock()
+	defer s.backendsMutex.RUnlock()
+	return s.writer, s.readers
+}
+
+func (b *Backend) countQuery() {
+	atomic.AddUint64(&b.Queries, 1)
+}
+
+func (s *Server) closeBackends() {
+	s.backendsMutex.Lock()
+	defer s.backendsMutex.Unlock()
+	if s.writer != nil {
+		s.writer.close()
+		s.writer = nil
+	}
+	for _, b := range s.readers {
+		b.close()
+	}
+	s.readers = nil
+	if s.shard != nil {
+		s.shard.close()
+		s.shard = nil
+	}
+}
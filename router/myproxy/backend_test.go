@@ -0,0 +1,28 @@
+package myproxy
+
+import "testing"
+
+func TestGetReader(t *testing.T) {
+	s, _ := NewProxyServer("127.0.0.1:0", "admin", "repman")
+	defer s.Close()
+	if _, err := s.GetReader(); err == nil {
+		t.Fatal("Expected no backend error")
+	}
+	s.SetWriter("db1:3306", "root@tcp(db1:3306)/")
+	if b, _ := s.GetReader(); b == nil || b.URL != "db1:3306" {
+		t.Fatal("Expected reads on the writer without readers")
+	}
+	s.SetReaders([]*Backend{{URL: "db2:3306", DSN: "root@tcp(db2:3306)/"}, {URL: "db3:3306", DSN: "root@tcp(db3:3306)/", Lag: 99}})
+	picks := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		b, _ := s.GetReader()
+		picks[b.URL]++
+	}
+	if picks["db1:3306"] > 0 || picks["db2:3306"] < 9000 || picks["db3:3306"] == 0 {
+		t.Fatalf("Expected reads weighted by lag, got %v", picks)
+	}
+	s.SetReaders([]*Backend{{URL: "db3:3306", DSN: "root@tcp(db3:3306)/", Lag: 5}})
+	if _, readers := s.GetBackends(); len(readers) != 1 || readers[0].Lag != 5 {
+		t.Fatal("Expected reader lag to be updated")
+	}
+}
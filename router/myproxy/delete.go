@@ -1,23 +1,28 @@
 package myproxy
 
 import (
+	"context"
+
 	_ "github.com/go-sql-driver/mysql"
 	siddonmysql "github.com/siddontang/go-mysql/mysql"
-	"github.com/xwb1989/sqlparser"
 )
 
-func (h MysqlHandler) handleDelete(delete *sqlparser.Delete) (*siddonmysql.Result, error) {
-	result, err := h.deleteDB(sqlparser.String(delete))
+func (h *MysqlHandler) handleDelete(delete string) (*siddonmysql.Result, error) {
+	sc, err := h.getWriterConn()
+	if err != nil {
+		return nil, err
+	}
+	result, err := h.deleteDB(sc, delete)
 	if err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
-// updateDB is responsable for doing delete Mysql
-func (h MysqlHandler) deleteDB(delete string) (*siddonmysql.Result, error) {
+// deleteDB is responsable for doing delete Mysql
+func (h *MysqlHandler) deleteDB(sc *sessionConn, delete string) (*siddonmysql.Result, error) {
 	// 1. Exec mysql delete
-	dbresult, err := h.db.Exec(delete)
+	dbresult, err := sc.conn.ExecContext(context.Background(), delete)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,156 @@
+package myproxy
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	. "github.com/siddontang/go-mysql/mysql"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+)
+
+// DigestLatencyBuckets are the upper bounds of the latency histogram of the digests, the last
+// count of the histogram is for the queries over the last bound
+var DigestLatencyBuckets = []time.Duration{time.Millisecond, 10 * time.Millisecond, 100 * time.Millisecond, time.Second, 10 * time.Second}
+
+// DigestOther is the digest of the queries recorded when the maximum number of digests is reached
+const DigestOther = "other"
+
+// DigestStats are the statistics of the queries of a user on a schema with the same digest,
+// times are in microseconds as in ProxySQL stats_mysql_query_digest
+type DigestStats struct {
+	Digest      string   `json:"digest"`
+	SchemaName  string   `json:"schemaName"`
+	UserName    string   `json:"userName"`
+	QueryDigest string   `json:"queryDigest"`
+	CountStar   uint64   `json:"countStar"`
+	FirstSeen   int64    `json:"firstSeen"`
+	LastSeen    int64    `json:"lastSeen"`
+	SumTime     uint64   `json:"sumTime"`
+	MinTime     uint64   `json:"minTime"`
+	MaxTime     uint64   `json:"maxTime"`
+	RowsSent    uint64   `json:"rowsSent"`
+	Errors      uint64   `json:"errors"`
+	Histogram   []uint64 `json:"histogram"`
+}
+
+// QueryDigestHash returns the digest of a query digest text, a 64 bit hash in hexadecimal as the digest
+// of ProxySQL, shared by the query rules and the digest statistics
+func QueryDigestHash(text string) string {
+	h := fnv.New64a()
+	h.Write([]byte(text))
+	return fmt.Sprintf("0x%016X", h.Sum64())
+}
+
+type digestKey struct {
+	user   string
+	schema string
+	digest string
+}
+
+type digestStore struct {
+	mutex   sync.Mutex
+	on      bool
+	max     int
+	digests map[digestKey]*DigestStats
+}
+
+// SetDigestStats turns the digest statistics on or off, at most max digests are recorded, the
+// queries of the next digests are counted in the digest other
+func (s *Server) SetDigestStats(on bool, max int) {
+	s.digests.mutex.Lock()
+	defer s.digests.mutex.Unlock()
+	s.digests.on = on
+	s.digests.max = max
+	if !on {
+		s.digests.digests = nil
+	}
+}
+
+// GetDigestStats returns the statistics of the digests ordered by total time
+func (s *Server) GetDigestStats() []DigestStats {
+	s.digests.mutex.Lock()
+	defer s.digests.mutex.Unlock()
+	stats := make([]DigestStats, 0, len(s.digests.digests))
+	for _, d := range s.digests.digests {
+		c := *d
+		c.Histogram = append([]uint64(nil), d.Histogram...)
+		stats = append(stats, c)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].SumTime > stats[j].SumTime })
+	return stats
+}
+
+// ResetDigestStats clears the statistics of the digests
+func (s *Server) ResetDigestStats() {
+	s.digests.mutex.Lock()
+	defer s.digests.mutex.Unlock()
+	s.digests.digests = nil
+}
+
+func (s *Server) isDigestStatsOn() bool {
+	s.digests.mutex.Lock()
+	defer s.digests.mutex.Unlock()
+	return s.digests.on
+}
+
+// recordDigest counts a query in the statistics of its digest
+func (s *Server) recordDigest(user string, schema string, query string, start time.Time, result *Result, err error) {
+	if !s.isDigestStatsOn() {
+		return
+	}
+	elapsed := time.Since(start)
+	text := dbhelper.GetQueryDigest(query)
+	key := digestKey{user: user, schema: schema, digest: text}
+
+	s.digests.mutex.Lock()
+	defer s.digests.mutex.Unlock()
+	if s.digests.digests == nil {
+		s.digests.digests = make(map[digestKey]*DigestStats)
+	}
+	d, ok := s.digests.digests[key]
+	if !ok {
+		if s.digests.max > 0 && len(s.digests.digests) >= s.digests.max {
+			key = digestKey{digest: DigestOther}
+			d, ok = s.digests.digests[key]
+			text = DigestOther
+		}
+		if !ok {
+			d = &DigestStats{
+				Digest:      QueryDigestHash(text),
+				SchemaName:  key.schema,
+				UserName:    key.user,
+				QueryDigest: text,
+				FirstSeen:   start.Unix(),
+				MinTime:     ^uint64(0),
+				Histogram:   make([]uint64, len(DigestLatencyBuckets)+1),
+			}
+			s.digests.digests[key] = d
+		}
+	}
+	us := uint64(elapsed / time.Microsecond)
+	d.CountStar++
+	d.LastSeen = start.Unix()
+	d.SumTime += us
+	if us < d.MinTime {
+		d.MinTime = us
+	}
+	if us > d.MaxTime {
+		d.MaxTime = us
+	}
+	bucket := len(DigestLatencyBuckets)
+	for i, b := range DigestLatencyBuckets {
+		if elapsed < b {
+			bucket = i
+			break
+		}
+	}
+	d.Histogram[bucket]++
+	if err != nil {
+		d.Errors++
+	} else if result != nil && result.Resultset != nil {
+		d.RowsSent += uint64(len(result.RowDatas))
+	}
+}
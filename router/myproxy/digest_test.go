@@ -0,0 +1,38 @@
+package myproxy
+
+import "testing"
+
+func TestDigestStats(t *testing.T) {
+	db1 := newFakeBackend(t, "db1")
+	s, conn := startTestProxy(t, db1)
+	defer s.Close()
+	defer conn.Close()
+	s.SetDigestStats(true, 2)
+
+	queryBackend(t, conn, "SELECT a FROM t WHERE id=1")
+	queryBackend(t, conn, "SELECT a FROM t WHERE id=2")
+	execProxy(t, conn, "UPDATE t SET a=1")
+	execProxy(t, conn, "DELETE FROM t")
+	stats := s.GetDigestStats()
+	if len(stats) != 3 {
+		t.Fatalf("Expected 2 digests and other, got %v", stats)
+	}
+	found := false
+	for _, d := range stats {
+		if d.QueryDigest == "select a from t where id=?" {
+			found = true
+		}
+		if d.Digest != QueryDigestHash(d.QueryDigest) {
+			t.Fatalf("Expected the digest of the rules, got %s", d.Digest)
+		}
+		if d.QueryDigest == "select a from t where id=?" && (d.CountStar != 2 || d.RowsSent != 2 || d.Histogram[0]+d.Histogram[1]+d.Histogram[2] != 2) {
+			t.Fatalf("Unexpected digest stats %v", d)
+		}
+		if d.QueryDigest == DigestOther && d.CountStar != 1 {
+			t.Fatalf("Expected query counted in other, got %v", d)
+		}
+	}
+	if !found {
+		t.Fatalf("Expected normalized select digest, got %v", stats)
+	}
+}
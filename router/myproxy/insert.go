@@ -1,13 +1,18 @@
 package myproxy
 
 import (
+	"context"
+
 	_ "github.com/go-sql-driver/mysql"
 	siddonmysql "github.com/siddontang/go-mysql/mysql"
-	"github.com/xwb1989/sqlparser"
 )
 
-func (h MysqlHandler) handleInsert(insert *sqlparser.Insert) (*siddonmysql.Result, error) {
-	result, err := h.insertDB(sqlparser.String(insert))
+func (h *MysqlHandler) handleInsert(insert string) (*siddonmysql.Result, error) {
+	sc, err := h.getWriterConn()
+	if err != nil {
+		return nil, err
+	}
+	result, err := h.insertDB(sc, insert)
 	if err != nil {
 		return nil, err
 	}
@@ -15,20 +20,25 @@ func (h MysqlHandler) handleInsert(insert *sqlparser.Insert) (*siddonmysql.Resul
 }
 
 // insertDB is responsable for doing insert into Mysql
-func (h MysqlHandler) insertDB(insert string) (*siddonmysql.Result, error) {
+func (h *MysqlHandler) insertDB(sc *sessionConn, insert string) (*siddonmysql.Result, error) {
 	// 1. Exec mysql insert
-	dbresult, err := h.db.Exec(insert)
+	dbresult, err := sc.conn.ExecContext(context.Background(), insert)
 	if err != nil {
 		return nil, err
 	}
 
 	// 2. Process result
+	num, err := dbresult.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
 	insertId, err := dbresult.LastInsertId()
 	if err != nil {
 		return nil, err
 	}
 
 	return &siddonmysql.Result{
-		InsertId: uint64(insertId),
+		AffectedRows: uint64(num),
+		InsertId:     uint64(insertId),
 	}, nil
 }
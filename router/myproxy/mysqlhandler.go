@@ -1,111 +1,328 @@
 package myproxy
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"regexp"
+	"sync/atomic"
+	"time"
 
-	"database/sql"
-
-	_ "github.com/go-sql-driver/mysql"
+	gomysql "github.com/go-sql-driver/mysql"
 	. "github.com/siddontang/go-mysql/mysql"
 	"github.com/xwb1989/sqlparser"
 )
 
+var (
+	beginRegex        = regexp.MustCompile(`(?i)^(begin|start\s+transaction)\b`)
+	endRegex          = regexp.MustCompile(`(?i)^(commit|rollback)\b`)
+	savepointRegex    = regexp.MustCompile(`(?i)^rollback\s+(work\s+)?to\b`)
+	tempTableRegex    = regexp.MustCompile(`(?i)^create\s+temporary\s+table\b`)
+	lockTablesRegex   = regexp.MustCompile(`(?i)^lock\s+tables?\b`)
+	unlockTablesRegex = regexp.MustCompile(`(?i)^unlock\s+tables?\b`)
+	setNoReplayRegex  = regexp.MustCompile(`(?i)^set\s+(global|persist|persist_only|transaction|password)\b|^set\s+@@global\.`)
+	getLockRegex      = regexp.MustCompile(`(?i)\bget_lock\s*\(`)
+	// reads using the session of the writer or locking rows
+	selectWriterRegex = regexp.MustCompile(`(?i)\bfor\s+update\b|\block\s+in\s+share\s+mode\b|\bfor\s+share\b|\binto\s+(outfile|dumpfile|@)|\b(last_insert_id|found_rows|row_count|get_lock|release_lock|is_used_lock|is_free_lock)\s*\(|@`)
+)
+
+// MysqlHandler serves a client connection, it tracks the session of the client
 type MysqlHandler struct {
-	db      *sql.DB
+	server  *Server
 	verbose bool
+	session *session
+	inTrx   bool
+	user    string
+	// route is the route of the current query set by the query rules
+	route int
 }
 
-func (h MysqlHandler) UseDB(dbName string) error {
+func newMysqlHandler(s *Server) *MysqlHandler {
+	return &MysqlHandler{server: s, verbose: s.verbose, session: newSession()}
+}
+
+// Close releases the backend connections of the session
+func (h *MysqlHandler) Close() {
+	if h.inTrx {
+		atomic.AddInt64(&h.server.activeTrx, -1)
+		h.inTrx = false
+	}
+	h.session.close()
+}
+
+// getConn returns a reader connection for a query that can run on a slave when read/write split is on
+// and the session does not read on the writer, the writer connection otherwise
+func (h *MysqlHandler) getConn(read bool) (*sessionConn, error) {
+	s := h.session
+	switch h.route {
+	case RouteShard:
+		return h.getShardConn()
+	case RouteWriter:
+		read = false
+	case RouteReader:
+		read = true
+	}
+	if read && h.server.readWriteSplit && !s.isOnWriter() {
+		b, err := h.server.GetReader()
+		if err != nil {
+			return nil, err
+		}
+		if w, _ := h.server.GetWriter(); b != w {
+			sc, ok := s.readers[b.URL]
+			if ok && sc.backend != b {
+				s.release(sc)
+				ok = false
+			}
+			if !ok {
+				sc, err = s.open(b)
+			} else {
+				err = s.sync(sc)
+			}
+			if err == nil {
+				s.readers[b.URL] = sc
+				b.countQuery()
+				return sc, nil
+			}
+			delete(s.readers, b.URL)
+			if h.verbose {
+				log.Printf("Reader %s unavailable for the session, using the writer: %s", b.URL, err)
+			}
+		}
+	}
+	return h.getWriterConn()
+}
+
+// getWriterConn returns the writer connection of the session, a session not pinned follows the writer
+// after a failover with its schema and variables replayed, a pinned session keeps its connection until
+// the end of the transaction. A session with temporary tables or named locks gets an error once as
+// they are not on the new writer.
+func (h *MysqlHandler) getWriterConn() (*sessionConn, error) {
+	s := h.session
+	if h.route == RouteShard {
+		return h.getShardConn()
+	}
+	b, err := h.server.GetWriter()
+	if err != nil {
+		if s.writer != nil && s.isPinned() {
+			return s.writer, nil
+		}
+		return nil, err
+	}
+	if s.writer != nil && s.writer.backend != b && !s.isPinned() {
+		s.release(s.writer)
+		s.writer = nil
+		if s.localState {
+			s.localState = false
+			return nil, NewError(ER_UNKNOWN_ERROR, "Session temporary tables and named locks lost by the switch to writer "+b.URL)
+		}
+	}
+	if s.writer == nil {
+		s.writer, err = s.open(b)
+		if err != nil {
+			return nil, err
+		}
+	} else if err := s.sync(s.writer); err != nil {
+		return nil, err
+	}
+	s.writer.backend.countQuery()
+	return s.writer, nil
+}
+
+// getShardConn returns the connection of the session to the shard proxy
+func (h *MysqlHandler) getShardConn() (*sessionConn, error) {
+	s := h.session
+	b, err := h.server.GetShard()
+	if err != nil {
+		return nil, err
+	}
+	if s.shard != nil && s.shard.backend != b {
+		s.release(s.shard)
+		s.shard = nil
+	}
+	if s.shard == nil {
+		s.shard, err = s.open(b)
+		if err != nil {
+			return nil, err
+		}
+	} else if err := s.sync(s.shard); err != nil {
+		return nil, err
+	}
+	b.countQuery()
+	return s.shard, nil
+}
+
+func (h *MysqlHandler) UseDB(dbName string) error {
 	//log.Printf("use %s \n", dbName)
-	_, err := h.SelectDB("use " + dbName)
+	if err := h.begin(); err != nil {
+		return err
+	}
+	defer h.end()
+	return h.useDB(dbName)
+}
+
+func (h *MysqlHandler) useDB(dbName string) error {
+	sc, err := h.getWriterConn()
+	if err != nil {
+		return err
+	}
+	_, err = h.execDB(sc, "USE "+quoteIdentifier(dbName))
 	if err != nil {
 		log.Printf("Error in use %s \n", err)
+		return err
 	}
-
+	h.session.db = dbName
+	sc.db = dbName
 	return nil
 }
 
-func (h MysqlHandler) HandleOtherCommand(cmd byte, data []byte) error {
+func (h *MysqlHandler) HandleOtherCommand(cmd byte, data []byte) error {
 
 	log.Printf("Other command %d is not supported now ", cmd)
 	return fmt.Errorf("Other command %d is not supported now ", cmd)
 }
 
-// HandleQuery is response to process select/insert/update/delete statement
-func (h MysqlHandler) HandleQuery(queryStr string) (*Result, error) {
-	// 1. parse
-	statement, err := sqlparser.Parse(queryStr)
+// HandleQuery routes a statement to the readers or to the writer connection of the session,
+// transactions, session variables, schema changes, temporary tables and locks are tracked
+func (h *MysqlHandler) HandleQuery(queryStr string) (*Result, error) {
+	if err := h.begin(); err != nil {
+		return nil, err
+	}
+	defer h.end()
+	start := time.Now()
+	schema := h.session.db
+	queryStr, route, err := h.server.applyRules(h.user, schema, queryStr)
 	if err != nil {
-		log.Printf("HandleQuery: %s, err=%v \n", queryStr, err)
+		h.server.recordDigest(h.user, schema, queryStr, start, nil, err)
 		return nil, err
 	}
-
-	var ok bool
-	var query *sqlparser.Select
-	var insert *sqlparser.Insert
-	var update *sqlparser.Update
-	var delete *sqlparser.Delete
-
+	h.route = route
+	defer func() { h.route = RouteDefault }()
+	query := sqlparser.StripLeadingComments(queryStr)
 	var result *Result
-
-	// 2. convert type to Select/Insert/Upadte/Delete
-	switch statement.(type) {
-	case *sqlparser.Select:
-		query, ok = statement.(*sqlparser.Select)
-		if !ok {
-			return nil, fmt.Errorf("convert to select sql failed. sql=%s \n", query)
-		}
-		result, err = h.handleSelect(query)
-
-	case *sqlparser.Insert:
-		insert, ok = statement.(*sqlparser.Insert)
-		if !ok {
-			return nil, fmt.Errorf("convert to insert sql failed. sql=%s \n", insert)
-		}
-		result, err = h.handleInsert(insert)
-
-	case *sqlparser.Update:
-		update, ok = statement.(*sqlparser.Update)
-		if !ok {
-			return nil, fmt.Errorf("convert to update sql failed. sql=%s \n", update)
-		}
-		result, err = h.handleUpdate(update)
-
-	case *sqlparser.Delete:
-		delete, ok = statement.(*sqlparser.Delete)
-		if !ok {
-			return nil, fmt.Errorf("convert to delete sql failed. sql=%s \n", delete)
-		}
-		result, err = h.handleDelete(delete)
-
-	case *sqlparser.Show:
-		query, ok = statement.(*sqlparser.Select)
-		if !ok {
-			return nil, fmt.Errorf("convert to select sql failed. sql=%s \n", query)
+	switch {
+	case beginRegex.MatchString(query):
+		result, err = h.handleTransaction(queryStr, true)
+	case endRegex.MatchString(query) && !savepointRegex.MatchString(query):
+		result, err = h.handleTransaction(queryStr, false)
+	default:
+		switch sqlparser.Preview(query) {
+		case sqlparser.StmtSelect:
+			result, err = h.handleSelect(queryStr)
+		case sqlparser.StmtInsert, sqlparser.StmtReplace:
+			result, err = h.handleInsert(queryStr)
+		case sqlparser.StmtUpdate:
+			result, err = h.handleUpdate(queryStr)
+		case sqlparser.StmtDelete:
+			result, err = h.handleDelete(queryStr)
+		case sqlparser.StmtSet:
+			result, err = h.handleSet(queryStr)
+		case sqlparser.StmtUse:
+			err = h.useDB(unquoteIdentifier(query[3:]))
+		case sqlparser.StmtDDL:
+			result, err = h.handleDDL(queryStr)
+		default:
+			// SHOW, CALL, EXPLAIN and the other statements
+			result, err = h.handlePassThrough(queryStr)
 		}
-		result, err = h.handleSelect(query)
+	}
+	if err != nil && h.verbose {
+		log.Printf("HandleQuery: %s, err=%v \n", queryStr, err)
+	}
+	if err == nil {
+		h.session.startStatement(sqlparser.Preview(query))
+	}
+	h.server.recordDigest(h.user, schema, queryStr, start, result, err)
+	return result, toClientError(err)
+}
 
-	default:
+func (h *MysqlHandler) handleTransaction(query string, begin bool) (*Result, error) {
+	sc, err := h.getWriterConn()
+	if err != nil {
+		return nil, err
+	}
+	result, err := h.execDB(sc, query)
+	// a failed commit or rollback ends the transaction too, the session can then follow a new writer
+	if err == nil || !begin {
+		h.session.inTrx = begin
+	}
+	return result, err
+}
 
+func (h *MysqlHandler) handleSet(query string) (*Result, error) {
+	sc, err := h.getWriterConn()
+	if err != nil {
+		return nil, err
+	}
+	result, err := h.execDB(sc, query)
+	if err != nil {
+		return nil, err
+	}
+	if !setNoReplayRegex.MatchString(sqlparser.StripLeadingComments(query)) {
+		h.session.addVar(query)
+		sc.varsVersion = h.session.varsVersion
 	}
+	return result, nil
+}
 
-	return result, err
+// handleDDL runs DDL on the writer, DDL commits the transaction and temporary tables pin the session
+func (h *MysqlHandler) handleDDL(query string) (*Result, error) {
+	sc, err := h.getWriterConn()
+	if err != nil {
+		return nil, err
+	}
+	result, err := h.execDB(sc, query)
+	if err != nil {
+		return nil, err
+	}
+	h.session.inTrx = false
+	if tempTableRegex.MatchString(sqlparser.StripLeadingComments(query)) {
+		h.session.localState = true
+	}
+	return result, nil
 }
 
-func (h MysqlHandler) HandleFieldList(table string, fieldWildcard string) ([]*Field, error) {
-	return nil, fmt.Errorf("HandleFieldList: not supported now")
+func (h *MysqlHandler) handlePassThrough(query string) (*Result, error) {
+	sc, err := h.getWriterConn()
+	if err != nil {
+		return nil, err
+	}
+	result, err := h.SelectDB(sc, query)
+	stripped := sqlparser.StripLeadingComments(query)
+	if unlockTablesRegex.MatchString(stripped) {
+		// the locks are released by a failed unlock on a lost connection too
+		h.session.lockTables = false
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lockTablesRegex.MatchString(stripped) {
+		h.session.lockTables = true
+	}
+	return result, nil
 }
 
-func (h MysqlHandler) HandleStmtPrepare(query string) (int, int, interface{}, error) {
-	return 0, 0, nil, fmt.Errorf("HandleStmtPrepare: not supported now")
+// execDB runs a statement without result set
+func (h *MysqlHandler) execDB(sc *sessionConn, query string) (*Result, error) {
+	dbresult, err := sc.conn.ExecContext(context.Background(), query)
+	if err != nil {
+		return nil, err
+	}
+	num, _ := dbresult.RowsAffected()
+	insertId, _ := dbresult.LastInsertId()
+	return &Result{
+		AffectedRows: uint64(num),
+		InsertId:     uint64(insertId),
+	}, nil
 }
 
-func (h MysqlHandler) HandleStmtExecute(context interface{}, query string, args []interface{}) (*Result, error) {
-	return nil, fmt.Errorf("HandleStmtExecute: not supported now")
+// toClientError keeps the error code of the backend
+func toClientError(err error) error {
+	if me, ok := err.(*gomysql.MySQLError); ok {
+		return NewError(me.Number, me.Message)
+	}
+	return err
 }
 
-func (h MysqlHandler) HandleStmtClose(context interface{}) error {
-	log.Printf("HandleStmtClose\n")
-	return nil
+func (h *MysqlHandler) HandleFieldList(table string, fieldWildcard string) ([]*Field, error) {
+	return nil, fmt.Errorf("HandleFieldList: not supported now")
 }
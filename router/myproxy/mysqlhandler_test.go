@@ -0,0 +1,394 @@
+package myproxy
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	siddonmysql "github.com/siddontang/go-mysql/mysql"
+	siddon "github.com/siddontang/go-mysql/server"
+)
+
+// fakeBackend is a MySQL server recording the queries, a SELECT returns the name of the backend
+type fakeBackend struct {
+	name     string
+	listener net.Listener
+	mutex    sync.Mutex
+	queries  []string
+}
+
+func newFakeBackend(t *testing.T, name string) *fakeBackend {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBackend{name: name, listener: l}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn, err := siddon.NewConn(c, "root", "pass", &fakeHandler{backend: b})
+				if err != nil {
+					return
+				}
+				for conn.HandleCommand() == nil {
+				}
+			}()
+		}
+	}()
+	return b
+}
+
+func (b *fakeBackend) DSN() string {
+	return "root:pass@tcp(" + b.listener.Addr().String() + ")/"
+}
+
+func (b *fakeBackend) record(q string) {
+	b.mutex.Lock()
+	b.queries = append(b.queries, q)
+	b.mutex.Unlock()
+}
+
+// received returns true when the backend received the query
+func (b *fakeBackend) received(q string) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, r := range b.queries {
+		if r == q {
+			return true
+		}
+	}
+	return false
+}
+
+type fakeHandler struct {
+	siddon.EmptyHandler
+	backend *fakeBackend
+}
+
+func (h *fakeHandler) UseDB(dbName string) error {
+	h.backend.record("USE " + dbName)
+	return nil
+}
+
+func (h *fakeHandler) HandleQuery(query string) (*siddonmysql.Result, error) {
+	h.backend.record(query)
+	if strings.HasPrefix(strings.ToUpper(query), "SELECT") {
+		rs, err := siddonmysql.BuildSimpleResultset([]string{"backend"}, [][]interface{}{{h.backend.name}}, false)
+		if err != nil {
+			return nil, err
+		}
+		return &siddonmysql.Result{Resultset: rs}, nil
+	}
+	return &siddonmysql.Result{AffectedRows: 1}, nil
+}
+
+func (h *fakeHandler) HandleStmtPrepare(query string) (int, int, interface{}, error) {
+	h.backend.record("PREPARE " + query)
+	return strings.Count(query, "?"), 0, nil, nil
+}
+
+func (h *fakeHandler) HandleStmtExecute(context interface{}, query string, args []interface{}) (*siddonmysql.Result, error) {
+	h.backend.record("EXECUTE " + query)
+	if strings.HasPrefix(strings.ToUpper(query), "SELECT") {
+		rs, err := siddonmysql.BuildSimpleResultset([]string{"backend", "arg"}, [][]interface{}{{h.backend.name, args[0]}}, true)
+		if err != nil {
+			return nil, err
+		}
+		return &siddonmysql.Result{Resultset: rs}, nil
+	}
+	return &siddonmysql.Result{AffectedRows: 1}, nil
+}
+
+func (h *fakeHandler) HandleStmtClose(context interface{}) error {
+	return nil
+}
+
+func startTestProxy(t *testing.T, writer *fakeBackend, readers ...*fakeBackend) (*Server, *sql.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	s, _ := NewProxyServer(addr, "admin", "repman")
+	s.SetReadWriteSplit(true)
+	s.SetWriter(writer.name, writer.DSN())
+	var pool []*Backend
+	for _, r := range readers {
+		pool = append(pool, &Backend{URL: r.name, DSN: r.DSN()})
+	}
+	s.SetReaders(pool)
+	go s.Run()
+	db, _ := sql.Open("mysql", "admin:repman@tcp("+addr+")/")
+	for i := 0; i < 50; i++ {
+		if err = db.Ping(); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, conn
+}
+
+func queryBackend(t *testing.T, conn *sql.Conn, query string) string {
+	var name string
+	if err := conn.QueryRowContext(context.Background(), query).Scan(&name); err != nil {
+		t.Fatalf("%s: %s", query, err)
+	}
+	return name
+}
+
+func execProxy(t *testing.T, conn *sql.Conn, query string) {
+	if _, err := conn.ExecContext(context.Background(), query); err != nil {
+		t.Fatalf("%s: %s", query, err)
+	}
+}
+
+func TestSessionRouting(t *testing.T) {
+	db1 := newFakeBackend(t, "db1")
+	db2 := newFakeBackend(t, "db2")
+	s, conn := startTestProxy(t, db1, db2)
+	defer s.Close()
+	defer conn.Close()
+
+	if b := queryBackend(t, conn, "SELECT 1"); b != "db2" {
+		t.Fatalf("Expected read on the reader, got %s", b)
+	}
+	execProxy(t, conn, "SET sql_mode='ANSI'")
+	execProxy(t, conn, "USE app")
+	if !db1.received("SET sql_mode='ANSI'") {
+		t.Fatal("Expected SET on the writer")
+	}
+	queryBackend(t, conn, "SELECT 2")
+	if !db2.received("SET sql_mode='ANSI'") || !db2.received("USE `app`") {
+		t.Fatal("Expected session replayed on the reader")
+	}
+	if b := queryBackend(t, conn, "SELECT 3 FOR UPDATE"); b != "db1" {
+		t.Fatalf("Expected locking read on the writer, got %s", b)
+	}
+
+	execProxy(t, conn, "START TRANSACTION")
+	if b := queryBackend(t, conn, "SELECT 4"); b != "db1" {
+		t.Fatalf("Expected read in transaction on the writer, got %s", b)
+	}
+	// the transaction drains on the old writer
+	db3 := newFakeBackend(t, "db3")
+	s.SetWriter(db3.name, db3.DSN())
+	execProxy(t, conn, "INSERT INTO t VALUES (1)")
+	execProxy(t, conn, "COMMIT")
+	if !db1.received("INSERT INTO t VALUES (1)") || !db1.received("COMMIT") {
+		t.Fatal("Expected transaction to stay on its connection")
+	}
+	if b := queryBackend(t, conn, "SELECT 5"); b != "db2" {
+		t.Fatalf("Expected read on the reader after commit, got %s", b)
+	}
+	execProxy(t, conn, "UPDATE t SET a=1")
+	if !db3.received("UPDATE t SET a=1") || !db3.received("SET sql_mode='ANSI'") || !db3.received("USE `app`") {
+		t.Fatal("Expected session to follow the new writer with its variables")
+	}
+
+	execProxy(t, conn, "CREATE TEMPORARY TABLE tmp (a int)")
+	if b := queryBackend(t, conn, "SELECT 6"); b != "db3" {
+		t.Fatalf("Expected session with temporary table pinned to the writer, got %s", b)
+	}
+	if _, err := conn.ExecContext(context.Background(), "CALL proc()"); err != nil || !db3.received("CALL proc()") {
+		t.Fatalf("Expected CALL passed through: %v", err)
+	}
+}
+
+func TestPreparedStatements(t *testing.T) {
+	db1 := newFakeBackend(t, "db1")
+	s, conn := startTestProxy(t, db1)
+	defer s.Close()
+	defer conn.Close()
+	s.SetReadWriteSplit(false)
+
+	ctx := context.Background()
+	stmt, err := conn.PrepareContext(ctx, "SELECT a FROM t WHERE id=?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	var name string
+	var arg int64
+	if err := stmt.QueryRowContext(ctx, 42).Scan(&name, &arg); err != nil {
+		t.Fatal(err)
+	}
+	if name != "db1" || arg != 42 {
+		t.Fatalf("Expected execute on db1 with argument 42, got %s %d", name, arg)
+	}
+	if _, err := conn.ExecContext(ctx, "UPDATE t SET a=? WHERE id=?", 1, 2); err != nil || !db1.received("EXECUTE UPDATE t SET a=? WHERE id=?") {
+		t.Fatalf("Expected update executed on db1: %v", err)
+	}
+
+	// the statement is prepared again on the new master
+	db2 := newFakeBackend(t, "db2")
+	s.SetWriter(db2.name, db2.DSN())
+	if err := stmt.QueryRowContext(ctx, 43).Scan(&name, &arg); err != nil {
+		t.Fatal(err)
+	}
+	if name != "db2" || arg != 43 || !db2.received("PREPARE SELECT a FROM t WHERE id=?") {
+		t.Fatalf("Expected statement prepared again on db2, got %s %d", name, arg)
+	}
+}
+
+func TestSwitchoverPause(t *testing.T) {
+	db1 := newFakeBackend(t, "db1")
+	s, conn := startTestProxy(t, db1)
+	defer s.Close()
+	defer conn.Close()
+
+	execProxy(t, conn, "START TRANSACTION")
+	s.Pause(5*time.Second, 10)
+	if s.GetActiveTransactions() != 1 || s.WaitDrain(100*time.Millisecond) {
+		t.Fatal("Expected transaction running during the pause")
+	}
+	// the transaction is not held and drains on the old writer
+	execProxy(t, conn, "INSERT INTO t VALUES (1)")
+	execProxy(t, conn, "COMMIT")
+	if !db1.received("COMMIT") || !s.WaitDrain(time.Second) {
+		t.Fatal("Expected transaction to end during the pause")
+	}
+
+	done := make(chan string)
+	go func() {
+		var name string
+		conn.QueryRowContext(context.Background(), "SELECT 1").Scan(&name)
+		done <- name
+	}()
+	for i := 0; i < 50 && s.GetHeldQueries() == 0; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if s.GetHeldQueries() != 1 {
+		t.Fatal("Expected query held by the pause")
+	}
+	db2 := newFakeBackend(t, "db2")
+	s.SetWriter(db2.name, db2.DSN())
+	s.Resume()
+	if b := <-done; b != "db2" {
+		t.Fatalf("Expected held query released to the new writer, got %s", b)
+	}
+}
+
+func TestAutocommitOffFailover(t *testing.T) {
+	db1 := newFakeBackend(t, "db1")
+	db2 := newFakeBackend(t, "db2")
+	s, conn := startTestProxy(t, db1, db2)
+	defer s.Close()
+	defer conn.Close()
+
+	execProxy(t, conn, "SET autocommit=0")
+	if b := queryBackend(t, conn, "SELECT 1"); b != "db1" {
+		t.Fatalf("Expected read with autocommit off on the writer, got %s", b)
+	}
+	execProxy(t, conn, "INSERT INTO t VALUES (1)")
+	// the implicit transaction ends on the old writer
+	db3 := newFakeBackend(t, "db3")
+	s.SetWriter(db3.name, db3.DSN())
+	execProxy(t, conn, "INSERT INTO t VALUES (2)")
+	execProxy(t, conn, "COMMIT")
+	if !db1.received("INSERT INTO t VALUES (2)") || !db1.received("COMMIT") {
+		t.Fatal("Expected implicit transaction to stay on its connection")
+	}
+	// the session follows the new writer between transactions with autocommit replayed
+	execProxy(t, conn, "INSERT INTO t VALUES (3)")
+	if !db3.received("INSERT INTO t VALUES (3)") || !db3.received("SET autocommit=0") {
+		t.Fatal("Expected session with autocommit off to follow the new writer")
+	}
+	execProxy(t, conn, "ROLLBACK")
+
+	execProxy(t, conn, "CREATE TEMPORARY TABLE tmp (a int)")
+	db4 := newFakeBackend(t, "db4")
+	s.SetWriter(db4.name, db4.DSN())
+	if _, err := conn.ExecContext(context.Background(), "INSERT INTO tmp VALUES (1)"); err == nil || !strings.Contains(err.Error(), "temporary tables") {
+		t.Fatalf("Expected error for the temporary tables lost by the switch, got %v", err)
+	}
+	execProxy(t, conn, "INSERT INTO t VALUES (4)")
+	if !db4.received("INSERT INTO t VALUES (4)") || db3.received("INSERT INTO tmp VALUES (1)") {
+		t.Fatal("Expected session to continue on the new writer")
+	}
+}
+
+func TestPreparedStatementsAutocommitOffFailover(t *testing.T) {
+	db1 := newFakeBackend(t, "db1")
+	s, conn := startTestProxy(t, db1)
+	defer s.Close()
+	defer conn.Close()
+
+	ctx := context.Background()
+	execProxy(t, conn, "SET autocommit=0")
+	stmt, err := conn.PrepareContext(ctx, "UPDATE t SET a=? WHERE id=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	if _, err := stmt.ExecContext(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	// the execute opened an implicit transaction kept on db1 until the commit
+	db2 := newFakeBackend(t, "db2")
+	s.SetWriter(db2.name, db2.DSN())
+	if _, err := stmt.ExecContext(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	execProxy(t, conn, "COMMIT")
+	if db2.received("EXECUTE UPDATE t SET a=? WHERE id=1") || !db1.received("COMMIT") {
+		t.Fatal("Expected implicit transaction to stay on db1")
+	}
+	if _, err := stmt.ExecContext(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	if !db2.received("SET autocommit=0") || !db2.received("PREPARE UPDATE t SET a=? WHERE id=1") || !db2.received("EXECUTE UPDATE t SET a=? WHERE id=1") {
+		t.Fatal("Expected statement prepared again on the new writer after the commit")
+	}
+}
+
+func TestSwitchoverPauseAutocommitOff(t *testing.T) {
+	db1 := newFakeBackend(t, "db1")
+	s, conn := startTestProxy(t, db1)
+	defer s.Close()
+	defer conn.Close()
+
+	execProxy(t, conn, "SET autocommit=0")
+	execProxy(t, conn, "INSERT INTO t VALUES (1)")
+	s.Pause(5*time.Second, 10)
+	if s.GetActiveTransactions() != 1 || s.WaitDrain(100*time.Millisecond) {
+		t.Fatal("Expected implicit transaction counted during the pause")
+	}
+	execProxy(t, conn, "COMMIT")
+	if !s.WaitDrain(time.Second) {
+		t.Fatal("Expected implicit transaction drained by the commit")
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := conn.ExecContext(context.Background(), "INSERT INTO t VALUES (2)")
+		done <- err
+	}()
+	for i := 0; i < 50 && s.GetHeldQueries() == 0; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if s.GetHeldQueries() != 1 {
+		t.Fatal("Expected session with autocommit off held between transactions")
+	}
+	db2 := newFakeBackend(t, "db2")
+	s.SetWriter(db2.name, db2.DSN())
+	s.Resume()
+	if err := <-done; err != nil || !db2.received("INSERT INTO t VALUES (2)") {
+		t.Fatalf("Expected held statement released to the new writer: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package myproxy
+
+import (
+	"sync/atomic"
+	"time"
+
+	. "github.com/siddontang/go-mysql/mysql"
+)
+
+// pause holds the queries of the sessions outside a transaction during a switchover
+type pause struct {
+	resume  chan struct{}
+	held    int
+	maxHeld int
+	timer   *time.Timer
+}
+
+// Pause holds the new queries until Resume or until maxPause is reached, at most maxHeld queries
+// are held, the queries over the limit get an error. Sessions in a transaction are not held.
+func (s *Server) Pause(maxPause time.Duration, maxHeld int) {
+	s.pauseMutex.Lock()
+	defer s.pauseMutex.Unlock()
+	if s.pause != nil {
+		return
+	}
+	p := &pause{resume: make(chan struct{}), maxHeld: maxHeld}
+	p.timer = time.AfterFunc(maxPause, s.Resume)
+	s.pause = p
+}
+
+// Resume releases the held queries to the current writer
+func (s *Server) Resume() {
+	s.pauseMutex.Lock()
+	defer s.pauseMutex.Unlock()
+	if s.pause == nil {
+		return
+	}
+	s.pause.timer.Stop()
+	close(s.pause.resume)
+	s.pause = nil
+}
+
+// IsPaused returns true during a pause
+func (s *Server) IsPaused() bool {
+	s.pauseMutex.Lock()
+	defer s.pauseMutex.Unlock()
+	return s.pause != nil
+}
+
+// GetHeldQueries returns the number of queries held by the current pause
+func (s *Server) GetHeldQueries() int {
+	s.pauseMutex.Lock()
+	defer s.pauseMutex.Unlock()
+	if s.pause == nil {
+		return 0
+	}
+	return s.pause.held
+}
+
+// GetActiveTransactions returns the number of sessions in a transaction, implicit with autocommit off,
+// or holding table locks on the writer
+func (s *Server) GetActiveTransactions() int64 {
+	return atomic.LoadInt64(&s.activeTrx)
+}
+
+// WaitDrain waits for the sessions in a transaction to commit or rollback, it returns false
+// when some transactions are still running after the timeout
+func (s *Server) WaitDrain(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for s.GetActiveTransactions() > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return true
+}
+
+// hold blocks until the end of the pause
+func (s *Server) hold() error {
+	s.pauseMutex.Lock()
+	p := s.pause
+	if p == nil {
+		s.pauseMutex.Unlock()
+		return nil
+	}
+	if p.held >= p.maxHeld {
+		s.pauseMutex.Unlock()
+		return NewError(ER_CON_COUNT_ERROR, "Too many queries held by the switchover")
+	}
+	p.held++
+	s.pauseMutex.Unlock()
+	<-p.resume
+	return nil
+}
+
+// begin holds a command of a session that is not pinned to its writer connection during a pause, the
+// pinned sessions are counted by end to be drained
+func (h *MysqlHandler) begin() error {
+	if h.session.isPinned() {
+		return nil
+	}
+	return h.server.hold()
+}
+
+// end counts the sessions pinned to their writer connection after a command, the same sessions are not held
+func (h *MysqlHandler) end() {
+	inTrx := h.session.isPinned()
+	if inTrx != h.inTrx {
+		h.inTrx = inTrx
+		if inTrx {
+			atomic.AddInt64(&h.server.activeTrx, 1)
+		} else {
+			atomic.AddInt64(&h.server.activeTrx, -1)
+		}
+	}
+}
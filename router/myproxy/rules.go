@@ -0,0 +1,156 @@
+package myproxy
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/siddontang/go-mysql/mysql"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+)
+
+const (
+	RouteDefault = iota
+	RouteWriter
+	RouteReader
+	RouteShard
+)
+
+// QueryRule matches the queries of a user on a schema by digest or by pattern, a matching query is
+// blocked with ErrorMsg, rewritten with ReplacePattern, routed or rate limited. Rules are applied
+// by Id until a matching rule with Apply. As in ProxySQL Digest is the hash of the query digest
+// returned by QueryDigestHash and MatchDigest matches the query digest text.
+type QueryRule struct {
+	Id             uint32
+	User           string
+	Schema         string
+	Digest         string
+	MatchDigest    *regexp.Regexp
+	MatchPattern   *regexp.Regexp
+	ReplacePattern string
+	ErrorMsg       string
+	Route          int
+	// RateLimit is the number of queries per second allowed by the rule, 0 for no limit
+	RateLimit int64
+	Apply     bool
+	hits      *uint64
+	rate      *rateCounter
+}
+
+type rateCounter struct {
+	mutex  sync.Mutex
+	second int64
+	count  int64
+}
+
+// allow counts a query in the current second and returns false over the limit
+func (r *rateCounter) allow(limit int64) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	now := time.Now().Unix()
+	if now != r.second {
+		r.second = now
+		r.count = 0
+	}
+	r.count++
+	return r.count <= limit
+}
+
+func (r *QueryRule) needDigest() bool {
+	return r.Digest != "" || r.MatchDigest != nil
+}
+
+func (r *QueryRule) match(user string, schema string, query string, digest string) bool {
+	if r.User != "" && r.User != user {
+		return false
+	}
+	if r.Schema != "" && r.Schema != schema {
+		return false
+	}
+	if r.Digest != "" && !strings.EqualFold(r.Digest, QueryDigestHash(digest)) {
+		return false
+	}
+	if r.MatchDigest != nil && !r.MatchDigest.MatchString(digest) {
+		return false
+	}
+	if r.MatchPattern != nil && !r.MatchPattern.MatchString(query) {
+		return false
+	}
+	return true
+}
+
+// SetQueryRules replaces the query rules, the hit counters of the rules are kept by Id
+func (s *Server) SetQueryRules(rules []*QueryRule) {
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Id < rules[j].Id })
+	s.rulesMutex.Lock()
+	defer s.rulesMutex.Unlock()
+	if s.ruleHits == nil {
+		s.ruleHits = make(map[uint32]*uint64)
+	}
+	prev := make(map[uint32]*QueryRule)
+	for _, r := range s.rules {
+		prev[r.Id] = r
+	}
+	for _, r := range rules {
+		if _, ok := s.ruleHits[r.Id]; !ok {
+			s.ruleHits[r.Id] = new(uint64)
+		}
+		r.hits = s.ruleHits[r.Id]
+		if p, ok := prev[r.Id]; ok {
+			r.rate = p.rate
+		} else {
+			r.rate = new(rateCounter)
+		}
+	}
+	s.rules = rules
+}
+
+// GetQueryRuleHits returns the number of queries matched by each rule
+func (s *Server) GetQueryRuleHits() map[uint32]uint64 {
+	s.rulesMutex.RLock()
+	defer s.rulesMutex.RUnlock()
+	hits := make(map[uint32]uint64)
+	for id, h := range s.ruleHits {
+		hits[id] = atomic.LoadUint64(h)
+	}
+	return hits
+}
+
+// applyRules returns the query rewritten by the matching rules and its route, or the error of a blocking rule
+func (s *Server) applyRules(user string, schema string, query string) (string, int, error) {
+	s.rulesMutex.RLock()
+	rules := s.rules
+	s.rulesMutex.RUnlock()
+	route := RouteDefault
+	digest := ""
+	for _, r := range rules {
+		if r.needDigest() && digest == "" {
+			digest = dbhelper.GetQueryDigest(query)
+		}
+		if !r.match(user, schema, query, digest) {
+			continue
+		}
+		atomic.AddUint64(r.hits, 1)
+		if r.ErrorMsg != "" {
+			return query, route, NewError(ER_SPECIFIC_ACCESS_DENIED_ERROR, r.ErrorMsg)
+		}
+		if r.RateLimit > 0 && !r.rate.allow(r.RateLimit) {
+			return query, route, NewError(ER_USER_LIMIT_REACHED, "Query rate limit reached for rule "+strconv.FormatUint(uint64(r.Id), 10))
+		}
+		if r.MatchPattern != nil && r.ReplacePattern != "" {
+			query = r.MatchPattern.ReplaceAllString(query, r.ReplacePattern)
+			digest = ""
+		}
+		if r.Route != RouteDefault {
+			route = r.Route
+		}
+		if r.Apply {
+			break
+		}
+	}
+	return query, route, nil
+}
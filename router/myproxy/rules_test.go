@@ -0,0 +1,47 @@
+package myproxy
+
+import (
+	"context"
+	"regexp"
+	"testing"
+)
+
+func TestQueryRules(t *testing.T) {
+	db1 := newFakeBackend(t, "db1")
+	db2 := newFakeBackend(t, "db2")
+	s, conn := startTestProxy(t, db1, db2)
+	defer s.Close()
+	defer conn.Close()
+
+	s.SetQueryRules([]*QueryRule{
+		{Id: 3, MatchPattern: regexp.MustCompile(`(?i)^SELECT`), Route: RouteWriter},
+		{Id: 1, User: "admin", MatchPattern: regexp.MustCompile(`(?i)^DELETE FROM audit`), ErrorMsg: "Audit is append only", Apply: true},
+		{Id: 2, MatchPattern: regexp.MustCompile(`(?i)^UPDATE t1\b`), ReplacePattern: "UPDATE t2", Apply: true},
+		{Id: 4, Digest: QueryDigestHash("insert into t values(?+)"), RateLimit: 1},
+	})
+
+	_, err := conn.ExecContext(context.Background(), "DELETE FROM audit")
+	if err == nil || db1.received("DELETE FROM audit") {
+		t.Fatal("Expected query blocked")
+	}
+	execProxy(t, conn, "UPDATE t1 SET a=1")
+	if !db1.received("UPDATE t2 SET a=1") {
+		t.Fatal("Expected query rewritten")
+	}
+	if b := queryBackend(t, conn, "SELECT 1"); b != "db1" {
+		t.Fatalf("Expected read routed to the writer, got %s", b)
+	}
+	limited := false
+	for i := 0; i < 3; i++ {
+		if _, err := conn.ExecContext(context.Background(), "INSERT INTO t VALUES (1)"); err != nil {
+			limited = true
+		}
+	}
+	if !limited {
+		t.Fatal("Expected rate limit")
+	}
+	hits := s.GetQueryRuleHits()
+	if hits[1] != 1 || hits[2] != 1 || hits[3] != 1 || hits[4] != 3 {
+		t.Fatalf("Unexpected hits %v", hits)
+	}
+}
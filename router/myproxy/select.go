@@ -1,6 +1,8 @@
 package myproxy
 
 import (
+	"context"
+	"database/sql"
 	"log"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -8,13 +10,21 @@ import (
 	"github.com/xwb1989/sqlparser"
 )
 
-func (h MysqlHandler) handleSelect(selectStatement *sqlparser.Select) (*mysql.Result, error) {
+func (h *MysqlHandler) handleSelect(selectStatement string) (*mysql.Result, error) {
 
-	newSelect := sqlparser.String(selectStatement)
+	stripped := sqlparser.StripLeadingComments(selectStatement)
+	if getLockRegex.MatchString(stripped) {
+		h.session.localState = true
+	}
+	// locking reads and reads of the session state run on the writer
+	sc, err := h.getConn(!selectWriterRegex.MatchString(stripped))
+	if err != nil {
+		return nil, err
+	}
 	if h.verbose {
-		log.Println(selectStatement, "->", newSelect)
+		log.Println(selectStatement, "->", sc.backend.URL)
 	}
-	result, err := h.SelectDB(newSelect)
+	result, err := h.SelectDB(sc, selectStatement)
 	if err != nil {
 		log.Println(err)
 		return nil, err
@@ -25,15 +35,25 @@ func (h MysqlHandler) handleSelect(selectStatement *sqlparser.Select) (*mysql.Re
 }
 
 // SelectDB is responsable for doing select query from Mysql
-func (h MysqlHandler) SelectDB(selectStatement string) (*mysql.Result, error) {
+func (h *MysqlHandler) SelectDB(sc *sessionConn, selectStatement string) (*mysql.Result, error) {
 	// 1. Exec mysql query
-	rows, err := h.db.Query(selectStatement)
+	rows, err := sc.conn.QueryContext(context.Background(), selectStatement)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	// 2. Process result
+	return buildResultset(rows, false)
+}
+
+// buildResultset reads the rows in a text resultset, or in a binary resultset for a prepared statement
+func buildResultset(rows *sql.Rows, binary bool) (*mysql.Result, error) {
 	columns, _ := rows.Columns()
+	if len(columns) == 0 {
+		// statement without result set
+		return &mysql.Result{}, rows.Err()
+	}
 	scanArgs := make([]interface{}, len(columns))
 	valueList := [][]interface{}{}
 
@@ -43,29 +63,26 @@ func (h MysqlHandler) SelectDB(selectStatement string) (*mysql.Result, error) {
 			scanArgs[i] = &values[i]
 		}
 
-		// parse records
-		err = rows.Scan(scanArgs...)
+		// parse records, NULL are kept as nil
+		err := rows.Scan(scanArgs...)
 		if err != nil {
 			return nil, err
 		}
 
-		for i, _ := range values {
-			if values[i] == nil {
-				values[i] = []byte{}
-			}
-		}
-
 		valueList = append(valueList, values)
 
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 	result, err := mysql.BuildSimpleResultset(
 		columns,
 		valueList,
-		false,
+		binary,
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	return &mysql.Result{0, 0, 0, result}, nil
+	return &mysql.Result{Resultset: result}, nil
 }
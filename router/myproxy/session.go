@@ -0,0 +1,187 @@
+package myproxy
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+var (
+	autocommitOffRegex = regexp.MustCompile(`(?i)\bautocommit\s*=\s*(0|off|false)\b`)
+	autocommitOnRegex  = regexp.MustCompile(`(?i)\bautocommit\s*=\s*(1|on|true)\b`)
+	spacesRegex        = regexp.MustCompile(`\s+`)
+)
+
+// session is the state of a client connection, transactions and table locks stick the session to
+// its writer connection, the schema and the session variables, autocommit included, are replayed on
+// the backend connections opened after a backend switch. Temporary tables and named locks can't be
+// replayed, they are lost when the session follows a new writer.
+type session struct {
+	db           string
+	vars         []string
+	varsKeys     map[string]int
+	varsVersion  int
+	inTrx        bool
+	noAutocommit bool
+	lockTables   bool
+	localState   bool
+	stmtID       uint32
+	writer       *sessionConn
+	shard        *sessionConn
+	readers      map[string]*sessionConn
+}
+
+// sessionConn is a backend connection of a session with the state already applied to it
+type sessionConn struct {
+	backend     *Backend
+	conn        *sql.Conn
+	db          string
+	varsVersion int
+	stmts       map[uint32]*sql.Stmt
+}
+
+func newSession() *session {
+	return &session{varsKeys: make(map[string]int), readers: make(map[string]*sessionConn)}
+}
+
+// isPinned is true when the session can't leave its writer connection, a transaction, explicit or
+// implicit with autocommit off, or table locks must end on it
+func (s *session) isPinned() bool {
+	return s.inTrx || s.lockTables
+}
+
+// isOnWriter is true when the reads of the session run on its writer connection
+func (s *session) isOnWriter() bool {
+	return s.isPinned() || s.noAutocommit || s.localState
+}
+
+// isDirty is true when a connection of the session has a state other sessions must not inherit
+func (s *session) isDirty() bool {
+	return s.isPinned() || s.localState || s.db != "" || len(s.vars) > 0
+}
+
+// startStatement records the transaction implicitly started by a statement when autocommit is off
+func (s *session) startStatement(kind int) {
+	if !s.noAutocommit {
+		return
+	}
+	switch kind {
+	case sqlparser.StmtSelect, sqlparser.StmtInsert, sqlparser.StmtReplace, sqlparser.StmtUpdate, sqlparser.StmtDelete:
+		s.inTrx = true
+	}
+}
+
+// addVar records a SET statement to replay, SET of the same variables replaces the previous one
+func (s *session) addVar(query string) {
+	key := strings.ToLower(spacesRegex.ReplaceAllString(strings.TrimSpace(query), " "))
+	if i := strings.Index(key, "="); i > 0 {
+		key = strings.TrimSpace(key[:i])
+	}
+	if i, ok := s.varsKeys[key]; ok {
+		s.vars[i] = query
+	} else {
+		s.varsKeys[key] = len(s.vars)
+		s.vars = append(s.vars, query)
+	}
+	s.varsVersion++
+	if autocommitOffRegex.MatchString(query) {
+		s.noAutocommit = true
+	}
+	if autocommitOnRegex.MatchString(query) {
+		// enabling autocommit commits the running transaction
+		s.noAutocommit = false
+		s.inTrx = false
+	}
+}
+
+// sync applies the schema and the session variables missing on the backend connection
+func (s *session) sync(sc *sessionConn) error {
+	ctx := context.Background()
+	if s.db != "" && sc.db != s.db {
+		if _, err := sc.conn.ExecContext(ctx, "USE "+quoteIdentifier(s.db)); err != nil {
+			return err
+		}
+		sc.db = s.db
+	}
+	if sc.varsVersion != s.varsVersion {
+		for _, v := range s.vars {
+			if _, err := sc.conn.ExecContext(ctx, v); err != nil {
+				return err
+			}
+		}
+		sc.varsVersion = s.varsVersion
+	}
+	return nil
+}
+
+func (s *session) open(b *Backend) (*sessionConn, error) {
+	conn, err := b.DB().Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	sc := &sessionConn{backend: b, conn: conn, stmts: make(map[uint32]*sql.Stmt)}
+	if err := s.sync(sc); err != nil {
+		s.release(sc)
+		return nil, err
+	}
+	return sc, nil
+}
+
+// release returns the connection to the pool of the backend, a connection with a session state is closed
+func (s *session) release(sc *sessionConn) {
+	for _, stmt := range sc.stmts {
+		stmt.Close()
+	}
+	if s.isDirty() {
+		sc.conn.Raw(func(interface{}) error {
+			return driver.ErrBadConn
+		})
+	}
+	sc.conn.Close()
+}
+
+func (s *session) close() {
+	if s.writer != nil {
+		s.release(s.writer)
+		s.writer = nil
+	}
+	if s.shard != nil {
+		s.release(s.shard)
+		s.shard = nil
+	}
+	for url, sc := range s.readers {
+		s.release(sc)
+		delete(s.readers, url)
+	}
+}
+
+// conns returns the backend connections opened by the session
+func (s *session) conns() []*sessionConn {
+	var conns []*sessionConn
+	if s.writer != nil {
+		conns = append(conns, s.writer)
+	}
+	if s.shard != nil {
+		conns = append(conns, s.shard)
+	}
+	for _, sc := range s.readers {
+		conns = append(conns, sc)
+	}
+	return conns
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+func unquoteIdentifier(name string) string {
+	name = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(name), ";"))
+	if len(name) > 1 && name[0] == '`' && name[len(name)-1] == '`' {
+		name = strings.Replace(name[1:len(name)-1], "``", "`", -1)
+	}
+	return name
+}
@@ -0,0 +1,170 @@
+package myproxy
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log"
+	"time"
+
+	. "github.com/siddontang/go-mysql/mysql"
+	"github.com/xwb1989/sqlparser"
+)
+
+// preparedStmt is a client prepared statement, it is prepared on each backend connection of the
+// session it is executed on, so a statement survives a failover or a read on another slave
+type preparedStmt struct {
+	id        uint32
+	query     string
+	params    int
+	kind      int
+	read      bool
+	resultset bool
+	tempTable bool
+	route     int
+}
+
+// HandleStmtPrepare prepares the statement on the writer connection to check it and to get its number of parameters
+func (h *MysqlHandler) HandleStmtPrepare(query string) (int, int, interface{}, error) {
+	if err := h.begin(); err != nil {
+		return 0, 0, nil, err
+	}
+	defer h.end()
+	query, route, err := h.server.applyRules(h.user, h.session.db, query)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	h.route = route
+	defer func() { h.route = RouteDefault }()
+	sc, err := h.getWriterConn()
+	if err != nil {
+		return 0, 0, nil, toClientError(err)
+	}
+	params := 0
+	err = sc.conn.Raw(func(dc interface{}) error {
+		cp, ok := dc.(driver.ConnPrepareContext)
+		if !ok {
+			return errors.New("Backend driver can't prepare statements")
+		}
+		ds, err := cp.PrepareContext(context.Background(), query)
+		if err != nil {
+			return err
+		}
+		params = ds.NumInput()
+		return ds.Close()
+	})
+	if err != nil {
+		return 0, 0, nil, toClientError(err)
+	}
+	stripped := sqlparser.StripLeadingComments(query)
+	h.session.stmtID++
+	st := &preparedStmt{id: h.session.stmtID, query: query, params: params, kind: sqlparser.Preview(stripped), route: route}
+	switch st.kind {
+	case sqlparser.StmtSelect:
+		st.read = !selectWriterRegex.MatchString(stripped)
+		st.resultset = true
+	case sqlparser.StmtDDL:
+		st.tempTable = tempTableRegex.MatchString(stripped)
+	case sqlparser.StmtInsert, sqlparser.StmtReplace, sqlparser.StmtUpdate, sqlparser.StmtDelete, sqlparser.StmtSet, sqlparser.StmtUse,
+		sqlparser.StmtBegin, sqlparser.StmtCommit, sqlparser.StmtRollback:
+	default:
+		st.resultset = true
+	}
+	// column definitions are sent by the execute
+	return params, 0, st, nil
+}
+
+// getStmt returns the statement prepared on the backend connection, preparing it on first use
+func (h *MysqlHandler) getStmt(sc *sessionConn, st *preparedStmt) (*sql.Stmt, error) {
+	if stmt, ok := sc.stmts[st.id]; ok {
+		return stmt, nil
+	}
+	stmt, err := sc.conn.PrepareContext(context.Background(), st.query)
+	if err != nil {
+		return nil, err
+	}
+	sc.stmts[st.id] = stmt
+	return stmt, nil
+}
+
+// HandleStmtExecute runs the statement on the connection the query would be routed to by HandleQuery
+func (h *MysqlHandler) HandleStmtExecute(stmtContext interface{}, query string, args []interface{}) (*Result, error) {
+	st, ok := stmtContext.(*preparedStmt)
+	if !ok {
+		return nil, errors.New("Unknown prepared statement")
+	}
+	if err := h.begin(); err != nil {
+		return nil, err
+	}
+	defer h.end()
+	h.route = st.route
+	defer func() { h.route = RouteDefault }()
+	start := time.Now()
+	result, err := h.executeStmt(st, args)
+	if err == nil {
+		h.session.startStatement(st.kind)
+	} else if st.kind == sqlparser.StmtCommit || st.kind == sqlparser.StmtRollback {
+		h.session.inTrx = false
+	}
+	if err != nil && h.verbose {
+		log.Printf("HandleStmtExecute: %s, err=%v \n", st.query, err)
+	}
+	h.server.recordDigest(h.user, h.session.db, st.query, start, result, err)
+	return result, toClientError(err)
+}
+
+func (h *MysqlHandler) executeStmt(st *preparedStmt, args []interface{}) (*Result, error) {
+	sc, err := h.getConn(st.read)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := h.getStmt(sc, st)
+	if err != nil {
+		return nil, err
+	}
+	if st.resultset {
+		rows, err := stmt.QueryContext(context.Background(), args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		return buildResultset(rows, true)
+	}
+	dbresult, err := stmt.ExecContext(context.Background(), args...)
+	if err != nil {
+		return nil, err
+	}
+	num, _ := dbresult.RowsAffected()
+	insertId, _ := dbresult.LastInsertId()
+	switch st.kind {
+	case sqlparser.StmtBegin:
+		h.session.inTrx = true
+	case sqlparser.StmtCommit, sqlparser.StmtRollback:
+		h.session.inTrx = false
+	case sqlparser.StmtDDL:
+		h.session.inTrx = false
+		if st.tempTable {
+			h.session.localState = true
+		}
+	}
+	return &Result{
+		AffectedRows: uint64(num),
+		InsertId:     uint64(insertId),
+	}, nil
+}
+
+// HandleStmtClose closes the statement on the backend connections of the session
+func (h *MysqlHandler) HandleStmtClose(stmtContext interface{}) error {
+	st, ok := stmtContext.(*preparedStmt)
+	if !ok {
+		return nil
+	}
+	for _, sc := range h.session.conns() {
+		if stmt, ok := sc.stmts[st.id]; ok {
+			stmt.Close()
+			delete(sc.stmts, st.id)
+		}
+	}
+	return nil
+}
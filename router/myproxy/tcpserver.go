@@ -1,9 +1,9 @@
 package myproxy
 
 import (
-	"database/sql"
 	"log"
 	"net"
+	"sync"
 
 	siddon "github.com/siddontang/go-mysql/server"
 	"github.com/signal18/replication-manager/config"
@@ -11,7 +11,6 @@ import (
 
 type Server struct {
 	cfg      *config.Config
-	db       *sql.DB
 	addr     string
 	user     string
 	password string
@@ -20,12 +19,28 @@ type Server struct {
 	verbose bool
 
 	listener net.Listener
+
+	backendsMutex  sync.RWMutex
+	writer         *Backend
+	readers        []*Backend
+	shard          *Backend
+	readWriteSplit bool
+
+	rulesMutex sync.RWMutex
+	rules      []*QueryRule
+	ruleHits   map[uint32]*uint64
+
+	digests digestStore
+
+	pauseMutex sync.Mutex
+	pause      *pause
+	activeTrx  int64
 }
 
 // StartProxyServer start tcp proxy server for Mysql.
-func NewProxyServer(host string, user string, password string, db *sql.DB) (*Server, error) {
+// Backends are set with SetWriter and SetReaders
+func NewProxyServer(host string, user string, password string) (*Server, error) {
 	s := new(Server)
-	s.db = db
 	s.addr = host
 	s.password = password
 	s.user = user
@@ -54,22 +69,28 @@ func (s *Server) Run() {
 			continue
 		}
 
-		go s.proxyHandle(conn, s.db)
+		go s.proxyHandle(conn)
 	}
 }
 func (s *Server) Close() {
 	s.running = false
+	s.Resume()
 	if s.listener != nil {
 		s.listener.Close()
-		s.db.Close()
 	}
+	s.closeBackends()
+}
+
+// SetReadWriteSplit routes the plain SELECT to the readers when true, every query goes to the writer otherwise
+func (s *Server) SetReadWriteSplit(split bool) {
+	s.readWriteSplit = split
 }
 func (s *Server) IsRunning() bool {
 
 	return s.running
 }
 
-func (s *Server) proxyHandle(conn net.Conn, db *sql.DB) {
+func (s *Server) proxyHandle(conn net.Conn) {
 	// close connection before exit
 	defer conn.Close()
 
@@ -78,10 +99,13 @@ func (s *Server) proxyHandle(conn net.Conn, db *sql.DB) {
 	}
 	// Create a connection with user root and an empty passowrd
 	// We only an empty handler to handle command too
-	siddonconn, err := siddon.NewConn(conn, s.user, s.password, MysqlHandler{db: db, verbose: s.verbose})
+	h := newMysqlHandler(s)
+	defer h.Close()
+	siddonconn, err := siddon.NewConn(conn, s.user, s.password, h)
 	if err != nil {
 		return
 	}
+	h.user = siddonconn.GetUser()
 	//defer siddonconn.Close()
 	for s.running {
 		err := siddonconn.HandleCommand()
@@ -1,13 +1,18 @@
 package myproxy
 
 import (
+	"context"
+
 	_ "github.com/go-sql-driver/mysql"
 	siddonmysql "github.com/siddontang/go-mysql/mysql"
-	"github.com/xwb1989/sqlparser"
 )
 
-func (h MysqlHandler) handleUpdate(update *sqlparser.Update) (*siddonmysql.Result, error) {
-	result, err := h.updateDB(sqlparser.String(update))
+func (h *MysqlHandler) handleUpdate(update string) (*siddonmysql.Result, error) {
+	sc, err := h.getWriterConn()
+	if err != nil {
+		return nil, err
+	}
+	result, err := h.updateDB(sc, update)
 	if err != nil {
 		return nil, err
 	}
@@ -15,9 +20,9 @@ func (h MysqlHandler) handleUpdate(update *sqlparser.Update) (*siddonmysql.Resul
 }
 
 // updateDB is responsable for doing update Mysql
-func (h MysqlHandler) updateDB(update string) (*siddonmysql.Result, error) {
+func (h *MysqlHandler) updateDB(sc *sessionConn, update string) (*siddonmysql.Result, error) {
 	// 1. Exec mysql update
-	dbresult, err := h.db.Exec(update)
+	dbresult, err := sc.conn.ExecContext(context.Background(), update)
 	if err != nil {
 		return nil, err
 	}
@@ -22,12 +22,11 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/codegangsta/negroni"
-	jwt "github.com/dgrijalva/jwt-go"
-	"github.com/dgrijalva/jwt-go/request"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/signal18/replication-manager/cluster"
 	"github.com/signal18/replication-manager/regtest"
+	"github.com/signal18/replication-manager/utils/prometheus"
 )
 
 //RSA KEYS AND INITIALISATION
@@ -101,13 +100,18 @@ type token struct {
 
 func (repman *ReplicationManager) apiserver() {
 	repman.initKeys()
+	repman.initOIDC()
+	repman.initAudit()
 	//PUBLIC ENDPOINTS
 	router := mux.NewRouter()
+	router.Use(repman.auditMiddleware)
 	router.HandleFunc("/", repman.handlerApp)
 	// page to view which does not need authorization
 	router.PathPrefix("/static/").Handler(http.FileServer(http.Dir(repman.Conf.HttpRoot)))
 	router.PathPrefix("/app/").Handler(http.FileServer(http.Dir(repman.Conf.HttpRoot)))
 	router.HandleFunc("/api/login", repman.loginHandler)
+	router.HandleFunc("/api/auth/oidc/login", repman.handlerOIDCLogin)
+	router.HandleFunc("/api/auth/oidc/callback", repman.handlerOIDCCallback)
 	router.Handle("/api/clusters", negroni.New(
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusters)),
 	))
@@ -142,6 +146,8 @@ func (repman *ReplicationManager) apiserver() {
 	repman.apiClusterUnprotectedHandler(router)
 	repman.apiClusterProtectedHandler(router)
 	repman.apiProxyProtectedHandler(router)
+	repman.apiTokenProtectedHandler(router)
+	repman.apiAuditProtectedHandler(router)
 
 	log.Info("Starting HTTPS & JWT API on " + repman.Conf.APIBind + ":" + repman.Conf.APIPort)
 	var err error
@@ -163,20 +169,34 @@ func (repman *ReplicationManager) apiserver() {
 /////////////////////////////////////////
 
 func (repman *ReplicationManager) IsValidClusterACL(r *http.Request, cluster *cluster.Cluster) bool {
+	return repman.IsValidClusterURLACL(r, cluster, r.URL.Path)
+}
 
-	token, err := request.ParseFromRequest(r, request.AuthorizationHeaderExtractor, func(token *jwt.Token) (interface{}, error) {
-		vk, _ := jwt.ParseRSAPublicKeyFromPEM(verificationKey)
-		return vk, nil
-	})
-	if err == nil {
-		claims := token.Claims.(jwt.MapClaims)
-		userinfo := claims["CustomUserInfo"]
-		mycutinfo := userinfo.(map[string]interface{})
-		meuser := mycutinfo["Name"].(string)
-		mepwd := mycutinfo["Password"].(string)
-		return cluster.IsValidACL(meuser, mepwd, r.URL.Path)
+// IsValidClusterURLACL checks the user of a request against another URL than the requested one
+func (repman *ReplicationManager) IsValidClusterURLACL(r *http.Request, cluster *cluster.Cluster, URL string) bool {
+	id, err := repman.getIdentity(r)
+	if err != nil {
+		return false
+	}
+	if id.Token != "" {
+		return cluster.IsValidTokenACL(id.Token, URL)
 	}
-	return false
+	if id.Oidc {
+		return cluster.IsValidGroupsACL(id.User, id.Groups, URL)
+	}
+	if id.Ldap {
+		return cluster.IsValidLdapACL(id.User, URL)
+	}
+	return cluster.IsValidACL(id.User, id.Password, URL)
+}
+
+// getUserFromRequest returns the user name of the JWT token of the request
+func (repman *ReplicationManager) getUserFromRequest(r *http.Request) string {
+	id, err := repman.getIdentity(r)
+	if err != nil {
+		return ""
+	}
+	return id.User
 }
 
 func (repman *ReplicationManager) loginHandler(w http.ResponseWriter, r *http.Request) {
@@ -196,23 +216,12 @@ func (repman *ReplicationManager) loginHandler(w http.ResponseWriter, r *http.Re
 
 		if cluster.IsValidACL(user.Username, user.Password, r.URL.Path) {
 
-			signer := jwt.New(jwt.SigningMethodRS256)
-			claims := signer.Claims.(jwt.MapClaims)
-			//set claims
-			claims["iss"] = "https://api.replication-manager.signal18.io"
-			claims["iat"] = time.Now().Unix()
-			claims["exp"] = time.Now().Add(time.Minute * 120).Unix()
-			claims["jti"] = "1" // should be user ID(?)
-			claims["CustomUserInfo"] = struct {
-				Name     string
-				Role     string
-				Password string
-			}{user.Username, "Member", user.Password}
-			signer.Claims = claims
-			sk, _ := jwt.ParseRSAPrivateKeyFromPEM(signingKey)
-			//sk, _ := jwt.ParseRSAPublicKeyFromPEM(signingKey)
-
-			tokenString, err := signer.SignedString(sk)
+			role, password := "Member", user.Password
+			if cluster.IsLdapUser(user.Username) {
+				// the directory password is never kept in the token
+				role, password = ldapRole, ""
+			}
+			tokenString, err := repman.signUserToken(user.Username, role, password, nil)
 
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
@@ -301,19 +310,10 @@ func (repman *ReplicationManager) handlerMuxClusters(w http.ResponseWriter, r *h
 func (repman *ReplicationManager) validateTokenMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	//validate token
-	token, err := request.ParseFromRequest(r, request.AuthorizationHeaderExtractor,
-		func(token *jwt.Token) (interface{}, error) {
-			vk, _ := jwt.ParseRSAPublicKeyFromPEM(verificationKey)
-			return vk, nil
-		})
+	_, err := repman.getIdentity(r)
 
 	if err == nil {
-		if token.Valid {
-			next(w, r)
-		} else {
-			w.WriteHeader(http.StatusUnauthorized)
-			fmt.Fprint(w, "Token is not valid")
-		}
+		next(w, r)
 	} else {
 		w.WriteHeader(http.StatusUnauthorized)
 		fmt.Fprint(w, "Unauthorised access to this resource"+err.Error())
@@ -345,12 +345,17 @@ func (repman *ReplicationManager) handlerMuxClusterAdd(w http.ResponseWriter, r
 func (repman *ReplicationManager) handlerMuxPrometheus(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	for _, cluster := range repman.Clusters {
-		for _, server := range cluster.Servers {
-			res := server.GetPrometheusMetrics()
-			w.Write([]byte(res))
-		}
+	w.Header().Set("Content-Type", prometheus.ContentType)
+	reg := prometheus.NewRegistry()
+	names := make([]string, 0, len(repman.Clusters))
+	for name := range repman.Clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		repman.Clusters[name].CollectPrometheusMetrics(reg)
 	}
+	reg.WriteTo(w)
 }
 
 func (repman *ReplicationManager) handlerMuxClustersOld(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,248 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Author: Stephane Varoqui  <svaroqui@gmail.com>
+// License: GNU General Public License, version 3. Redistribution/Reuse of this code is permitted under the GNU v3 license, as an additional term ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/negroni"
+	"github.com/gorilla/mux"
+	"github.com/signal18/replication-manager/cluster"
+	"github.com/signal18/replication-manager/utils/s18log"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	auditDefaultLimit = 100
+	auditMaxLimit     = 10000
+	auditMask         = "XXXXXXXX"
+)
+
+// auditReadOnlyActions are the actions not changing the clusters
+var auditReadOnlyActions = []string{
+	"/actions/waitdatabases",
+	"/actions/switchover/plan",
+	"/actions/explain-pfs",
+	"/actions/explain-slowlog",
+	"/actions/analyze-pfs",
+	"/actions/analyze-slowlog",
+	"/actions/wait-innodb-purge",
+}
+
+// auditSensitiveNames are the parts of the setting and parameter names whose values are masked
+var auditSensitiveNames = []string{"pass", "credential", "secret", "key", "token"}
+
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *auditResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (repman *ReplicationManager) initAudit() {
+	if !repman.Conf.APIAuditLog {
+		return
+	}
+	path := repman.Conf.APIAuditFile
+	if path == "" {
+		path = repman.Conf.WorkingDir + "/audit.log"
+	}
+	audit, err := s18log.NewAuditLog(path, repman.Conf.APIAuditSyslog)
+	if audit == nil {
+		log.Errorf("Could not open audit log %s: %s", path, err)
+		return
+	}
+	if err != nil {
+		log.Errorf("Could not connect audit log to syslog: %s", err)
+	}
+	repman.audit = audit
+	log.Infof("Audit of the API actions in %s", path)
+}
+
+func (repman *ReplicationManager) apiAuditProtectedHandler(router *mux.Router) {
+	router.Handle("/api/clusters/{clusterName}/audit", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterAudit)),
+	))
+}
+
+// isAuditedRequest returns true for the routes changing the clusters or the monitor
+func isAuditedRequest(r *http.Request, endpoint string) bool {
+	if endpoint == "/api/monitor/tokens" {
+		return r.Method == http.MethodPost
+	}
+	if !strings.Contains(endpoint, "/actions/") {
+		return false
+	}
+	for _, a := range auditReadOnlyActions {
+		if strings.HasSuffix(endpoint, a) {
+			return false
+		}
+	}
+	return true
+}
+
+func isAuditSensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range auditSensitiveNames {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// getAuditParameters returns the route variables and the form values of a request, the values of the
+// sensitive settings and parameters are masked
+func getAuditParameters(r *http.Request) map[string]string {
+	params := make(map[string]string)
+	vars := mux.Vars(r)
+	for k, v := range vars {
+		if k == "clusterName" {
+			continue
+		}
+		params[k] = v
+	}
+	if _, ok := params["settingValue"]; ok && isAuditSensitive(vars["settingName"]) {
+		params["settingValue"] = auditMask
+	}
+	form := r.Form
+	if form == nil {
+		form = r.URL.Query()
+	}
+	for k, v := range form {
+		if _, ok := params[k]; ok {
+			continue
+		}
+		if isAuditSensitive(k) {
+			params[k] = auditMask
+		} else {
+			params[k] = strings.Join(v, ",")
+		}
+	}
+	return params
+}
+
+// auditMiddleware records the user, source, parameters, status and duration of the actions
+func (repman *ReplicationManager) auditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var endpoint string
+		if route := mux.CurrentRoute(r); route != nil {
+			endpoint, _ = route.GetPathTemplate()
+		}
+		if repman.audit == nil || !isAuditedRequest(r, endpoint) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		aw := &auditResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(aw, r)
+		if aw.status == 0 {
+			aw.status = http.StatusOK
+		}
+		source, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			source = r.RemoteAddr
+		}
+		record := s18log.AuditRecord{
+			Timestamp:  start,
+			User:       repman.getUserFromRequest(r),
+			Source:     source,
+			Cluster:    mux.Vars(r)["clusterName"],
+			Method:     r.Method,
+			Endpoint:   endpoint,
+			Parameters: getAuditParameters(r),
+			Status:     aw.status,
+			Result:     "success",
+			Duration:   time.Since(start).Seconds(),
+		}
+		if aw.status >= http.StatusBadRequest {
+			record.Result = "failure"
+		}
+		if err := repman.audit.Add(record); err != nil {
+			log.Errorf("Could not write audit record: %s", err)
+		}
+	})
+}
+
+// handlerMuxClusterAudit returns the latest actions on a cluster, newest first, filtered by user, from and to
+// RFC 3339 times, up to limit records
+func (repman *ReplicationManager) handlerMuxClusterAudit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster == nil {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+	if !repman.IsValidClusterACL(r, mycluster) {
+		http.Error(w, "No valid ACL", 403)
+		return
+	}
+	if repman.audit == nil {
+		http.Error(w, "Audit log is disabled", http.StatusNotFound)
+		return
+	}
+	filter := s18log.AuditFilter{
+		Cluster: mycluster.Name,
+		User:    r.URL.Query().Get("user"),
+		Limit:   auditDefaultLimit,
+	}
+	var err error
+	if v := r.URL.Query().Get("from"); v != "" {
+		if filter.From, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "Invalid from: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		if filter.To, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "Invalid to: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit <= 0 || filter.Limit > auditMaxLimit {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	records, err := repman.audit.Search(filter)
+	if err != nil {
+		mycluster.LogPrintf(cluster.LvlErr, "Could not read audit log: %s", err)
+		http.Error(w, "Could not read audit log", 500)
+		return
+	}
+	if records == nil {
+		records = []s18log.AuditRecord{}
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	err = e.Encode(records)
+	if err != nil {
+		mycluster.LogPrintf(cluster.LvlErr, "API Error encoding JSON: %s", err)
+		http.Error(w, "Encoding error", 500)
+		return
+	}
+}
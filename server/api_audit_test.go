@@ -0,0 +1,96 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Author: Stephane Varoqui  <svaroqui@gmail.com>
+// License: GNU General Public License, version 3. Redistribution/Reuse of this code is permitted under the GNU v3 license, as an additional term ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestIsAuditedRequest(t *testing.T) {
+	for _, c := range []struct {
+		method   string
+		endpoint string
+		audited  bool
+	}{
+		{"GET", "/api/clusters/{clusterName}/actions/switchover", true},
+		{"POST", "/api/clusters/{clusterName}/servers/{serverName}/actions/stop", true},
+		{"GET", "/api/clusters/{clusterName}/settings/actions/set/{settingName}/{settingValue}", true},
+		{"GET", "/api/clusters/{clusterName}/actions/switchover/plan", false},
+		{"GET", "/api/clusters/{clusterName}/actions/waitdatabases", false},
+		{"GET", "/api/clusters/{clusterName}/servers/{serverName}/actions/analyze-slowlog", false},
+		{"GET", "/api/clusters/{clusterName}/topology/servers", false},
+		{"POST", "/api/monitor/tokens", true},
+		{"GET", "/api/monitor/tokens", false},
+		{"GET", "", false},
+	} {
+		r := httptest.NewRequest(c.method, "/", nil)
+		if isAuditedRequest(r, c.endpoint) != c.audited {
+			t.Errorf("Expected %s %s audited %t", c.method, c.endpoint, c.audited)
+		}
+	}
+}
+
+func TestIsAuditSensitive(t *testing.T) {
+	for name, sensitive := range map[string]bool{
+		"db-servers-credential":       true,
+		"api-credentials":             true,
+		"monitoring-save-config":      false,
+		"alert-webhook-secret":        true,
+		"alert-pagerduty-routing-key": true,
+		"Password":                    true,
+		"api-token-ttl":               true,
+		"prefmaster":                  false,
+		"failover-mode":               false,
+	} {
+		if isAuditSensitive(name) != sensitive {
+			t.Errorf("Expected %s sensitive %t", name, sensitive)
+		}
+	}
+}
+
+func TestGetAuditParameters(t *testing.T) {
+	for _, c := range []struct {
+		url    string
+		vars   map[string]string
+		params map[string]string
+	}{
+		{
+			"/api/clusters/c1/actions/switchover?prefmaster=db2:3306",
+			map[string]string{"clusterName": "c1"},
+			map[string]string{"prefmaster": "db2:3306"},
+		},
+		{
+			"/api/clusters/c1/settings/actions/set/db-servers-credential/root:secret",
+			map[string]string{"clusterName": "c1", "settingName": "db-servers-credential", "settingValue": "root:secret"},
+			map[string]string{"settingName": "db-servers-credential", "settingValue": auditMask},
+		},
+		{
+			"/api/clusters/c1/settings/actions/set/failover-limit/3",
+			map[string]string{"clusterName": "c1", "settingName": "failover-limit", "settingValue": "3"},
+			map[string]string{"settingName": "failover-limit", "settingValue": "3"},
+		},
+		{
+			"/api/clusters/c1/servers/db1/actions/delayed-extract?filter=id:gt:10&filter=name:like:a%25&password=x",
+			map[string]string{"clusterName": "c1", "serverName": "db1"},
+			map[string]string{"serverName": "db1", "filter": "id:gt:10,name:like:a%", "password": auditMask},
+		},
+		{
+			"/api/clusters/c1/actions/replication/bootstrap/master-slave?topology=ring",
+			map[string]string{"clusterName": "c1", "topology": "master-slave"},
+			map[string]string{"topology": "master-slave"},
+		},
+	} {
+		r := mux.SetURLVars(httptest.NewRequest("GET", c.url, nil), c.vars)
+		if params := getAuditParameters(r); !reflect.DeepEqual(params, c.params) {
+			t.Errorf("Expected %s parameters %v, got %v", c.url, c.params, params)
+		}
+	}
+}
@@ -7,11 +7,13 @@
 package server
 
 import (
+	"database/sql"
 	"encoding/json"
 	"io"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/codegangsta/negroni"
 	log "github.com/sirupsen/logrus"
@@ -20,6 +22,7 @@ import (
 	"github.com/signal18/replication-manager/cluster"
 	"github.com/signal18/replication-manager/config"
 	"github.com/signal18/replication-manager/regtest"
+	"github.com/signal18/replication-manager/utils/alert"
 )
 
 func (repman *ReplicationManager) apiClusterUnprotectedHandler(router *mux.Router) {
@@ -54,6 +57,14 @@ func (repman *ReplicationManager) apiClusterProtectedHandler(router *mux.Router)
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterBackups)),
 	))
+	router.Handle("/api/clusters/{clusterName}/backups/catalog", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterBackupCatalog)),
+	))
+	router.Handle("/api/clusters/{clusterName}/actions/backup-verify", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterBackupVerify)),
+	))
 
 	router.Handle("/api/clusters/{clusterName}/certificates", negroni.New(
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
@@ -64,6 +75,14 @@ func (repman *ReplicationManager) apiClusterProtectedHandler(router *mux.Router)
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterQueryRules)),
 	))
+	router.Handle("/api/clusters/{clusterName}/queryrules/actions/add", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterQueryRuleAdd)),
+	))
+	router.Handle("/api/clusters/{clusterName}/queryrules/{ruleId}/actions/delete", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterQueryRuleDelete)),
+	))
 	router.Handle("/api/clusters/{clusterName}/shardclusters", negroni.New(
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterShardClusters)),
@@ -114,6 +133,10 @@ func (repman *ReplicationManager) apiClusterProtectedHandler(router *mux.Router)
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxSwitchover)),
 	))
+	router.Handle("/api/clusters/{clusterName}/actions/switchover/plan", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxSwitchoverPlan)),
+	))
 	router.Handle("/api/clusters/{clusterName}/actions/failover", negroni.New(
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxFailover)),
@@ -257,6 +280,34 @@ func (repman *ReplicationManager) apiClusterProtectedHandler(router *mux.Router)
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxCrashes)),
 	))
+	router.Handle("/api/clusters/{clusterName}/alerts/routes", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxAlertRoutes)),
+	))
+	router.Handle("/api/clusters/{clusterName}/alerts/silences", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxAlertSilences)),
+	))
+	router.Handle("/api/clusters/{clusterName}/alerts/silences/actions/add", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxAlertSilenceAdd)),
+	))
+	router.Handle("/api/clusters/{clusterName}/alerts/silences/{silenceId}/actions/delete", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxAlertSilenceDelete)),
+	))
+	router.Handle("/api/clusters/{clusterName}/failovers", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxFailovers)),
+	))
+	router.Handle("/api/clusters/{clusterName}/failovers/{failoverId}", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxFailoverEvent)),
+	))
+	router.Handle("/api/clusters/{clusterName}/topology/election", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxElection)),
+	))
 	//PROTECTED ENDPOINTS FOR TESTS
 
 	router.Handle("/api/clusters/{clusterName}/tests/actions/run/all", negroni.New(
@@ -852,6 +903,67 @@ func (repman *ReplicationManager) handlerMuxClusterTags(w http.ResponseWriter, r
 	}
 }
 
+func (repman *ReplicationManager) handlerMuxSwitchoverPlan(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		r.ParseForm() // Parses the request body
+		fail := r.Form.Get("failover") == "true"
+		// a failover plan needs the grant of the failover action
+		if fail && !repman.IsValidClusterURLACL(r, mycluster, "/api/clusters/"+mycluster.Name+"/actions/failover") {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		if !fail && mycluster.IsMasterFailed() {
+			http.Error(w, "Master failed", http.StatusBadRequest)
+			return
+		}
+		// like the switchover, a prefered master not found in database servers is ignored
+		prefMaster := r.Form.Get("prefmaster")
+		if !mycluster.IsInHostList(prefMaster) {
+			prefMaster = ""
+		}
+		plan := mycluster.GetFailoverPlan(fail, prefMaster)
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(plan)
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxClusterBackupCatalog(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetBackupCatalog())
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
 func (repman *ReplicationManager) handlerMuxClusterBackups(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	vars := mux.Vars(r)
@@ -918,6 +1030,103 @@ func (repman *ReplicationManager) handlerMuxClusterQueryRules(w http.ResponseWri
 	}
 }
 
+func (repman *ReplicationManager) handlerMuxClusterQueryRuleAdd(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		r.ParseForm() // Parses the request body
+		rule := config.QueryRule{Active: 1, Proxies: r.Form.Get("proxies")}
+		for field, value := range map[string]*sql.NullString{
+			"user":            &rule.UserName,
+			"schema":          &rule.SchemaName,
+			"digest":          &rule.Digest,
+			"match-digest":    &rule.Match_Digest,
+			"match-pattern":   &rule.Match_Pattern,
+			"replace-pattern": &rule.ReplacePattern,
+			"error-msg":       &rule.ErrorMsg,
+		} {
+			if v := r.Form.Get(field); v != "" {
+				*value = sql.NullString{String: v, Valid: true}
+			}
+		}
+		var err error
+		if v := r.Form.Get("id"); v != "" {
+			id, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				http.Error(w, "Invalid id: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			rule.Id = uint32(id)
+		}
+		if v := r.Form.Get("destination-hostgroup"); v != "" {
+			rule.DestinationHostgroup.Int64, err = strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid destination hostgroup: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			rule.DestinationHostgroup.Valid = true
+		}
+		if v := r.Form.Get("rate-limit"); v != "" {
+			rule.RateLimit, err = strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid rate limit: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if r.Form.Get("apply") == "1" || r.Form.Get("apply") == "true" {
+			rule.Apply = 1
+		}
+		if r.Form.Get("active") == "0" || r.Form.Get("active") == "false" {
+			rule.Active = 0
+		}
+		rule, err = mycluster.AddQueryRule(rule)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err = e.Encode(rule)
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxClusterQueryRuleDelete(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		id, err := strconv.ParseUint(vars["ruleId"], 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid rule id", http.StatusBadRequest)
+			return
+		}
+		err = mycluster.DeleteQueryRule(uint32(id))
+		if err != nil {
+			http.Error(w, err.Error(), 404)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
 func (repman *ReplicationManager) handlerMuxSwitchSettings(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -978,6 +1187,8 @@ func (repman *ReplicationManager) handlerMuxSwitchSettings(w http.ResponseWriter
 			mycluster.SwitchSchedulerBackupLogical()
 		case "scheduler-db-servers-physical-backup":
 			mycluster.SwitchSchedulerBackupPhysical()
+		case "scheduler-db-servers-backup-verify":
+			mycluster.SwitchSchedulerBackupVerify()
 		case "scheduler-db-servers-logs":
 			mycluster.SwitchSchedulerDatabaseLogs()
 		case "scheduler-jobs-ssh":
@@ -1027,6 +1238,8 @@ func (repman *ReplicationManager) handlerMuxSwitchSettings(w http.ResponseWriter
 			mycluster.SwitchProvDockerDaemonPrivate()
 		case "backup-restic":
 			mycluster.SwitchBackupRestic()
+		case "backup-s3":
+			mycluster.SwitchBackupS3()
 		case "backup-binlogs":
 			mycluster.SwitchBackupBinlogs()
 		case "monitoring-save-config":
@@ -1174,6 +1387,8 @@ func (repman *ReplicationManager) handlerMuxSetSettings(w http.ResponseWriter, r
 			mycluster.SetSchedulerDbServersOptimizeCron(vars["settingValue"])
 		case "scheduler-db-servers-physical-backup-cron":
 			mycluster.SetSchedulerDbServersPhysicalBackupCron(vars["settingValue"])
+		case "scheduler-db-servers-backup-verify-cron":
+			mycluster.SetSchedulerDbServersBackupVerifyCron(vars["settingValue"])
 		case "scheduler-rolling-reprov-cron":
 			mycluster.SetSchedulerRollingReprovCron(vars["settingValue"])
 		case "scheduler-rolling-restart-cron":
@@ -1314,6 +1529,191 @@ func (repman *ReplicationManager) handlerMuxCrashes(w http.ResponseWriter, r *ht
 	}
 }
 
+func (repman *ReplicationManager) handlerMuxAlertRoutes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetAlertRoutes())
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxAlertSilences(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetAlertSilences())
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxAlertSilenceAdd(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		r.ParseForm() // Parses the request body
+		s := alert.Silence{
+			Server:  r.Form.Get("server"),
+			Key:     r.Form.Get("key"),
+			Comment: r.Form.Get("comment"),
+			User:    repman.getUserFromRequest(r),
+		}
+		var err error
+		if r.Form.Get("start") != "" {
+			s.Start, err = time.Parse(time.RFC3339, r.Form.Get("start"))
+			if err != nil {
+				http.Error(w, "Invalid start: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if r.Form.Get("end") != "" {
+			s.End, err = time.Parse(time.RFC3339, r.Form.Get("end"))
+			if err != nil {
+				http.Error(w, "Invalid end: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		} else {
+			duration, err := time.ParseDuration(r.Form.Get("duration"))
+			if err != nil {
+				http.Error(w, "Silence needs an end or a duration", http.StatusBadRequest)
+				return
+			}
+			if s.Start.IsZero() {
+				s.Start = time.Now()
+			}
+			s.End = s.Start.Add(duration)
+		}
+		s, err = mycluster.AddAlertSilence(s)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err = e.Encode(s)
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxAlertSilenceDelete(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		err := mycluster.DeleteAlertSilence(vars["silenceId"])
+		if err != nil {
+			http.Error(w, err.Error(), 404)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxFailovers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetFailoverJournal())
+		if err != nil {
+			log.Println("Error encoding JSON: ", err)
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "Cluster Not Found", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxFailoverEvent(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		event := mycluster.GetFailoverEvent(vars["failoverId"])
+		if event == nil {
+			http.Error(w, "Failover Not Found", 404)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(event)
+		if err != nil {
+			log.Println("Error encoding JSON: ", err)
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "Cluster Not Found", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxElection(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetElectionCandidatesScores())
+		if err != nil {
+			log.Println("Error encoding JSON: ", err)
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "Cluster Not Found", 500)
+		return
+	}
+}
+
 func (repman *ReplicationManager) handlerMuxOneTest(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	vars := mux.Vars(r)
@@ -1475,6 +1875,27 @@ func (repman *ReplicationManager) handlerMuxClusterMasterPhysicalBackup(w http.R
 	}
 }
 
+func (repman *ReplicationManager) handlerMuxClusterBackupVerify(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		if mycluster.GetLastRestorableBackup() == nil {
+			http.Error(w, "No logical backup to verify in the backup catalog", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		go mycluster.JobVerifyBackup()
+	} else {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "No cluster found:"+vars["clusterName"])
+	}
+}
+
 func (repman *ReplicationManager) handlerMuxClusterOptimize(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	vars := mux.Vars(r)
@@ -0,0 +1,262 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Author: Stephane Varoqui  <svaroqui@gmail.com>
+// License: GNU General Public License, version 3. Redistribution/Reuse of this code is permitted under the GNU v3 license, as an additional term ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/dgrijalva/jwt-go/request"
+	"github.com/signal18/replication-manager/cluster"
+	"github.com/signal18/replication-manager/utils/oidc"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	apiTokenIssuer  = "https://api.replication-manager.signal18.io"
+	apiTokenTTL     = 120 * time.Minute
+	oidcRole        = "oidc"
+	ldapRole        = "ldap"
+	oidcStateCookie = "repman_oidc_state"
+	oidcStateTTL    = 10 * time.Minute
+)
+
+// apiIdentity is the user of an API request, either a local user checked with its password on each
+// request, a user of the LDAP directory looked up on each request, a user of the OpenID provider granted
+// by its groups or an API token checked by each cluster
+type apiIdentity struct {
+	User     string
+	Password string
+	Groups   []string
+	Oidc     bool
+	Ldap     bool
+	Token    string
+}
+
+func (repman *ReplicationManager) initOIDC() {
+	if repman.Conf.APIOIDCIssuer == "" {
+		return
+	}
+	p := oidc.NewProvider(repman.Conf.APIOIDCIssuer, repman.Conf.APIOIDCClientId, repman.Conf.APIOIDCClientSecret, repman.Conf.APIOIDCRedirectURL)
+	p.JwksURL = repman.Conf.APIOIDCJwksURL
+	p.Audience = repman.Conf.APIOIDCAudience
+	if scopes := strings.Fields(repman.Conf.APIOIDCScopes); len(scopes) > 0 {
+		p.Scopes = scopes
+	}
+	repman.oidc = p
+	log.Infof("OpenID Connect login with issuer %s", p.Issuer)
+}
+
+// signUserToken returns a token of the monitor for a user, the password of a local user is checked again on each
+// request, a LDAP user has no password in its token
+func (repman *ReplicationManager) signUserToken(user string, role string, password string, groups []string) (string, error) {
+	return repman.signUserTokenUntil(user, role, password, groups, time.Now().Add(apiTokenTTL))
+}
+
+// signUserTokenUntil returns a token of the monitor for a user expiring at exp
+func (repman *ReplicationManager) signUserTokenUntil(user string, role string, password string, groups []string, exp time.Time) (string, error) {
+	claims := jwt.MapClaims{
+		"iss": apiTokenIssuer,
+		"iat": time.Now().Unix(),
+		"exp": exp.Unix(),
+		"jti": "1", // should be user ID(?)
+		"CustomUserInfo": struct {
+			Name     string
+			Role     string
+			Password string
+			Groups   []string `json:",omitempty"`
+		}{user, role, password, groups},
+	}
+	return repman.signClaims(claims)
+}
+
+func (repman *ReplicationManager) signClaims(claims jwt.MapClaims) (string, error) {
+	sk, err := jwt.ParseRSAPrivateKeyFromPEM(signingKey)
+	if err != nil {
+		return "", err
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(sk)
+}
+
+func localKeyFunc(token *jwt.Token) (interface{}, error) {
+	return jwt.ParseRSAPublicKeyFromPEM(verificationKey)
+}
+
+// apiKeyFunc returns the key verifying a bearer token: the keys of the issuer JWKS for the tokens of the
+// OpenID provider, the key of the monitor for the others
+func (repman *ReplicationManager) apiKeyFunc(token *jwt.Token) (interface{}, error) {
+	if repman.oidc != nil {
+		if claims, ok := token.Claims.(jwt.MapClaims); ok && repman.oidc.IsIssuer(claims) {
+			return repman.oidc.KeyFunc(token)
+		}
+	}
+	return localKeyFunc(token)
+}
+
+// getIdentity validates the bearer token of a request and returns its user
+func (repman *ReplicationManager) getIdentity(r *http.Request) (*apiIdentity, error) {
+	if bearer, err := request.AuthorizationHeaderExtractor.ExtractToken(r); err == nil && strings.HasPrefix(bearer, cluster.APITokenPrefix) {
+		return repman.getTokenIdentity(bearer)
+	}
+	token, err := request.ParseFromRequest(r, request.AuthorizationHeaderExtractor, repman.apiKeyFunc)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("Token is not valid")
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	if repman.oidc != nil && repman.oidc.IsIssuer(claims) {
+		if err := repman.oidc.VerifyClaims(claims); err != nil {
+			return nil, err
+		}
+		return repman.getOIDCIdentity(claims), nil
+	}
+	userinfo, ok := claims["CustomUserInfo"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("Token has no user")
+	}
+	id := new(apiIdentity)
+	id.User, _ = userinfo["Name"].(string)
+	id.Password, _ = userinfo["Password"].(string)
+	switch role, _ := userinfo["Role"].(string); role {
+	case oidcRole:
+		id.Oidc = true
+		id.Groups = oidc.GetClaimStrings(jwt.MapClaims(userinfo), "Groups")
+	case ldapRole:
+		id.Ldap = true
+		id.Password = ""
+	}
+	return id, nil
+}
+
+func (repman *ReplicationManager) getOIDCIdentity(claims jwt.MapClaims) *apiIdentity {
+	return &apiIdentity{
+		User:   oidc.GetUser(claims, repman.Conf.APIOIDCUserClaim, "email"),
+		Groups: oidc.GetClaimStrings(claims, repman.Conf.APIOIDCGroupsClaim),
+		Oidc:   true,
+	}
+}
+
+// getOIDCTokenExpire returns the expiry of a token of the monitor for an id token, the token does not outlive the
+// id token
+func getOIDCTokenExpire(idclaims jwt.MapClaims, now time.Time) time.Time {
+	exp := now.Add(apiTokenTTL)
+	if v, ok := idclaims["exp"].(float64); ok && time.Unix(int64(v), 0).Before(exp) {
+		exp = time.Unix(int64(v), 0)
+	}
+	return exp
+}
+
+// isLocalRedirect accepts the paths of the monitor only
+func isLocalRedirect(u string) bool {
+	return strings.HasPrefix(u, "/") && !strings.HasPrefix(u, "//") && !strings.Contains(u, "\\")
+}
+
+// handlerOIDCLogin redirects to the authorization endpoint of the OpenID provider, the state is a short lived token
+// of the monitor bound to the user agent by a cookie, it carries the page to return to after the callback. Its nonce
+// is also the OpenID nonce the id token must hold.
+func (repman *ReplicationManager) handlerOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if repman.oidc == nil {
+		http.Error(w, "OpenID Connect is not configured", http.StatusNotFound)
+		return
+	}
+	b := make([]byte, 16)
+	if _, err := cryptorand.Read(b); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	nonce := hex.EncodeToString(b)
+	redirect := r.URL.Query().Get("redirect")
+	if !isLocalRedirect(redirect) {
+		redirect = ""
+	}
+	state, err := repman.signClaims(jwt.MapClaims{
+		"iss":      apiTokenIssuer,
+		"exp":      time.Now().Add(oidcStateTTL).Unix(),
+		"nonce":    nonce,
+		"redirect": redirect,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	u, err := repman.oidc.AuthCodeURL(state, nonce)
+	if err != nil {
+		http.Error(w, "OpenID provider discovery failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Value: nonce, Path: "/api/auth/oidc", MaxAge: int(oidcStateTTL / time.Second), HttpOnly: true, Secure: true})
+	http.Redirect(w, r, u, http.StatusFound)
+}
+
+// handlerOIDCCallback exchanges the authorization code and returns a token of the monitor holding the groups
+// of the user and expiring with the id token at most, the token is appended to the fragment of the page given at login
+func (repman *ReplicationManager) handlerOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if repman.oidc == nil {
+		http.Error(w, "OpenID Connect is not configured", http.StatusNotFound)
+		return
+	}
+	if e := r.FormValue("error"); e != "" {
+		http.Error(w, "OpenID login failed: "+e+" "+r.FormValue("error_description"), http.StatusForbidden)
+		return
+	}
+	state, err := jwt.Parse(r.FormValue("state"), func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("Unexpected signing method %v", token.Header["alg"])
+		}
+		return localKeyFunc(token)
+	})
+	if err != nil || !state.Valid {
+		http.Error(w, "Invalid OpenID login state", http.StatusForbidden)
+		return
+	}
+	claims := state.Claims.(jwt.MapClaims)
+	nonce, _ := claims["nonce"].(string)
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || nonce == "" || cookie.Value != nonce {
+		http.Error(w, "OpenID login state does not match the user agent", http.StatusForbidden)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/api/auth/oidc", MaxAge: -1, HttpOnly: true, Secure: true})
+
+	tr, err := repman.oidc.Exchange(r.FormValue("code"))
+	if err != nil {
+		log.Errorf("OpenID code exchange failed: %s", err)
+		http.Error(w, "OpenID code exchange failed", http.StatusForbidden)
+		return
+	}
+	idclaims, err := repman.oidc.Verify(tr.IdToken)
+	if err != nil {
+		log.Errorf("OpenID id token rejected: %s", err)
+		http.Error(w, "OpenID id token rejected", http.StatusForbidden)
+		return
+	}
+	if !oidc.HasClaim(idclaims, "nonce", nonce) {
+		log.Errorf("OpenID id token rejected: nonce mismatch")
+		http.Error(w, "OpenID id token rejected", http.StatusForbidden)
+		return
+	}
+	id := repman.getOIDCIdentity(idclaims)
+	tokenString, err := repman.signUserTokenUntil(id.User, oidcRole, "", id.Groups, getOIDCTokenExpire(idclaims, time.Now()))
+	if err != nil {
+		http.Error(w, "Error while signing the token", http.StatusInternalServerError)
+		return
+	}
+	log.Infof("OpenID login of user %s with groups %s", id.User, strings.Join(id.Groups, " "))
+	if redirect, _ := claims["redirect"].(string); isLocalRedirect(redirect) {
+		http.Redirect(w, r, redirect+"#token="+tokenString, http.StatusFound)
+		return
+	}
+	repman.jsonResponse(token{tokenString}, w)
+}
@@ -0,0 +1,30 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Author: Stephane Varoqui  <svaroqui@gmail.com>
+// License: GNU General Public License, version 3. Redistribution/Reuse of this code is permitted under the GNU v3 license, as an additional term ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func TestOIDCTokenExpire(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	for name, c := range map[string]struct {
+		claims jwt.MapClaims
+		exp    time.Time
+	}{
+		"short id token": {jwt.MapClaims{"exp": float64(now.Add(5 * time.Minute).Unix())}, now.Add(5 * time.Minute)},
+		"long id token":  {jwt.MapClaims{"exp": float64(now.Add(24 * time.Hour).Unix())}, now.Add(apiTokenTTL)},
+		"no expiry":      {jwt.MapClaims{}, now.Add(apiTokenTTL)},
+	} {
+		if exp := getOIDCTokenExpire(c.claims, now); !exp.Equal(c.exp) {
+			t.Errorf("Expected %s token expiry %s, got %s", name, c.exp, exp)
+		}
+	}
+}
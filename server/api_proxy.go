@@ -7,6 +7,7 @@
 package server
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
 
@@ -33,6 +34,18 @@ func (repman *ReplicationManager) apiProxyProtectedHandler(router *mux.Router) {
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxProxyStart)),
 	))
+	router.Handle("/api/clusters/{clusterName}/proxies/{proxyName}/digests", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxProxyDigests)),
+	))
+	router.Handle("/api/clusters/{clusterName}/proxies/{proxyName}/xds-nodes", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxProxyXdsNodes)),
+	))
+	router.Handle("/api/clusters/{clusterName}/proxies/{proxyName}/maxscale/{collection}", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxProxyMaxscaleResources)),
+	))
 
 }
 
@@ -58,6 +71,102 @@ func (repman *ReplicationManager) handlerMuxProxyStart(w http.ResponseWriter, r
 	}
 }
 
+func (repman *ReplicationManager) handlerMuxProxyDigests(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		node := mycluster.GetProxyFromName(vars["proxyName"])
+		if node == nil {
+			http.Error(w, "Server Not Found", 500)
+			return
+		}
+		digests, err := mycluster.GetProxyDigests(node)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err = e.Encode(digests)
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "Cluster Not Found", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxProxyXdsNodes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		node := mycluster.GetProxyFromName(vars["proxyName"])
+		if node == nil {
+			http.Error(w, "Server Not Found", 500)
+			return
+		}
+		nodes, err := mycluster.GetEnvoyNodes(node)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err = e.Encode(nodes)
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "Cluster Not Found", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxProxyMaxscaleResources(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		node := mycluster.GetProxyFromName(vars["proxyName"])
+		if node == nil {
+			http.Error(w, "Server Not Found", 500)
+			return
+		}
+		resources, err := mycluster.GetMaxscaleResources(node, vars["collection"])
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err = e.Encode(resources)
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "Cluster Not Found", 500)
+		return
+	}
+}
+
 func (repman *ReplicationManager) handlerMuxProxyStop(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	vars := mux.Vars(r)
@@ -0,0 +1,257 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Author: Stephane Varoqui  <svaroqui@gmail.com>
+// License: GNU General Public License, version 3. Redistribution/Reuse of this code is permitted under the GNU v3 license, as an additional term ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/codegangsta/negroni"
+	"github.com/gorilla/mux"
+	"github.com/signal18/replication-manager/cluster"
+	"github.com/signal18/replication-manager/config"
+)
+
+// apiTokenRequest creates a token, the grants are acl prefixes like api-credentials-acl-allow and ttl is in hours
+type apiTokenRequest struct {
+	Name     string   `json:"name"`
+	Grants   []string `json:"grants"`
+	Clusters []string `json:"clusters"`
+	TTL      int      `json:"ttl"`
+}
+
+type apiTokenResponse struct {
+	Token string `json:"token"`
+	cluster.APIToken
+}
+
+// apiTokenRevokeResponse lists the clusters where a token is revoked and the ones where it is kept because
+// the user has no cluster-grant on them
+type apiTokenRevokeResponse struct {
+	Revoked []string `json:"revoked"`
+	Denied  []string `json:"denied"`
+}
+
+func (repman *ReplicationManager) apiTokenProtectedHandler(router *mux.Router) {
+	router.Handle("/api/monitor/tokens", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxTokens)),
+	)).Methods("GET")
+	router.Handle("/api/monitor/tokens", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxTokenCreate)),
+	)).Methods("POST")
+	router.Handle("/api/monitor/tokens/{tokenId}/actions/revoke", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxTokenRevoke)),
+	)).Methods("POST")
+}
+
+// getIdentityGrants returns the grants of a user on a cluster, an API token can not manage the tokens
+func (repman *ReplicationManager) getIdentityGrants(id *apiIdentity, mycluster *cluster.Cluster) (map[string]bool, bool) {
+	if id.Token != "" {
+		return nil, false
+	}
+	if id.Oidc {
+		return mycluster.GetGroupsGrants(id.Groups), true
+	}
+	if id.Ldap {
+		return mycluster.GetLdapGrants(id.User)
+	}
+	return mycluster.GetUserGrants(id.User, id.Password)
+}
+
+// getTokenClusters returns the clusters on which the user of a request can manage the tokens
+func (repman *ReplicationManager) getTokenClusters(r *http.Request) (*apiIdentity, map[string]map[string]bool, error) {
+	id, err := repman.getIdentity(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	clusters := make(map[string]map[string]bool)
+	for name, mycluster := range repman.Clusters {
+		if grants, ok := repman.getIdentityGrants(id, mycluster); ok && grants[config.GrantClusterGrant] {
+			clusters[name] = grants
+		}
+	}
+	return id, clusters, nil
+}
+
+// handlerMuxTokens lists the tokens of the clusters the user can grant, a token stored in several clusters
+// is merged with the union of its grants and its latest use
+func (repman *ReplicationManager) handlerMuxTokens(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	_, clusters, err := repman.getTokenClusters(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	tokens := make(map[string]*cluster.APIToken)
+	for name := range clusters {
+		for _, t := range repman.Clusters[name].GetAPITokens() {
+			m, ok := tokens[t.Id]
+			if !ok {
+				c := t
+				c.Clusters = nil
+				c.Grants = nil
+				tokens[t.Id] = &c
+				m = &c
+			}
+			m.Clusters = append(m.Clusters, name)
+			for _, g := range t.Grants {
+				if !containsString(m.Grants, g) {
+					m.Grants = append(m.Grants, g)
+				}
+			}
+			if t.LastUsed.After(m.LastUsed) {
+				m.LastUsed = t.LastUsed
+			}
+			m.Revoked = m.Revoked && t.Revoked
+			if t.RevokedBy != "" {
+				m.RevokedBy = t.RevokedBy
+			}
+		}
+	}
+	list := make([]*cluster.APIToken, 0, len(tokens))
+	for _, t := range tokens {
+		sort.Strings(t.Clusters)
+		sort.Strings(t.Grants)
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	if err := e.Encode(list); err != nil {
+		http.Error(w, "Encoding error", 500)
+	}
+}
+
+// handlerMuxTokenCreate creates a token on each requested cluster, the user must hold cluster-grant on them
+// and the token only gets the requested grants the user holds. The secret is only returned in the response.
+func (repman *ReplicationManager) handlerMuxTokenCreate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	id, clusters, err := repman.getTokenClusters(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	var req apiTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Decode error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" || len(req.Grants) == 0 || len(req.Clusters) == 0 {
+		http.Error(w, "A token needs a name, grants and clusters", http.StatusBadRequest)
+		return
+	}
+	ttl := req.TTL
+	if maxTTL := repman.Conf.APITokensMaxTTL; maxTTL > 0 {
+		if ttl > maxTTL {
+			http.Error(w, fmt.Sprintf("Token ttl exceeds api-tokens-max-ttl of %d hours", maxTTL), http.StatusBadRequest)
+			return
+		}
+		if ttl <= 0 {
+			ttl = maxTTL
+		}
+	}
+	for _, name := range req.Clusters {
+		grants, ok := clusters[name]
+		if !ok {
+			http.Error(w, "No cluster-grant on cluster "+name, http.StatusForbidden)
+			return
+		}
+		delegated := false
+		for _, g := range repman.Clusters[name].GetGrantsFromACL(req.Grants) {
+			delegated = delegated || grants[g]
+		}
+		if !delegated {
+			http.Error(w, "No requested grant can be delegated on cluster "+name, http.StatusForbidden)
+			return
+		}
+	}
+	t, secret, err := cluster.NewAPIToken(req.Name, id.User, time.Duration(ttl)*time.Hour)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	t.Clusters = req.Clusters
+	for _, name := range req.Clusters {
+		mycluster := repman.Clusters[name]
+		c := *t
+		c.Grants = mycluster.GetGrantsFromACL(req.Grants)
+		mycluster.AddAPIToken(&c, clusters[name])
+	}
+	t.Hash = ""
+	t.Grants = req.Grants
+	repman.jsonResponse(apiTokenResponse{Token: secret, APIToken: *t}, w)
+}
+
+// handlerMuxTokenRevoke revokes a token on the clusters the user can grant, the status is 207 when the token
+// is kept on clusters without cluster-grant and 403 when it could not be revoked at all
+func (repman *ReplicationManager) handlerMuxTokenRevoke(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	id, clusters, err := repman.getTokenClusters(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	res := apiTokenRevokeResponse{Revoked: []string{}, Denied: []string{}}
+	for name, mycluster := range repman.Clusters {
+		if _, ok := clusters[name]; !ok {
+			if mycluster.HasAPIToken(vars["tokenId"]) {
+				res.Denied = append(res.Denied, name)
+			}
+			continue
+		}
+		if mycluster.RevokeAPIToken(vars["tokenId"], id.User) {
+			res.Revoked = append(res.Revoked, name)
+		}
+	}
+	sort.Strings(res.Revoked)
+	sort.Strings(res.Denied)
+	switch {
+	case len(res.Revoked) == 0 && len(res.Denied) == 0:
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	case len(res.Revoked) == 0:
+		w.WriteHeader(http.StatusForbidden)
+	case len(res.Denied) > 0:
+		w.WriteHeader(http.StatusMultiStatus)
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	if err := e.Encode(res); err != nil {
+		http.Error(w, "Encoding error", 500)
+	}
+}
+
+// getTokenIdentity returns the identity of an API token valid on at least one cluster
+func (repman *ReplicationManager) getTokenIdentity(secret string) (*apiIdentity, error) {
+	err := cluster.ErrAPITokenInvalid
+	for _, mycluster := range repman.Clusters {
+		t, e := mycluster.GetAPIToken(secret)
+		if e == nil {
+			return &apiIdentity{User: "token:" + t.Id, Token: secret}, nil
+		}
+		if e != cluster.ErrAPITokenInvalid {
+			err = e
+		}
+	}
+	return nil, err
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -36,8 +36,10 @@ import (
 	"github.com/signal18/replication-manager/graphite"
 	"github.com/signal18/replication-manager/opensvc"
 	"github.com/signal18/replication-manager/regtest"
+	"github.com/signal18/replication-manager/router/envoy"
 	"github.com/signal18/replication-manager/utils/crypto"
 	"github.com/signal18/replication-manager/utils/misc"
+	"github.com/signal18/replication-manager/utils/oidc"
 	"github.com/signal18/replication-manager/utils/s18log"
 )
 
@@ -77,6 +79,9 @@ type ReplicationManager struct {
 	isStarted            bool
 	Confs                map[string]config.Config
 	ForcedConfs          map[string]config.Config
+	oidc                 *oidc.Provider
+	audit                *s18log.AuditLog
+	xds                  *envoy.Server
 	sync.Mutex
 }
 
@@ -626,6 +631,9 @@ func (repman *ReplicationManager) StartCluster(clusterName string) (*cluster.Clu
 		myClusterConf.WorkingDir = myClusterConf.BaseDir + "/data"
 	}
 	repman.currentCluster.Init(myClusterConf, clusterName, &repman.tlog, &repman.Logs, repman.termlength, repman.UUID, repman.Version, repman.Hostname, k)
+	if myClusterConf.EnvoyOn {
+		repman.currentCluster.SetEnvoyServer(repman.getEnvoyServer())
+	}
 	repman.Clusters[clusterName] = repman.currentCluster
 	repman.currentCluster.SetCertificate(repman.OpenSVC)
 	go repman.currentCluster.Run()
@@ -633,6 +641,22 @@ func (repman *ReplicationManager) StartCluster(clusterName string) (*cluster.Clu
 	return repman.currentCluster, nil
 }
 
+// getEnvoyServer returns the xDS control plane shared by the clusters, it is started by the first cluster
+// routed by Envoy and serves each Envoy node the routing of the cluster named by its node id or node cluster
+func (repman *ReplicationManager) getEnvoyServer() *envoy.Server {
+	if repman.xds != nil {
+		return repman.xds
+	}
+	xds := envoy.NewServer("0.0.0.0:" + strconv.Itoa(repman.Conf.EnvoyXdsPort))
+	if err := xds.Start(); err != nil {
+		log.Errorf("Could not start Envoy xDS control plane on port %d: %s", repman.Conf.EnvoyXdsPort, err)
+		return nil
+	}
+	log.Infof("Envoy xDS control plane listening on port %d", repman.Conf.EnvoyXdsPort)
+	repman.xds = xds
+	return xds
+}
+
 func (repman *ReplicationManager) AddCluster(clusterName string, clusterHead string) error {
 	var myconf = make(map[string]config.Config)
 
@@ -0,0 +1,228 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package alert
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SeverityInfo     string = "INFO"
+	SeverityWarn     string = "WARN"
+	SeverityError    string = "ERROR"
+	SeverityCritical string = "CRITICAL"
+)
+
+// Event is a server state change or a cluster state opened or resolved, sent to every sink
+type Event struct {
+	Cluster   string    `json:"cluster"`
+	Origin    string    `json:"origin"`
+	State     string    `json:"state"`
+	PrevState string    `json:"prevState"`
+	Severity  string    `json:"severity"`
+	ErrKey    string    `json:"errKey,omitempty"`
+	ErrFrom   string    `json:"errFrom,omitempty"`
+	Desc      string    `json:"desc"`
+	Resolved  bool      `json:"resolved"`
+	Tags      []string  `json:"tags,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// DedupKey identifies an incident from the cluster, the server and the error key, open and resolve events of
+// the same incident share it, the state changes of a server are one incident
+func (e *Event) DedupKey() string {
+	if e.ErrKey != "" {
+		return e.Cluster + "/" + e.Origin + "/" + e.ErrKey
+	}
+	return e.Cluster + "/" + e.Origin + "/state"
+}
+
+// Summary is a one line description of the event
+func (e *Event) Summary() string {
+	if e.Resolved {
+		return "Resolved " + e.Desc
+	}
+	return e.Desc
+}
+
+// Sink delivers events to an external system
+type Sink interface {
+	Name() string
+	Send(e *Event) error
+}
+
+// Channel is a sink with the minimum severity of the events it receives
+type Channel struct {
+	Sink        Sink
+	MinSeverity string
+}
+
+// Dispatcher fans out events to the channels, retrying with exponential backoff and dropping an incident
+// sent again within the dedup window unless its severity raised, the resolve event of an incident is sent
+// to every channel the incident was sent to
+type Dispatcher struct {
+	Channels    []Channel
+	Routes      []Route
+	Retry       int
+	Backoff     time.Duration
+	DedupWindow time.Duration
+	Log         func(level string, format string, args ...interface{})
+	sent        map[string]sentIncident
+	open        map[string]map[string]bool
+	sync.Mutex
+	wg sync.WaitGroup
+}
+
+type sentIncident struct {
+	time     time.Time
+	severity int
+}
+
+// NewDispatcher returns a dispatcher without channels
+func NewDispatcher(retry int, backoff time.Duration, dedup time.Duration) *Dispatcher {
+	d := new(Dispatcher)
+	d.Retry = retry
+	d.Backoff = backoff
+	d.DedupWindow = dedup
+	d.sent = make(map[string]sentIncident)
+	d.open = make(map[string]map[string]bool)
+	return d
+}
+
+// AddChannel registers a sink receiving events of at least the given severity
+func (d *Dispatcher) AddChannel(sink Sink, minSeverity string) {
+	d.Channels = append(d.Channels, Channel{Sink: sink, MinSeverity: minSeverity})
+}
+
+// SeverityLevel orders severities, unknown values are ranked as info
+func SeverityLevel(severity string) int {
+	switch strings.ToUpper(severity) {
+	case SeverityCritical:
+		return 3
+	case SeverityError, "ERR":
+		return 2
+	case SeverityWarn, "WARNING":
+		return 1
+	}
+	return 0
+}
+
+// IsRouted is true when the routes of the sink send it the event
+func (d *Dispatcher) IsRouted(sink string, e *Event) bool {
+	routed := true
+	for _, r := range d.Routes {
+		if r.Sink != sink {
+			continue
+		}
+		if r.Match(e) {
+			return true
+		}
+		routed = false
+	}
+	return routed
+}
+
+func (d *Dispatcher) isDuplicate(e *Event) bool {
+	if d.DedupWindow <= 0 {
+		return false
+	}
+	key := e.DedupKey()
+	other := key + "/resolved"
+	if e.Resolved {
+		key, other = other, key
+	}
+	d.Lock()
+	defer d.Unlock()
+	now := time.Now()
+	for k, s := range d.sent {
+		if now.Sub(s.time) > d.DedupWindow {
+			delete(d.sent, k)
+		}
+	}
+	severity := SeverityLevel(e.Severity)
+	if s, ok := d.sent[key]; ok && severity <= s.severity {
+		return true
+	}
+	// an incident opened again after its resolution is not a duplicate
+	delete(d.sent, other)
+	d.sent[key] = sentIncident{time: now, severity: severity}
+	return false
+}
+
+// isAccepted returns true when a channel receives an event, an incident sent to a channel is kept open on
+// it until its resolve event is sent whatever its severity and routes
+func (d *Dispatcher) isAccepted(c Channel, e *Event) bool {
+	name := c.Sink.Name()
+	key := e.DedupKey()
+	d.Lock()
+	defer d.Unlock()
+	if e.Resolved && d.open[name][key] {
+		delete(d.open[name], key)
+		return true
+	}
+	if SeverityLevel(e.Severity) < SeverityLevel(c.MinSeverity) || !d.IsRouted(name, e) {
+		return false
+	}
+	if !e.Resolved {
+		if d.open[name] == nil {
+			d.open[name] = make(map[string]bool)
+		}
+		d.open[name][key] = true
+	}
+	return true
+}
+
+// Dispatch sends the event to every channel accepting its severity, in background
+func (d *Dispatcher) Dispatch(e *Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if d.isDuplicate(e) {
+		return
+	}
+	for _, c := range d.Channels {
+		if !d.isAccepted(c, e) {
+			continue
+		}
+		d.wg.Add(1)
+		go d.send(c.Sink, e)
+	}
+}
+
+// Wait blocks until all pending deliveries are done
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) send(sink Sink, e *Event) {
+	defer d.wg.Done()
+	backoff := d.Backoff
+	var err error
+	for i := 0; i <= d.Retry; i++ {
+		err = sink.Send(e)
+		if err == nil {
+			return
+		}
+		if i < d.Retry {
+			d.log("WARN", "Alert %s failed, retrying in %s: %s", sink.Name(), backoff, err)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	d.log("ERROR", "Could not send %s alert: %s", sink.Name(), err)
+}
+
+func (d *Dispatcher) log(level string, format string, args ...interface{}) {
+	if d.Log != nil {
+		d.Log(level, format, args...)
+	}
+}
@@ -0,0 +1,126 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package alert
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testSink struct {
+	fails int
+	calls int
+	sync.Mutex
+}
+
+func (s *testSink) Name() string {
+	return "test"
+}
+
+func (s *testSink) Send(e *Event) error {
+	s.Lock()
+	defer s.Unlock()
+	s.calls++
+	if s.calls <= s.fails {
+		return errors.New("sink down")
+	}
+	return nil
+}
+
+func TestDispatcherSeverityAndDedup(t *testing.T) {
+	sink := &testSink{}
+	d := NewDispatcher(0, 0, time.Minute)
+	d.AddChannel(sink, SeverityError)
+	d.Dispatch(&Event{Cluster: "c1", Origin: "db1:3306", Severity: SeverityWarn, Desc: "warn"})
+	d.Dispatch(&Event{Cluster: "c1", Origin: "db1:3306", Severity: SeverityCritical, Desc: "failed"})
+	d.Dispatch(&Event{Cluster: "c1", Origin: "db1:3306", Severity: SeverityCritical, Desc: "failed"})
+	d.Wait()
+	if sink.calls != 1 {
+		t.Fatalf("Expected 1 call after severity filter and dedup, got %d", sink.calls)
+	}
+}
+
+func TestDispatcherResolve(t *testing.T) {
+	sink := &testSink{}
+	d := NewDispatcher(0, 0, time.Minute)
+	d.AddChannel(sink, SeverityError)
+	d.Dispatch(&Event{Cluster: "c1", Origin: "db1:3306", State: "Suspect", Severity: SeverityWarn})
+	d.Dispatch(&Event{Cluster: "c1", Origin: "db1:3306", State: "Failed", Severity: SeverityCritical})
+	d.Dispatch(&Event{Cluster: "c1", Origin: "db1:3306", State: "Failed", Severity: SeverityError})
+	// the resolve of the incident is sent to the channel below its minimum severity
+	d.Dispatch(&Event{Cluster: "c1", Origin: "db1:3306", State: "Slave", Severity: SeverityWarn, Resolved: true})
+	d.Dispatch(&Event{Cluster: "c1", Origin: "db2:3306", State: "Slave", Severity: SeverityWarn, Resolved: true})
+	d.Dispatch(&Event{Cluster: "c1", Origin: "db1:3306", State: "Failed", Severity: SeverityCritical})
+	d.Wait()
+	if sink.calls != 3 {
+		t.Fatalf("Expected failed, resolved and failed again calls, got %d", sink.calls)
+	}
+}
+
+func TestDispatcherRetry(t *testing.T) {
+	sink := &testSink{fails: 2}
+	d := NewDispatcher(2, time.Millisecond, 0)
+	d.AddChannel(sink, SeverityInfo)
+	d.Dispatch(&Event{Cluster: "c1", Origin: "db1:3306", Severity: SeverityInfo})
+	d.Wait()
+	if sink.calls != 3 {
+		t.Fatalf("Expected 3 calls with 2 retries, got %d", sink.calls)
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	var signature, expected string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		signature = r.Header.Get("X-Repman-Signature")
+		expected = Sign("secret", body)
+	}))
+	defer ts.Close()
+	w := &Webhook{URL: ts.URL, Secret: "secret"}
+	err := w.Send(&Event{Cluster: "c1", Origin: "db1:3306", Severity: SeverityError})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signature == "" || signature != expected {
+		t.Fatalf("Webhook signature %s differs from %s", signature, expected)
+	}
+}
+
+func TestRoutesAndSilences(t *testing.T) {
+	routes, err := ParseRoutes("sink=test,key=ERR000*,tag=production;sink=test,severity=CRITICAL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &testSink{}
+	d := NewDispatcher(0, 0, 0)
+	d.Routes = routes
+	d.AddChannel(sink, SeverityInfo)
+	d.Dispatch(&Event{Origin: "db1:3306", ErrKey: "ERR00042", Severity: SeverityError, Tags: []string{"production"}})
+	d.Dispatch(&Event{Origin: "db1:3306", ErrKey: "ERR00042", Severity: SeverityError})
+	d.Dispatch(&Event{Origin: "db1:3306", ErrKey: "WARN0048", Severity: SeverityWarn})
+	d.Dispatch(&Event{Origin: "db1:3306", Severity: SeverityCritical})
+	d.Wait()
+	if sink.calls != 2 {
+		t.Fatalf("Expected 2 routed events, got %d", sink.calls)
+	}
+	now := time.Now()
+	s := Silence{Server: "db1:*", Key: "ERR*", Start: now.Add(-time.Minute), End: now.Add(time.Hour)}
+	if !s.Match(&Event{Origin: "db1:3306", ErrKey: "ERR00042", Time: now}) {
+		t.Fatal("Expected silence to match")
+	}
+	if s.Match(&Event{Origin: "db2:3306", ErrKey: "ERR00042", Time: now}) {
+		t.Fatal("Expected silence not to match another server")
+	}
+	if s.Match(&Event{Origin: "db1:3306", ErrKey: "ERR00042", Time: now.Add(2 * time.Hour)}) {
+		t.Fatal("Expected silence to be expired")
+	}
+}
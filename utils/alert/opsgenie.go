@@ -0,0 +1,80 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package alert
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Opsgenie creates alerts with the Opsgenie Alert API, resolved events close the alert
+type Opsgenie struct {
+	URL    string
+	APIKey string
+}
+
+type opsgenieAlert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description"`
+	Source      string            `json:"source"`
+	Entity      string            `json:"entity"`
+	Priority    string            `json:"priority"`
+	Tags        []string          `json:"tags,omitempty"`
+	Details     map[string]string `json:"details,omitempty"`
+}
+
+type opsgenieClose struct {
+	Source string `json:"source"`
+	Note   string `json:"note"`
+}
+
+func (o *Opsgenie) Name() string {
+	return "opsgenie"
+}
+
+func opsgeniePriority(severity string) string {
+	switch SeverityLevel(severity) {
+	case 3:
+		return "P1"
+	case 2:
+		return "P2"
+	case 1:
+		return "P3"
+	}
+	return "P5"
+}
+
+func (o *Opsgenie) Send(e *Event) error {
+	base := strings.TrimSuffix(o.URL, "/")
+	if base == "" {
+		base = "https://api.opsgenie.com"
+	}
+	headers := map[string]string{"Authorization": "GenieKey " + o.APIKey}
+	if e.Resolved {
+		return postJSON(base+"/v2/alerts/"+url.PathEscape(e.DedupKey())+"/close?identifierType=alias", opsgenieClose{Source: "replication-manager", Note: e.Summary()}, headers)
+	}
+	oa := opsgenieAlert{
+		Message:     e.Summary(),
+		Alias:       e.DedupKey(),
+		Description: e.Desc,
+		Source:      "replication-manager",
+		Entity:      e.Origin,
+		Priority:    opsgeniePriority(e.Severity),
+		Tags:        append([]string{e.Cluster}, e.Tags...),
+		Details: map[string]string{
+			"cluster":   e.Cluster,
+			"state":     e.State,
+			"prevState": e.PrevState,
+			"errKey":    e.ErrKey,
+		},
+	}
+	return postJSON(base+"/v2/alerts", oa, headers)
+}
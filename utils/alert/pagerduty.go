@@ -0,0 +1,73 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package alert
+
+// PagerDuty sends events to the PagerDuty Events API v2, resolved events close the incident
+type PagerDuty struct {
+	URL        string
+	RoutingKey string
+}
+
+type pagerDutyPayload struct {
+	Summary       string `json:"summary"`
+	Source        string `json:"source"`
+	Severity      string `json:"severity"`
+	Timestamp     string `json:"timestamp"`
+	Component     string `json:"component,omitempty"`
+	Group         string `json:"group,omitempty"`
+	Class         string `json:"class,omitempty"`
+	CustomDetails *Event `json:"custom_details,omitempty"`
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+func (p *PagerDuty) Name() string {
+	return "pagerduty"
+}
+
+func pagerDutySeverity(severity string) string {
+	switch SeverityLevel(severity) {
+	case 3:
+		return "critical"
+	case 2:
+		return "error"
+	case 1:
+		return "warning"
+	}
+	return "info"
+}
+
+func (p *PagerDuty) Send(e *Event) error {
+	url := p.URL
+	if url == "" {
+		url = "https://events.pagerduty.com/v2/enqueue"
+	}
+	pe := pagerDutyEvent{RoutingKey: p.RoutingKey, EventAction: "trigger", DedupKey: e.DedupKey()}
+	if e.Resolved {
+		pe.EventAction = "resolve"
+	} else {
+		pe.Payload = &pagerDutyPayload{
+			Summary:       e.Summary(),
+			Source:        e.Origin,
+			Severity:      pagerDutySeverity(e.Severity),
+			Timestamp:     e.Time.Format("2006-01-02T15:04:05.000Z07:00"),
+			Component:     e.ErrFrom,
+			Group:         e.Cluster,
+			Class:         e.ErrKey,
+			CustomDetails: e,
+		}
+	}
+	return postJSON(url, pe, nil)
+}
@@ -0,0 +1,134 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package alert
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// Route sends to a sink only the events matching every condition set, a sink without route receives every event
+type Route struct {
+	Sink     string `json:"sink"`
+	Cluster  string `json:"cluster,omitempty"`
+	Key      string `json:"key,omitempty"`
+	Severity string `json:"severity,omitempty"`
+	Tag      string `json:"tag,omitempty"`
+}
+
+// ParseRoutes reads routes separated by semicolons, each route is a comma list of
+// sink=name,cluster=name,key=pattern,severity=level,tag=name where key is a glob like ERR000*
+func ParseRoutes(s string) ([]Route, error) {
+	var routes []Route
+	for _, r := range strings.Split(s, ";") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		var route Route
+		for _, cond := range strings.Split(r, ",") {
+			kv := strings.SplitN(strings.TrimSpace(cond), "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("Invalid alert route condition %s", cond)
+			}
+			switch kv[0] {
+			case "sink":
+				route.Sink = kv[1]
+			case "cluster":
+				route.Cluster = kv[1]
+			case "key":
+				if _, err := path.Match(kv[1], ""); err != nil {
+					return nil, fmt.Errorf("Invalid alert route key %s: %s", kv[1], err)
+				}
+				route.Key = kv[1]
+			case "severity":
+				route.Severity = strings.ToUpper(kv[1])
+			case "tag":
+				route.Tag = kv[1]
+			default:
+				return nil, fmt.Errorf("Unknown alert route condition %s", kv[0])
+			}
+		}
+		if route.Sink == "" {
+			return nil, fmt.Errorf("Alert route without sink %s", r)
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns true if the event satisfies all the conditions of the route
+func (r Route) Match(e *Event) bool {
+	if r.Cluster != "" && r.Cluster != e.Cluster {
+		return false
+	}
+	if r.Key != "" {
+		if ok, _ := path.Match(r.Key, e.ErrKey); !ok {
+			return false
+		}
+	}
+	if r.Severity != "" && SeverityLevel(e.Severity) < SeverityLevel(r.Severity) {
+		return false
+	}
+	if r.Tag != "" && !hasTag(e.Tags, r.Tag) {
+		return false
+	}
+	return true
+}
+
+// Silence mutes the events matching its server and key patterns between start and end
+type Silence struct {
+	Id      string    `json:"id"`
+	Server  string    `json:"server,omitempty"`
+	Key     string    `json:"key,omitempty"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Comment string    `json:"comment"`
+	User    string    `json:"user"`
+}
+
+// IsActive returns true if the silence window contains t
+func (s Silence) IsActive(t time.Time) bool {
+	return !t.Before(s.Start) && t.Before(s.End)
+}
+
+// IsExpired returns true if the silence window ended before t
+func (s Silence) IsExpired(t time.Time) bool {
+	return !t.Before(s.End)
+}
+
+// Match returns true if the silence is active and mutes the event
+func (s Silence) Match(e *Event) bool {
+	if !s.IsActive(e.Time) {
+		return false
+	}
+	if s.Server != "" {
+		if ok, _ := path.Match(s.Server, e.Origin); !ok {
+			return false
+		}
+	}
+	if s.Key != "" {
+		if ok, _ := path.Match(s.Key, e.ErrKey); !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// Script calls a local program with origin, previous and new state as arguments,
+// the event is also passed as JSON on stdin and REPMAN_ALERT_* environment variables
+type Script struct {
+	Path string
+}
+
+func (s *Script) Name() string {
+	return "script"
+}
+
+func (s *Script) Send(e *Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(s.Path, e.Origin, e.PrevState, e.State)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Env = append(os.Environ(),
+		"REPMAN_ALERT_CLUSTER="+e.Cluster,
+		"REPMAN_ALERT_SEVERITY="+e.Severity,
+		"REPMAN_ALERT_KEY="+e.ErrKey,
+		"REPMAN_ALERT_DESC="+e.Desc,
+		"REPMAN_ALERT_RESOLVED="+strconv.FormatBool(e.Resolved),
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %s", err, out)
+	}
+	return nil
+}
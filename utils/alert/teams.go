@@ -0,0 +1,69 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package alert
+
+// Teams posts a message card to a Microsoft Teams incoming webhook
+type Teams struct {
+	URL string
+}
+
+type teamsFact struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type teamsSection struct {
+	Facts []teamsFact `json:"facts"`
+}
+
+type teamsCard struct {
+	Type       string         `json:"@type"`
+	Context    string         `json:"@context"`
+	ThemeColor string         `json:"themeColor"`
+	Summary    string         `json:"summary"`
+	Title      string         `json:"title"`
+	Text       string         `json:"text"`
+	Sections   []teamsSection `json:"sections"`
+}
+
+func (t *Teams) Name() string {
+	return "teams"
+}
+
+func teamsColor(e *Event) string {
+	if e.Resolved {
+		return "2EB886"
+	}
+	switch SeverityLevel(e.Severity) {
+	case 3, 2:
+		return "D00000"
+	case 1:
+		return "FFA500"
+	}
+	return "0078D7"
+}
+
+func (t *Teams) Send(e *Event) error {
+	card := teamsCard{
+		Type:       "MessageCard",
+		Context:    "https://schema.org/extensions",
+		ThemeColor: teamsColor(e),
+		Summary:    e.Summary(),
+		Title:      "Repman " + e.Severity + " - " + e.Cluster,
+		Text:       e.Summary(),
+		Sections: []teamsSection{{Facts: []teamsFact{
+			{Name: "Server", Value: e.Origin},
+			{Name: "State", Value: e.PrevState + " > " + e.State},
+			{Name: "Key", Value: e.ErrKey},
+			{Name: "Time", Value: e.Time.Format("2006-01-02 15:04:05")},
+		}}},
+	}
+	return postJSON(t.URL, card, nil)
+}
@@ -1507,7 +1507,7 @@ func GetTableChecksumResult(db *sqlx.DB) (map[uint64]chunk, string, error) {
 	defer rows.Close()
 	for rows.Next() {
 		var v chunk
-		err = rows.Scan(&v.ChunkId, &v.ChunkMinKey, &v.ChunkMaxKey, v.ChunkCheckSum)
+		err = rows.Scan(&v.ChunkId, &v.ChunkMinKey, &v.ChunkMaxKey, &v.ChunkCheckSum)
 		if err != nil {
 			return vars, query, err
 		}
@@ -1960,6 +1960,34 @@ func StartSlave(db *sqlx.DB, Channel string, myver *MySQLVersion) (string, error
 	return cmd, err
 }
 
+// StartSlaveUntil starts replication until the condition, a MASTER_LOG_FILE/MASTER_LOG_POS pair or SQL_BEFORE_GTIDS for MySQL
+func StartSlaveUntil(db *sqlx.DB, until string, Channel string, myver *MySQLVersion) (string, error) {
+	cmd := "START SLAVE"
+	if myver.IsMariaDB() && Channel != "" {
+		cmd += " '" + Channel + "'"
+	}
+	cmd += " UNTIL " + until
+	if myver.IsMySQLOrPercona() && Channel != "" {
+		cmd += " FOR CHANNEL '" + Channel + "'"
+	}
+	_, err := db.Exec(cmd)
+	return cmd, err
+}
+
+// SetSlaveDelay changes the replication delay in seconds, replication has to be stopped
+func SetSlaveDelay(db *sqlx.DB, delay string, Channel string, myver *MySQLVersion) (string, error) {
+	cmd := "CHANGE MASTER"
+	if myver.IsMariaDB() && Channel != "" {
+		cmd += " '" + Channel + "'"
+	}
+	cmd += " TO MASTER_DELAY=" + delay
+	if myver.IsMySQLOrPercona() && Channel != "" {
+		cmd += " FOR CHANNEL '" + Channel + "'"
+	}
+	_, err := db.Exec(cmd)
+	return cmd, err
+}
+
 func ResetSlave(db *sqlx.DB, all bool, Channel string, myver *MySQLVersion) (string, error) {
 	stmt := ""
 	if myver.IsPPostgreSQL() {
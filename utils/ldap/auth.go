@@ -0,0 +1,172 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package ldap
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUserNotFound is returned when the user filter matches no entry
+var ErrUserNotFound = errors.New("LDAP user not found")
+
+// Authenticator binds the users to the directory and returns their groups. The user is searched with the
+// bind account, or anonymously, then bound with its password. The groups are the values of the group
+// attribute of the user entry, memberOf for AD, or the entries of the group search when a group base is set.
+type Authenticator struct {
+	URL          string
+	StartTLS     bool
+	TLSConfig    *tls.Config
+	BindDN       string
+	BindPassword string
+	UserBase     string
+	// UserFilter holds a %s replaced by the escaped user name
+	UserFilter     string
+	GroupAttribute string
+	GroupBase      string
+	// GroupFilter holds a %s replaced by the escaped user DN
+	GroupFilter string
+	// CacheTTL is the time the groups found by Lookup are reused, 0 searches the directory on each call,
+	// a user removed from a group or from the directory keeps its groups up to this delay
+	CacheTTL time.Duration
+	mutex    sync.Mutex
+	cache    map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	groups []string
+	time   time.Time
+}
+
+// Authenticate binds a user with its password and returns its groups, the groups are the common names of the
+// group entries, the password is checked on each call
+func (a *Authenticator) Authenticate(user string, password string) ([]string, error) {
+	if user == "" || password == "" {
+		return nil, &Error{Code: ResultBadCreds, Message: "empty credentials"}
+	}
+	groups, err := a.search(user, password)
+	a.setCache(user, groups, err)
+	return groups, err
+}
+
+// Lookup returns the groups of an authenticated user without its password, the user is searched by the bind
+// account or anonymously, a user missing from the directory returns ErrUserNotFound
+func (a *Authenticator) Lookup(user string) ([]string, error) {
+	if user == "" {
+		return nil, ErrUserNotFound
+	}
+	if a.CacheTTL > 0 {
+		a.mutex.Lock()
+		c, ok := a.cache[user]
+		a.mutex.Unlock()
+		if ok && time.Since(c.time) < a.CacheTTL {
+			return c.groups, nil
+		}
+	}
+	groups, err := a.search(user, "")
+	a.setCache(user, groups, err)
+	return groups, err
+}
+
+func (a *Authenticator) setCache(user string, groups []string, err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.cache == nil {
+		a.cache = make(map[string]cacheEntry)
+	}
+	if err == nil && a.CacheTTL > 0 {
+		a.cache[user] = cacheEntry{groups: groups, time: time.Now()}
+	} else {
+		delete(a.cache, user)
+	}
+}
+
+// search returns the groups of a user, the user is bound with its password unless the password is empty
+func (a *Authenticator) search(user string, password string) ([]string, error) {
+	l, err := Dial(a.URL, a.StartTLS, a.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+	if a.BindDN != "" {
+		if err := l.Bind(a.BindDN, a.BindPassword); err != nil {
+			return nil, fmt.Errorf("LDAP bind account: %s", err)
+		}
+	}
+	attrs := []string{"dn"}
+	if a.GroupAttribute != "" {
+		attrs = append(attrs, a.GroupAttribute)
+	}
+	entries, err := l.Search(a.UserBase, ScopeSubtree, strings.Replace(a.UserFilter, "%s", EscapeFilter(user), -1), attrs)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, ErrUserNotFound
+	}
+	if len(entries) > 1 {
+		return nil, fmt.Errorf("LDAP user filter matches %d entries", len(entries))
+	}
+	userEntry := entries[0]
+	if password != "" {
+		if err := l.Bind(userEntry.DN, password); err != nil {
+			return nil, err
+		}
+	}
+	if a.GroupBase == "" {
+		var groups []string
+		for _, dn := range userEntry.GetAttribute(a.GroupAttribute) {
+			groups = append(groups, GetCommonName(dn))
+		}
+		return groups, nil
+	}
+	// the user may not read the groups
+	if a.BindDN != "" && password != "" {
+		if err := l.Bind(a.BindDN, a.BindPassword); err != nil {
+			return nil, fmt.Errorf("LDAP bind account: %s", err)
+		}
+	}
+	entries, err = l.Search(a.GroupBase, ScopeSubtree, strings.Replace(a.GroupFilter, "%s", EscapeFilter(userEntry.DN), -1), []string{"cn"})
+	if err != nil {
+		return nil, err
+	}
+	var groups []string
+	for _, e := range entries {
+		if cn := e.GetAttribute("cn"); len(cn) > 0 {
+			groups = append(groups, cn[0])
+		} else {
+			groups = append(groups, GetCommonName(e.DN))
+		}
+	}
+	return groups, nil
+}
+
+// GetCommonName returns the value of the first RDN of a DN
+func GetCommonName(dn string) string {
+	rdn := dn
+	for i := 0; i < len(dn); i++ {
+		if dn[i] == '\\' {
+			i++
+			continue
+		}
+		if dn[i] == ',' {
+			rdn = dn[:i]
+			break
+		}
+	}
+	if eq := strings.IndexByte(rdn, '='); eq >= 0 {
+		rdn = rdn[eq+1:]
+	}
+	return strings.TrimSpace(strings.Replace(rdn, "\\", "", -1))
+}
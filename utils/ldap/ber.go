@@ -0,0 +1,167 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package ldap
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// The LDAP messages are BER encoded, only the definite length forms and the single byte tags used
+// by the bind, search and StartTLS operations are supported
+
+const (
+	berBoolean     = 0x01
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berEnumerated  = 0x0a
+	berSequence    = 0x30
+	berSet         = 0x31
+
+	berMaxLength = 16 << 20
+)
+
+type berElement struct {
+	tag  byte
+	data []byte
+}
+
+func berLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+func berTLV(tag byte, content []byte) []byte {
+	b := append([]byte{tag}, berLength(len(content))...)
+	return append(b, content...)
+}
+
+func berString(tag byte, s string) []byte {
+	return berTLV(tag, []byte(s))
+}
+
+func berInt(tag byte, v int64) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(v)}, b...)
+		if (v >= -128 && v < 128) || (v >= 0 && len(b) > 8) {
+			break
+		}
+		v >>= 8
+	}
+	return berTLV(tag, b)
+}
+
+func berBool(b bool) []byte {
+	if b {
+		return berTLV(berBoolean, []byte{0xff})
+	}
+	return berTLV(berBoolean, []byte{0})
+}
+
+func berSeq(tag byte, children ...[]byte) []byte {
+	var content []byte
+	for _, c := range children {
+		content = append(content, c...)
+	}
+	return berTLV(tag, content)
+}
+
+// readLength reads a definite length
+func readLength(r io.ByteReader) (int, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b < 0x80 {
+		return int(b), nil
+	}
+	n := int(b & 0x7f)
+	if n == 0 || n > 4 {
+		return 0, errors.New("Unsupported BER length")
+	}
+	l := 0
+	for i := 0; i < n; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		l = l<<8 | int(b)
+	}
+	if l > berMaxLength {
+		return 0, errors.New("BER element too large")
+	}
+	return l, nil
+}
+
+// readElement reads an element from a stream
+func readElement(r *bufio.Reader) (berElement, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return berElement{}, err
+	}
+	l, err := readLength(r)
+	if err != nil {
+		return berElement{}, err
+	}
+	data := make([]byte, l)
+	_, err = io.ReadFull(r, data)
+	return berElement{tag: tag, data: data}, err
+}
+
+type byteReader struct {
+	b []byte
+}
+
+func (r *byteReader) ReadByte() (byte, error) {
+	if len(r.b) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	c := r.b[0]
+	r.b = r.b[1:]
+	return c, nil
+}
+
+// parseElements splits the content of a constructed element in its children
+func parseElements(b []byte) ([]berElement, error) {
+	var elements []berElement
+	r := &byteReader{b: b}
+	for len(r.b) > 0 {
+		tag, _ := r.ReadByte()
+		l, err := readLength(r)
+		if err != nil {
+			return nil, err
+		}
+		if l > len(r.b) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		elements = append(elements, berElement{tag: tag, data: r.b[:l]})
+		r.b = r.b[l:]
+	}
+	return elements, nil
+}
+
+func parseInt(b []byte) int64 {
+	var v int64
+	for i, c := range b {
+		if i == 0 && c&0x80 != 0 {
+			v = -1
+		}
+		v = v<<8 | int64(c)
+	}
+	return v
+}
@@ -0,0 +1,318 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+// Package ldap is a minimal LDAP v3 client binding users and searching their entries and groups,
+// over ldap://, ldaps:// or StartTLS.
+package ldap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	appBindRequest      = 0x60
+	appBindResponse     = 0x61
+	appUnbindRequest    = 0x42
+	appSearchRequest    = 0x63
+	appSearchEntry      = 0x64
+	appSearchDone       = 0x65
+	appSearchReference  = 0x73
+	appExtendedRequest  = 0x77
+	appExtendedResponse = 0x78
+
+	authSimple     = 0x80
+	extRequestName = 0x80
+	startTLSOid    = "1.3.6.1.4.1.1466.20037"
+	derefNever     = 0
+	searchTimeout  = 10
+	defaultTimeout = 10 * time.Second
+)
+
+// Result codes
+const (
+	ResultSuccess  = 0
+	ResultBadCreds = 49
+)
+
+// Search scopes
+const (
+	ScopeBase    = 0
+	ScopeOne     = 1
+	ScopeSubtree = 2
+)
+
+// Error is an LDAP result other than success
+type Error struct {
+	Code    int64
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("LDAP result %d %s", e.Code, e.Message)
+}
+
+// IsInvalidCredentials returns true for a failed bind
+func IsInvalidCredentials(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Code == ResultBadCreds
+}
+
+// Entry is a search result
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// GetAttribute returns the values of an attribute, attribute names are case insensitive
+func (e *Entry) GetAttribute(name string) []string {
+	for k, v := range e.Attributes {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+// Conn is a connection to a directory, the operations are synchronous
+type Conn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	msgId   int64
+	Timeout time.Duration
+}
+
+// Dial connects to an ldap:// or ldaps:// URL, the connection is upgraded with StartTLS when asked
+func Dial(rawurl string, startTLS bool, tlsConfig *tls.Config) (*Conn, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Hostname()
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = host
+	}
+	dialer := &net.Dialer{Timeout: defaultTimeout}
+	var c net.Conn
+	switch u.Scheme {
+	case "ldap":
+		port := u.Port()
+		if port == "" {
+			port = "389"
+		}
+		c, err = dialer.Dial("tcp", net.JoinHostPort(host, port))
+	case "ldaps":
+		port := u.Port()
+		if port == "" {
+			port = "636"
+		}
+		c, err = tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(host, port), tlsConfig)
+	default:
+		return nil, fmt.Errorf("Unsupported LDAP URL scheme %s", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	l := NewConn(c)
+	if startTLS && u.Scheme == "ldap" {
+		if err := l.StartTLS(tlsConfig); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// NewConn returns a client on an established connection
+func NewConn(c net.Conn) *Conn {
+	return &Conn{conn: c, reader: bufio.NewReader(c), Timeout: defaultTimeout}
+}
+
+func (l *Conn) send(op []byte) (int64, error) {
+	l.msgId++
+	l.conn.SetDeadline(time.Now().Add(l.Timeout))
+	_, err := l.conn.Write(berSeq(berSequence, berInt(berInteger, l.msgId), op))
+	return l.msgId, err
+}
+
+// receive reads the protocol operation of the next message of a request
+func (l *Conn) receive(msgId int64) (berElement, error) {
+	for {
+		msg, err := readElement(l.reader)
+		if err != nil {
+			return berElement{}, err
+		}
+		if msg.tag != berSequence {
+			return berElement{}, errors.New("Malformed LDAP message")
+		}
+		parts, err := parseElements(msg.data)
+		if err != nil {
+			return berElement{}, err
+		}
+		if len(parts) < 2 || parts[0].tag != berInteger {
+			return berElement{}, errors.New("Malformed LDAP message")
+		}
+		// unsolicited notifications have the id 0
+		if parseInt(parts[0].data) != msgId {
+			continue
+		}
+		return parts[1], nil
+	}
+}
+
+// parseResult returns the error of an LDAPResult
+func parseResult(op berElement) error {
+	parts, err := parseElements(op.data)
+	if err != nil {
+		return err
+	}
+	if len(parts) < 3 || parts[0].tag != berEnumerated {
+		return errors.New("Malformed LDAP result")
+	}
+	if code := parseInt(parts[0].data); code != ResultSuccess {
+		return &Error{Code: code, Message: string(parts[2].data)}
+	}
+	return nil
+}
+
+// StartTLS upgrades the connection to TLS
+func (l *Conn) StartTLS(tlsConfig *tls.Config) error {
+	id, err := l.send(berSeq(appExtendedRequest, berString(extRequestName, startTLSOid)))
+	if err != nil {
+		return err
+	}
+	op, err := l.receive(id)
+	if err != nil {
+		return err
+	}
+	if op.tag != appExtendedResponse {
+		return errors.New("Unexpected StartTLS response")
+	}
+	if err := parseResult(op); err != nil {
+		return err
+	}
+	tc := tls.Client(l.conn, tlsConfig)
+	tc.SetDeadline(time.Now().Add(l.Timeout))
+	if err := tc.Handshake(); err != nil {
+		return err
+	}
+	l.conn = tc
+	l.reader = bufio.NewReader(tc)
+	return nil
+}
+
+// Bind authenticates with a simple bind, an empty password is refused as it would be an unauthenticated bind
+func (l *Conn) Bind(dn string, password string) error {
+	if password == "" {
+		return &Error{Code: ResultBadCreds, Message: "empty password"}
+	}
+	id, err := l.send(berSeq(appBindRequest, berInt(berInteger, 3), berString(berOctetString, dn), berString(authSimple, password)))
+	if err != nil {
+		return err
+	}
+	op, err := l.receive(id)
+	if err != nil {
+		return err
+	}
+	if op.tag != appBindResponse {
+		return errors.New("Unexpected bind response")
+	}
+	return parseResult(op)
+}
+
+// Search returns the entries matching a filter, the references are ignored
+func (l *Conn) Search(base string, scope int, filter string, attributes []string) ([]*Entry, error) {
+	f, err := compileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	var attrs [][]byte
+	for _, a := range attributes {
+		attrs = append(attrs, berString(berOctetString, a))
+	}
+	id, err := l.send(berSeq(appSearchRequest,
+		berString(berOctetString, base),
+		berInt(berEnumerated, int64(scope)),
+		berInt(berEnumerated, derefNever),
+		berInt(berInteger, 0),
+		berInt(berInteger, searchTimeout),
+		berBool(false),
+		f,
+		berSeq(berSequence, attrs...),
+	))
+	if err != nil {
+		return nil, err
+	}
+	var entries []*Entry
+	for {
+		op, err := l.receive(id)
+		if err != nil {
+			return nil, err
+		}
+		switch op.tag {
+		case appSearchEntry:
+			entry, err := parseEntry(op)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		case appSearchReference:
+		case appSearchDone:
+			return entries, parseResult(op)
+		default:
+			return nil, errors.New("Unexpected search response")
+		}
+	}
+}
+
+func parseEntry(op berElement) (*Entry, error) {
+	parts, err := parseElements(op.data)
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) < 2 {
+		return nil, errors.New("Malformed search entry")
+	}
+	entry := &Entry{DN: string(parts[0].data), Attributes: make(map[string][]string)}
+	attrs, err := parseElements(parts[1].data)
+	if err != nil {
+		return nil, err
+	}
+	for _, attr := range attrs {
+		av, err := parseElements(attr.data)
+		if err != nil || len(av) < 2 {
+			return nil, errors.New("Malformed search attribute")
+		}
+		vals, err := parseElements(av[1].data)
+		if err != nil {
+			return nil, err
+		}
+		name := string(av[0].data)
+		for _, v := range vals {
+			entry.Attributes[name] = append(entry.Attributes[name], string(v.data))
+		}
+	}
+	return entry, nil
+}
+
+// Close sends an unbind request and closes the connection
+func (l *Conn) Close() error {
+	l.send(berTLV(appUnbindRequest, nil))
+	return l.conn.Close()
+}
@@ -0,0 +1,179 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package ldap
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+const (
+	filterAnd            = 0xa0
+	filterOr             = 0xa1
+	filterNot            = 0xa2
+	filterEquality       = 0xa3
+	filterSubstrings     = 0xa4
+	filterGreaterOrEqual = 0xa5
+	filterLessOrEqual    = 0xa6
+	filterPresent        = 0x87
+	filterApprox         = 0xa8
+
+	substringInitial = 0x80
+	substringAny     = 0x81
+	substringFinal   = 0x82
+)
+
+var errFilter = errors.New("Invalid LDAP filter")
+
+// EscapeFilter escapes a value inserted in a filter
+func EscapeFilter(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '*', '(', ')', '\\', 0:
+			b.WriteString("\\" + hex.EncodeToString([]byte{c}))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// unescapeFilter decodes the \XX escapes of a filter value
+func unescapeFilter(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b = append(b, s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", errFilter
+		}
+		c, err := hex.DecodeString(s[i+1 : i+3])
+		if err != nil {
+			return "", errFilter
+		}
+		b = append(b, c...)
+		i += 2
+	}
+	return string(b), nil
+}
+
+// compileFilter encodes a RFC 4515 string filter
+func compileFilter(filter string) ([]byte, error) {
+	if !strings.HasPrefix(filter, "(") {
+		filter = "(" + filter + ")"
+	}
+	b, rest, err := parseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, errFilter
+	}
+	return b, nil
+}
+
+func parseFilter(f string) ([]byte, string, error) {
+	if len(f) < 3 || f[0] != '(' {
+		return nil, "", errFilter
+	}
+	f = f[1:]
+	switch f[0] {
+	case '&', '|':
+		tag := byte(filterAnd)
+		if f[0] == '|' {
+			tag = filterOr
+		}
+		f = f[1:]
+		var children [][]byte
+		for len(f) > 0 && f[0] == '(' {
+			child, rest, err := parseFilter(f)
+			if err != nil {
+				return nil, "", err
+			}
+			children = append(children, child)
+			f = rest
+		}
+		if len(f) == 0 || f[0] != ')' {
+			return nil, "", errFilter
+		}
+		return berSeq(tag, children...), f[1:], nil
+	case '!':
+		child, rest, err := parseFilter(f[1:])
+		if err != nil {
+			return nil, "", err
+		}
+		if len(rest) == 0 || rest[0] != ')' {
+			return nil, "", errFilter
+		}
+		return berSeq(filterNot, child), rest[1:], nil
+	}
+	end := strings.IndexByte(f, ')')
+	if end < 0 {
+		return nil, "", errFilter
+	}
+	b, err := parseItem(f[:end])
+	return b, f[end+1:], err
+}
+
+func parseItem(item string) ([]byte, error) {
+	eq := strings.IndexByte(item, '=')
+	if eq < 1 {
+		return nil, errFilter
+	}
+	attr, value := item[:eq], item[eq+1:]
+	tag := byte(filterEquality)
+	switch attr[len(attr)-1] {
+	case '>':
+		tag, attr = filterGreaterOrEqual, attr[:len(attr)-1]
+	case '<':
+		tag, attr = filterLessOrEqual, attr[:len(attr)-1]
+	case '~':
+		tag, attr = filterApprox, attr[:len(attr)-1]
+	}
+	if attr == "" {
+		return nil, errFilter
+	}
+	if tag == filterEquality && value == "*" {
+		return berString(filterPresent, attr), nil
+	}
+	if tag == filterEquality && strings.Contains(value, "*") {
+		parts := strings.Split(value, "*")
+		var subs [][]byte
+		for i, p := range parts {
+			if p == "" {
+				continue
+			}
+			p, err := unescapeFilter(p)
+			if err != nil {
+				return nil, err
+			}
+			subtag := byte(substringAny)
+			if i == 0 {
+				subtag = substringInitial
+			} else if i == len(parts)-1 {
+				subtag = substringFinal
+			}
+			subs = append(subs, berString(subtag, p))
+		}
+		return berSeq(filterSubstrings, berString(berOctetString, attr), berSeq(berSequence, subs...)), nil
+	}
+	value, err := unescapeFilter(value)
+	if err != nil {
+		return nil, err
+	}
+	return berSeq(tag, berString(berOctetString, attr), berString(berOctetString, value)), nil
+}
@@ -0,0 +1,185 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package ldap
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// mockDirectory serves binds and searches of a fixed directory, the filters are compared encoded
+type mockDirectory struct {
+	listener  net.Listener
+	passwords map[string]string
+	entries   map[string][]*Entry
+	binds     int32
+}
+
+func newMockDirectory(t *testing.T) *mockDirectory {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &mockDirectory{
+		listener: l,
+		passwords: map[string]string{
+			"cn=repman,dc=example,dc=com":           "svc",
+			"uid=alice,ou=people,dc=example,dc=com": "alicepw",
+		},
+		entries: make(map[string][]*Entry),
+	}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(c)
+		}
+	}()
+	return d
+}
+
+func (d *mockDirectory) addEntries(filter string, entries ...*Entry) {
+	f, _ := compileFilter(filter)
+	d.entries[string(f)] = entries
+}
+
+func (d *mockDirectory) result(tag byte, code int64) []byte {
+	return berSeq(tag, berInt(berEnumerated, code), berString(berOctetString, ""), berString(berOctetString, ""))
+}
+
+func (d *mockDirectory) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	for {
+		msg, err := readElement(r)
+		if err != nil {
+			return
+		}
+		parts, _ := parseElements(msg.data)
+		id := berInt(berInteger, parseInt(parts[0].data))
+		op := parts[1]
+		reply := func(b []byte) { c.Write(berSeq(berSequence, id, b)) }
+		switch op.tag {
+		case appBindRequest:
+			atomic.AddInt32(&d.binds, 1)
+			req, _ := parseElements(op.data)
+			code := int64(ResultBadCreds)
+			if pw, ok := d.passwords[string(req[1].data)]; ok && pw == string(req[2].data) {
+				code = ResultSuccess
+			}
+			reply(d.result(appBindResponse, code))
+		case appSearchRequest:
+			req, _ := parseElements(op.data)
+			filter := berTLV(req[6].tag, req[6].data)
+			for _, e := range d.entries[string(filter)] {
+				var attrs [][]byte
+				for name, vals := range e.Attributes {
+					var v [][]byte
+					for _, s := range vals {
+						v = append(v, berString(berOctetString, s))
+					}
+					attrs = append(attrs, berSeq(berSequence, berString(berOctetString, name), berSeq(berSet, v...)))
+				}
+				reply(berSeq(appSearchEntry, berString(berOctetString, e.DN), berSeq(berSequence, attrs...)))
+			}
+			reply(d.result(appSearchDone, ResultSuccess))
+		case appUnbindRequest:
+			return
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	f, err := compileFilter("(&(objectClass=person)(|(uid=al*ce)(!(cn=*)))(mail=a\\2ab))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := berSeq(filterAnd,
+		berSeq(filterEquality, berString(berOctetString, "objectClass"), berString(berOctetString, "person")),
+		berSeq(filterOr,
+			berSeq(filterSubstrings, berString(berOctetString, "uid"), berSeq(berSequence, berString(substringInitial, "al"), berString(substringFinal, "ce"))),
+			berSeq(filterNot, berString(filterPresent, "cn")),
+		),
+		berSeq(filterEquality, berString(berOctetString, "mail"), berString(berOctetString, "a*b")),
+	)
+	if !bytes.Equal(f, want) {
+		t.Errorf("Unexpected filter encoding %x", f)
+	}
+	for _, bad := range []string{"(uid=a", "(&(uid=a)", "(=a)", "(uid=a\\2)"} {
+		if _, err := compileFilter(bad); err == nil {
+			t.Errorf("Invalid filter %s compiled", bad)
+		}
+	}
+	if EscapeFilter("a*(b)\\") != "a\\2a\\28b\\29\\5c" {
+		t.Errorf("Unexpected escape %s", EscapeFilter("a*(b)\\"))
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	d := newMockDirectory(t)
+	defer d.listener.Close()
+	d.addEntries("(uid=alice)", &Entry{
+		DN: "uid=alice,ou=people,dc=example,dc=com",
+		Attributes: map[string][]string{
+			"memberOf": {"cn=dba,ou=groups,dc=example,dc=com", "cn=backup\\, ops,ou=groups,dc=example,dc=com"},
+		},
+	})
+	d.addEntries("(member=uid=alice,ou=people,dc=example,dc=com)", &Entry{DN: "cn=dba,ou=groups,dc=example,dc=com", Attributes: map[string][]string{"cn": {"dba"}}})
+
+	a := &Authenticator{
+		URL:            "ldap://" + d.listener.Addr().String(),
+		BindDN:         "cn=repman,dc=example,dc=com",
+		BindPassword:   "svc",
+		UserBase:       "ou=people,dc=example,dc=com",
+		UserFilter:     "(uid=%s)",
+		GroupAttribute: "memberOf",
+		CacheTTL:       time.Minute,
+	}
+	groups, err := a.Authenticate("alice", "alicepw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 || groups[0] != "dba" || groups[1] != "backup, ops" {
+		t.Errorf("Unexpected groups %v", groups)
+	}
+	binds := atomic.LoadInt32(&d.binds)
+	if groups, err := a.Lookup("alice"); err != nil || len(groups) != 2 || atomic.LoadInt32(&d.binds) != binds {
+		t.Errorf("Cached groups not reused: %v %v", groups, err)
+	}
+	if _, err := a.Authenticate("alice", "alicepw"); err != nil || atomic.LoadInt32(&d.binds) == binds {
+		t.Errorf("Password not checked again: %v", err)
+	}
+	if _, err := a.Authenticate("alice", "wrong"); !IsInvalidCredentials(err) {
+		t.Errorf("Wrong password accepted: %v", err)
+	}
+	if _, err := a.Authenticate("alice", ""); err == nil {
+		t.Error("Empty password accepted")
+	}
+	if _, err := a.Authenticate("bob", "bobpw"); err != ErrUserNotFound {
+		t.Errorf("Unknown user: %v", err)
+	}
+	if _, err := a.Lookup("bob"); err != ErrUserNotFound {
+		t.Errorf("Unknown user lookup: %v", err)
+	}
+
+	a.GroupBase = "ou=groups,dc=example,dc=com"
+	a.GroupFilter = "(member=%s)"
+	a.CacheTTL = 0
+	groups, err = a.Authenticate("alice", "alicepw")
+	if err != nil || len(groups) != 1 || groups[0] != "dba" {
+		t.Errorf("Unexpected group search %v %v", groups, err)
+	}
+}
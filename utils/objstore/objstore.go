@@ -0,0 +1,226 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package objstore
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+const (
+	SSENone   string = ""
+	SSEAES256 string = "AES256"
+	SSEKMS    string = "aws:kms"
+)
+
+// Config describes an S3 compatible bucket
+type Config struct {
+	Endpoint    string
+	Region      string
+	Bucket      string
+	AccessKey   string
+	SecretKey   string
+	PathStyle   bool
+	SSE         string
+	SSEKmsKeyId string
+	PartSize    int64
+	Concurrency int
+}
+
+// Object is an object of the bucket
+type Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// Snapshot is the set of objects sharing the same prefix directory, one backup
+type Snapshot struct {
+	Prefix  string
+	Time    time.Time
+	Size    int64
+	Objects []Object
+}
+
+// Store uploads, lists and deletes backups of a bucket
+type Store struct {
+	Conf     Config
+	client   *s3.S3
+	uploader *s3manager.Uploader
+}
+
+// New returns a store for the bucket of the configuration
+func New(conf Config) (*Store, error) {
+	if conf.Bucket == "" {
+		return nil, errors.New("No bucket defined")
+	}
+	switch conf.SSE {
+	case SSENone, SSEAES256, SSEKMS:
+	default:
+		return nil, errors.New("Unknown server side encryption " + conf.SSE)
+	}
+	awsConf := aws.NewConfig().WithS3ForcePathStyle(conf.PathStyle)
+	if conf.Region != "" {
+		awsConf = awsConf.WithRegion(conf.Region)
+	} else {
+		awsConf = awsConf.WithRegion("us-east-1")
+	}
+	if conf.Endpoint != "" {
+		awsConf = awsConf.WithEndpoint(conf.Endpoint)
+	}
+	if conf.AccessKey != "" {
+		awsConf = awsConf.WithCredentials(credentials.NewStaticCredentials(conf.AccessKey, conf.SecretKey, ""))
+	}
+	sess, err := session.NewSession(awsConf)
+	if err != nil {
+		return nil, err
+	}
+	st := new(Store)
+	st.Conf = conf
+	st.client = s3.New(sess)
+	st.uploader = s3manager.NewUploaderWithClient(st.client, func(u *s3manager.Uploader) {
+		if conf.PartSize >= s3manager.MinUploadPartSize {
+			u.PartSize = conf.PartSize
+		}
+		if conf.Concurrency > 0 {
+			u.Concurrency = conf.Concurrency
+		}
+	})
+	return st, nil
+}
+
+// URL returns the s3:// location of a key
+func (st *Store) URL(key string) string {
+	return "s3://" + st.Conf.Bucket + "/" + key
+}
+
+// Upload streams a reader to a key, objects bigger than the part size use multipart upload
+func (st *Store) Upload(key string, r io.Reader) error {
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(st.Conf.Bucket),
+		Key:    aws.String(key),
+		Body:   r,
+	}
+	if st.Conf.SSE != SSENone {
+		input.ServerSideEncryption = aws.String(st.Conf.SSE)
+		if st.Conf.SSE == SSEKMS && st.Conf.SSEKmsKeyId != "" {
+			input.SSEKMSKeyId = aws.String(st.Conf.SSEKmsKeyId)
+		}
+	}
+	_, err := st.uploader.Upload(input)
+	return err
+}
+
+// Download copies a key to a writer
+func (st *Store) Download(key string, w io.Writer) error {
+	out, err := st.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(st.Conf.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return err
+	}
+	defer out.Body.Close()
+	_, err = io.Copy(w, out.Body)
+	return err
+}
+
+// List returns the objects under a prefix
+func (st *Store) List(prefix string) ([]Object, error) {
+	var objects []Object
+	err := st.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(st.Conf.Bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, last bool) bool {
+		for _, o := range page.Contents {
+			objects = append(objects, Object{Key: aws.StringValue(o.Key), Size: aws.Int64Value(o.Size), LastModified: aws.TimeValue(o.LastModified)})
+		}
+		return true
+	})
+	return objects, err
+}
+
+// Delete removes keys by batch of 1000, the maximum of a delete request
+func (st *Store) Delete(keys []string) error {
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > 1000 {
+			n = 1000
+		}
+		del := &s3.Delete{Quiet: aws.Bool(true)}
+		for _, k := range keys[:n] {
+			del.Objects = append(del.Objects, &s3.ObjectIdentifier{Key: aws.String(k)})
+		}
+		out, err := st.client.DeleteObjects(&s3.DeleteObjectsInput{Bucket: aws.String(st.Conf.Bucket), Delete: del})
+		if err != nil {
+			return err
+		}
+		if len(out.Errors) > 0 {
+			return errors.New("Delete " + aws.StringValue(out.Errors[0].Key) + ": " + aws.StringValue(out.Errors[0].Message))
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
+
+// ListSnapshots groups the objects under a prefix by their first sub directory, newest first
+func (st *Store) ListSnapshots(prefix string) ([]Snapshot, error) {
+	objects, err := st.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return GroupSnapshots(prefix, objects), nil
+}
+
+// GroupSnapshots groups objects by their first sub directory under the prefix, newest first
+func GroupSnapshots(prefix string, objects []Object) []Snapshot {
+	index := make(map[string]int)
+	var snapshots []Snapshot
+	for _, o := range objects {
+		name := strings.TrimPrefix(o.Key, prefix)
+		i := strings.Index(name, "/")
+		if i <= 0 {
+			continue
+		}
+		p := prefix + name[:i+1]
+		k, ok := index[p]
+		if !ok {
+			k = len(snapshots)
+			index[p] = k
+			snapshots = append(snapshots, Snapshot{Prefix: p})
+		}
+		s := &snapshots[k]
+		s.Objects = append(s.Objects, o)
+		s.Size += o.Size
+		if o.LastModified.After(s.Time) {
+			s.Time = o.LastModified
+		}
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Time.After(snapshots[j].Time) })
+	return snapshots
+}
+
+// DeleteSnapshot removes every object of a snapshot
+func (st *Store) DeleteSnapshot(s Snapshot) error {
+	keys := make([]string, 0, len(s.Objects))
+	for _, o := range s.Objects {
+		keys = append(keys, o.Key)
+	}
+	return st.Delete(keys)
+}
@@ -0,0 +1,176 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package objstore
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is a minimal path style S3 stand-in keeping objects in memory
+type fakeS3 struct {
+	sync.Mutex
+	objects map[string][]byte
+	parts   map[string]map[int][]byte
+	sse     []string
+	uploads int
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: make(map[string][]byte), parts: make(map[string]map[int][]byte)}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	path := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	key := ""
+	if len(path) == 2 {
+		key = path[1]
+	}
+	q := r.URL.Query()
+	body, _ := ioutil.ReadAll(r.Body)
+	switch {
+	case r.Method == "POST" && q.Get("uploads") == "" && strings.Contains(r.URL.RawQuery, "uploads"):
+		f.uploads++
+		id := strconv.Itoa(f.uploads)
+		f.parts[id] = make(map[int][]byte)
+		f.sse = append(f.sse, r.Header.Get("X-Amz-Server-Side-Encryption"))
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>", path[0], key, id)
+	case r.Method == "PUT" && q.Get("uploadId") != "":
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		f.parts[q.Get("uploadId")][n] = body
+		w.Header().Set("ETag", fmt.Sprintf("\"%d\"", n))
+	case r.Method == "POST" && q.Get("uploadId") != "":
+		parts := f.parts[q.Get("uploadId")]
+		var nums []int
+		for n := range parts {
+			nums = append(nums, n)
+		}
+		sort.Ints(nums)
+		var data []byte
+		for _, n := range nums {
+			data = append(data, parts[n]...)
+		}
+		f.objects[key] = data
+		fmt.Fprintf(w, "<CompleteMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><ETag>\"x\"</ETag></CompleteMultipartUploadResult>", path[0], key)
+	case r.Method == "PUT":
+		f.objects[key] = body
+		f.sse = append(f.sse, r.Header.Get("X-Amz-Server-Side-Encryption"))
+		w.Header().Set("ETag", "\"x\"")
+	case r.Method == "GET" && q.Get("list-type") == "2":
+		var keys []string
+		for k := range f.objects {
+			if strings.HasPrefix(k, q.Get("prefix")) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(w, "<ListBucketResult><Name>%s</Name><KeyCount>%d</KeyCount><IsTruncated>false</IsTruncated>", path[0], len(keys))
+		for _, k := range keys {
+			fmt.Fprintf(w, "<Contents><Key>%s</Key><Size>%d</Size><LastModified>%s</LastModified></Contents>", k, len(f.objects[k]), time.Now().UTC().Format(time.RFC3339))
+		}
+		fmt.Fprint(w, "</ListBucketResult>")
+	case r.Method == "GET":
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "<Error><Code>NoSuchKey</Code></Error>")
+			return
+		}
+		w.Write(data)
+	case r.Method == "POST" && strings.Contains(r.URL.RawQuery, "delete"):
+		var del struct {
+			Objects []struct {
+				Key string
+			} `xml:"Object"`
+		}
+		xml.Unmarshal(body, &del)
+		for _, o := range del.Objects {
+			delete(f.objects, o.Key)
+		}
+		fmt.Fprint(w, "<DeleteResult></DeleteResult>")
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func TestStoreUpload(t *testing.T) {
+	fake := newFakeS3()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	st, err := New(Config{Endpoint: srv.URL, Bucket: "backups", AccessKey: "key", SecretKey: "secret", PathStyle: true, SSE: SSEAES256, PartSize: 5 * 1024 * 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	big := bytes.Repeat([]byte("0123456789"), 1200*1024)
+	if err := st.Upload("c1/db1_3306/mysqldump/1/mysqldump.sql.gz", bytes.NewReader(big)); err != nil {
+		t.Fatal(err)
+	}
+	if fake.uploads != 1 {
+		t.Fatalf("Expected one multipart upload, got %d", fake.uploads)
+	}
+	if err := st.Upload("c1/db1_3306/mysqldump/2/mysqldump.sql.gz", strings.NewReader("small")); err != nil {
+		t.Fatal(err)
+	}
+	for _, sse := range fake.sse {
+		if sse != SSEAES256 {
+			t.Fatalf("Expected server side encryption header, got %q", sse)
+		}
+	}
+	var out bytes.Buffer
+	if err := st.Download("c1/db1_3306/mysqldump/1/mysqldump.sql.gz", &out); err != nil || !bytes.Equal(out.Bytes(), big) {
+		t.Fatalf("Expected multipart object to be reassembled, got %d bytes %v", out.Len(), err)
+	}
+	snapshots, err := st.ListSnapshots("c1/db1_3306/mysqldump/")
+	if err != nil || len(snapshots) != 2 {
+		t.Fatalf("Expected 2 snapshots, got %v %v", snapshots, err)
+	}
+	if err := st.DeleteSnapshot(snapshots[0]); err != nil {
+		t.Fatal(err)
+	}
+	if objects, _ := st.List("c1/"); len(objects) != 1 {
+		t.Fatalf("Expected 1 object left, got %v", objects)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	now := time.Date(2020, 6, 15, 12, 0, 0, 0, time.UTC)
+	var snapshots []Snapshot
+	// one backup every 6 hours for 40 days
+	for i := 0; i < 160; i++ {
+		snapshots = append(snapshots, Snapshot{Prefix: strconv.Itoa(i), Time: now.Add(-time.Duration(i) * 6 * time.Hour)})
+	}
+	keep, expired := Retention{Hourly: 1, Daily: 3, Weekly: 2, Monthly: 2}.Apply(snapshots)
+	if len(keep)+len(expired) != len(snapshots) {
+		t.Fatal("Expected every snapshot to be kept or expired")
+	}
+	if keep[0].Prefix != "0" {
+		t.Fatal("Expected newest snapshot to be kept")
+	}
+	// newest of 3 days, the previous week is the second day, then the last of May
+	if len(keep) != 4 {
+		t.Fatalf("Expected 4 kept snapshots, got %d", len(keep))
+	}
+	if keep, expired = (Retention{}).Apply(snapshots); len(expired) != 0 || len(keep) != len(snapshots) {
+		t.Fatal("Expected empty retention to keep everything")
+	}
+}
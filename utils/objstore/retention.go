@@ -0,0 +1,74 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package objstore
+
+import (
+	"fmt"
+	"time"
+)
+
+// Retention keeps the newest snapshot of the last N hours, days, weeks, months and years,
+// the same policy as restic forget with the backup-keep-* settings
+type Retention struct {
+	Hourly  int
+	Daily   int
+	Weekly  int
+	Monthly int
+	Yearly  int
+}
+
+type retentionBucket struct {
+	keep   int
+	period func(t time.Time) string
+	last   string
+}
+
+// IsEmpty is true when no period is configured, everything is kept
+func (r Retention) IsEmpty() bool {
+	return r.Hourly <= 0 && r.Daily <= 0 && r.Weekly <= 0 && r.Monthly <= 0 && r.Yearly <= 0
+}
+
+// Apply splits snapshots sorted newest first into the kept and the expired ones,
+// the newest snapshot is always kept
+func (r Retention) Apply(snapshots []Snapshot) (keep []Snapshot, expired []Snapshot) {
+	if r.IsEmpty() {
+		return snapshots, nil
+	}
+	buckets := []*retentionBucket{
+		{keep: r.Hourly, period: func(t time.Time) string { return t.Format("2006-01-02 15") }},
+		{keep: r.Daily, period: func(t time.Time) string { return t.Format("2006-01-02") }},
+		{keep: r.Weekly, period: func(t time.Time) string {
+			y, w := t.ISOWeek()
+			return fmt.Sprintf("%d-%02d", y, w)
+		}},
+		{keep: r.Monthly, period: func(t time.Time) string { return t.Format("2006-01") }},
+		{keep: r.Yearly, period: func(t time.Time) string { return t.Format("2006") }},
+	}
+	for i, s := range snapshots {
+		kept := i == 0
+		for _, b := range buckets {
+			if b.keep <= 0 {
+				continue
+			}
+			p := b.period(s.Time.UTC())
+			if p != b.last {
+				b.last = p
+				b.keep--
+				kept = true
+			}
+		}
+		if kept {
+			keep = append(keep, s)
+		} else {
+			expired = append(expired, s)
+		}
+	}
+	return keep, expired
+}
@@ -0,0 +1,315 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+// Package oidc is an OpenID Connect relying party: it discovers the endpoints of an issuer, exchanges
+// authorization codes for tokens and validates the tokens signed by the keys of the issuer JWKS.
+package oidc
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// jwksMinRefresh limits the JWKS downloads triggered by tokens signed with an unknown key
+const jwksMinRefresh = time.Minute
+
+// Discovery is the OpenID provider metadata of an issuer
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+// TokenResponse is the response of the token endpoint
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IdToken     string `json:"id_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// Provider validates the tokens of an issuer, the audience is the client id unless set
+type Provider struct {
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	Audience     string
+	// JwksURL overrides the jwks_uri of the discovery
+	JwksURL   string
+	client    *http.Client
+	mutex     sync.Mutex
+	discovery *Discovery
+	keys      map[string]*rsa.PublicKey
+	keysTime  time.Time
+}
+
+func NewProvider(issuer string, clientId string, clientSecret string, redirectURL string) *Provider {
+	return &Provider{
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"openid", "profile", "email"},
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *Provider) getJSON(u string, v interface{}) error {
+	resp, err := p.client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Discover returns the metadata of the issuer, it is fetched once
+func (p *Provider) Discover() (*Discovery, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.discover()
+}
+
+func (p *Provider) discover() (*Discovery, error) {
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	d := new(Discovery)
+	if err := p.getJSON(p.Issuer+"/.well-known/openid-configuration", d); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("Discovery issuer %s does not match %s", d.Issuer, p.Issuer)
+	}
+	p.discovery = d
+	return d, nil
+}
+
+// AuthCodeURL returns the authorization endpoint URL the user agent is redirected to, the nonce is returned in
+// the id token
+func (p *Provider) AuthCodeURL(state string, nonce string) (string, error) {
+	d, err := p.Discover()
+	if err != nil {
+		return "", err
+	}
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.ClientId)
+	v.Set("redirect_uri", p.RedirectURL)
+	v.Set("scope", strings.Join(p.Scopes, " "))
+	v.Set("state", state)
+	if nonce != "" {
+		v.Set("nonce", nonce)
+	}
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + v.Encode(), nil
+}
+
+// Exchange trades an authorization code for the tokens of the user
+func (p *Provider) Exchange(code string) (*TokenResponse, error) {
+	d, err := p.Discover()
+	if err != nil {
+		return nil, err
+	}
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", code)
+	v.Set("redirect_uri", p.RedirectURL)
+	req, err := http.NewRequest("POST", d.TokenEndpoint, strings.NewReader(v.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.ClientId), url.QueryEscape(p.ClientSecret))
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Token endpoint returned %s", resp.Status)
+	}
+	tr := new(TokenResponse)
+	if err := json.NewDecoder(resp.Body).Decode(tr); err != nil {
+		return nil, err
+	}
+	if tr.IdToken == "" {
+		return nil, errors.New("Token endpoint returned no id_token")
+	}
+	return tr, nil
+}
+
+// getKey returns the public key of a key id, the JWKS is downloaded again for an unknown key
+func (p *Provider) getKey(kid string) (*rsa.PublicKey, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysTime) < jwksMinRefresh {
+		return nil, fmt.Errorf("Unknown signing key %s", kid)
+	}
+	jwksURL := p.JwksURL
+	if jwksURL == "" {
+		d, err := p.discover()
+		if err != nil {
+			return nil, err
+		}
+		jwksURL = d.JwksURI
+	}
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(jwksURL, &jwks); err != nil {
+		return nil, err
+	}
+	p.keysTime = time.Now()
+	p.keys = make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		key, err := parseRSAKey(k)
+		if err != nil {
+			continue
+		}
+		p.keys[k.Kid] = key
+	}
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	// a single key without kid signs the tokens without kid header
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown signing key %s", kid)
+}
+
+func parseRSAKey(k jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(k.N, "="))
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(k.E, "="))
+	if err != nil {
+		return nil, err
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+// KeyFunc returns the key verifying a token of the issuer, only RSA signatures are accepted
+func (p *Provider) KeyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		return nil, fmt.Errorf("Unexpected signing method %v", token.Header["alg"])
+	}
+	kid, _ := token.Header["kid"].(string)
+	return p.getKey(kid)
+}
+
+// IsIssuer returns true when the unverified claims of a token were issued by the provider
+func (p *Provider) IsIssuer(claims jwt.MapClaims) bool {
+	iss, _ := claims["iss"].(string)
+	return iss != "" && strings.TrimSuffix(iss, "/") == p.Issuer
+}
+
+// Verify validates the signature, the expiry, the issuer and the audience of a token
+func (p *Provider) Verify(raw string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(raw, p.KeyFunc)
+	if err != nil {
+		return nil, err
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	if err := p.VerifyClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// VerifyClaims validates the issuer and the audience of the claims of a verified token
+func (p *Provider) VerifyClaims(claims jwt.MapClaims) error {
+	if !p.IsIssuer(claims) {
+		return errors.New("Token issuer mismatch")
+	}
+	aud := p.Audience
+	if aud == "" {
+		aud = p.ClientId
+	}
+	if aud != "" && !HasClaim(claims, "aud", aud) {
+		return errors.New("Token audience mismatch")
+	}
+	return nil
+}
+
+// GetClaimStrings returns a string or a list of strings claim
+func GetClaimStrings(claims jwt.MapClaims, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var res []string
+		for _, s := range v {
+			if str, ok := s.(string); ok {
+				res = append(res, str)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+// HasClaim returns true when a string or a list of strings claim holds a value
+func HasClaim(claims jwt.MapClaims, name string, value string) bool {
+	for _, v := range GetClaimStrings(claims, name) {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// GetUser returns the first non empty claim of a list, sub is the last resort
+func GetUser(claims jwt.MapClaims, names ...string) string {
+	for _, name := range append(names, "sub") {
+		if v, ok := claims[name].(string); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
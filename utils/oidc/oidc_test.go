@@ -0,0 +1,128 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// mockIssuer is a local OpenID provider signing its tokens with a generated key
+type mockIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Discovery{
+			Issuer:                m.URL,
+			AuthorizationEndpoint: m.URL + "/authorize",
+			TokenEndpoint:         m.URL + "/token",
+			JwksURI:               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []jsonWebKey{{
+			Kid: "k1",
+			Kty: "RSA",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if user != "repman" || pass != "secret" || r.FormValue("code") != "good" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(TokenResponse{IdToken: m.sign(t, "k1", jwt.MapClaims{"iss": m.URL, "aud": "repman", "preferred_username": "alice", "groups": []string{"dba"}, "exp": time.Now().Add(time.Hour).Unix()})})
+	})
+	m.Server = httptest.NewServer(mux)
+	return m
+}
+
+func (m *mockIssuer) sign(t *testing.T, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	s, err := token.SignedString(m.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestProvider(t *testing.T) {
+	m := newMockIssuer(t)
+	defer m.Close()
+	p := NewProvider(m.URL, "repman", "secret", "https://repman/api/auth/oidc/callback")
+
+	u, err := p.AuthCodeURL("xyz", "n0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pu, _ := url.Parse(u)
+	if pu.Path != "/authorize" || pu.Query().Get("state") != "xyz" || pu.Query().Get("nonce") != "n0" || pu.Query().Get("client_id") != "repman" {
+		t.Errorf("Unexpected authorization URL %s", u)
+	}
+
+	if _, err := p.Exchange("bad"); err == nil {
+		t.Error("Bad code exchanged")
+	}
+	tr, err := p.Exchange("good")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := p.Verify(tr.IdToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if GetUser(claims, "preferred_username") != "alice" || !HasClaim(claims, "groups", "dba") {
+		t.Errorf("Unexpected claims %v", claims)
+	}
+
+	exp := time.Now().Add(time.Hour).Unix()
+	for name, token := range map[string]string{
+		"audience": m.sign(t, "k1", jwt.MapClaims{"iss": m.URL, "aud": "other", "exp": exp}),
+		"issuer":   m.sign(t, "k1", jwt.MapClaims{"iss": "https://evil", "aud": "repman", "exp": exp}),
+		"expired":  m.sign(t, "k1", jwt.MapClaims{"iss": m.URL, "aud": "repman", "exp": time.Now().Add(-time.Hour).Unix()}),
+		"kid":      m.sign(t, "k2", jwt.MapClaims{"iss": m.URL, "aud": "repman", "exp": exp}),
+		"hmac":     hmacToken(t, m.URL),
+	} {
+		if _, err := p.Verify(token); err == nil {
+			t.Errorf("Token with bad %s verified", name)
+		}
+	}
+}
+
+func hmacToken(t *testing.T, iss string) string {
+	s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iss": iss, "aud": "repman"}).SignedString([]byte("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
@@ -0,0 +1,158 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+// Package prometheus writes metrics in the Prometheus text exposition format. The samples of a
+// metric family are grouped under a single HELP and TYPE header whatever the order they are added.
+package prometheus
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the content type of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Metric types
+const (
+	Gauge   = "gauge"
+	Counter = "counter"
+	Untyped = "untyped"
+)
+
+// Labels are the labels of a sample, they are written sorted by name
+type Labels map[string]string
+
+type sample struct {
+	labels Labels
+	value  float64
+}
+
+type family struct {
+	name    string
+	help    string
+	typ     string
+	samples []sample
+}
+
+// Registry collects the samples of a scrape
+type Registry struct {
+	families []*family
+	index    map[string]*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{index: make(map[string]*family)}
+}
+
+// Add adds a sample, the help and the type of a family are the ones of its first sample
+func (r *Registry) Add(name string, typ string, help string, value float64, labels Labels) {
+	name = Name(name)
+	f, ok := r.index[name]
+	if !ok {
+		f = &family{name: name, help: help, typ: typ}
+		r.index[name] = f
+		r.families = append(r.families, f)
+	}
+	f.samples = append(f.samples, sample{labels: labels, value: value})
+}
+
+// AddString adds a sample from a string value, the values that are not numbers are skipped
+func (r *Registry) AddString(name string, typ string, help string, value string, labels Labels) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return
+	}
+	r.Add(name, typ, help, v, labels)
+}
+
+// Gauge adds a gauge sample
+func (r *Registry) Gauge(name string, help string, value float64, labels Labels) {
+	r.Add(name, Gauge, help, value, labels)
+}
+
+// Counter adds a counter sample
+func (r *Registry) Counter(name string, help string, value float64, labels Labels) {
+	r.Add(name, Counter, help, value, labels)
+}
+
+// Bool returns 1 for true and 0 for false
+func Bool(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Name returns a valid metric name, the invalid characters are replaced by underscores
+func Name(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if c == '_' || c == ':' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9') {
+			continue
+		}
+		b[i] = '_'
+	}
+	return string(b)
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// WriteTo writes the families in the order they were first added
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	var n int64
+	write := func(s string) {
+		m, _ := bw.WriteString(s)
+		n += int64(m)
+	}
+	for _, f := range r.families {
+		if f.help != "" {
+			write("# HELP " + f.name + " " + helpReplacer.Replace(f.help) + "\n")
+		}
+		write("# TYPE " + f.name + " " + f.typ + "\n")
+		for _, s := range f.samples {
+			write(f.name)
+			if len(s.labels) > 0 {
+				names := make([]string, 0, len(s.labels))
+				for k := range s.labels {
+					names = append(names, k)
+				}
+				sort.Strings(names)
+				write("{")
+				for i, k := range names {
+					if i > 0 {
+						write(",")
+					}
+					write(Name(k) + "=\"" + labelReplacer.Replace(s.labels[k]) + "\"")
+				}
+				write("}")
+			}
+			write(" " + formatValue(s.value) + "\n")
+		}
+	}
+	return n, bw.Flush()
+}
@@ -0,0 +1,49 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package prometheus
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.Gauge("up", "Server is up", 1, Labels{"server": "db1:3306", "cluster": "c1"})
+	r.Counter("failover_total", "Failovers", 2, Labels{"cluster": "c1"})
+	r.Gauge("up", "", 0, Labels{"server": "db2:3306", "cluster": "c1"})
+	r.AddString("mysql_global_status_uptime", Untyped, "", "12", nil)
+	r.AddString("mysql_global_status_version", Untyped, "", "10.5.8-MariaDB", nil)
+	r.Gauge("state", "Open state", 1, Labels{"desc": "say \"hi\"\n"})
+	r.Gauge("pfs.digest-1", "", 0, nil)
+
+	var b bytes.Buffer
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP up Server is up
+# TYPE up gauge
+up{cluster="c1",server="db1:3306"} 1
+up{cluster="c1",server="db2:3306"} 0
+# HELP failover_total Failovers
+# TYPE failover_total counter
+failover_total{cluster="c1"} 2
+# TYPE mysql_global_status_uptime untyped
+mysql_global_status_uptime 12
+# HELP state Open state
+# TYPE state gauge
+state{desc="say \"hi\"\n"} 1
+# TYPE pfs_digest_1 gauge
+pfs_digest_1 0
+`
+	if b.String() != want {
+		t.Errorf("Unexpected exposition:\n%s", b.String())
+	}
+}
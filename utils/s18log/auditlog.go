@@ -0,0 +1,136 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package s18log
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/syslog"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditRecord is an action of an API user
+type AuditRecord struct {
+	Timestamp  time.Time         `json:"timestamp"`
+	User       string            `json:"user"`
+	Source     string            `json:"source"`
+	Cluster    string            `json:"cluster,omitempty"`
+	Method     string            `json:"method"`
+	Endpoint   string            `json:"endpoint"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+	Status     int               `json:"status"`
+	Result     string            `json:"result"`
+	Duration   float64           `json:"duration"`
+}
+
+// AuditFilter selects the records of a search, the empty fields match all records
+type AuditFilter struct {
+	Cluster string
+	User    string
+	From    time.Time
+	To      time.Time
+	Limit   int
+}
+
+// Match returns true when a record is selected by the filter
+func (f *AuditFilter) Match(r *AuditRecord) bool {
+	if f.Cluster != "" && r.Cluster != f.Cluster {
+		return false
+	}
+	if f.User != "" && r.User != f.User {
+		return false
+	}
+	if !f.From.IsZero() && r.Timestamp.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && r.Timestamp.After(f.To) {
+		return false
+	}
+	return true
+}
+
+// AuditLog writes the records as JSON lines to a file opened in append mode, and to syslog when enabled. The file
+// is not rotated, an external rotation must truncate it in place as it is kept open.
+type AuditLog struct {
+	Path   string
+	file   *os.File
+	syslog *syslog.Writer
+	L      sync.Mutex
+}
+
+// NewAuditLog opens the audit file, the syslog is the local one used by log-syslog
+func NewAuditLog(path string, useSyslog bool) (*AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	al := &AuditLog{Path: path, file: file}
+	if useSyslog {
+		al.syslog, err = syslog.Dial("udp", "localhost:514", syslog.LOG_INFO|syslog.LOG_AUTH, "replication-manager-audit")
+		if err != nil {
+			return al, err
+		}
+	}
+	return al, nil
+}
+
+// Add appends a record
+func (al *AuditLog) Add(r AuditRecord) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	al.L.Lock()
+	defer al.L.Unlock()
+	if al.syslog != nil {
+		al.syslog.Info(string(line))
+	}
+	_, err = al.file.Write(append(line, '\n'))
+	return err
+}
+
+// Search returns the latest records selected by a filter, newest first. The file is read with its own read-only
+// handle without blocking Add, a line being appended is not complete and is skipped.
+func (al *AuditLog) Search(f AuditFilter) ([]AuditRecord, error) {
+	file, err := os.Open(al.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var records []AuditRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r AuditRecord
+		if json.Unmarshal(scanner.Bytes(), &r) != nil || !f.Match(&r) {
+			continue
+		}
+		records = append(records, r)
+		if f.Limit > 0 && len(records) > f.Limit {
+			records = records[1:]
+		}
+	}
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	return records, scanner.Err()
+}
+
+// Close closes the file and the syslog connection
+func (al *AuditLog) Close() error {
+	al.L.Lock()
+	defer al.L.Unlock()
+	if al.syslog != nil {
+		al.syslog.Close()
+	}
+	return al.file.Close()
+}
@@ -0,0 +1,84 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package s18log
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "repman")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	al, err := NewAuditLog(dir+"/audit.log", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i, r := range []AuditRecord{
+		{Timestamp: now.Add(-time.Hour), User: "admin", Cluster: "c1", Endpoint: "/api/clusters/{clusterName}/actions/switchover"},
+		{Timestamp: now, User: "token:1f0c", Cluster: "c2", Endpoint: "/api/clusters/{clusterName}/actions/failover"},
+		{Timestamp: now, User: "admin", Cluster: "c1", Endpoint: "/api/clusters/{clusterName}/settings/actions/set/{settingName}/{settingValue}"},
+	} {
+		if err := al.Add(r); err != nil {
+			t.Fatalf("Record %d: %s", i, err)
+		}
+	}
+	al.Close()
+
+	// the records are appended to the existing file
+	al, err = NewAuditLog(dir+"/audit.log", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer al.Close()
+	al.Add(AuditRecord{Timestamp: now, User: "bob", Cluster: "c1"})
+	records, err := al.Search(AuditFilter{Cluster: "c1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[0].User != "bob" || records[2].Endpoint != "/api/clusters/{clusterName}/actions/switchover" {
+		t.Errorf("Unexpected records %v", records)
+	}
+	records, _ = al.Search(AuditFilter{Cluster: "c1", User: "admin", From: now.Add(-time.Minute), Limit: 1})
+	if len(records) != 1 || records[0].Timestamp.Before(now.Add(-time.Minute)) {
+		t.Errorf("Unexpected filtered records %v", records)
+	}
+}
+
+func TestAuditLogSearchDuringAdd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "repman")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	al, err := NewAuditLog(dir+"/audit.log", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer al.Close()
+	al.Add(AuditRecord{Timestamp: time.Now(), User: "admin", Cluster: "c1"})
+	// a record being written by Add holds the lock and is not complete yet
+	al.L.Lock()
+	al.file.Write([]byte(`{"timestamp":"2020-03-02T10:41:07Z","user":"bob","clus`))
+	records, err := al.Search(AuditFilter{Cluster: "c1"})
+	al.L.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].User != "admin" {
+		t.Errorf("Unexpected records %v", records)
+	}
+}
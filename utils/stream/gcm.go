@@ -0,0 +1,190 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package stream
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// An encrypted stream is the magic, a random salt and a sequence of sealed chunks. The key of the stream is
+// derived from the backup key and its salt, so the many streams of a backup never share a key and nonce. Each
+// chunk is prefixed by its sealed length, the high bit flags the last chunk, the nonce is the chunk counter and
+// the last chunk flag is authenticated, so reordered, dropped or truncated chunks fail to decrypt.
+const (
+	gcmMagic       = "RMBKGCM2"
+	gcmSaltSize    = 32
+	gcmChunkSize   = 64 * 1024
+	gcmFinalFlag   = 1 << 31
+	gcmMaxSealSize = gcmChunkSize + 16
+)
+
+var ErrTruncated = errors.New("Encrypted stream is truncated")
+
+// newGCM returns the cipher of a stream keyed with HKDF-SHA256 of the backup key and the stream salt
+func newGCM(key []byte, salt []byte) (cipher.AEAD, error) {
+	streamKey := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, salt, []byte(gcmMagic)), streamKey); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(streamKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func gcmNonce(counter uint64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], counter)
+	return nonce
+}
+
+func gcmAdditionalData(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+type gcmWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	counter uint64
+	buf     []byte
+	closed  bool
+}
+
+func newGCMWriter(w io.Writer, key []byte) (*gcmWriter, error) {
+	salt := make([]byte, gcmSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, gcmMagic); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(salt); err != nil {
+		return nil, err
+	}
+	return &gcmWriter{w: w, aead: aead, buf: make([]byte, 0, gcmChunkSize)}, nil
+}
+
+func (g *gcmWriter) seal(final bool) error {
+	sealed := g.aead.Seal(nil, gcmNonce(g.counter), g.buf, gcmAdditionalData(final))
+	g.counter++
+	g.buf = g.buf[:0]
+	size := uint32(len(sealed))
+	if final {
+		size |= gcmFinalFlag
+	}
+	head := make([]byte, 4)
+	binary.BigEndian.PutUint32(head, size)
+	if _, err := g.w.Write(head); err != nil {
+		return err
+	}
+	_, err := g.w.Write(sealed)
+	return err
+}
+
+func (g *gcmWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		// keep a full chunk buffered so the last one is sealed on close
+		if len(g.buf) == gcmChunkSize {
+			if err := g.seal(false); err != nil {
+				return n, err
+			}
+		}
+		c := copy(g.buf[len(g.buf):gcmChunkSize], p)
+		g.buf = g.buf[:len(g.buf)+c]
+		p = p[c:]
+		n += c
+	}
+	return n, nil
+}
+
+func (g *gcmWriter) Close() error {
+	if g.closed {
+		return nil
+	}
+	g.closed = true
+	return g.seal(true)
+}
+
+type gcmReader struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	counter uint64
+	plain   []byte
+	final   bool
+}
+
+// newGCMReader reads an encrypted stream, the magic is already consumed
+func newGCMReader(r io.Reader, key []byte) (*gcmReader, error) {
+	salt := make([]byte, gcmSaltSize)
+	if _, err := io.ReadFull(r, salt); err != nil {
+		return nil, ErrTruncated
+	}
+	aead, err := newGCM(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &gcmReader{r: r, aead: aead}, nil
+}
+
+func (g *gcmReader) open() error {
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(g.r, head); err != nil {
+		return ErrTruncated
+	}
+	size := binary.BigEndian.Uint32(head)
+	final := size&gcmFinalFlag != 0
+	size &^= gcmFinalFlag
+	if size > gcmMaxSealSize {
+		return errors.New("Encrypted stream chunk is too large")
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(g.r, sealed); err != nil {
+		return ErrTruncated
+	}
+	plain, err := g.aead.Open(nil, gcmNonce(g.counter), sealed, gcmAdditionalData(final))
+	if err != nil {
+		return errors.New("Encrypted stream authentication failed, wrong key or corrupted backup")
+	}
+	g.counter++
+	g.plain = plain
+	g.final = final
+	return nil
+}
+
+func (g *gcmReader) Read(p []byte) (int, error) {
+	for len(g.plain) == 0 {
+		if g.final {
+			return 0, io.EOF
+		}
+		if err := g.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, g.plain)
+	g.plain = g.plain[n:]
+	return n, nil
+}
@@ -0,0 +1,270 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+// Package stream compresses and encrypts backup streams. Encoded streams are self describing,
+// a reader finds the encryption from the magic of the stream and the compression from the magic
+// of the gzip or zstd frames, plain streams are read as is.
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os/exec"
+)
+
+const (
+	CompressNone  string = "none"
+	CompressGzip  string = "gzip"
+	CompressZstd  string = "zstd"
+	EncryptNone   string = "none"
+	EncryptAESGCM string = "aes-gcm"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Options of a backup stream, zstd is run with the binary of ZstdPath
+type Options struct {
+	Compression string
+	Encryption  string
+	Key         []byte
+	ZstdPath    string
+}
+
+// Validate checks the compression and the encryption of the options
+func (o Options) Validate() error {
+	switch o.Compression {
+	case "", CompressNone, CompressGzip, CompressZstd:
+	default:
+		return errors.New("Unknown backup compression " + o.Compression)
+	}
+	switch o.Encryption {
+	case "", EncryptNone:
+	case EncryptAESGCM:
+		if len(o.Key) == 0 {
+			return errors.New("No backup encryption key")
+		}
+	default:
+		return errors.New("Unknown backup encryption " + o.Encryption)
+	}
+	return nil
+}
+
+// IsPlain is true when the options neither compress nor encrypt
+func (o Options) IsPlain() bool {
+	return (o.Compression == "" || o.Compression == CompressNone) && (o.Encryption == "" || o.Encryption == EncryptNone)
+}
+
+// Extension returns the file name extension of the compression of the options
+func (o Options) Extension() string {
+	switch o.Compression {
+	case CompressGzip:
+		return ".gz"
+	case CompressZstd:
+		return ".zst"
+	}
+	return ""
+}
+
+type writer struct {
+	io.Writer
+	closers []io.Closer
+}
+
+// Close flushes the compression then the encryption, the underlying writer is not closed
+func (w *writer) Close() error {
+	var err error
+	for _, c := range w.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// NewWriter returns a writer compressing then encrypting to w
+func NewWriter(w io.Writer, o Options) (io.WriteCloser, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	out := &writer{Writer: w}
+	if o.Encryption == EncryptAESGCM {
+		g, err := newGCMWriter(w, o.Key)
+		if err != nil {
+			return nil, err
+		}
+		out.Writer = g
+		out.closers = append(out.closers, g)
+	}
+	switch o.Compression {
+	case CompressGzip:
+		gw := gzip.NewWriter(out.Writer)
+		out.Writer = gw
+		out.closers = append([]io.Closer{gw}, out.closers...)
+	case CompressZstd:
+		zw, err := newZstdWriter(o.ZstdPath, out.Writer)
+		if err != nil {
+			return nil, err
+		}
+		out.Writer = zw
+		out.closers = append([]io.Closer{zw}, out.closers...)
+	}
+	return out, nil
+}
+
+type reader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *reader) Close() error {
+	var err error
+	for _, c := range r.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// NewDecrypter returns the content of a stream without its encryption, a compressed stream stays compressed
+func NewDecrypter(r io.Reader, o Options) (*bufio.Reader, error) {
+	br := bufio.NewReader(r)
+	if !IsEncrypted(br) {
+		return br, nil
+	}
+	if len(o.Key) == 0 {
+		return nil, errors.New("Backup is encrypted and no key is available")
+	}
+	br.Discard(len(gcmMagic))
+	g, err := newGCMReader(br, o.Key)
+	if err != nil {
+		return nil, err
+	}
+	return bufio.NewReader(g), nil
+}
+
+// IsEncrypted is true when the stream starts with the encryption magic, the stream is not consumed
+func IsEncrypted(br *bufio.Reader) bool {
+	magic, _ := br.Peek(len(gcmMagic))
+	return string(magic) == gcmMagic
+}
+
+// NewReader returns the plain content of a stream written by NewWriter, a gzip or zstd stream or a plain stream,
+// the key and the zstd binary of the options are used when the stream needs them
+func NewReader(r io.Reader, o Options) (io.ReadCloser, error) {
+	out := &reader{}
+	br, err := NewDecrypter(r, o)
+	if err != nil {
+		return nil, err
+	}
+	out.Reader = br
+	magic, _ := br.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		out.Reader = gr
+		out.closers = append(out.closers, gr)
+	case bytes.Equal(magic, zstdMagic):
+		zr, err := newZstdReader(o.ZstdPath, br)
+		if err != nil {
+			return nil, err
+		}
+		out.Reader = zr
+		out.closers = append(out.closers, zr)
+	}
+	return out, nil
+}
+
+// IsEncoded is true when the stream is compressed or encrypted
+func IsEncoded(r io.Reader) bool {
+	magic := make([]byte, len(gcmMagic))
+	n, _ := io.ReadFull(r, magic)
+	magic = magic[:n]
+	return bytes.Equal(magic, []byte(gcmMagic)) || bytes.HasPrefix(magic, gzipMagic) || bytes.HasPrefix(magic, zstdMagic)
+}
+
+// zstdWriter compresses through the zstd binary
+type zstdWriter struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+}
+
+func newZstdWriter(path string, w io.Writer) (*zstdWriter, error) {
+	z := &zstdWriter{cmd: exec.Command(path, "-q", "-c", "-")}
+	z.cmd.Stdout = w
+	var err error
+	z.stdin, err = z.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := z.cmd.Start(); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+func (z *zstdWriter) Write(p []byte) (int, error) {
+	return z.stdin.Write(p)
+}
+
+func (z *zstdWriter) Close() error {
+	z.stdin.Close()
+	return z.cmd.Wait()
+}
+
+// zstdReader decompresses through the zstd binary
+type zstdReader struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	done   bool
+}
+
+func newZstdReader(path string, r io.Reader) (*zstdReader, error) {
+	z := &zstdReader{cmd: exec.Command(path, "-q", "-d", "-c", "-")}
+	z.cmd.Stdin = r
+	var err error
+	z.stdout, err = z.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := z.cmd.Start(); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+func (z *zstdReader) Read(p []byte) (int, error) {
+	n, err := z.stdout.Read(p)
+	if err == io.EOF && !z.done {
+		z.done = true
+		if werr := z.cmd.Wait(); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func (z *zstdReader) Close() error {
+	if z.done {
+		return nil
+	}
+	z.done = true
+	z.cmd.Process.Kill()
+	z.cmd.Wait()
+	return nil
+}
@@ -0,0 +1,106 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017 Signal 18 SARL
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package stream
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os/exec"
+	"testing"
+)
+
+func roundTrip(t *testing.T, o Options, data []byte) []byte {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("%s/%s: %s", o.Compression, o.Encryption, err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatalf("%s/%s: expected %d bytes, got %d", o.Compression, o.Encryption, len(data), len(out))
+	}
+	return buf.Bytes()
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	data := bytes.Repeat([]byte("INSERT INTO t VALUES (1,'replication');\n"), 5000)
+	compressions := []string{CompressNone, CompressGzip}
+	if _, err := exec.LookPath("zstd"); err == nil {
+		compressions = append(compressions, CompressZstd)
+	}
+	for _, c := range compressions {
+		for _, e := range []string{EncryptNone, EncryptAESGCM} {
+			enc := roundTrip(t, Options{Compression: c, Encryption: e, Key: key, ZstdPath: "zstd"}, data)
+			if e == EncryptAESGCM && bytes.Contains(enc, []byte("replication")) {
+				t.Fatal("Expected encrypted stream to hide the content")
+			}
+		}
+	}
+	// empty stream still has its last chunk
+	roundTrip(t, Options{Compression: CompressNone, Encryption: EncryptAESGCM, Key: key}, nil)
+}
+
+func TestStreamTampering(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	data := bytes.Repeat([]byte{1, 2, 3}, 100000)
+	o := Options{Compression: CompressNone, Encryption: EncryptAESGCM, Key: key}
+	enc := roundTrip(t, o, data)
+
+	read := func(b []byte, o Options) error {
+		r, err := NewReader(bytes.NewReader(b), o)
+		if err != nil {
+			return err
+		}
+		_, err = ioutil.ReadAll(r)
+		return err
+	}
+	if err := read(enc[:len(enc)-100], o); err == nil {
+		t.Fatal("Expected truncated stream error")
+	}
+	tampered := append([]byte{}, enc...)
+	tampered[100] ^= 1
+	if err := read(tampered, o); err == nil {
+		t.Fatal("Expected authentication error")
+	}
+	// the salt keys the stream
+	tampered = append([]byte{}, enc...)
+	tampered[len(gcmMagic)] ^= 1
+	if err := read(tampered, o); err == nil {
+		t.Fatal("Expected salt authentication error")
+	}
+	// the streams of one key are sealed with their own salt and key
+	if other := roundTrip(t, o, data); bytes.Equal(other[:len(gcmMagic)+gcmSaltSize], enc[:len(gcmMagic)+gcmSaltSize]) || bytes.Equal(other, enc) {
+		t.Fatal("Expected streams of the same key to have their own salt")
+	}
+	if err := read(enc, Options{Key: bytes.Repeat([]byte{8}, 32)}); err == nil {
+		t.Fatal("Expected wrong key error")
+	}
+	if err := read(enc, Options{}); err == nil {
+		t.Fatal("Expected missing key error")
+	}
+	if err := read([]byte("plain dump"), Options{}); err != nil {
+		t.Fatal("Expected plain stream to be read as is")
+	}
+}